@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#       Account Groups       #
+	#                            #
+	##############################
+*/
+
+// handleAccountGroupForm creates and edits account groups, they are listed on the accounts page
+func handleAccountGroupForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/groups/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleAccountGroupForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Group"
+	ctx["Btn"] = "Create Group"
+
+	g := EmptyAccountGroup()
+
+	// Get the current group
+	if groupID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(groupID[0])
+		if e != nil {
+			err.Init("handleAccountGroupForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = g.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleAccountGroupForm()", "Error finding account group: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			g = EmptyAccountGroup()
+		} else {
+			ctx["Title"] = "Edit Group"
+			ctx["Btn"] = "Save Group"
+		}
+	}
+
+	ctx["Group"] = g
+
+	if ctx["IncomeSchedules"], err = GetAllIncomeSchedules(db); !err.Empty() {
+		err.AddTraceback("handleAccountGroupForm()", "Error while getting the income schedules.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "account_group_form.html", ctx); e != nil {
+			err.Init("handleAccountGroupForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	before := auditSnapshot(g)
+
+	g.Name = r.FormValue("name")
+	g.IncludeInNetWorth = r.FormValue("include_in_net_worth") == "on"
+
+	if sequence, e := strconv.ParseInt(r.FormValue("sequence"), 0, 64); e == nil {
+		g.Sequence = sequence
+	}
+	// No schedule: the accounts of the group use the default schedule
+	if incomeScheduleID, e := strconv.ParseInt(r.FormValue("income_schedule"), 0, 64); e == nil {
+		g.IncomeScheduleID = incomeScheduleID
+	} else {
+		g.IncomeScheduleID = 0
+	}
+
+	create := g.ID == 0
+	err = writeAccountGroup(&g, webActor(ctx), before)
+
+	if !err.Empty() {
+		err.AddTraceback("handleAccountGroupForm()", "Error while writing the account group to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			g.ID = 0
+		}
+		ctx["Group"] = g
+		ctx["Error"] = "The group could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "account_group_form.html", ctx); e != nil {
+			err.Init("handleAccountGroupForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/accounts/", http.StatusSeeOther)
+}
+
+// writeAccountGroup creates or saves the group, the change is logged in the same database transaction
+func writeAccountGroup(g *AccountGroup, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if g.ID == 0 {
+			if err := g.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, actor, AuditCreate, AuditAccountGroup, g.ID, nil, g)
+		}
+		if err := g.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditAccountGroup, g.ID, before, g)
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// AccountGroup groups accounts on the accounts page and the dashboard, e.g. "Daily", "Savings" or "Debt"
+// Groups are ordered by their Sequence, accounts without a group are listed in an ungrouped group with ID 0
+// Only the groups which are IncludeInNetWorth count in the net worth
+// Balance and BalanceForecast are the sums of the active accounts of the group in the base Currency
+type AccountGroup struct {
+	ID                int64
+	Name              string
+	Sequence          int64
+	IncludeInNetWorth bool
+	// IncomeScheduleID are the paydays of the accounts of the group, 0 for the default schedule
+	IncomeScheduleID int64
+	CreateDate       time.Time
+	LastUpdate       time.Time
+
+	// Computed fields
+	Accounts        []Account
+	Balance         Money
+	BalanceForecast Money
+	Currency        string
+}
+
+// EmptyAccountGroup returns an empty account group
+func EmptyAccountGroup() AccountGroup {
+	g := AccountGroup{
+		ID:                0,
+		Name:              "",
+		Sequence:          10,
+		IncludeInNetWorth: true,
+		IncomeScheduleID:  0,
+		CreateDate:        time.Now().Local(),
+		LastUpdate:        time.Now().Local(),
+	}
+
+	return g
+}
+
+// ungroupedAccountGroup returns the group of the accounts without a group
+func ungroupedAccountGroup() AccountGroup {
+	g := EmptyAccountGroup()
+	g.Name = "Other Accounts"
+
+	return g
+}
+
+// Create 's the account group
+func (g *AccountGroup) Create(cr Cursor) err.Error {
+	if g.ID != 0 {
+		var err err.Error
+		err.Init("AccountGroup.Create()", "This object already has an id")
+		return err
+	} else if g.Name == "" {
+		var err err.Error
+		err.Init("AccountGroup.Create()", "The account group does not have a name")
+		return err
+	}
+
+	g.CreateDate = time.Now().Local()
+	g.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO account_groups (name, sequence, include_in_net_worth, income_schedule_id, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
+
+	e := cr.QueryRow(query, g.Name, g.Sequence, g.IncludeInNetWorth, g.incomeScheduleID(), g.CreateDate, g.LastUpdate).Scan(&g.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("AccountGroup.Create()", e.Error())
+		return err
+	}
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the account group
+func (g *AccountGroup) Save(cr Cursor) err.Error {
+	if g.ID <= 0 {
+		var err err.Error
+		err.Init("AccountGroup.Save()", "This account group has no ID, maybe create it first?")
+		return err
+	} else if g.Name == "" {
+		var err err.Error
+		err.Init("AccountGroup.Save()", "The account group does not have a name")
+		return err
+	}
+
+	g.LastUpdate = time.Now().Local()
+
+	query := "UPDATE account_groups SET name=$2, sequence=$3, include_in_net_worth=$4, income_schedule_id=$5, "
+	query += "last_update=$6 WHERE id=$1"
+
+	if _, e := cr.Exec(query, g.ID, g.Name, g.Sequence, g.IncludeInNetWorth, g.incomeScheduleID(), g.LastUpdate); e != nil {
+		var err err.Error
+		err.Init("AccountGroup.Save()", e.Error())
+		return err
+	}
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// incomeScheduleID returns the income schedule for the database, nil for groups which use the default schedule
+func (g *AccountGroup) incomeScheduleID() interface{} {
+	if g.IncomeScheduleID <= 0 {
+		return nil
+	}
+	return g.IncomeScheduleID
+}
+
+// Delete 's the account group, it's accounts are ungrouped
+func (g *AccountGroup) Delete(cr Cursor) err.Error {
+	if g.ID <= 0 {
+		var err err.Error
+		err.Init("AccountGroup.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM account_groups WHERE id=$1", g.ID); e != nil {
+		var err err.Error
+		err.Init("AccountGroup.Delete()", e.Error())
+		return err
+	}
+
+	g.ID = 0
+
+	return err.Error{}
+}
+
+// computeFields computes the accounts of the group and their sums in the base currency
+// The accounts of the group with ID 0 are the ones without a group
+func (g *AccountGroup) computeFields(cr Cursor) {
+	g.Accounts = nil
+	g.Balance = 0
+	g.BalanceForecast = 0
+
+	var err err.Error
+	if g.Currency, err = GetBaseCurrency(cr); !err.Empty() {
+		err.AddTraceback("AccountGroup.computeFields()", "Error while getting the base currency.")
+		log.Println("[WARN]", err)
+	}
+
+	var ids []int64
+
+	query := "SELECT id FROM accounts WHERE COALESCE(group_id, 0)=$1 ORDER BY active DESC, name, id"
+
+	rows, e := cr.Query(query, g.ID)
+	if e != nil {
+		err.Init("AccountGroup.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+		return
+	}
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] AccountGroup.computeFields(): Skipping account")
+			log.Printf("[WARN] AccountGroup.computeFields(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		a, err := FindAccountByID(cr, id)
+		if !err.Empty() {
+			err.AddTraceback("AccountGroup.computeFields()", "Error while finding account: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		g.Accounts = append(g.Accounts, a)
+	}
+
+	// Compute: Balance, BalanceForecast with today's exchange rate, closed accounts are left out
+	query = "SELECT "
+	query += "COALESCE(round(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2), 0), "
+	query += "COALESCE(round(SUM(b.balance_forecast * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2), 0) "
+	query += "FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id "
+	query += "WHERE a.active=true AND COALESCE(a.group_id, 0)=$1"
+
+	if e = cr.QueryRow(query, g.ID).Scan(&g.Balance, &g.BalanceForecast); e != nil {
+		err.Init("AccountGroup.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+}
+
+// FindByID finds an account group with it's id
+func (g *AccountGroup) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, sequence, include_in_net_worth, income_schedule_id, create_date, last_update "
+	query += "FROM account_groups WHERE id=$1"
+
+	var incomeScheduleID sql.NullInt64
+
+	e := cr.QueryRow(query, id).Scan(
+		&g.ID,
+		&g.Name,
+		&g.Sequence,
+		&g.IncludeInNetWorth,
+		&incomeScheduleID,
+		&g.CreateDate,
+		&g.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("AccountGroup.FindByID()", e.Error())
+		return err
+	}
+
+	g.IncomeScheduleID = incomeScheduleID.Int64
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindAccountGroupByID is similar to FindByID but returns the account group
+func FindAccountGroupByID(cr Cursor, id int64) (AccountGroup, err.Error) {
+	g := EmptyAccountGroup()
+
+	if e := g.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindAccountGroupByID()", "Error while finding account group by ID: "+fmt.Sprintf("%d", id))
+		return g, e
+	}
+
+	return g, err.Error{}
+}
+
+// GetAllAccountGroups returns all account groups with their accounts ordered by their sequence
+// If there are accounts without a group, they are returned in a last group with ID 0
+func GetAllAccountGroups(cr Cursor) ([]AccountGroup, err.Error) {
+	var ids []int64
+	var result []AccountGroup
+
+	rows, e := cr.Query("SELECT id FROM account_groups ORDER BY sequence, name, id")
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllAccountGroups()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllAccountGroups(): Skipping record")
+			log.Printf("[WARN] GetAllAccountGroups(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		g, err := FindAccountGroupByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllAccountGroups(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, g)
+	}
+
+	ungrouped := ungroupedAccountGroup()
+	ungrouped.computeFields(cr)
+	if len(ungrouped.Accounts) > 0 {
+		result = append(result, ungrouped)
+	}
+
+	return result, err.Error{}
+}
+
+// NetWorth returns the sum of the balances of the groups which are included in the net worth
+func NetWorth(groups []AccountGroup) Money {
+	var total Money
+
+	for _, g := range groups {
+		if g.IncludeInNetWorth {
+			total += g.Balance
+		}
+	}
+
+	return total
+}
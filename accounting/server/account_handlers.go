@@ -1,10 +1,13 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nitohu/err"
 )
@@ -36,8 +39,15 @@ func handleAccountOverview(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	ctx["Title"] = "Accounts"
-	if ctx["Accounts"], e = GetAllAccounts(db); !e.Empty() {
-		e.AddTraceback("handleAccountOverview", "Error while getting the accounts.")
+	groups, e := GetAllAccountGroups(db)
+	if !e.Empty() {
+		e.AddTraceback("handleAccountOverview", "Error while getting the account groups.")
+		fmt.Println("[ERROR]", e)
+	}
+	ctx["Groups"] = groups
+	ctx["NetWorth"] = NetWorth(groups)
+	if ctx["Goals"], e = GetAllGoals(db, false); !e.Empty() {
+		e.AddTraceback("handleAccountOverview", "Error while getting the goals.")
 		fmt.Println("[ERROR]", e)
 	}
 
@@ -94,11 +104,45 @@ func handleAccountForm(w http.ResponseWriter, r *http.Request) {
 			ctx["Title"] = "Edit Account"
 			ctx["Header"] = "Edit " + account.Name
 			ctx["Btn"] = "Save Account"
+
+			if attachments, e := GetAttachments(db, AuditAccount, account.ID); !e.Empty() {
+				e.AddTraceback("handleAccountForm()", "Error while getting the attachments of account: "+fmt.Sprintf("%d", account.ID))
+				log.Println("[WARN]", e)
+			} else {
+				ctx["Attachments"] = attachments
+			}
+
+			if account.BankType == AccountInvestment {
+				if ctx["Holdings"], e = GetHoldings(db, account.ID); !e.Empty() {
+					e.AddTraceback("handleAccountForm()", "Error while getting the holdings.")
+					log.Println("[WARN]", e)
+				}
+				if ctx["Trades"], e = GetTradesByAccount(db, account.ID); !e.Empty() {
+					e.AddTraceback("handleAccountForm()", "Error while getting the trades.")
+					log.Println("[WARN]", e)
+				}
+			}
+
+			// Accounts the installments of a loan can be paid from and the balance is transferred to when closing
+			if ctx["Accounts"], e = GetAllAccounts(db); !e.Empty() {
+				e.AddTraceback("handleAccountForm()", "Error while getting the accounts.")
+				log.Println("[WARN]", e)
+			}
+			ctx["CloseDate"] = time.Now().Local().Format(dateLayout)
 		}
 	}
 
 	ctx["Account"] = account
 
+	if ctx["Groups"], e = GetAllAccountGroups(db); !e.Empty() {
+		e.AddTraceback("handleAccountForm()", "Error while getting the account groups.")
+		log.Println("[WARN]", e)
+	}
+	if ctx["IncomeSchedules"], e = GetAllIncomeSchedules(db); !e.Empty() {
+		e.AddTraceback("handleAccountForm()", "Error while getting the income schedules.")
+		log.Println("[WARN]", e)
+	}
+
 	// Method is GET
 	// Return the form
 	if r.Method != http.MethodPost {
@@ -112,42 +156,201 @@ func handleAccountForm(w http.ResponseWriter, r *http.Request) {
 
 	// Method is POST
 	// Process the form
+	before := auditSnapshot(account)
 	account.Name = r.FormValue("name")
-	account.Balance, _ = strconv.ParseFloat(r.FormValue("balance"), 64)
-	account.BalanceForecast = account.Balance
+	// The balance can only be set when the account is created,
+	// afterwards it's computed from the journal
+	if account.ID <= 0 && r.FormValue("balance") != "" {
+		var e error
+		if account.Balance, e = ParseMoney(r.FormValue("balance")); e != nil {
+			var err err.Error
+			err.Init("handleAccountForm()", e.Error())
+			log.Println("[WARN]", err)
+
+			ctx["Error"] = "Invalid balance: " + r.FormValue("balance")
+			tmpl.ExecuteTemplate(w, "account_form.html", ctx)
+			return
+		}
+		account.BalanceForecast = account.Balance
+	}
 	account.Iban = r.FormValue("iban")
 	account.BankCode = r.FormValue("bankCode")
 	account.AccountNr = r.FormValue("accountNumber")
 	account.BankType = r.FormValue("accountType")
+	// No group or an invalid one: the account is listed under the other accounts
+	groupID, parseErr := strconv.ParseInt(r.FormValue("group"), 0, 64)
+	if parseErr != nil {
+		groupID = 0
+	}
+	account.GroupID = groupID
+	// No schedule: the paydays of the group or the default schedule are used
+	incomeScheduleID, parseErr := strconv.ParseInt(r.FormValue("incomeSchedule"), 0, 64)
+	if parseErr != nil {
+		incomeScheduleID = 0
+	}
+	account.IncomeScheduleID = incomeScheduleID
+	// Empty currency: the account is created in the base currency
+	account.Currency = strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))
 
-	if account.BankType == "bank" {
-		account.BankName = r.FormValue("bankName")
-	} else {
+	if account.BankType == AccountOnline {
 		account.BankName = r.FormValue("providerName")
+	} else {
+		account.BankName = r.FormValue("bankName")
 	}
 
-	if account.BankType != "bank" && account.BankType != "online" {
-		var err err.Error
-		err.Init("handleAccountForm", "Unkown bank type: "+account.BankType)
-		log.Println("[WARN]", err)
-
-		ctx["Error"] = "Unkown bank type: " + account.BankType
-		tmpl.ExecuteTemplate(w, "account_form.html", ctx)
-		return
+	// The terms are only used by loans, the model validates them
+	if account.BankType == AccountLoan {
+		var e error
+		if account.Principal, e = ParseMoney(r.FormValue("principal")); e != nil {
+			account.Principal = 0
+		}
+		if account.InterestRate, e = strconv.ParseFloat(r.FormValue("interestRate"), 64); e != nil {
+			account.InterestRate = 0
+		}
+		if account.TermMonths, e = strconv.ParseInt(r.FormValue("termMonths"), 0, 64); e != nil {
+			account.TermMonths = 0
+		}
+		if account.FirstPaymentDate, e = time.ParseInLocation(dateLayout, r.FormValue("firstPaymentDate"), time.Local); e != nil {
+			ctx["Error"] = "Invalid date of the first payment: " + r.FormValue("firstPaymentDate")
+			tmpl.ExecuteTemplate(w, "account_form.html", ctx)
+			return
+		}
 	}
 
 	// Save or create the account
-	if account.ID <= 0 {
-		if err := account.Create(db); !err.Empty() {
-			err.AddTraceback("handleAccountForm()", "Error while creating the account.")
-			log.Println("[ERROR]", err)
+	create := account.ID <= 0
+	err := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if create {
+			if err := account.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, webActor(ctx), AuditCreate, AuditAccount, account.ID, nil, account)
 		}
-	} else {
-		if err := account.Save(db); !err.Empty() {
-			err.AddTraceback("handleAccountForm", "Error while saving the account.")
-			log.Println("[ERROR]", err)
+		if err := account.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, webActor(ctx), AuditUpdate, AuditAccount, account.ID, before, account)
+	})
+	if !err.Empty() {
+		err.AddTraceback("handleAccountForm()", "Error while writing the account to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			account.ID = 0
 		}
+		ctx["Account"] = account
+		ctx["Error"] = "The account could not be saved: " + err.Error()
+		tmpl.ExecuteTemplate(w, "account_form.html", ctx)
+		return
 	}
 
 	http.Redirect(w, r, "/accounts", http.StatusSeeOther)
 }
+
+// handleLoanPayment books the next installment of the loan ?id= from the account of the form
+func handleLoanPayment(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/payment/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleLoanPayment()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "Method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, parseErr := strconv.ParseInt(r.URL.Query().Get("id"), 0, 64)
+	if parseErr != nil {
+		http.Error(w, "Please provide a valid ID", http.StatusBadRequest)
+		return
+	}
+
+	loan, e := FindAccountByID(db, id)
+	if !e.Empty() {
+		e.AddTraceback("handleLoanPayment()", "Error while finding account: "+fmt.Sprintf("%d", id))
+		log.Println("[WARN]", e)
+		handleNotFound(w, r)
+		return
+	}
+
+	fromAccount, _ := strconv.ParseInt(r.FormValue("fromAccount"), 0, 64)
+	date, parseErr := time.ParseInLocation(dateLayout, r.FormValue("date"), time.Local)
+	if parseErr != nil {
+		http.Error(w, "Invalid date of the payment: "+r.FormValue("date"), http.StatusBadRequest)
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		_, bookErr := loan.BookPayment(tx, webActor(ctx), fromAccount, date)
+		return bookErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("handleLoanPayment()", "Error while booking the payment of loan: "+fmt.Sprintf("%d", id))
+		log.Println("[ERROR]", e)
+		http.Error(w, "The payment could not be booked: "+e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/accounts/form/?id=%d", loan.ID), http.StatusSeeOther)
+}
+
+// handleAccountClose closes the account ?id=, it's balance is transferred to the account of the form
+func handleAccountClose(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/close/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleAccountClose()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "Method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, parseErr := strconv.ParseInt(r.URL.Query().Get("id"), 0, 64)
+	if parseErr != nil {
+		http.Error(w, "Please provide a valid ID", http.StatusBadRequest)
+		return
+	}
+
+	account, e := FindAccountByID(db, id)
+	if !e.Empty() {
+		e.AddTraceback("handleAccountClose()", "Error while finding account: "+fmt.Sprintf("%d", id))
+		log.Println("[WARN]", e)
+		handleNotFound(w, r)
+		return
+	}
+
+	toAccount, _ := strconv.ParseInt(r.FormValue("toAccount"), 0, 64)
+	date, parseErr := time.ParseInLocation(dateLayout, r.FormValue("date"), time.Local)
+	if parseErr != nil {
+		http.Error(w, "Invalid date of the closing: "+r.FormValue("date"), http.StatusBadRequest)
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		_, closeErr := account.Close(tx, webActor(ctx), toAccount, date)
+		return closeErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("handleAccountClose()", "Error while closing account: "+fmt.Sprintf("%d", id))
+		log.Println("[ERROR]", e)
+		http.Error(w, "The account could not be closed: "+e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/accounts/form/?id=%d", account.ID), http.StatusSeeOther)
+}
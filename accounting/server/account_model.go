@@ -9,23 +9,79 @@ import (
 	"github.com/nitohu/err"
 )
 
+// Types of accounts, stored in BankType
+const (
+	// AccountBank is an account at a bank with IBAN, bank code and account number
+	AccountBank = "bank"
+	// AccountOnline is an account at an online provider like Paypal
+	AccountOnline = "online"
+	// AccountLoan is a liability which is paid off in monthly installments, e.g. a mortgage
+	AccountLoan = "loan"
+	// AccountCredit is a liability without fixed installments, e.g. a credit card
+	AccountCredit = "credit"
+	// AccountInvestment is a brokerage account which holds cash and securities
+	AccountInvestment = "investment"
+)
+
+// GetAllAccountTypes returns all types an account can have
+func GetAllAccountTypes() []string {
+	return []string{
+		AccountBank,
+		AccountOnline,
+		AccountLoan,
+		AccountCredit,
+		AccountInvestment,
+	}
+}
+
 // Account object
+// Balance and BalanceForecast are computed from the journal lines of the account,
+// the Balance is only written once when the account is created, as transaction of the type opening_balance
+// Accounts with transactions can't be deleted, they are closed instead, see Close()
+// All amounts of the account are in it's Currency, an ISO 4217 code like EUR
+// BankType is one of GetAllAccountTypes, loan and credit accounts are liabilities:
+// their balance is negative and RemainingDebt is the amount which is owed
+// Principal, InterestRate (yearly, in percent), TermMonths and FirstPaymentDate are the terms of a loan,
+// see computeLoan() for the amortisation schedule
+// The balance of investment accounts includes the MarketValue of their holdings, see trade_model.go
 type Account struct {
 	ID              int64
 	Name            string
 	Active          bool
-	Balance         float64
-	BalanceForecast float64
+	Balance         Money
+	BalanceForecast Money
 	Iban            string
 	BankCode        string
 	AccountNr       string
 	BankName        string
 	BankType        string
-	CreateDate      time.Time
-	LastUpdate      time.Time
+	Currency        string
+	// GroupID is the account group, 0 if the account isn't in a group
+	GroupID int64
+	// IncomeScheduleID are the paydays of the account, 0 for the ones of the group or the default schedule
+	IncomeScheduleID int64
+	CreateDate       time.Time
+	LastUpdate       time.Time
+
+	// Loan terms
+	Principal        Money
+	InterestRate     float64
+	TermMonths       int64
+	FirstPaymentDate time.Time
 
 	// Computed Fields
 	TransactionCount int64
+	MarketValue      Money
+	NextPaydayStr    string
+	Liability        bool
+	RemainingDebt    Money
+	// Only computed for loan accounts
+	MonthlyPayment      Money
+	Schedule            []LoanPayment
+	NextPayment         LoanPayment
+	PayoffDate          time.Time
+	PayoffDateStr       string
+	FirstPaymentDateStr string
 }
 
 // EmptyAccount ...
@@ -34,34 +90,120 @@ func EmptyAccount() Account {
 		ID:               0,
 		Name:             "",
 		Active:           true,
-		Balance:          0.0,
-		BalanceForecast:  0.0,
+		Balance:          0,
+		BalanceForecast:  0,
 		Iban:             "",
 		BankCode:         "",
 		AccountNr:        "",
 		BankName:         "",
 		BankType:         "",
+		Currency:         "",
+		GroupID:          0,
+		IncomeScheduleID: 0,
 		CreateDate:       time.Now().Local(),
 		LastUpdate:       time.Now().Local(),
+		Principal:        0,
+		InterestRate:     0,
+		TermMonths:       0,
+		FirstPaymentDate: time.Now().Local().AddDate(0, 1, 0),
 		TransactionCount: 0,
 	}
 
 	return a
 }
 
+// groupID returns the account group for the database, nil for accounts without a group
+func (a *Account) groupID() interface{} {
+	if a.GroupID <= 0 {
+		return nil
+	}
+	return a.GroupID
+}
+
+// incomeScheduleID returns the income schedule for the database, nil for accounts without an own schedule
+func (a *Account) incomeScheduleID() interface{} {
+	if a.IncomeScheduleID <= 0 {
+		return nil
+	}
+	return a.IncomeScheduleID
+}
+
+// IsLiability returns true for accounts which hold debt instead of money
+func (a *Account) IsLiability() bool {
+	return a.BankType == AccountLoan || a.BankType == AccountCredit
+}
+
+// validate checks the type and the loan terms of the account
+func (a *Account) validate(funcName string) err.Error {
+	var err err.Error
+
+	if !ValidCurrency(a.Currency) {
+		err.Init(funcName, "The currency must be a three letter code like EUR: "+a.Currency)
+		return err
+	}
+
+	valid := false
+	for _, t := range GetAllAccountTypes() {
+		valid = valid || t == a.BankType
+	}
+	if !valid {
+		err.Init(funcName, "Unknown account type: "+a.BankType)
+		return err
+	}
+
+	if a.BankType != AccountLoan {
+		return err
+	}
+	if a.Principal <= 0 {
+		err.Init(funcName, "The principal of the loan must be bigger than 0")
+	} else if a.TermMonths <= 0 {
+		err.Init(funcName, "The term of the loan must be at least one month")
+	} else if a.InterestRate < 0 {
+		err.Init(funcName, "The interest rate can't be negative")
+	} else if payment := annuityPayment(a.Principal, a.InterestRate, a.TermMonths); payment <= monthlyInterest(a.Principal, a.InterestRate) {
+		err.Init(funcName, "The monthly payment of "+payment.String()+" doesn't cover the interest, please choose a shorter term")
+	}
+
+	return err
+}
+
 // Create 's an account with the current values of the object
-func (a *Account) Create(cr *sql.DB) err.Error {
+func (a *Account) Create(cr *sql.Tx) err.Error {
 	if a.ID != 0 {
 		var err err.Error
 		err.Init("Account.Create()", "This object already has an id")
 		return err
 	}
 
+	// Accounts without a currency are held in the base currency
+	if a.Currency == "" {
+		var err err.Error
+		if a.Currency, err = GetBaseCurrency(cr); !err.Empty() {
+			err.AddTraceback("Account.Create()", "Error while getting the base currency.")
+			return err
+		}
+	}
+	// Accounts without a type are online accounts, like the default of the form
+	if a.BankType == "" {
+		a.BankType = AccountOnline
+	}
+	if err := a.validate("Account.Create()"); !err.Empty() {
+		return err
+	}
+
+	// The opening balance of a liability is the debt, a loan starts with it's principal
+	if a.IsLiability() && a.Balance > 0 {
+		a.Balance = a.Balance * -1
+	} else if a.BankType == AccountLoan && a.Balance == 0 {
+		a.Balance = a.Principal * -1
+	}
+
 	var id int64
 
-	query := "INSERT INTO accounts ( name, active, balance, balance_forecast, iban,"
-	query += " bank_code, account_nr, bank_name, bank_type, create_date, last_update"
-	query += ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id;"
+	query := "INSERT INTO accounts ( name, active, iban,"
+	query += " bank_code, account_nr, bank_name, bank_type, currency, create_date, last_update,"
+	query += " principal, interest_rate, term_months, first_payment_date, group_id, income_schedule_id"
+	query += ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id;"
 
 	a.CreateDate = time.Now().Local()
 	a.LastUpdate = time.Now().Local()
@@ -69,15 +211,20 @@ func (a *Account) Create(cr *sql.DB) err.Error {
 	e := cr.QueryRow(query,
 		a.Name,
 		a.Active,
-		a.Balance,
-		a.BalanceForecast,
 		a.Iban,
 		a.BankCode,
 		a.AccountNr,
 		a.BankName,
 		a.BankType,
+		a.Currency,
 		a.CreateDate,
 		a.LastUpdate,
+		a.Principal,
+		a.InterestRate,
+		a.TermMonths,
+		a.FirstPaymentDate,
+		a.groupID(),
+		a.incomeScheduleID(),
 	).Scan(&id)
 
 	if e != nil {
@@ -88,32 +235,64 @@ func (a *Account) Create(cr *sql.DB) err.Error {
 
 	a.ID = id
 
+	// The initial balance is booked as opening balance transaction
+	if err := a.createOpeningBalance(cr); !err.Empty() {
+		err.AddTraceback("Account.Create()", "Error while creating the opening balance.")
+		return err
+	}
+
+	a.computeFields(cr)
+
 	return err.Error{}
 }
 
 // Save 's the current values of the object to the database
-func (a *Account) Save(cr *sql.DB) err.Error {
+func (a *Account) Save(cr Cursor) err.Error {
 	if a.ID == 0 {
 		var err err.Error
 		err.Init("Account.Save()", "This account as no ID, maybe create it first?")
 		return err
+	} else if err := a.validate("Account.Save()"); !err.Empty() {
+		return err
+	}
+
+	// The currency can't be changed once amounts in another currency were posted on the account
+	var count int64
+
+	query := "SELECT COUNT(*) FROM journal_lines WHERE account_id=$1 AND currency<>$2"
+
+	if e := cr.QueryRow(query, a.ID, a.Currency).Scan(&count); e != nil {
+		var err err.Error
+		err.Init("Account.Save()", e.Error())
+		return err
+	} else if count > 0 {
+		var err err.Error
+		err.Init("Account.Save()", "The currency of account "+a.Name+" can't be changed, it already has journal lines in another currency")
+		return err
 	}
 
-	query := "UPDATE accounts SET name=$2, active=$3, balance=$4, balance_forecast=$5, iban=$6,"
-	query += " bank_code=$7, account_nr=$8, bank_name=$9, bank_type=$10, last_update=$11 WHERE id=$1"
+	query = "UPDATE accounts SET name=$2, active=$3, iban=$4,"
+	query += " bank_code=$5, account_nr=$6, bank_name=$7, bank_type=$8, currency=$9, last_update=$10,"
+	query += " principal=$11, interest_rate=$12, term_months=$13, first_payment_date=$14, group_id=$15,"
+	query += " income_schedule_id=$16 WHERE id=$1"
 
 	res, e := cr.Exec(query,
 		a.ID,
 		a.Name,
 		a.Active,
-		a.Balance,
-		a.BalanceForecast,
 		a.Iban,
 		a.BankCode,
 		a.AccountNr,
 		a.BankName,
 		a.BankType,
+		a.Currency,
 		time.Now().Local(),
+		a.Principal,
+		a.InterestRate,
+		a.TermMonths,
+		a.FirstPaymentDate,
+		a.groupID(),
+		a.incomeScheduleID(),
 	)
 	if e != nil {
 		var err err.Error
@@ -131,15 +310,103 @@ func (a *Account) Save(cr *sql.DB) err.Error {
 	return err.Error{}
 }
 
-// Delete 's the account
-func (a *Account) Delete(cr *sql.DB) err.Error {
+// createOpeningBalance creates the opening balance transaction of a new account
+// A positive balance comes into the account, a negative one (e.g. the debt of a loan) leaves it
+func (a *Account) createOpeningBalance(cr *sql.Tx) err.Error {
+	if a.Balance == 0 {
+		return err.Error{}
+	}
+
+	t := EmptyTransaction()
+	t.Name = "Opening balance " + a.Name
+	t.Active = true
+	t.TransactionDate = a.CreateDate
+	t.TransactionType = TransactionOpeningBalance
+	if a.Balance > 0 {
+		t.Amount = a.Balance
+		t.ToAccount = a.ID
+	} else {
+		t.Amount = a.Balance * -1
+		t.FromAccount = a.ID
+	}
+
+	if err := t.Create(cr); !err.Empty() {
+		err.AddTraceback("Account.createOpeningBalance()", "Error while creating the opening balance of account: "+fmt.Sprintf("%d", a.ID))
+		return err
+	}
+
+	return err.Error{}
+}
+
+// CheckDeletable returns an error if the account has a history which would be lost by deleting it
+// Only accounts without transactions (besides their opening balance), recurring transactions and trades can be deleted
+func (a *Account) CheckDeletable(cr Cursor) err.Error {
+	var transactions, recurring, trades int64
+
+	query := "SELECT "
+	query += "(SELECT COUNT(*) FROM transactions WHERE (account_id=$1 OR to_account=$1) AND transaction_type<>$2), "
+	query += "(SELECT COUNT(*) FROM recurring_transactions WHERE account_id=$1 OR to_account=$1), "
+	query += "(SELECT COUNT(*) FROM trades WHERE account_id=$1)"
+
+	if e := cr.QueryRow(query, a.ID, TransactionOpeningBalance).Scan(&transactions, &recurring, &trades); e != nil {
+		var err err.Error
+		err.Init("Account.CheckDeletable()", e.Error())
+		return err
+	}
+
+	var err err.Error
+	if transactions > 0 {
+		err.Init("Account.CheckDeletable()", fmt.Sprintf("%s has %d transactions, close the account instead", a.Name, transactions))
+	} else if recurring > 0 {
+		err.Init("Account.CheckDeletable()", fmt.Sprintf("%s has %d recurring transactions, delete them or close the account instead", a.Name, recurring))
+	} else if trades > 0 {
+		err.Init("Account.CheckDeletable()", fmt.Sprintf("%s has %d trades, close the account instead", a.Name, trades))
+	}
+
+	return err
+}
+
+// Delete 's the account with it's opening balance, see CheckDeletable() for the accounts which can be deleted
+func (a *Account) Delete(cr *sql.Tx) err.Error {
 	if a.ID == 0 {
 		var err err.Error
 		err.Init("Account.Delete()", "The account you want to delete does not have an id")
 		return err
 	}
 
-	query := "DELETE FROM accounts WHERE id=$1"
+	if err := a.CheckDeletable(cr); !err.Empty() {
+		return err
+	}
+
+	if err := checkNoAttachments(cr, AuditAccount, a.ID, "Account.Delete()"); !err.Empty() {
+		return err
+	}
+
+	// The opening balance is dated on the creation of the account
+	if err := checkPeriodOpen(cr, a.CreateDate, "Account.Delete()"); !err.Empty() {
+		return err
+	}
+
+	// Remove the opening balance, the journal entry is deleted with the transaction
+	query := "DELETE FROM transactions WHERE (account_id=$1 OR to_account=$1) AND transaction_type=$2"
+
+	if _, e := cr.Exec(query, a.ID, TransactionOpeningBalance); e != nil {
+		var err err.Error
+		err.Init("Account.Delete()", e.Error())
+		return err
+	}
+
+	// Opening balances of accounts created before they were transactions are journal entries only
+	query = "DELETE FROM journal_entries WHERE transaction_id IS NULL AND id IN "
+	query += "(SELECT entry_id FROM journal_lines WHERE account_id=$1)"
+
+	if _, e := cr.Exec(query, a.ID); e != nil {
+		var err err.Error
+		err.Init("Account.Delete()", e.Error())
+		return err
+	}
+
+	query = "DELETE FROM accounts WHERE id=$1"
 
 	_, e := cr.Exec(query, a.ID)
 
@@ -152,10 +419,130 @@ func (a *Account) Delete(cr *sql.DB) err.Error {
 	return err.Error{}
 }
 
+// Close transfers the remaining balance of the account to the account toAccount on the date and deactivates it
+// The transactions of the account are kept, it's recurring transactions are deactivated
+// The balance has to be final: future transactions and securities have to be booked or sold first
+// and the date can't be before the last transaction of the account
+// toAccount is only needed if there is a balance left, the transfer is returned
+func (a *Account) Close(cr *sql.Tx, actor string, toAccount int64, date time.Time) (Transaction, err.Error) {
+	t := EmptyTransaction()
+
+	if a.ID == 0 {
+		var err err.Error
+		err.Init("Account.Close()", "The account you want to close does not have an id")
+		return t, err
+	} else if !a.Active {
+		var err err.Error
+		err.Init("Account.Close()", "The account "+a.Name+" is already closed")
+		return t, err
+	} else if date.After(time.Now()) {
+		var err err.Error
+		err.Init("Account.Close()", "The account can't be closed in the future")
+		return t, err
+	} else if a.MarketValue != 0 {
+		var err err.Error
+		err.Init("Account.Close()", "Sell the securities of "+a.Name+" before closing it")
+		return t, err
+	} else if a.BalanceForecast != a.Balance {
+		var err err.Error
+		err.Init("Account.Close()", "The account "+a.Name+" has future transactions, delete them or wait until they are booked")
+		return t, err
+	}
+
+	// The current balance is transferred, so it has to be the balance on the date as well
+	var lastDate sql.NullTime
+
+	query := "SELECT MAX(e.entry_date) FROM journal_entries AS e JOIN journal_lines AS l ON l.entry_id=e.id WHERE l.account_id=$1"
+
+	if e := cr.QueryRow(query, a.ID).Scan(&lastDate); e != nil {
+		var err err.Error
+		err.Init("Account.Close()", e.Error())
+		return t, err
+	} else if last := lastDate.Time; lastDate.Valid && date.Before(time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.Local)) {
+		var err err.Error
+		err.Init("Account.Close()", "The account "+a.Name+" has transactions until "+last.Format(dateLayout)+", it can't be closed before")
+		return t, err
+	}
+
+	before := auditSnapshot(a)
+
+	if a.Balance != 0 {
+		if toAccount <= 0 || toAccount == a.ID {
+			var err err.Error
+			err.Init("Account.Close()", "Please choose the account the balance of "+a.Balance.String()+" "+a.Currency+" is transferred to")
+			return t, err
+		}
+
+		target, targetErr := FindAccountByID(cr, toAccount)
+		if !targetErr.Empty() {
+			targetErr.AddTraceback("Account.Close()", "Error while finding the account: "+fmt.Sprintf("%d", toAccount))
+			return t, targetErr
+		} else if !target.Active {
+			targetErr.Init("Account.Close()", "The balance can't be transferred to the closed account "+target.Name)
+			return t, targetErr
+		}
+
+		t.Name = "Closing balance " + a.Name
+		t.Active = true
+		t.TransactionDate = date
+		t.TransactionType = TransactionTransfer
+
+		if a.Balance > 0 {
+			t.Amount = a.Balance
+			t.FromAccount = a.ID
+			t.ToAccount = target.ID
+		} else {
+			// The debt is paid from the other account, the amount is sent in it's currency
+			t.FromAccount = target.ID
+			t.ToAccount = a.ID
+			t.ToAmount = a.Balance * -1
+			t.Amount = t.ToAmount
+
+			if target.Currency != a.Currency {
+				rate, rateErr := FindExchangeRate(cr, a.Currency, target.Currency, date)
+				if !rateErr.Empty() {
+					rateErr.AddTraceback("Account.Close()", "No exchange rate found for the transfer.")
+					return t, rateErr
+				}
+				t.Amount = t.ToAmount.Convert(rate)
+			}
+		}
+
+		if err := t.Create(cr); !err.Empty() {
+			err.AddTraceback("Account.Close()", "Error while transferring the balance of account: "+fmt.Sprintf("%d", a.ID))
+			return t, err
+		}
+		if err := LogAudit(cr, actor, AuditCreate, AuditTransaction, t.ID, nil, t); !err.Empty() {
+			err.AddTraceback("Account.Close()", "Error while logging the transfer of the balance.")
+			return t, err
+		}
+	}
+
+	query = "UPDATE recurring_transactions SET active=false, last_update=$2 WHERE (account_id=$1 OR to_account=$1) AND active=true"
+
+	if _, e := cr.Exec(query, a.ID, time.Now().Local()); e != nil {
+		var err err.Error
+		err.Init("Account.Close()", e.Error())
+		return t, err
+	}
+
+	a.Active = false
+	if err := a.Save(cr); !err.Empty() {
+		err.AddTraceback("Account.Close()", "Error while deactivating account: "+fmt.Sprintf("%d", a.ID))
+		return t, err
+	}
+	if err := LogAudit(cr, actor, AuditUpdate, AuditAccount, a.ID, before, a); !err.Empty() {
+		err.AddTraceback("Account.Close()", "Error while logging the closing of the account.")
+		return t, err
+	}
+
+	return t, err.Error{}
+}
+
 // ComputeFields computes the fields for this model
 // Gets automatically called in Account.Save() and Account.FindByID()
-func (a *Account) computeFields(cr *sql.DB) {
-	query := "SELECT COUNT(*) FROM transactions WHERE account_id=$1;"
+func (a *Account) computeFields(cr Cursor) {
+	query := "SELECT COUNT(*) FROM transactions WHERE account_id=$1 OR to_account=$1;"
 
 	e := cr.QueryRow(query, a.ID).Scan(
 		&a.TransactionCount,
@@ -165,55 +552,66 @@ func (a *Account) computeFields(cr *sql.DB) {
 		err.Init("Account.ComputeFields()", "Error getting the number of transactions for account "+fmt.Sprintf("%d", a.ID))
 		log.Println("[WARN]", err)
 	}
-}
-
-// Book books a transaction in the account
-// Also saves the new balance to the database
-func (a *Account) Book(cr *sql.DB, t *Transaction, invert bool) err.Error {
-	amount := t.Amount
-	if invert == true {
-		amount = amount * -1
-	}
-
-	a.BalanceForecast += amount
-	a.Balance += amount
 
-	// currentTime := time.Now().Local()
+	// Compute: Balance, BalanceForecast, MarketValue
+	query = "SELECT balance, balance_forecast, market_value FROM account_balances WHERE account_id=$1;"
 
-	// TODO: Unnecessary for now, will be more important for later
-	// features (forecasting and later booking)
-	// if currentTime.After(t.TransactionDate) {
-	// 	a.Balance += amount
-	// }
+	e = cr.QueryRow(query, a.ID).Scan(
+		&a.Balance,
+		&a.BalanceForecast,
+		&a.MarketValue,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Account.ComputeFields()", "Error getting the balance from the journal for account "+fmt.Sprintf("%d", a.ID))
+		log.Println("[WARN]", err)
+	}
 
-	e := a.Save(cr)
+	// Compute: NextPaydayStr from the schedule of the account, the one of it's group or the default schedule
+	query = "SELECT COALESCE(to_char(next_payday($1), 'DD.MM.YYYY'), '')"
 
-	if e.Empty() == false {
+	if e = cr.QueryRow(query, a.ID).Scan(&a.NextPaydayStr); e != nil {
 		var err err.Error
-		err.AddTraceback("Account.Book()", "Error while saving the Account "+a.Name)
-		return err
+		err.Init("Account.ComputeFields()", "Error getting the next payday for account "+fmt.Sprintf("%d", a.ID))
+		log.Println("[WARN]", err)
 	}
 
-	return err.Error{}
+	// Compute: Liability, RemainingDebt and the schedule of loans
+	a.Liability = a.IsLiability()
+	a.RemainingDebt = 0
+	if a.Liability {
+		a.RemainingDebt = a.Balance * -1
+	}
+	a.FirstPaymentDateStr = a.FirstPaymentDate.Format(dateLayout)
+	a.computeLoan()
 }
 
 // FindByID finds an account with it's id
-func (a *Account) FindByID(cr *sql.DB, accountID int64) err.Error {
-	query := "SELECT * FROM accounts WHERE id=$1"
+func (a *Account) FindByID(cr Cursor, accountID int64) err.Error {
+	query := "SELECT id, name, active, iban, bank_code, account_nr, bank_name, bank_type, "
+	query += "currency, create_date, last_update, principal, interest_rate, term_months, "
+	query += "COALESCE(first_payment_date, create_date), group_id, income_schedule_id FROM accounts WHERE id=$1"
+
+	var groupID, incomeScheduleID sql.NullInt64
 
 	e := cr.QueryRow(query, accountID).Scan(
 		&a.ID,
 		&a.Name,
 		&a.Active,
-		&a.Balance,
-		&a.BalanceForecast,
 		&a.Iban,
 		&a.BankCode,
 		&a.AccountNr,
 		&a.BankName,
 		&a.BankType,
+		&a.Currency,
 		&a.CreateDate,
 		&a.LastUpdate,
+		&a.Principal,
+		&a.InterestRate,
+		&a.TermMonths,
+		&a.FirstPaymentDate,
+		&groupID,
+		&incomeScheduleID,
 	)
 
 	if e != nil {
@@ -222,13 +620,16 @@ func (a *Account) FindByID(cr *sql.DB, accountID int64) err.Error {
 		return err
 	}
 
+	a.GroupID = groupID.Int64
+	a.IncomeScheduleID = incomeScheduleID.Int64
+
 	a.computeFields(cr)
 
 	return err.Error{}
 }
 
 // FindAccountByID is similar to FindByID but returns the account
-func FindAccountByID(cr *sql.DB, accountID int64) (Account, err.Error) {
+func FindAccountByID(cr Cursor, accountID int64) (Account, err.Error) {
 	a := EmptyAccount()
 
 	e := a.FindByID(cr, accountID)
@@ -243,7 +644,7 @@ func FindAccountByID(cr *sql.DB, accountID int64) (Account, err.Error) {
 }
 
 // GetAllAccounts does that what you expect
-func GetAllAccounts(cr *sql.DB) ([]Account, err.Error) {
+func GetAllAccounts(cr Cursor) ([]Account, err.Error) {
 	var accounts []Account
 	query := "SELECT id FROM accounts"
 
@@ -279,40 +680,22 @@ func GetAllAccounts(cr *sql.DB) ([]Account, err.Error) {
 	return accounts, err.Error{}
 }
 
-// GetLimitAccounts returns a limited number of accounts
-func GetLimitAccounts(cr *sql.DB, number int) ([]Account, err.Error) {
-	var result []Account
+// accountCurrency returns the currency of the account with the given id
+// The external account (id 0) has no currency of it's own and returns an empty string
+func accountCurrency(cr Cursor, accountID int64) (string, err.Error) {
+	var currency string
 
-	if number <= 0 {
-		var err err.Error
-		err.Init("GetLimitAccounts()", "The number of the accounts must be bigger than 0.")
-		return result, err
+	if accountID == 0 {
+		return "", err.Error{}
 	}
 
-	query := "SELECT id FROM accounts LIMIT $1"
-
-	res, e := cr.Query(query, number)
+	query := "SELECT currency FROM accounts WHERE id=$1"
 
-	if e != nil {
+	if e := cr.QueryRow(query, accountID).Scan(&currency); e != nil {
 		var err err.Error
-		err.Init("Account.GetLimitAccount()", e.Error())
-		return nil, err
-	}
-
-	for res.Next() {
-		var id int64
-		if e = res.Scan(&id); e != nil {
-			var err err.Error
-			err.Init("Account.GetLimitAccount()", e.Error())
-			return nil, err
-		}
-		acc := EmptyAccount()
-		if err := acc.FindByID(cr, id); e != nil {
-			err.AddTraceback("Account.GetLimitAccount()", "Error while finding account: "+fmt.Sprintf("%d", id))
-			return nil, err
-		}
-		result = append(result, acc)
+		err.Init("accountCurrency()", e.Error())
+		return "", err
 	}
 
-	return result, err.Error{}
+	return currency, err.Error{}
 }
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -124,6 +128,12 @@ func (api *APIHandler) checkAccessRight(w http.ResponseWriter, accessRight strin
 }
 
 func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	// Attachments of a record are addressed by the path
+	if model, recordID, attachmentID, ok := parseAttachmentPath(path); ok {
+		api.handleAttachments(w, r, model, recordID, attachmentID, body)
+		return
+	}
+
 	switch path {
 	//
 	// Categories
@@ -146,6 +156,11 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			return
 		}
 		api.getCategories(w, r)
+	case "/categories/tree":
+		if !api.checkAccessRight(w, "category.read") {
+			return
+		}
+		api.getCategoryTree(w, r)
 	case "/categories/create":
 		if !api.checkAccessRight(w, "category.write") {
 			return
@@ -164,6 +179,8 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			return
 		}
 		c := EmptyCategory()
+		// Keeps the parent category if no ParentID is given
+		c.ParentID = -1
 		if err := json.Unmarshal(body, &c); err != nil {
 			w.WriteHeader(400)
 			fmt.Fprintf(w, "{'error': '%s'}", err)
@@ -213,11 +230,26 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			return
 		}
 		api.getAccounts(w, r)
+	case "/accounts/journal":
+		if !api.checkAccessRight(w, "account.read") {
+			return
+		}
+		a := EmptyAccount()
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &a); err != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", err)
+				return
+			}
+		}
+		api.id = a.ID
+		api.getAccountJournal(w, r)
 	case "/accounts/create":
 		if !api.checkAccessRight(w, "account.write") {
 			return
 		}
 		a := EmptyAccount()
+		a.FirstPaymentDate = time.Time{}
 		if err := json.Unmarshal(body, &a); err != nil {
 			w.WriteHeader(400)
 			fmt.Fprintf(w, "{'error': '%s'}", err)
@@ -231,6 +263,7 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			return
 		}
 		a := EmptyAccount()
+		a.FirstPaymentDate = time.Time{}
 		if err := json.Unmarshal(body, &a); err != nil {
 			w.WriteHeader(400)
 			fmt.Fprintf(w, "{'error': '%s'}", err)
@@ -259,6 +292,80 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 		}
 		api.id = a.ID
 		api.deleteAccount(w, r)
+	case "/accounts/payment":
+		if !api.checkAccessRight(w, "account.read") || !api.checkAccessRight(w, "transaction.write") {
+			return
+		}
+		req := loanPaymentRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.bookLoanPayment(w, r)
+	case "/accounts/close":
+		if !api.checkAccessRight(w, "account.write") || !api.checkAccessRight(w, "transaction.write") {
+			return
+		}
+		req := closeAccountRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.closeAccount(w, r)
+	case "/accountgroups":
+		if !api.checkAccessRight(w, "account.read") {
+			return
+		}
+		api.id = 0
+		g := AccountGroup{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &g); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = g.ID
+		if api.id > 0 {
+			api.getAccountGroupByID(w, r)
+			return
+		}
+		api.getAccountGroups(w, r)
+	case "/accountgroups/update":
+		if !api.checkAccessRight(w, "account.write") {
+			return
+		}
+		api.id = 0
+		req := accountGroupRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateAccountGroup(w, r)
+	case "/accountgroups/delete":
+		if !api.checkAccessRight(w, "account.delete") {
+			return
+		}
+		api.id = 0
+		g := AccountGroup{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &g); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = g.ID
+		api.deleteAccountGroup(w, r)
 	//
 	// Transactions
 	//
@@ -276,11 +383,17 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			}
 		}
 		api.id = t.ID
+		api.obj = t
 		if api.id > 0 {
 			api.getTransactionByID(w, r)
 			return
 		}
 		api.getTransactions(w, r)
+	case "/tags":
+		if !api.checkAccessRight(w, "transaction.read") {
+			return
+		}
+		api.getTags(w, r)
 	case "/transactions/update":
 		if !api.checkAccessRight(w, "transaction.write") {
 			return
@@ -313,6 +426,21 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 		}
 		api.id = t.ID
 		api.deleteTransaction(w, r)
+	case "/transactions/unreconcile":
+		if !api.checkAccessRight(w, "transaction.write") {
+			return
+		}
+		api.id = 0
+		t := Transaction{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &t); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = t.ID
+		api.unreconcileTransaction(w, r)
 	case "/statistics":
 		if !api.checkAccessRight(w, "statistic.read") {
 			return
@@ -327,214 +455,3750 @@ func (api *APIHandler) multiplexer(w http.ResponseWriter, r *http.Request, path
 			}
 		}
 		api.id = s.ID
+		api.obj = s
 		if api.id > 0 {
 			api.getStatisticByID(w, r)
 			return
 		}
 		api.getStatistics(w, r)
-	default:
-		w.WriteHeader(404)
-		fmt.Fprint(w, "{'error': '404 Not Found', 'status': 404}")
-	}
-}
-
-func (api APIHandler) sendResult(w http.ResponseWriter, data interface{}) {
-	d, err := json.Marshal(data)
-	if err != nil {
-		log.Println("[ERROR] APIHandler.sendResult():", err)
-		fmt.Fprint(w, "{'error': 'Server error while parsing data into JSON.'}")
-		return
-	}
-
-	fmt.Fprint(w, string(d))
-}
-
-/*
-	##############################
-	#                            #
-	#         Categories         #
-	#                            #
-	##############################
-*/
-
-// getCategories gets all Categories
-// Also handles if
-func (api APIHandler) getCategories(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/categories/: Method must be GET.'}")
-		return
-	}
-
-	c, err := GetAllCategories(db)
-	if !err.Empty() {
-		err.AddTraceback("APIHandler.getCategories()", "Error getting all categories.")
-		log.Println("[ERROR]", err)
-		w.WriteHeader(500)
-		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
-		return
-	}
-
-	api.sendResult(w, c)
-}
-
-// getCategoryByID gets a category by it's ID
-func (api APIHandler) getCategoryByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/categories/: Method must be POST for getting categories by ID.'}")
-		return
-	}
-	if api.id <= 0 {
-		w.WriteHeader(400)
-		fmt.Fprintln(w, errorID)
-		return
-	}
-
-	c := EmptyCategory()
-
-	if err := c.FindByID(db, api.id); !err.Empty() {
-		err.AddTraceback("APIHandler.getCategoryByID()", "Error getting category:"+fmt.Sprintf("%d", api.id))
-		log.Println("[ERROR]", err)
-		w.WriteHeader(400)
-		fmt.Fprintln(w, errorGetID)
-		return
-	}
-
-	api.sendResult(w, c)
-}
-
-// getCategoryByID write to a category
-// if this category does not exist or has no ID, create one
-// Method MUST be POST
-// Returns the data written to the database
-func (api APIHandler) updateCategory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/categories/create: Method must be POST.'}")
-		return
-	}
-
-	c := EmptyCategory()
-
-	// Get data if ID is present
-	if api.id > 0 {
-		if err := c.FindByID(db, api.id); !err.Empty() {
-			err.AddTraceback("APIHandler.updateCategory()", "Error getting category by ID: "+fmt.Sprintf("%d", api.id))
-			log.Println("[WARN]", err)
+	//
+	// Exchange Rates
+	//
+	case "/exchangerates":
+		if !api.checkAccessRight(w, "exchangerate.read") {
+			return
+		}
+		api.id = 0
+		er := EmptyExchangeRate()
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &er); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = er.ID
+		if api.id > 0 {
+			api.getExchangeRateByID(w, r)
+			return
+		}
+		api.getExchangeRates(w, r)
+	case "/exchangerates/update":
+		if !api.checkAccessRight(w, "exchangerate.write") {
+			return
+		}
+		api.id = 0
+		er := EmptyExchangeRate()
+		if e := json.Unmarshal(body, &er); e != nil {
 			w.WriteHeader(400)
-			fmt.Fprint(w, errorGetID)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
 			return
 		}
-	} else {
-		c.CreateDate = time.Now()
-	}
-
-	// Create necessary variables for parsing the data
-	reqData := api.obj.(Category)
-	name := c.Name
-	hex := c.Hex
-
-	// Error catching when the client wants to create a category but provides no name
-	if c.ID == 0 && reqData.Name == "" {
-		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error': 'Please provide a name for creating a category.'}")
-		return
-	}
-
-	// Update data only if it is given
-	if reqData.Name != "" {
-		name = reqData.Name
-	}
-	if reqData.Hex != "" {
-		hex = reqData.Hex
-	}
-
-	// Update object
-	c.Name = name
-	c.Hex = hex
-	c.LastUpdate = time.Now()
-
-	// Save the object to the database
-	var e err.Error
-	if c.ID == 0 {
-		e = c.Create(db)
-	} else {
-		e = c.Save(db)
-	}
-	if !e.Empty() {
-		var err err.Error
-		err.AddTraceback("APIHandler.updateCategory()", "Error creating/saving the category.")
-		log.Println("[WARN]", err)
-		w.WriteHeader(500)
-		fmt.Fprint(w, "{'error': 'Error creating/saving the category.'}")
-		return
-	}
-
-	api.sendResult(w, c)
-}
-
-// deletes a category with an ID
-func (api APIHandler) deleteCategory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/categories/delete: Method must be DELETE.'}")
-		return
-	}
-	if api.id <= 0 {
-		w.WriteHeader(400)
-		fmt.Fprintln(w, errorID)
-		return
-	}
-
-	c := Category{
-		ID: api.id,
-	}
-
-	if e := c.Delete(db); !e.Empty() {
-		e.AddTraceback("APIHandler.deleteCategory", "Error deleting category with ID: "+fmt.Sprintf("%d", api.id))
-		log.Println("[WARN]", e)
-		w.WriteHeader(400)
-		fmt.Fprintf(w, "{'error': 'There was an error deleting the record from the database.'}")
-		return
-	}
-
-	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
-}
-
-/*
-	##############################
-	#                            #
-	#          Accounts          #
+		api.id = er.ID
+		api.obj = er
+		api.updateExchangeRate(w, r)
+	case "/exchangerates/delete":
+		if !api.checkAccessRight(w, "exchangerate.delete") {
+			return
+		}
+		api.id = 0
+		er := EmptyExchangeRate()
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &er); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = er.ID
+		api.deleteExchangeRate(w, r)
+	//
+	// Recurring Transactions
+	//
+	case "/recurring":
+		if !api.checkAccessRight(w, "recurring.read") {
+			return
+		}
+		api.id = 0
+		rt := EmptyRecurringTransaction()
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rt); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rt.ID
+		if api.id > 0 {
+			api.getRecurringTransactionByID(w, r)
+			return
+		}
+		api.getRecurringTransactions(w, r)
+	case "/recurring/update":
+		if !api.checkAccessRight(w, "recurring.write") {
+			return
+		}
+		api.id = 0
+		// The dates stay empty if they are not part of the request
+		rt := RecurringTransaction{Active: true}
+		if e := json.Unmarshal(body, &rt); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = rt.ID
+		api.obj = rt
+		api.updateRecurringTransaction(w, r)
+	case "/recurring/delete":
+		if !api.checkAccessRight(w, "recurring.delete") {
+			return
+		}
+		api.id = 0
+		rt := RecurringTransaction{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rt); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rt.ID
+		api.deleteRecurringTransaction(w, r)
+	//
+	// Budgets
+	//
+	case "/budgets":
+		if !api.checkAccessRight(w, "budget.read") {
+			return
+		}
+		api.id = 0
+		// PeriodStart computes the budgets for the period which contains this date instead of the current one
+		b := Budget{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &b); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = b.ID
+		api.obj = b
+		if api.id > 0 {
+			api.getBudgetByID(w, r)
+			return
+		}
+		api.getBudgets(w, r)
+	case "/budgets/update":
+		if !api.checkAccessRight(w, "budget.write") {
+			return
+		}
+		api.id = 0
+		req := budgetRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateBudget(w, r)
+	case "/budgets/delete":
+		if !api.checkAccessRight(w, "budget.delete") {
+			return
+		}
+		api.id = 0
+		b := Budget{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &b); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = b.ID
+		api.deleteBudget(w, r)
+	//
+	// Savings Goals
+	//
+	case "/goals":
+		if !api.checkAccessRight(w, "goal.read") {
+			return
+		}
+		api.id = 0
+		g := Goal{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &g); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = g.ID
+		if api.id > 0 {
+			api.getGoalByID(w, r)
+			return
+		}
+		api.getGoals(w, r)
+	case "/goals/update":
+		if !api.checkAccessRight(w, "goal.write") {
+			return
+		}
+		api.id = 0
+		req := goalRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateGoal(w, r)
+	case "/goals/delete":
+		if !api.checkAccessRight(w, "goal.delete") {
+			return
+		}
+		api.id = 0
+		g := Goal{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &g); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = g.ID
+		api.deleteGoal(w, r)
+	//
+	// Payees
+	//
+	case "/payees":
+		if !api.checkAccessRight(w, "payee.read") {
+			return
+		}
+		api.id = 0
+		p := Payee{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &p); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = p.ID
+		api.obj = p
+		if api.id > 0 {
+			api.getPayeeByID(w, r)
+			return
+		}
+		api.getPayees(w, r)
+	case "/payees/update":
+		if !api.checkAccessRight(w, "payee.write") {
+			return
+		}
+		api.id = 0
+		req := payeeRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updatePayee(w, r)
+	case "/payees/delete":
+		if !api.checkAccessRight(w, "payee.delete") {
+			return
+		}
+		api.id = 0
+		p := Payee{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &p); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = p.ID
+		api.deletePayee(w, r)
+	//
+	// Rules
+	//
+	case "/rules":
+		if !api.checkAccessRight(w, "rule.read") {
+			return
+		}
+		api.id = 0
+		rule := Rule{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rule); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rule.ID
+		if api.id > 0 {
+			api.getRuleByID(w, r)
+			return
+		}
+		api.getRules(w, r)
+	case "/rules/update":
+		if !api.checkAccessRight(w, "rule.write") {
+			return
+		}
+		api.id = 0
+		req := ruleRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateRule(w, r)
+	case "/rules/delete":
+		if !api.checkAccessRight(w, "rule.delete") {
+			return
+		}
+		api.id = 0
+		rule := Rule{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rule); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rule.ID
+		api.deleteRule(w, r)
+	case "/rules/apply":
+		// Changes transactions, so it needs both access rights
+		if !api.checkAccessRight(w, "rule.read") || !api.checkAccessRight(w, "transaction.write") {
+			return
+		}
+		req := ruleApplyRequest{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &req); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.obj = req
+		api.applyRules(w, r)
+	//
+	// Reconciliations
+	//
+	case "/reconciliations":
+		if !api.checkAccessRight(w, "reconciliation.read") {
+			return
+		}
+		api.id = 0
+		rec := Reconciliation{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rec); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rec.ID
+		api.obj = rec
+		if api.id > 0 {
+			api.getReconciliationByID(w, r)
+			return
+		}
+		api.getReconciliations(w, r)
+	case "/reconciliations/update":
+		if !api.checkAccessRight(w, "reconciliation.write") {
+			return
+		}
+		api.id = 0
+		req := reconciliationRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateReconciliation(w, r)
+	case "/reconciliations/delete":
+		if !api.checkAccessRight(w, "reconciliation.delete") {
+			return
+		}
+		api.id = 0
+		rec := Reconciliation{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &rec); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = rec.ID
+		api.deleteReconciliation(w, r)
+	//
+	// Administration
+	//
+	case "/admin/ledger":
+		report := LedgerReport{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &report); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		// Only reporting needs the read right, fixing the issues the write right
+		accessRight := "ledger.read"
+		if report.Fix {
+			accessRight = "ledger.write"
+		}
+		if !api.checkAccessRight(w, accessRight) {
+			return
+		}
+		api.obj = report
+		api.checkLedger(w, r)
+	case "/audit":
+		if !api.checkAccessRight(w, "audit.read") {
+			return
+		}
+		entry := AuditEntry{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &entry); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = entry.RecordID
+		api.obj = entry
+		api.getAuditEntries(w, r)
+	//
+	// Investments
+	//
+	case "/securities":
+		if !api.checkAccessRight(w, "investment.read") {
+			return
+		}
+		api.id = 0
+		s := Security{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &s); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = s.ID
+		if api.id > 0 {
+			api.getSecurityByID(w, r)
+			return
+		}
+		api.getSecurities(w, r)
+	case "/securities/update":
+		if !api.checkAccessRight(w, "investment.write") {
+			return
+		}
+		api.id = 0
+		s := EmptySecurity()
+		if e := json.Unmarshal(body, &s); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = s.ID
+		api.obj = s
+		api.updateSecurity(w, r)
+	case "/securities/delete":
+		if !api.checkAccessRight(w, "investment.delete") {
+			return
+		}
+		api.id = 0
+		s := Security{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &s); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = s.ID
+		api.deleteSecurity(w, r)
+	case "/securities/prices/import":
+		if !api.checkAccessRight(w, "investment.write") {
+			return
+		}
+		req := priceImportRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.obj = req
+		api.importPrices(w, r)
+	case "/trades":
+		if !api.checkAccessRight(w, "investment.read") {
+			return
+		}
+		api.id = 0
+		t := Trade{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &t); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = t.ID
+		if api.id > 0 {
+			api.getTradeByID(w, r)
+			return
+		}
+		api.obj = t
+		api.getTrades(w, r)
+	case "/trades/create":
+		if !api.checkAccessRight(w, "investment.write") {
+			return
+		}
+		api.id = 0
+		t := EmptyTrade()
+		t.TradeDate = time.Time{}
+		if e := json.Unmarshal(body, &t); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.obj = t
+		api.createTrade(w, r)
+	case "/trades/delete":
+		if !api.checkAccessRight(w, "investment.delete") {
+			return
+		}
+		api.id = 0
+		t := Trade{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &t); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = t.ID
+		api.deleteTrade(w, r)
+	case "/holdings":
+		if !api.checkAccessRight(w, "investment.read") {
+			return
+		}
+		h := Holding{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &h); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = h.AccountID
+		api.getHoldings(w, r)
+	//
+	// Closed periods
+	//
+	case "/periods":
+		if !api.checkAccessRight(w, "period.read") {
+			return
+		}
+		api.id = 0
+		p := Period{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &p); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = p.ID
+		if api.id > 0 {
+			api.getPeriodByID(w, r)
+			return
+		}
+		api.getPeriods(w, r)
+	case "/periods/close":
+		if !api.checkAccessRight(w, "period.write") {
+			return
+		}
+		req := closePeriodRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.obj = req
+		api.closePeriod(w, r)
+	case "/admin/periods/reopen":
+		// Reopening changes the history, so it has a right of it's own
+		if !api.checkAccessRight(w, "period.reopen") {
+			return
+		}
+		api.id = 0
+		p := Period{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &p); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = p.ID
+		api.reopenPeriod(w, r)
+	//
+	// Income Schedules
+	//
+	case "/income":
+		if !api.checkAccessRight(w, "income.read") {
+			return
+		}
+		api.id = 0
+		s := IncomeSchedule{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &s); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = s.ID
+		if api.id > 0 {
+			api.getIncomeScheduleByID(w, r)
+			return
+		}
+		api.getIncomeSchedules(w, r)
+	case "/income/update":
+		if !api.checkAccessRight(w, "income.write") {
+			return
+		}
+		api.id = 0
+		req := incomeScheduleRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.ID
+		api.obj = req
+		api.updateIncomeSchedule(w, r)
+	case "/income/delete":
+		if !api.checkAccessRight(w, "income.delete") {
+			return
+		}
+		api.id = 0
+		s := IncomeSchedule{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &s); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = s.ID
+		api.deleteIncomeSchedule(w, r)
+	//
+	// Import
+	//
+	case "/import":
+		if !api.checkAccessRight(w, "import.write") || !api.checkAccessRight(w, "transaction.write") {
+			return
+		}
+		req := importRequest{}
+		if e := json.Unmarshal(body, &req); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = req.MappingID
+		api.obj = req
+		api.importStatement(w, r)
+	case "/import/mappings":
+		if !api.checkAccessRight(w, "import.read") {
+			return
+		}
+		api.id = 0
+		m := ImportMapping{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &m); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = m.ID
+		if api.id > 0 {
+			api.getImportMappingByID(w, r)
+			return
+		}
+		api.getImportMappings(w, r)
+	case "/import/mappings/update":
+		if !api.checkAccessRight(w, "import.write") {
+			return
+		}
+		api.id = 0
+		m := EmptyImportMapping()
+		if e := json.Unmarshal(body, &m); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': '%s'}", e)
+			return
+		}
+		api.id = m.ID
+		api.obj = m
+		api.updateImportMapping(w, r)
+	case "/import/mappings/delete":
+		if !api.checkAccessRight(w, "import.delete") {
+			return
+		}
+		api.id = 0
+		m := ImportMapping{}
+		if len(body) > 0 {
+			if e := json.Unmarshal(body, &m); e != nil {
+				w.WriteHeader(400)
+				fmt.Fprintf(w, "{'error': '%s'}", e)
+				return
+			}
+		}
+		api.id = m.ID
+		api.deleteImportMapping(w, r)
+	default:
+		w.WriteHeader(404)
+		fmt.Fprint(w, "{'error': '404 Not Found', 'status': 404}")
+	}
+}
+
+func (api APIHandler) sendResult(w http.ResponseWriter, data interface{}) {
+	d, err := json.Marshal(data)
+	if err != nil {
+		log.Println("[ERROR] APIHandler.sendResult():", err)
+		fmt.Fprint(w, "{'error': 'Server error while parsing data into JSON.'}")
+		return
+	}
+
+	fmt.Fprint(w, string(d))
+}
+
+/*
+	##############################
+	#                            #
+	#         Categories         #
+	#                            #
+	##############################
+*/
+
+// getCategories gets all Categories
+// Also handles if
+func (api APIHandler) getCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/: Method must be GET.'}")
+		return
+	}
+
+	c, err := GetAllCategories(db)
+	if !err.Empty() {
+		err.AddTraceback("APIHandler.getCategories()", "Error getting all categories.")
+		log.Println("[ERROR]", err)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
+		return
+	}
+
+	api.sendResult(w, c)
+}
+
+// getCategoryTree gets the top-level categories with their subcategories in Children
+func (api APIHandler) getCategoryTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/tree: Method must be GET.'}")
+		return
+	}
+
+	c, err := GetCategoryTree(db)
+	if !err.Empty() {
+		err.AddTraceback("APIHandler.getCategoryTree()", "Error getting the category tree.")
+		log.Println("[ERROR]", err)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while fetching categories.'}")
+		return
+	}
+
+	api.sendResult(w, c)
+}
+
+// getCategoryByID gets a category by it's ID
+func (api APIHandler) getCategoryByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/: Method must be POST for getting categories by ID.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, errorID)
+		return
+	}
+
+	c := EmptyCategory()
+
+	if err := c.FindByID(db, api.id); !err.Empty() {
+		err.AddTraceback("APIHandler.getCategoryByID()", "Error getting category:"+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", err)
+		w.WriteHeader(400)
+		fmt.Fprintln(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, c)
+}
+
+// getCategoryByID write to a category
+// if this category does not exist or has no ID, create one
+// Method MUST be POST
+// Returns the data written to the database
+func (api APIHandler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/create: Method must be POST.'}")
+		return
+	}
+
+	c := EmptyCategory()
+
+	// Get data if ID is present
+	if api.id > 0 {
+		if err := c.FindByID(db, api.id); !err.Empty() {
+			err.AddTraceback("APIHandler.updateCategory()", "Error getting category by ID: "+fmt.Sprintf("%d", api.id))
+			log.Println("[WARN]", err)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	} else {
+		c.CreateDate = time.Now()
+	}
+
+	before := auditSnapshot(c)
+
+	// Create necessary variables for parsing the data
+	reqData := api.obj.(Category)
+	name := c.Name
+	hex := c.Hex
+	parentID := c.ParentID
+
+	// Error catching when the client wants to create a category but provides no name
+	if c.ID == 0 && reqData.Name == "" {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'Please provide a name for creating a category.'}")
+		return
+	}
+
+	// Update data only if it is given
+	if reqData.Name != "" {
+		name = reqData.Name
+	}
+	if reqData.Hex != "" {
+		hex = reqData.Hex
+	}
+	// 0 makes it a top-level category
+	if reqData.ParentID >= 0 {
+		parentID = reqData.ParentID
+	}
+
+	// Update object
+	c.Name = name
+	c.Hex = hex
+	c.ParentID = parentID
+	c.LastUpdate = time.Now()
+
+	// Save the object to the database
+	create := c.ID == 0
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if create {
+			if e := c.Create(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditCreate, AuditCategory, c.ID, nil, c)
+		}
+		if e := c.Save(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditCategory, c.ID, before, c)
+	})
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.updateCategory()", "Error creating/saving the category.")
+		log.Println("[WARN]", e)
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "{'error': 'Error creating/saving the category: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, c)
+}
+
+// deletes a category with an ID
+func (api APIHandler) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/delete: Method must be DELETE.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, errorID)
+		return
+	}
+
+	c := Category{
+		ID: api.id,
+	}
+
+	// Read the category for the audit log
+	before := c
+	if e := before.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("APIHandler.deleteCategory", "Error getting category with ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := c.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditCategory, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.deleteCategory", "Error deleting category with ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'There was an error deleting the record from the database.'}")
+		return
+	}
+
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#          Accounts          #
+	#                            #
+	##############################
+*/
+
+// Gives back all accounts
+func (api APIHandler) getAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/: Method must be GET.'}")
+		return
+	}
+
+	acc, e := GetAllAccounts(db)
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.getAccount()", "Error while getting accounts")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
+		return
+	}
+
+	api.sendResult(w, acc)
+}
+
+// Returns a specific account with the given id
+func (api APIHandler) getAccountByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	acc := EmptyAccount()
+	if err := acc.FindByID(db, api.id); !err.Empty() {
+		err.AddTraceback("APIHandler.getAccountByID", "Error while getting account: "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", err)
+
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, acc)
+}
+
+// Returns the journal lines posted on the account with the given id
+func (api APIHandler) getAccountJournal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/journal: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	lines, err := GetJournalLinesByAccount(db, api.id)
+	if !err.Empty() {
+		err.AddTraceback("APIHandler.getAccountJournal()", "Error while getting journal of account: "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", err)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while fetching the journal.'}")
+		return
+	}
+
+	api.sendResult(w, lines)
+}
+
+func (api APIHandler) updateAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/categories/create: Method must be POST.'}")
+		return
+	}
+
+	acc := EmptyAccount()
+
+	if api.id > 0 {
+		if err := acc.FindByID(db, api.id); !err.Empty() {
+			err.AddTraceback("APIHandler.updateAccount()", "Error while getting account:"+fmt.Sprintf("%d", api.id))
+			log.Println("[ERROR]", err)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	} else {
+		acc.CreateDate = time.Now()
+		acc.Active = true
+	}
+
+	before := auditSnapshot(acc)
+	reqData := api.obj.(Account)
+
+	// Validate user input
+	if acc.ID == 0 && reqData.Name == "" && reqData.Balance == 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'Please provide a name and balance for creating a category.'}")
+		return
+	}
+
+	// Set fields which are not empty
+	if reqData.Name != "" {
+		acc.Name = reqData.Name
+	}
+	// The balance is computed from the journal, it can only be set as opening balance
+	if acc.ID == 0 && reqData.Balance != 0 {
+		acc.Balance = reqData.Balance
+	}
+	if reqData.Iban != "" {
+		acc.Iban = reqData.Iban
+	}
+	if reqData.BankCode != "" {
+		acc.BankCode = reqData.BankCode
+	}
+	if reqData.AccountNr != "" {
+		acc.AccountNr = reqData.AccountNr
+	}
+	if reqData.BankName != "" {
+		acc.BankName = reqData.BankName
+	}
+	if reqData.BankType != "" {
+		acc.BankType = reqData.BankType
+	}
+	if reqData.Currency != "" {
+		acc.Currency = strings.ToUpper(reqData.Currency)
+	}
+	if reqData.Principal != 0 {
+		acc.Principal = reqData.Principal
+	}
+	if reqData.InterestRate != 0 {
+		acc.InterestRate = reqData.InterestRate
+	}
+	if reqData.TermMonths != 0 {
+		acc.TermMonths = reqData.TermMonths
+	}
+	if !reqData.FirstPaymentDate.IsZero() {
+		acc.FirstPaymentDate = reqData.FirstPaymentDate
+	}
+	// A GroupID of -1 removes the account from it's group
+	if reqData.GroupID > 0 {
+		acc.GroupID = reqData.GroupID
+	} else if reqData.GroupID < 0 {
+		acc.GroupID = 0
+	}
+	// An IncomeScheduleID of -1 makes the account use the paydays of it's group or the default schedule
+	if reqData.IncomeScheduleID > 0 {
+		acc.IncomeScheduleID = reqData.IncomeScheduleID
+	} else if reqData.IncomeScheduleID < 0 {
+		acc.IncomeScheduleID = 0
+	}
+
+	acc.LastUpdate = time.Now()
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if acc.ID <= 0 {
+			if e := acc.Create(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditCreate, AuditAccount, acc.ID, nil, acc)
+		}
+		if e := acc.Save(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditAccount, acc.ID, before, acc)
+	})
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.updateAccount()", "Error while writing account to the database.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "{'error': 'Error creating/saving the account: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, acc)
+}
+
+// deletes an account with an ID
+func (api APIHandler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/delete: Method must be DELETE.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, errorID)
+		return
+	}
+
+	a, e := FindAccountByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.deleteAccount()", "Error getting account: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprintln(w, "{'error': 'There was an error finding the record in the database.'}")
+		return
+	}
+
+	// Accounts with a history are closed instead
+	if e := a.CheckDeletable(db); !e.Empty() {
+		w.WriteHeader(403)
+		fmt.Fprintf(w, "{'error': '%s'}", e.Error())
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := a.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditAccount, a.ID, a, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.deleteAccount()", "Error while deleting account.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "{'error': 'There was an error deleting the record from the database.'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteAccount(): Account with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+// loanPaymentRequest is the body of /api/accounts/payment
+// ID is the loan account, Date defaults to today
+type loanPaymentRequest struct {
+	ID          int64
+	FromAccount int64
+	Date        time.Time
+}
+
+// Books the next installment of a loan and returns the created transactions
+func (api APIHandler) bookLoanPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/payment: Method must be POST.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	req := api.obj.(loanPaymentRequest)
+	if req.Date.IsZero() {
+		req.Date = time.Now().Local()
+	}
+
+	loan, e := FindAccountByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.bookLoanPayment()", "Error while getting account: "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	var transactions []Transaction
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		var bookErr err.Error
+		transactions, bookErr = loan.BookPayment(tx, apiActor(api.key), req.FromAccount, req.Date)
+		return bookErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.bookLoanPayment()", "Error while booking the payment.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'The payment could not be booked: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, transactions)
+}
+
+// closeAccountRequest is the body of /api/accounts/close
+// ToAccount receives the remaining balance, Date defaults to today
+type closeAccountRequest struct {
+	ID        int64
+	ToAccount int64
+	Date      time.Time
+}
+
+// closeAccountResult is the answer of /api/accounts/close
+// Transfer has no ID if the account had no balance left
+type closeAccountResult struct {
+	Account  Account
+	Transfer Transaction
+}
+
+// Closes an account, it's balance is transferred to ToAccount
+func (api APIHandler) closeAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accounts/close: Method must be POST.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	req := api.obj.(closeAccountRequest)
+	if req.Date.IsZero() {
+		req.Date = time.Now().Local()
+	}
+
+	result := closeAccountResult{}
+
+	var e err.Error
+	if result.Account, e = FindAccountByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.closeAccount()", "Error while getting account: "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		var closeErr err.Error
+		result.Transfer, closeErr = result.Account.Close(tx, apiActor(api.key), req.ToAccount, req.Date)
+		return closeErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.closeAccount()", "Error while closing the account.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'The account could not be closed: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, result)
+}
+
+/*
+	##############################
+	#                            #
+	#       Account Groups       #
+	#                            #
+	##############################
+*/
+
+// accountGroupsResult are the account groups with the net worth of the groups which are included in it
+type accountGroupsResult struct {
+	Groups   []AccountGroup
+	NetWorth Money
+	Currency string
+}
+
+// Returns all account groups with their accounts, balances and the net worth
+// Accounts without a group are returned in the last group with the ID 0
+func (api APIHandler) getAccountGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accountgroups: Method must be GET.'}")
+		return
+	}
+
+	groups, e := GetAllAccountGroups(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getAccountGroups()", "Error while getting account groups.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the account groups.'}")
+		return
+	}
+
+	result := accountGroupsResult{
+		Groups:   groups,
+		NetWorth: NetWorth(groups),
+	}
+	if result.Currency, e = GetBaseCurrency(db); !e.Empty() {
+		e.AddTraceback("api.getAccountGroups()", "Error while getting the base currency.")
+		log.Println("[WARN]", e)
+	}
+
+	api.sendResult(w, result)
+}
+
+// Returns a specific account group
+func (api APIHandler) getAccountGroupByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accountgroups: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	g := EmptyAccountGroup()
+	if e := g.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getAccountGroupByID()", "Error getting account group: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, g)
+}
+
+// accountGroupRequest is the body of /api/accountgroups/update
+// Only the fields of the request are changed, renaming a group keeps it's order, net worth and schedule
+type accountGroupRequest struct {
+	ID                int64
+	Name              string
+	Sequence          *int64
+	IncludeInNetWorth *bool
+	IncomeScheduleID  *int64
+}
+
+// Creates or updates an account group
+// Accounts are added to a group with the GroupID of /api/accounts/update
+func (api APIHandler) updateAccountGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accountgroups/update: Method must be POST.'}")
+		return
+	}
+
+	g := EmptyAccountGroup()
+	if api.id > 0 {
+		if e := g.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateAccountGroup()", "Error while searching account group per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	before := auditSnapshot(g)
+	req := api.obj.(accountGroupRequest)
+
+	if req.Name == "" && api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (Name)'}")
+		return
+	}
+
+	if req.Name != "" {
+		g.Name = req.Name
+	}
+	if req.Sequence != nil {
+		g.Sequence = *req.Sequence
+	}
+	if req.IncludeInNetWorth != nil {
+		g.IncludeInNetWorth = *req.IncludeInNetWorth
+	}
+	// An IncomeScheduleID of 0 makes the accounts of the group use the default schedule
+	if req.IncomeScheduleID != nil {
+		g.IncomeScheduleID = *req.IncomeScheduleID
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := g.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditAccountGroup, g.ID, before, g)
+		}
+		if e := g.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditAccountGroup, g.ID, nil, g)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.updateAccountGroup()", "Error while creating/saving the account group.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the account group: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, g)
+}
+
+// deletes an account group, it's accounts are moved to the other accounts
+func (api APIHandler) deleteAccountGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/accountgroups/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	g := EmptyAccountGroup()
+	if e := g.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteAccountGroup()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(g)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := g.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditAccountGroup, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteAccountGroup()", "Error deleting the account group "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the account group from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteAccountGroup(): Account group with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#        Transactions        #
+	#                            #
+	##############################
+*/
+
+// Returns all transactions
+// If Tags are given in the body or as tag parameters of the url, only the transactions with all of them are returned
+func (api APIHandler) getTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprint(w, "{'error': '/api/transactions/: Method must be GET.'}")
+		return
+	}
+
+	tags := r.URL.Query()["tag"]
+	if req, ok := api.obj.(Transaction); ok {
+		tags = append(tags, req.Tags...)
+	}
+
+	var acc []Transaction
+	var e err.Error
+	if len(normalizeTags(tags)) > 0 {
+		acc, e = GetTransactionsByTags(db, tags)
+	} else {
+		acc, e = GetLatestTransactions(db, -1)
+	}
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.getTransactions()", "Error while getting transactions")
+		log.Println("[ERROR]", e)
+		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
+		return
+	}
+
+	api.sendResult(w, acc)
+}
+
+// Returns a specific transaction with the given id
+func (api APIHandler) getTransactionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprint(w, "{'error': '/api/transactions/: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	t := EmptyTransaction()
+	if err := t.FindByID(db, api.id); !err.Empty() {
+		err.AddTraceback("APIHandler.getTransactionByID", "Error while getting transaction: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", err)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, t)
+}
+
+func (api APIHandler) updateTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': '/api/transactions/update: Method must be POST.'}")
+		return
+	}
+
+	t := EmptyTransaction()
+	if api.id > 0 {
+		if e := t.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateTransaction()", "Error while searching transaction per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprintf(w, errorGetID)
+			return
+		}
+	} else {
+		t.CreateDate = time.Now()
+		t.LastUpdate = time.Now()
+	}
+
+	before := auditSnapshot(t)
+	req := api.obj.(Transaction)
+
+	if req.Name == "" || req.Amount <= 0 || (req.FromAccount <= 0 && req.ToAccount <= 0) {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error', 'At least one required field was empty (Name, Amount) or both accounts were 0'}")
+		return
+	}
+
+	t.Name = req.Name
+	t.Amount = req.Amount
+	// 0 converts the amount with the exchange rate for cross-currency transactions
+	t.ToAmount = req.ToAmount
+	t.Active = req.Active
+
+	var emptyTime time.Time
+
+	if req.Description != "" {
+		t.Description = req.Description
+	}
+	if req.TransactionDate != emptyTime {
+		t.TransactionDate = req.TransactionDate
+	}
+	if req.CategoryID >= 0 {
+		t.CategoryID = req.CategoryID
+	}
+	// 0 links new transactions to the payee matching their name
+	if req.PayeeID >= 0 {
+		t.PayeeID = req.PayeeID
+	}
+	if req.FromAccount >= 0 {
+		t.FromAccount = req.FromAccount
+	}
+	if req.ToAccount >= 0 {
+		t.ToAccount = req.ToAccount
+	}
+	// Without a type the current one is kept if it still fits the accounts, otherwise it's detected from them
+	if req.TransactionType != "" {
+		if !StrContains(GetAllTransactionTypes(), req.TransactionType) {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': 'Unknown TransactionType, it must be one of: %s'}", strings.Join(GetAllTransactionTypes(), ", "))
+			return
+		}
+		t.TransactionType = req.TransactionType
+	} else if !transactionTypeFits(t.TransactionType, t.FromAccount, t.ToAccount) {
+		t.TransactionType = ""
+	}
+	// Splits are only replaced if they are part of the request, an empty list removes them
+	if req.Splits != nil {
+		t.Splits = req.Splits
+	}
+	// The same goes for the tags
+	if req.Tags != nil {
+		t.Tags = req.Tags
+	}
+
+	t.LastUpdate = time.Now()
+
+	// Write the transaction, it's journal entry and the audit entry atomically
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := t.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditTransaction, t.ID, before, t)
+		}
+		if e := t.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditTransaction, t.ID, nil, t)
+	})
+	if !e.Empty() {
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the transaction: %s'}", e.Error())
+		e.AddTraceback("api.updateTransaction()", "Error while creating/saving the transaction.")
+		log.Println("[ERROR]", e)
+		return
+	}
+
+	api.sendResult(w, t)
+}
+
+func (api APIHandler) deleteTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error', '/api/transactions/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	// Validate that the ID is existing in the database
+	t := Transaction{}
+
+	if e := t.FindByID(db, api.id); !e.Empty() {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		e.AddTraceback("api.deleteTransaction()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		return
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := t.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditTransaction, t.ID, t, nil)
+	})
+	if !e.Empty() {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error', 'There was an unexpected error deleting the transaction from the database'}")
+		e.AddTraceback("api.deleteTransaction()", "Error deleting the transaction "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		return
+	}
+
+	log.Printf("[INFO] api.deleteTransaction(): Transaction with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+// Removes the transaction from it's reconciliations, so it can be changed again
+func (api APIHandler) unreconcileTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/transactions/unreconcile: Method must be POST.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	t := EmptyTransaction()
+	if e := t.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.unreconcileTransaction()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		return UnreconcileTransaction(tx, t.ID)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.unreconcileTransaction()", "Error while un-reconciling transaction: "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error un-reconciling the transaction'}")
+		return
+	}
+
+	t.Reconciled = false
+	api.sendResult(w, t)
+}
+
+/*
+	##############################
+	#                            #
+	#         Statistics         #
+	#                            #
+	##############################
+*/
+
+// Returns all Statistics
+func (api APIHandler) getStatistics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprint(w, "{'error': '/api/statistics: Method must be GET.")
+		return
+	}
+
+	stats, e := GetAllStatistics(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getStatistics()", "Error while getting statistics.")
+		log.Println("[ERROR]", e)
+		fmt.Fprint(w, "{'error': 'Server error while getting the statistics.'}")
+		return
+	}
+
+	// Report the values in the requested currency
+	res := stats.GetArray()
+	if req, ok := api.obj.(Statistic); ok && req.Currency != "" {
+		for i := range res {
+			if e := res[i].ComputeInCurrency(db, req.Currency); !e.Empty() {
+				e.AddTraceback("api.getStatistics()", "Error while computing statistic in "+req.Currency)
+				log.Println("[ERROR]", e)
+				w.WriteHeader(400)
+				fmt.Fprint(w, "{'error': 'Error while computing the statistics in the requested currency.'}")
+				return
+			}
+		}
+	}
+
+	api.sendResult(w, res)
+}
+
+// Returns specific Statistic
+func (api APIHandler) getStatisticByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		fmt.Fprint(w, "{'error': '/api/statistics: Method must be GET.")
+		return
+	}
+	if api.id <= 0 {
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	s := Statistic{}
+	if e := s.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getStatisticByID()", "Error getting Statistic by ID.")
+		log.Println("[WARN]", e)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	// Report the value in the requested currency
+	if req, ok := api.obj.(Statistic); ok && req.Currency != "" {
+		if e := s.ComputeInCurrency(db, req.Currency); !e.Empty() {
+			e.AddTraceback("api.getStatisticByID()", "Error while computing statistic in "+req.Currency)
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, "{'error': 'Error while computing the statistic in the requested currency.'}")
+			return
+		}
+	}
+
+	api.sendResult(w, s)
+}
+
+/*
+	##############################
+	#                            #
+	#       Exchange Rates       #
+	#                            #
+	##############################
+*/
+
+// Returns all exchange rates
+func (api APIHandler) getExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/exchangerates: Method must be GET.'}")
+		return
+	}
+
+	rates, e := GetAllExchangeRates(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getExchangeRates()", "Error while getting exchange rates.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the exchange rates.'}")
+		return
+	}
+
+	api.sendResult(w, rates)
+}
+
+// Returns a specific exchange rate
+func (api APIHandler) getExchangeRateByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/exchangerates: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	er := EmptyExchangeRate()
+	if e := er.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getExchangeRateByID()", "Error getting exchange rate: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, er)
+}
+
+// Creates or updates an exchange rate
+func (api APIHandler) updateExchangeRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/exchangerates/update: Method must be POST.'}")
+		return
+	}
+
+	er := EmptyExchangeRate()
+	if api.id > 0 {
+		if e := er.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateExchangeRate()", "Error while searching exchange rate per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	req := api.obj.(ExchangeRate)
+
+	if req.FromCurrency == "" || req.ToCurrency == "" || req.Rate <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (FromCurrency, ToCurrency, Rate)'}")
+		return
+	}
+
+	er.FromCurrency = req.FromCurrency
+	er.ToCurrency = req.ToCurrency
+	er.Rate = req.Rate
+
+	var emptyTime time.Time
+	if req.RateDate != emptyTime {
+		er.RateDate = req.RateDate
+	}
+
+	var e err.Error
+	if api.id > 0 {
+		e = er.Save(db)
+	} else {
+		e = er.Create(db)
+	}
+	if !e.Empty() {
+		e.AddTraceback("api.updateExchangeRate()", "Error while creating/saving the exchange rate.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'An error occured while saving/creating the exchange rate.'}")
+		return
+	}
+
+	api.sendResult(w, er)
+}
+
+// Deletes an exchange rate with an ID
+func (api APIHandler) deleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/exchangerates/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	er := EmptyExchangeRate()
+	if e := er.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteExchangeRate()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	if e := er.Delete(db); !e.Empty() {
+		e.AddTraceback("api.deleteExchangeRate()", "Error deleting the exchange rate "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the exchange rate from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteExchangeRate(): Exchange rate with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#   Recurring Transactions   #
+	#                            #
+	##############################
+*/
+
+// Returns all recurring transactions
+func (api APIHandler) getRecurringTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/recurring: Method must be GET.'}")
+		return
+	}
+
+	rts, e := GetAllRecurringTransactions(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getRecurringTransactions()", "Error while getting recurring transactions.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the recurring transactions.'}")
+		return
+	}
+
+	api.sendResult(w, rts)
+}
+
+// Returns a specific recurring transaction
+func (api APIHandler) getRecurringTransactionByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/recurring: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rt := EmptyRecurringTransaction()
+	if e := rt.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getRecurringTransactionByID()", "Error getting recurring transaction: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, rt)
+}
+
+// Creates or updates a recurring transaction
+// Dates which are already due get booked right away
+func (api APIHandler) updateRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/recurring/update: Method must be POST.'}")
+		return
+	}
+
+	rt := EmptyRecurringTransaction()
+	if api.id > 0 {
+		if e := rt.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateRecurringTransaction()", "Error while searching recurring transaction per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	req := api.obj.(RecurringTransaction)
+
+	if req.Name == "" || req.Amount <= 0 || req.Schedule == "" {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (Name, Amount, Schedule)'}")
+		return
+	}
+
+	rt.Name = req.Name
+	rt.Description = req.Description
+	rt.Active = req.Active
+	rt.Amount = req.Amount
+	// 0 converts the amount with the exchange rate for cross-currency transactions
+	rt.ToAmount = req.ToAmount
+	rt.FromAccount = req.FromAccount
+	rt.ToAccount = req.ToAccount
+	rt.CategoryID = req.CategoryID
+	rt.TransactionType = req.TransactionType
+	rt.Schedule = req.Schedule
+	// An empty end date repeats the transaction forever
+	rt.EndDate = req.EndDate
+
+	var emptyTime time.Time
+	if req.Day > 0 {
+		rt.Day = req.Day
+	}
+	if req.StartDate != emptyTime {
+		rt.StartDate = req.StartDate
+	}
+
+	var e err.Error
+	if api.id > 0 {
+		e = rt.Save(db)
+	} else {
+		e = rt.Create(db)
+	}
+	if !e.Empty() {
+		e.AddTraceback("api.updateRecurringTransaction()", "Error while creating/saving the recurring transaction.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the recurring transaction: %s'}", e.Error())
+		return
+	}
+
+	if e = BookDueRecurringTransactions(db, time.Now().Local()); !e.Empty() {
+		e.AddTraceback("api.updateRecurringTransaction()", "Error while booking the due recurring transactions.")
+		log.Println("[WARN]", e)
+	}
+	if e = rt.FindByID(db, rt.ID); !e.Empty() {
+		e.AddTraceback("api.updateRecurringTransaction()", "Error while reading the booked recurring transaction.")
+		log.Println("[WARN]", e)
+	}
+
+	api.sendResult(w, rt)
+}
+
+// Deletes a recurring transaction with an ID, the booked transactions are kept
+func (api APIHandler) deleteRecurringTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/recurring/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rt := EmptyRecurringTransaction()
+	if e := rt.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteRecurringTransaction()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	if e := rt.Delete(db); !e.Empty() {
+		e.AddTraceback("api.deleteRecurringTransaction()", "Error deleting the recurring transaction "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the recurring transaction from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteRecurringTransaction(): Recurring transaction with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#      Reconciliations       #
+	#                            #
+	##############################
+*/
+
+// Returns all reconciliations, or the ones of the account if AccountID is part of the request
+func (api APIHandler) getReconciliations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/reconciliations: Method must be GET.'}")
+		return
+	}
+
+	req := api.obj.(Reconciliation)
+
+	recs, e := GetReconciliationsByAccount(db, req.AccountID)
+	if !e.Empty() {
+		e.AddTraceback("api.getReconciliations()", "Error while getting reconciliations.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the reconciliations.'}")
+		return
+	}
+
+	api.sendResult(w, recs)
+}
+
+// Returns a specific reconciliation with the transactions which can be ticked off
+func (api APIHandler) getReconciliationByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/reconciliations: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rec := EmptyReconciliation()
+	if e := rec.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getReconciliationByID()", "Error getting reconciliation: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, rec)
+}
+
+// reconciliationRequest is the body of /api/reconciliations/update
+// ClosingBalance is only changed if it's part of the request, so ticking off transactions keeps it
+type reconciliationRequest struct {
+	ID             int64
+	AccountID      int64
+	StatementDate  time.Time
+	ClosingBalance *Money
+	State          string
+	TransactionIDs []int64
+}
+
+// Creates or updates a reconciliation
+// TransactionIDs are the ticked off transactions, State "done" finishes the reconciliation
+// and State "open" reopens a finished one, which is required before a finished one is changed
+func (api APIHandler) updateReconciliation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/reconciliations/update: Method must be POST.'}")
+		return
+	}
+
+	req := api.obj.(reconciliationRequest)
+
+	rec := EmptyReconciliation()
+	if api.id > 0 {
+		if e := rec.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateReconciliation()", "Error while searching reconciliation per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	} else {
+		if req.AccountID <= 0 {
+			w.WriteHeader(400)
+			fmt.Fprint(w, "{'error': 'At least one required field was empty (AccountID)'}")
+			return
+		}
+		rec.AccountID = req.AccountID
+	}
+
+	var emptyTime time.Time
+	// A finished reconciliation has to be reopened before it's statement or transactions change
+	if rec.State == ReconciliationDone && req.State != ReconciliationOpen {
+		if req.StatementDate != emptyTime || req.ClosingBalance != nil || req.TransactionIDs != nil {
+			w.WriteHeader(400)
+			fmt.Fprint(w, "{'error': 'The reconciliation is finished, set State to open to change it'}")
+			return
+		}
+		api.sendResult(w, rec)
+		return
+	}
+
+	if req.StatementDate != emptyTime {
+		rec.StatementDate = req.StatementDate
+	}
+	if req.ClosingBalance != nil {
+		rec.ClosingBalance = *req.ClosingBalance
+	}
+	if req.TransactionIDs != nil {
+		rec.TransactionIDs = req.TransactionIDs
+	}
+
+	// Create, reopen, save and finish the reconciliation and write the audit entry atomically
+	var before interface{}
+	if rec.ID > 0 {
+		before = auditSnapshot(rec)
+	}
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		action := AuditUpdate
+		if rec.ID == 0 {
+			action = AuditCreate
+			if e := rec.Create(tx); !e.Empty() {
+				return e
+			}
+		} else if rec.State == ReconciliationDone && req.State == ReconciliationOpen {
+			action = AuditReopen
+			if e := rec.Reopen(tx); !e.Empty() {
+				return e
+			}
+		}
+
+		if rec.State == ReconciliationOpen {
+			if e := rec.Save(tx); !e.Empty() {
+				return e
+			}
+		}
+		if req.State == ReconciliationDone && rec.State == ReconciliationOpen {
+			action = AuditClose
+			if e := rec.Finish(tx); !e.Empty() {
+				return e
+			}
+		}
+
+		return LogAudit(tx, apiActor(api.key), action, AuditReconciliation, rec.ID, before, rec)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.updateReconciliation()", "Error while writing the reconciliation.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'An error occured while writing the reconciliation.'}")
+		return
+	}
+
+	api.sendResult(w, rec)
+}
+
+// Deletes a reconciliation with an ID, it's transactions are un-reconciled
+func (api APIHandler) deleteReconciliation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/reconciliations/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rec := EmptyReconciliation()
+	if e := rec.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteReconciliation()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(rec)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := rec.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditReconciliation, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteReconciliation()", "Error deleting the reconciliation "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the reconciliation from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteReconciliation(): Reconciliation with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#       Administration       #
+	#                            #
+	##############################
+*/
+
+// Recalculates the balances from the transactions and reports the inconsistencies of the ledger
+// The issues are only fixed if the request contains {"Fix": true}
+func (api APIHandler) checkLedger(w http.ResponseWriter, r *http.Request) {
+	req := api.obj.(LedgerReport)
+
+	if req.Fix && r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/admin/ledger: Method must be POST for fixing the ledger.'}")
+		return
+	} else if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/admin/ledger: Method must be GET or POST.'}")
+		return
+	}
+
+	report, e := CheckLedger(db, req.Fix, apiActor(api.key))
+	if !e.Empty() {
+		e.AddTraceback("api.checkLedger()", "Error while checking the ledger.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while checking the ledger.'}")
+		return
+	}
+
+	api.sendResult(w, report)
+}
+
+// Returns the audit log, newest entries first
+// {"Model": "transaction", "RecordID": 1} returns the history of a record, only the model the changes of all it's records
+func (api APIHandler) getAuditEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/audit: Method must be GET or POST.'}")
+		return
+	}
+
+	req := api.obj.(AuditEntry)
+
+	entries, e := GetAuditEntries(db, req.Model, api.id, -1)
+	if !e.Empty() {
+		e.AddTraceback("api.getAuditEntries()", "Error while getting the audit log.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while fetching the audit log.'}")
+		return
+	}
+
+	api.sendResult(w, entries)
+}
+
+/*
+	##############################
+	#                            #
+	#           Budgets          #
+	#                            #
+	##############################
+*/
+
+// Returns all budgets with their spending in the current period or the period of PeriodStart
+func (api APIHandler) getBudgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/budgets: Method must be GET.'}")
+		return
+	}
+
+	req := api.obj.(Budget)
+
+	budgets, e := GetAllBudgets(db, false)
+	if !e.Empty() {
+		e.AddTraceback("api.getBudgets()", "Error while getting budgets.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the budgets.'}")
+		return
+	}
+
+	if !req.PeriodStart.IsZero() {
+		for i := range budgets {
+			if e = budgets[i].ComputeForDate(db, req.PeriodStart); !e.Empty() {
+				e.AddTraceback("api.getBudgets()", "Error while computing budget: "+fmt.Sprintf("%d", budgets[i].ID))
+				log.Println("[ERROR]", e)
+				w.WriteHeader(500)
+				fmt.Fprint(w, "{'error': 'Server error while computing the budgets.'}")
+				return
+			}
+		}
+	}
+
+	api.sendResult(w, budgets)
+}
+
+// Returns a specific budget
+func (api APIHandler) getBudgetByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/budgets: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	req := api.obj.(Budget)
+
+	b := EmptyBudget()
+	if e := b.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getBudgetByID()", "Error getting budget: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	if !req.PeriodStart.IsZero() {
+		if e := b.ComputeForDate(db, req.PeriodStart); !e.Empty() {
+			e.AddTraceback("api.getBudgetByID()", "Error while computing budget: "+fmt.Sprintf("%d", api.id))
+			log.Println("[ERROR]", e)
+			w.WriteHeader(500)
+			fmt.Fprint(w, "{'error': 'Server error while computing the budget.'}")
+			return
+		}
+	}
+
+	api.sendResult(w, b)
+}
+
+// budgetRequest is the body of /api/budgets/update
+// Only the fields of the request are changed, pausing a budget keeps it's amount and rollover
+type budgetRequest struct {
+	ID         int64
+	CategoryID *int64
+	Amount     *Money
+	Period     string
+	Rollover   *bool
+	StartDate  time.Time
+	Active     *bool
+}
+
+// Creates or updates a budget
+func (api APIHandler) updateBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/budgets/update: Method must be POST.'}")
+		return
+	}
+
+	b := EmptyBudget()
+	if api.id > 0 {
+		if e := b.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateBudget()", "Error while searching budget per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	req := api.obj.(budgetRequest)
+
+	if req.CategoryID != nil {
+		b.CategoryID = *req.CategoryID
+	}
+	if req.Amount != nil {
+		b.Amount = *req.Amount
+	}
+	if req.Period != "" {
+		b.Period = req.Period
+	}
+	if req.Rollover != nil {
+		b.Rollover = *req.Rollover
+	}
+	if !req.StartDate.IsZero() {
+		b.StartDate = req.StartDate
+	}
+	if req.Active != nil {
+		b.Active = *req.Active
+	}
+
+	if b.CategoryID <= 0 || b.Amount < 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'At least one required field was empty or invalid (CategoryID, Amount)'}")
+		return
+	}
+
+	var e err.Error
+	if api.id > 0 {
+		e = b.Save(db)
+	} else {
+		e = b.Create(db)
+	}
+	if !e.Empty() {
+		e.AddTraceback("api.updateBudget()", "Error while creating/saving the budget.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the budget: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, b)
+}
+
+func (api APIHandler) deleteBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/budgets/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	b := EmptyBudget()
+	if e := b.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteBudget()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	if e := b.Delete(db); !e.Empty() {
+		e.AddTraceback("api.deleteBudget()", "Error deleting the budget "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the budget from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteBudget(): Budget with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#        Savings Goals       #
+	#                            #
+	##############################
+*/
+
+// Returns all savings goals with their progress
+func (api APIHandler) getGoals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/goals: Method must be GET.'}")
+		return
+	}
+
+	goals, e := GetAllGoals(db, false)
+	if !e.Empty() {
+		e.AddTraceback("api.getGoals()", "Error while getting goals.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the goals.'}")
+		return
+	}
+
+	api.sendResult(w, goals)
+}
+
+// Returns a specific savings goal
+func (api APIHandler) getGoalByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/goals: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	g := EmptyGoal()
+	if e := g.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getGoalByID()", "Error getting goal: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, g)
+}
+
+// goalRequest is the body of /api/goals/update
+// Fields which are not part of the request keep their value, moving the deadline keeps the target
+type goalRequest struct {
+	ID           int64
+	Name         string
+	Description  *string
+	TargetAmount *Money
+	Currency     string
+	Deadline     time.Time
+	Active       *bool
+	AccountIDs   []int64
+}
+
+// Creates or updates a savings goal
+// AccountIDs replaces the linked accounts if it's part of the request
+func (api APIHandler) updateGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/goals/update: Method must be POST.'}")
+		return
+	}
+
+	g := EmptyGoal()
+	if api.id > 0 {
+		if e := g.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateGoal()", "Error while searching goal per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	req := api.obj.(goalRequest)
+
+	if req.Name != "" {
+		g.Name = req.Name
+	}
+	if req.Description != nil {
+		g.Description = *req.Description
+	}
+	if req.TargetAmount != nil {
+		g.TargetAmount = *req.TargetAmount
+	}
+	if req.Active != nil {
+		g.Active = *req.Active
+	}
+	if req.Currency != "" {
+		g.Currency = req.Currency
+	}
+	if !req.Deadline.IsZero() {
+		g.Deadline = req.Deadline
+	}
+	if req.AccountIDs != nil {
+		g.AccountIDs = req.AccountIDs
+	}
+
+	if g.Name == "" || g.TargetAmount <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (Name, TargetAmount)'}")
+		return
+	}
+
+	var e err.Error
+	if api.id > 0 {
+		e = withTransaction(db, g.Save)
+	} else {
+		e = withTransaction(db, g.Create)
+	}
+	if !e.Empty() {
+		e.AddTraceback("api.updateGoal()", "Error while creating/saving the goal.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the goal: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, g)
+}
+
+func (api APIHandler) deleteGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/goals/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	g := EmptyGoal()
+	if e := g.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteGoal()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	if e := g.Delete(db); !e.Empty() {
+		e.AddTraceback("api.deleteGoal()", "Error deleting the goal "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the goal from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteGoal(): Goal with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#            Tags            #
+	#                            #
+	##############################
+*/
+
+// Returns all tags which are in use with the number of transactions and their total
+func (api APIHandler) getTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/tags: Method must be GET.'}")
+		return
+	}
+
+	tags, e := GetAllTags(db)
+	if !e.Empty() {
+		e.AddTraceback("APIHandler.getTags()", "Error while getting the tags.")
+		log.Println("[ERROR]", e)
+		fmt.Fprint(w, "{'error': 'Server error while fetching the tags.'}")
+		return
+	}
+
+	api.sendResult(w, tags)
+}
+
+/*
+	##############################
+	#                            #
+	#           Payees           #
+	#                            #
+	##############################
+*/
+
+// Returns all payees with their totals
+// If PeriodStart is given, the amounts between PeriodStart and PeriodEnd (or now) are computed as well
+func (api APIHandler) getPayees(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/payees: Method must be GET.'}")
+		return
+	}
+
+	payees, e := GetAllPayees(db, false)
+	if !e.Empty() {
+		e.AddTraceback("api.getPayees()", "Error while getting payees.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the payees.'}")
+		return
+	}
+
+	if req, ok := api.obj.(Payee); ok && !req.PeriodStart.IsZero() {
+		end := req.PeriodEnd
+		if end.IsZero() {
+			end = time.Now().Local()
+		}
+		for i := range payees {
+			if e = payees[i].ComputeForPeriod(db, req.PeriodStart, end); !e.Empty() {
+				e.AddTraceback("api.getPayees()", "Error while computing payee: "+fmt.Sprintf("%d", payees[i].ID))
+				log.Println("[ERROR]", e)
+				w.WriteHeader(500)
+				fmt.Fprint(w, "{'error': 'Server error while computing the payees.'}")
+				return
+			}
+		}
+	}
+
+	api.sendResult(w, payees)
+}
+
+// Returns a specific payee
+func (api APIHandler) getPayeeByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/payees: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	p := EmptyPayee()
+	if e := p.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getPayeeByID()", "Error getting payee: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, p)
+}
+
+// payeeRequest is the body of /api/payees/update
+// Omitted fields are kept, so renaming a payee doesn't remove it's category or bank details
+type payeeRequest struct {
+	ID         int64
+	Name       string
+	Aliases    []string
+	CategoryID *int64
+	Iban       *string
+	BankCode   *string
+	BankName   *string
+	Active     *bool
+}
+
+// Creates or updates a payee
+// Aliases replaces the aliases if it's part of the request
+func (api APIHandler) updatePayee(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/payees/update: Method must be POST.'}")
+		return
+	}
+
+	p := EmptyPayee()
+	if api.id > 0 {
+		if e := p.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updatePayee()", "Error while searching payee per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	before := auditSnapshot(p)
+	req := api.obj.(payeeRequest)
+
+	if req.Name == "" && api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "{'error': 'The name of the payee is required'}")
+		return
+	}
+
+	if req.Name != "" {
+		p.Name = req.Name
+	}
+	if req.Aliases != nil {
+		p.Aliases = req.Aliases
+	}
+	// A CategoryID of 0 removes the default category
+	if req.CategoryID != nil {
+		p.CategoryID = *req.CategoryID
+	}
+	if req.Iban != nil {
+		p.Iban = *req.Iban
+	}
+	if req.BankCode != nil {
+		p.BankCode = *req.BankCode
+	}
+	if req.BankName != nil {
+		p.BankName = *req.BankName
+	}
+	if req.Active != nil {
+		p.Active = *req.Active
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := p.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditPayee, p.ID, before, p)
+		}
+		if e := p.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditPayee, p.ID, nil, p)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.updatePayee()", "Error while creating/saving the payee.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the payee: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, p)
+}
+
+// Deletes a payee, it's transactions are kept without a payee
+func (api APIHandler) deletePayee(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/payees/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	p := EmptyPayee()
+	if e := p.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deletePayee()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(p)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := p.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditPayee, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deletePayee()", "Error deleting the payee "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the payee from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deletePayee(): Payee with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#         Attachments        #
+	#                            #
+	##############################
+*/
+
+// parseAttachmentPath parses /transactions/{id}/attachments[/{attachmentID}] and the same for accounts
+func parseAttachmentPath(path string) (string, int64, int64, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[2] != "attachments" {
+		return "", 0, 0, false
+	}
+
+	var model string
+	switch parts[0] {
+	case "transactions":
+		model = AuditTransaction
+	case "accounts":
+		model = AuditAccount
+	default:
+		return "", 0, 0, false
+	}
+
+	recordID, e := strconv.ParseInt(parts[1], 10, 64)
+	if e != nil {
+		return "", 0, 0, false
+	}
+
+	var attachmentID int64
+	if len(parts) == 4 {
+		if attachmentID, e = strconv.ParseInt(parts[3], 10, 64); e != nil {
+			return "", 0, 0, false
+		}
+	}
+
+	return model, recordID, attachmentID, true
+}
+
+// handleAttachments lists (GET), uploads (POST) and deletes (DELETE) the attachments of a record
+// GET with an attachment id downloads the file
+// The access rights are the ones of the record, e.g. transaction.read for listing and downloading
+func (api *APIHandler) handleAttachments(w http.ResponseWriter, r *http.Request, model string, recordID, attachmentID int64, body []byte) {
+	var a Attachment
+
+	switch r.Method {
+	case http.MethodGet:
+		if !api.checkAccessRight(w, model+".read") {
+			return
+		}
+	case http.MethodPost:
+		if !api.checkAccessRight(w, model+".write") {
+			return
+		}
+	case http.MethodDelete:
+		if !api.checkAccessRight(w, model+".delete") {
+			return
+		}
+	default:
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': 'Method must be GET, POST or DELETE.'}")
+		return
+	}
+
+	// The attachment has to belong to the record of the path
+	if attachmentID > 0 {
+		var e err.Error
+		if a, e = FindAttachmentByID(db, attachmentID); !e.Empty() {
+			e.AddTraceback("api.handleAttachments()", "Error while finding attachment: "+fmt.Sprintf("%d", attachmentID))
+			log.Println("[WARN]", e)
+			w.WriteHeader(404)
+			fmt.Fprint(w, errorGetID)
+			return
+		} else if (model == AuditTransaction && a.TransactionID != recordID) || (model == AuditAccount && a.AccountID != recordID) {
+			w.WriteHeader(404)
+			fmt.Fprint(w, "{'error': 'The attachment does not belong to this record.'}")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && attachmentID > 0:
+		serveAttachment(w, r, a)
+	case r.Method == http.MethodGet:
+		attachments, e := GetAttachments(db, model, recordID)
+		if !e.Empty() {
+			e.AddTraceback("api.handleAttachments()", "Error while getting the attachments.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(500)
+			fmt.Fprint(w, "{'error': 'Server error while getting the attachments.'}")
+			return
+		}
+		api.sendResult(w, attachments)
+	case r.Method == http.MethodPost:
+		// The body was already read if it's length was known, the multipart form is parsed from it
+		if len(body) > 0 {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+		if e := r.ParseMultipartForm(1 << 20); e != nil {
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': 'Please upload the file as multipart/form-data with the field file: %s'}", e)
+			return
+		}
+		file, header, e := r.FormFile("file")
+		if e != nil {
+			w.WriteHeader(400)
+			fmt.Fprint(w, "{'error': 'Please upload the file as multipart/form-data with the field file.'}")
+			return
+		}
+		defer file.Close()
+
+		a = EmptyAttachment()
+		a.FileName = header.Filename
+		a.ContentType = header.Header.Get("Content-Type")
+		if model == AuditTransaction {
+			a.TransactionID = recordID
+		} else {
+			a.AccountID = recordID
+		}
+
+		if err := a.Create(db, file); !err.Empty() {
+			a.removeUnusedFile(db)
+			err.AddTraceback("api.handleAttachments()", "Error while creating the attachment.")
+			log.Println("[ERROR]", err)
+			w.WriteHeader(400)
+			fmt.Fprintf(w, "{'error': 'An error occured while uploading the attachment: %s'}", err.Error())
+			return
+		}
+		api.sendResult(w, a)
+	case r.Method == http.MethodDelete && attachmentID > 0:
+		if err := a.Delete(db); !err.Empty() {
+			err.AddTraceback("api.handleAttachments()", "Error deleting the attachment "+fmt.Sprintf("%d", attachmentID))
+			log.Println("[ERROR]", err)
+			w.WriteHeader(500)
+			fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the attachment from the database'}")
+			return
+		}
+		a.removeUnusedFile(db)
+
+		log.Printf("[INFO] api.handleAttachments(): Attachment with ID %d was successfully deleted.\n", attachmentID)
+		fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", attachmentID)
+	default:
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+	}
+}
+
+/*
+	##############################
+	#                            #
+	#            Rules           #
+	#                            #
+	##############################
+*/
+
+// ruleApplyRequest is the body of /api/rules/apply
+type ruleApplyRequest struct {
+	DryRun bool
+}
+
+// Returns all rules in the order they are applied
+func (api APIHandler) getRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/rules: Method must be GET.'}")
+		return
+	}
+
+	rules, e := GetAllRules(db, false)
+	if !e.Empty() {
+		e.AddTraceback("api.getRules()", "Error while getting rules.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the rules.'}")
+		return
+	}
+
+	api.sendResult(w, rules)
+}
+
+// Returns a specific rule
+func (api APIHandler) getRuleByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/rules: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rule := EmptyRule()
+	if e := rule.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getRuleByID()", "Error getting rule: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, rule)
+}
+
+// ruleRequest is the body of /api/rules/update
+// Conditions which are not part of the request are kept, a MinAmount, MaxAmount or AccountID of 0 removes the condition
+type ruleRequest struct {
+	ID           int64
+	Name         string
+	Sequence     *int64
+	NameContains *string
+	MinAmount    *Money
+	MaxAmount    *Money
+	AccountID    *int64
+	CategoryID   *int64
+	Tags         []string
+	Active       *bool
+}
+
+// Creates or updates a rule
+// Tags replaces the tags of the rule if it's part of the request
+func (api APIHandler) updateRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/rules/update: Method must be POST.'}")
+		return
+	}
+
+	rule := EmptyRule()
+	if api.id > 0 {
+		if e := rule.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateRule()", "Error while searching rule per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	before := auditSnapshot(rule)
+	req := api.obj.(ruleRequest)
+
+	if req.Name != "" {
+		rule.Name = req.Name
+	}
+	if req.Sequence != nil {
+		rule.Sequence = *req.Sequence
+	}
+	if req.NameContains != nil {
+		rule.NameContains = *req.NameContains
+	}
+	if req.MinAmount != nil {
+		rule.MinAmount = *req.MinAmount
+	}
+	if req.MaxAmount != nil {
+		rule.MaxAmount = *req.MaxAmount
+	}
+	if req.AccountID != nil {
+		rule.AccountID = *req.AccountID
+	}
+	if req.CategoryID != nil {
+		rule.CategoryID = *req.CategoryID
+	}
+	if req.Tags != nil {
+		rule.Tags = req.Tags
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := rule.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditRule, rule.ID, before, rule)
+		}
+		if e := rule.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditRule, rule.ID, nil, rule)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.updateRule()", "Error while creating/saving the rule.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the rule: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, rule)
+}
+
+// Deletes a rule, the transactions it categorised keep their category and tags
+func (api APIHandler) deleteRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/rules/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	rule := EmptyRule()
+	if e := rule.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteRule()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(rule)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := rule.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditRule, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteRule()", "Error deleting the rule "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the rule from the database'}")
+		return
+	}
+
+	log.Printf("[INFO] api.deleteRule(): Rule with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+// Runs the active rules over the transactions without a category and without splits
+// Returns the changed transactions, with DryRun nothing is saved
+func (api APIHandler) applyRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/rules/apply: Method must be POST.'}")
+		return
+	}
+
+	req := api.obj.(ruleApplyRequest)
+	var matches []RuleMatch
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		var runErr err.Error
+		matches, runErr = ApplyRules(tx, apiActor(api.key), req.DryRun)
+		return runErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.applyRules()", "Error while applying the rules.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprintf(w, "{'error': 'An error occured while applying the rules: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, matches)
+}
+
+/*
+	##############################
+	#                            #
+	#         Investments        #
+	#                            #
+	##############################
+*/
+
+// priceImportRequest is the body of /api/securities/prices/import
+// CSV has the same format as the price files of the investments page
+type priceImportRequest struct {
+	CSV string
+}
+
+// Returns all securities with their latest price
+func (api APIHandler) getSecurities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/securities: Method must be GET.'}")
+		return
+	}
+
+	securities, e := GetAllSecurities(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getSecurities()", "Error while getting securities.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the securities.'}")
+		return
+	}
+
+	api.sendResult(w, securities)
+}
+
+// Returns a specific security
+func (api APIHandler) getSecurityByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/securities: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	s := EmptySecurity()
+	if e := s.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getSecurityByID()", "Error getting security: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, s)
+}
+
+// Creates or updates a security
+func (api APIHandler) updateSecurity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/securities/update: Method must be POST.'}")
+		return
+	}
+
+	s := EmptySecurity()
+	if api.id > 0 {
+		if e := s.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateSecurity()", "Error while searching security per ID.")
+			log.Println("[ERROR]", e)
+			w.WriteHeader(400)
+			fmt.Fprint(w, errorGetID)
+			return
+		}
+	}
+
+	before := auditSnapshot(s)
+	req := api.obj.(Security)
+
+	s.Name = req.Name
+	s.Symbol = req.Symbol
+	s.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := s.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditSecurity, s.ID, before, s)
+		}
+		if e := s.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditSecurity, s.ID, nil, s)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.updateSecurity()", "Error while creating/saving the security.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the security: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, s)
+}
+
+// Deletes a security with it's prices, securities with trades can't be deleted
+func (api APIHandler) deleteSecurity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/securities/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	s := EmptySecurity()
+	if e := s.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteSecurity()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(s)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := s.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditSecurity, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteSecurity()", "Error deleting the security "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'The security could not be deleted: %s'}", e.Error())
+		return
+	}
+
+	log.Printf("[INFO] api.deleteSecurity(): Security with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+// Imports the prices of the CSV and returns the number of imported and the skipped lines
+func (api APIHandler) importPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/securities/prices/import: Method must be POST.'}")
+		return
+	}
+
+	req := api.obj.(priceImportRequest)
+	var result PriceImport
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		var importErr err.Error
+		result, importErr = ImportPrices(tx, strings.NewReader(req.CSV))
+		return importErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.importPrices()", "Error while importing the prices.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while importing the prices: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, result)
+}
+
+// Returns the trades of the AccountID in the request, or of all accounts
+func (api APIHandler) getTrades(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/trades: Method must be GET.'}")
+		return
+	}
+
+	req := api.obj.(Trade)
+
+	trades, e := GetTradesByAccount(db, req.AccountID)
+	if !e.Empty() {
+		e.AddTraceback("api.getTrades()", "Error while getting trades.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the trades.'}")
+		return
+	}
+
+	api.sendResult(w, trades)
+}
+
+// Returns a specific trade
+func (api APIHandler) getTradeByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/trades: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	t, e := FindTradeByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.getTradeByID()", "Error getting trade: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, t)
+}
+
+// Creates a trade, trades can't be updated
+// TradeDate defaults to today
+func (api APIHandler) createTrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/trades/create: Method must be POST.'}")
+		return
+	}
+
+	t := api.obj.(Trade)
+	t.ID = 0
+	if t.TradeDate.IsZero() {
+		t.TradeDate = time.Now().Local()
+	}
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := t.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditTrade, t.ID, nil, t)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.createTrade()", "Error while creating the trade.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while creating the trade: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, t)
+}
+
+// Deletes a trade with it's journal entry, the cost basis of the other trades is recomputed
+func (api APIHandler) deleteTrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/trades/delete: Method must be DELETE.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	t, e := FindTradeByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.deleteTrade()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	before := auditSnapshot(t)
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := t.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditTrade, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteTrade()", "Error deleting the trade "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'The trade could not be deleted: %s'}", e.Error())
+		return
+	}
+
+	log.Printf("[INFO] api.deleteTrade(): Trade with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
+}
+
+// Returns the holdings of the AccountID in the request, or of all accounts
+func (api APIHandler) getHoldings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/holdings: Method must be GET.'}")
+		return
+	}
+
+	holdings, e := GetHoldings(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.getHoldings()", "Error while getting holdings.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the holdings.'}")
+		return
+	}
+
+	api.sendResult(w, holdings)
+}
+
+/*
+	##############################
+	#                            #
+	#       Closed Periods       #
+	#                            #
+	##############################
+*/
+
+// closePeriodRequest is the body of /api/periods/close
+// The month or year (PeriodType) which contains the Date is closed
+type closePeriodRequest struct {
+	PeriodType string
+	Date       time.Time
+}
+
+// Returns all closed periods with the balances of the accounts
+func (api APIHandler) getPeriods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/periods: Method must be GET.'}")
+		return
+	}
+
+	periods, e := GetAllPeriods(db)
+	if !e.Empty() {
+		e.AddTraceback("api.getPeriods()", "Error while getting periods.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the periods.'}")
+		return
+	}
+
+	api.sendResult(w, periods)
+}
+
+// Returns a specific closed period
+func (api APIHandler) getPeriodByID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/periods: Method must be GET.'}")
+		return
+	}
+	if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	p, e := FindPeriodByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.getPeriodByID()", "Error getting period: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	api.sendResult(w, p)
+}
+
+// Closes a period and returns it with the balances of the accounts
+func (api APIHandler) closePeriod(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/periods/close: Method must be POST.'}")
+		return
+	}
+
+	req := api.obj.(closePeriodRequest)
+	var p Period
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		var closeErr err.Error
+		p, closeErr = ClosePeriod(tx, apiActor(api.key), req.PeriodType, req.Date)
+		return closeErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.closePeriod()", "Error while closing the period.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'The period could not be closed: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, p)
+}
+
+// Reopens a closed period, the transactions dated in it can be changed again
+func (api APIHandler) reopenPeriod(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/admin/periods/reopen: Method must be POST.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	p, e := FindPeriodByID(db, api.id)
+	if !e.Empty() {
+		e.AddTraceback("api.reopenPeriod()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		return p.Reopen(tx, apiActor(api.key))
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.reopenPeriod()", "Error while reopening the period "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error reopening the period'}")
+		return
+	}
+
+	log.Printf("[INFO] api.reopenPeriod(): Period with ID %d was successfully reopened.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The period with the id %d was successfully reopened.'}", api.id)
+}
+
+/*
+	##############################
+	#                            #
+	#      Income Schedules      #
 	#                            #
 	##############################
 */
 
-// Gives back all accounts
-func (api APIHandler) getAccounts(w http.ResponseWriter, r *http.Request) {
+// Returns all income schedules with their next payday
+func (api APIHandler) getIncomeSchedules(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/accounts/: Method must be GET.'}")
+		fmt.Fprint(w, "{'error': '/api/income: Method must be GET.'}")
 		return
 	}
 
-	acc, e := GetAllAccounts(db)
+	schedules, e := GetAllIncomeSchedules(db)
 	if !e.Empty() {
-		e.AddTraceback("APIHandler.getAccount()", "Error while getting accounts")
+		e.AddTraceback("api.getIncomeSchedules()", "Error while getting income schedules.")
 		log.Println("[ERROR]", e)
-		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the income schedules.'}")
 		return
 	}
 
-	api.sendResult(w, acc)
+	api.sendResult(w, schedules)
 }
 
-// Returns a specific account with the given id
-func (api APIHandler) getAccountByID(w http.ResponseWriter, r *http.Request) {
+// Returns a specific income schedule
+func (api APIHandler) getIncomeScheduleByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/accounts/: Method must be GET.'}")
+		fmt.Fprint(w, "{'error': '/api/income: Method must be GET.'}")
 		return
 	}
 	if api.id <= 0 {
@@ -543,254 +4207,322 @@ func (api APIHandler) getAccountByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acc := EmptyAccount()
-	if err := acc.FindByID(db, api.id); !err.Empty() {
-		err.AddTraceback("APIHandler.getAccountByID", "Error while getting account: "+fmt.Sprintf("%d", api.id))
-		log.Println("[ERROR]", err)
-
+	s := EmptyIncomeSchedule()
+	if e := s.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getIncomeScheduleByID()", "Error getting income schedule: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
 		w.WriteHeader(400)
 		fmt.Fprint(w, errorGetID)
 		return
 	}
 
-	api.sendResult(w, acc)
+	api.sendResult(w, s)
 }
 
-func (api APIHandler) updateAccount(w http.ResponseWriter, r *http.Request) {
+// incomeScheduleRequest is the body of /api/income/update
+// Only the fields of the request are changed, an empty Frequency or WeekendRule keeps the current one
+type incomeScheduleRequest struct {
+	ID          int64
+	Name        string
+	Active      *bool
+	Frequency   string
+	AnchorDate  time.Time
+	WeekendRule string
+	Default     *bool
+}
+
+// Creates or updates an income schedule
+// The AnchorDate is kept if it's not part of the request
+func (api APIHandler) updateIncomeSchedule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/categories/create: Method must be POST.'}")
+		fmt.Fprint(w, "{'error': '/api/income/update: Method must be POST.'}")
 		return
 	}
 
-	acc := EmptyAccount()
-
+	s := EmptyIncomeSchedule()
 	if api.id > 0 {
-		if err := acc.FindByID(db, api.id); !err.Empty() {
-			err.AddTraceback("APIHandler.updateAccount()", "Error while getting account:"+fmt.Sprintf("%d", api.id))
-			log.Println("[ERROR]", err)
+		if e := s.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateIncomeSchedule()", "Error while searching income schedule per ID.")
+			log.Println("[ERROR]", e)
 			w.WriteHeader(400)
 			fmt.Fprint(w, errorGetID)
 			return
 		}
-	} else {
-		acc.CreateDate = time.Now()
-		acc.Active = true
 	}
 
-	reqData := api.obj.(Account)
+	before := auditSnapshot(s)
+	req := api.obj.(incomeScheduleRequest)
 
-	// Validate user input
-	if acc.ID == 0 && reqData.Name == "" && reqData.Balance == 0.0 {
+	if req.Name == "" && api.id <= 0 {
 		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error': 'Please provide a name and balance for creating a category.'}")
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (Name)'}")
 		return
 	}
 
-	// Set fields which are not empty
-	if reqData.Name != "" {
-		acc.Name = reqData.Name
-	}
-	if reqData.Balance != 0.0 {
-		acc.Balance = reqData.Balance
+	if req.Name != "" {
+		s.Name = req.Name
 	}
-	if reqData.Iban != "" {
-		acc.Iban = reqData.Iban
+	if req.Active != nil {
+		s.Active = *req.Active
 	}
-	if reqData.BankCode != "" {
-		acc.BankCode = reqData.BankCode
+	if req.Default != nil {
+		s.Default = *req.Default
 	}
-	if reqData.AccountNr != "" {
-		acc.AccountNr = reqData.AccountNr
+	if req.Frequency != "" {
+		s.Frequency = req.Frequency
 	}
-	if reqData.BankName != "" {
-		acc.BankName = reqData.BankName
+	if req.WeekendRule != "" {
+		s.WeekendRule = req.WeekendRule
 	}
-	if reqData.BankType != "" {
-		acc.BankType = reqData.BankType
+	if !req.AnchorDate.IsZero() {
+		s.AnchorDate = req.AnchorDate
 	}
 
-	acc.LastUpdate = time.Now()
-
-	var e err.Error
-	if acc.ID <= 0 {
-		e = acc.Create(db)
-	} else {
-		e = acc.Save(db)
-	}
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := s.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditIncome, s.ID, before, s)
+		}
+		if e := s.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditIncome, s.ID, nil, s)
+	})
 	if !e.Empty() {
-		e.AddTraceback("APIHandler.updateAccount()", "Error while writing account to the database.")
+		e.AddTraceback("api.updateIncomeSchedule()", "Error while creating/saving the income schedule.")
 		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the income schedule: %s'}", e.Error())
 		return
 	}
 
-	api.sendResult(w, acc)
+	api.sendResult(w, s)
 }
 
-// deletes an account with an ID
-func (api APIHandler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+// deletes an income schedule, it's accounts and groups use the default schedule afterwards
+func (api APIHandler) deleteIncomeSchedule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error': '/api/accounts/delete: Method must be DELETE.'}")
+		fmt.Fprint(w, "{'error': '/api/income/delete: Method must be DELETE.'}")
 		return
-	}
-	if api.id <= 0 {
+	} else if api.id <= 0 {
 		w.WriteHeader(400)
-		fmt.Fprintln(w, errorID)
+		fmt.Fprint(w, errorID)
 		return
 	}
 
-	a, err := FindAccountByID(db, api.id)
-	if !err.Empty() {
-		err.AddTraceback("APIHandler.deleteAccount()", "Error getting account: "+fmt.Sprintf("%d", api.id))
-		log.Println("[WARN]", err)
+	s := EmptyIncomeSchedule()
+	if e := s.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteIncomeSchedule()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
 		w.WriteHeader(400)
-		fmt.Fprintln(w, "{'error': 'There was an error finding the record in the database.'}")
-		return
-	}
-
-	if a.TransactionCount > 0 {
-		w.WriteHeader(403)
-		fmt.Fprintln(w, "{'error': 'You cannot delete this record because it has transactions referenced to it'}")
+		fmt.Fprint(w, errorGetID)
 		return
 	}
 
-	if err := a.Delete(db); !err.Empty() {
-		err.AddTraceback("APIHandler.deleteAccount()", "Error while deleting account.")
-		log.Println("[ERROR]", err)
+	before := auditSnapshot(s)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := s.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditIncome, api.id, before, nil)
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.deleteIncomeSchedule()", "Error deleting the income schedule "+fmt.Sprintf("%d", api.id))
+		log.Println("[ERROR]", e)
 		w.WriteHeader(500)
-		fmt.Fprintf(w, "{'error': 'There was an error deleting the record from the database.'}")
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the income schedule from the database'}")
 		return
 	}
 
-	log.Printf("[INFO] api.deleteAccount(): Account with ID %d was successfully deleted.\n", api.id)
+	log.Printf("[INFO] api.deleteIncomeSchedule(): Income schedule with ID %d was successfully deleted.\n", api.id)
 	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
 }
 
 /*
 	##############################
 	#                            #
-	#        Transactions        #
+	#           Import           #
 	#                            #
 	##############################
 */
 
-// Returns all transactions
-func (api APIHandler) getTransactions(w http.ResponseWriter, r *http.Request) {
+// importRequest is the body of /api/import
+// CSV is the statement in the format of the mapping, AccountID is the account of the mapping if it's 0
+// With DryRun the lines are only previewed, otherwise the Lines with these numbers are booked,
+// or all lines which are neither invalid nor duplicates if there are none
+type importRequest struct {
+	MappingID int64
+	AccountID int64
+	CSV       string
+	DryRun    bool
+	Lines     []int
+}
+
+// Previews or books the transactions of a statement and returns the lines
+func (api APIHandler) importStatement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/import: Method must be POST.'}")
+		return
+	} else if api.id <= 0 {
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorID)
+		return
+	}
+
+	req := api.obj.(importRequest)
+
+	m := EmptyImportMapping()
+	if e := m.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.importStatement()", "Error while finding import mapping: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
+		fmt.Fprint(w, errorGetID)
+		return
+	}
+	if req.AccountID == 0 {
+		req.AccountID = m.AccountID
+	}
+
+	var lines []ImportLine
+
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		var importErr err.Error
+		if lines, importErr = ParseImport(tx, m, req.AccountID, strings.NewReader(req.CSV)); !importErr.Empty() || req.DryRun {
+			return importErr
+		}
+		lines, importErr = BookImport(tx, apiActor(api.key), lines, req.Lines)
+		return importErr
+	})
+	if !e.Empty() {
+		e.AddTraceback("api.importStatement()", "Error while importing the statement.")
+		log.Println("[ERROR]", e)
+		w.WriteHeader(400)
+		fmt.Fprintf(w, "{'error': 'An error occured while importing the statement: %s'}", e.Error())
+		return
+	}
+
+	api.sendResult(w, lines)
+}
+
+// Returns all import mappings
+func (api APIHandler) getImportMappings(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		fmt.Fprint(w, "{'error': '/api/transactions/: Method must be GET.'}")
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/import/mappings: Method must be GET.'}")
 		return
 	}
 
-	acc, e := GetLatestTransactions(db, -1)
+	mappings, e := GetAllImportMappings(db)
 	if !e.Empty() {
-		e.AddTraceback("APIHandler.getTransactions()", "Error while getting transactions")
+		e.AddTraceback("api.getImportMappings()", "Error while getting import mappings.")
 		log.Println("[ERROR]", e)
-		fmt.Fprint(w, "{'error': 'Server error while fetching accounts.'}")
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'Server error while getting the import mappings.'}")
 		return
 	}
 
-	api.sendResult(w, acc)
+	api.sendResult(w, mappings)
 }
 
-// Returns a specific transaction with the given id
-func (api APIHandler) getTransactionByID(w http.ResponseWriter, r *http.Request) {
+// Returns a specific import mapping
+func (api APIHandler) getImportMappingByID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		fmt.Fprint(w, "{'error': '/api/transactions/: Method must be GET.'}")
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/import/mappings: Method must be GET.'}")
 		return
 	}
 	if api.id <= 0 {
+		w.WriteHeader(400)
 		fmt.Fprint(w, errorID)
 		return
 	}
 
-	t := EmptyTransaction()
-	if err := t.FindByID(db, api.id); !err.Empty() {
-		err.AddTraceback("APIHandler.getTransactionByID", "Error while getting transaction: "+fmt.Sprintf("%d", api.id))
-		log.Println("[WARN]", err)
+	m := EmptyImportMapping()
+	if e := m.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.getImportMappingByID()", "Error getting import mapping: "+fmt.Sprintf("%d", api.id))
+		log.Println("[WARN]", e)
+		w.WriteHeader(400)
 		fmt.Fprint(w, errorGetID)
 		return
 	}
 
-	api.sendResult(w, t)
+	api.sendResult(w, m)
 }
 
-func (api APIHandler) updateTransaction(w http.ResponseWriter, r *http.Request) {
+// Creates or updates an import mapping
+func (api APIHandler) updateImportMapping(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error': '/api/transactions/update: Method must be POST.'}")
+		w.WriteHeader(405)
+		fmt.Fprint(w, "{'error': '/api/import/mappings/update: Method must be POST.'}")
 		return
 	}
 
-	t := EmptyTransaction()
+	m := EmptyImportMapping()
 	if api.id > 0 {
-		if e := t.FindByID(db, api.id); !e.Empty() {
-			e.AddTraceback("api.updateTransaction()", "Error while searching transaction per ID.")
+		if e := m.FindByID(db, api.id); !e.Empty() {
+			e.AddTraceback("api.updateImportMapping()", "Error while searching import mapping per ID.")
 			log.Println("[ERROR]", e)
 			w.WriteHeader(400)
-			fmt.Fprintf(w, errorGetID)
+			fmt.Fprint(w, errorGetID)
 			return
 		}
-	} else {
-		t.CreateDate = time.Now()
-		t.LastUpdate = time.Now()
 	}
 
-	req := api.obj.(Transaction)
+	before := auditSnapshot(m)
+	req := api.obj.(ImportMapping)
 
-	if req.Name == "" || req.Amount <= 0 || (req.FromAccount <= 0 && req.ToAccount <= 0) {
+	if req.Name == "" {
 		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error', 'At least one required field was empty (Name, Amount) or both accounts were 0'}")
+		fmt.Fprint(w, "{'error': 'At least one required field was empty (Name)'}")
 		return
 	}
 
-	t.Name = req.Name
-	t.Amount = req.Amount
-	t.Active = req.Active
-
-	var emptyTime time.Time
-
-	if req.Description != "" {
-		t.Description = req.Description
-	}
-	if req.TransactionDate != emptyTime {
-		t.TransactionDate = req.TransactionDate
-	}
-	if req.TransactionType != "" {
-		t.TransactionType = req.TransactionType
-	}
-	if req.CategoryID >= 0 {
-		t.CategoryID = req.CategoryID
-	}
-	if req.FromAccount >= 0 {
-		t.FromAccount = req.FromAccount
-	}
-	if req.ToAccount >= 0 {
-		t.ToAccount = req.ToAccount
-	}
-
-	t.LastUpdate = time.Now()
+	m.Name = req.Name
+	m.Delimiter = req.Delimiter
+	m.SkipLines = req.SkipLines
+	m.DateFormat = req.DateFormat
+	m.DecimalSeparator = req.DecimalSeparator
+	m.DateColumn = req.DateColumn
+	m.AmountColumn = req.AmountColumn
+	m.NameColumn = req.NameColumn
+	m.CounterpartyColumn = req.CounterpartyColumn
+	m.IbanColumn = req.IbanColumn
+	m.DescriptionColumn = req.DescriptionColumn
+	m.AccountID = req.AccountID
 
-	var e err.Error
-	if api.id > 0 {
-		e = t.Save(db)
-	} else {
-		e = t.Create(db)
-	}
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if api.id > 0 {
+			if e := m.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, apiActor(api.key), AuditUpdate, AuditImport, m.ID, before, m)
+		}
+		if e := m.Create(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditCreate, AuditImport, m.ID, nil, m)
+	})
 	if !e.Empty() {
+		e.AddTraceback("api.updateImportMapping()", "Error while creating/saving the import mapping.")
+		log.Println("[ERROR]", e)
 		w.WriteHeader(400)
-		fmt.Println("{'error': 'An error occured while saving/creating the transaction.'}")
-		e.AddTraceback("api.updateTransaction()", "Error while creating/saving the transaction.")
+		fmt.Fprintf(w, "{'error': 'An error occured while saving/creating the import mapping: %s'}", e.Error())
 		return
 	}
 
-	api.sendResult(w, t)
+	api.sendResult(w, m)
 }
 
-func (api APIHandler) deleteTransaction(w http.ResponseWriter, r *http.Request) {
+// deletes an import mapping, the imported transactions are kept
+func (api APIHandler) deleteImportMapping(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		w.WriteHeader(405)
-		fmt.Fprint(w, "{'error', '/api/transactions/delete: Method must be DELETE.'}")
+		fmt.Fprint(w, "{'error': '/api/import/mappings/delete: Method must be DELETE.'}")
 		return
 	} else if api.id <= 0 {
 		w.WriteHeader(400)
@@ -798,73 +4530,30 @@ func (api APIHandler) deleteTransaction(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Validate that the ID is existing in the database
-	t := Transaction{}
-
-	if e := t.FindByID(db, api.id); !e.Empty() {
-		w.WriteHeader(400)
-		fmt.Fprint(w, errorGetID)
-		e.AddTraceback("api.deleteTransaction()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
+	m := EmptyImportMapping()
+	if e := m.FindByID(db, api.id); !e.Empty() {
+		e.AddTraceback("api.deleteImportMapping()", "Error while finding record by ID: "+fmt.Sprintf("%d", api.id))
 		log.Println("[WARN]", e)
-		return
-	}
-
-	if e := t.Delete(db); !e.Empty() {
 		w.WriteHeader(400)
-		fmt.Fprint(w, "{'error', 'There was an unexpected error deleting the transaction from the database'}")
-		e.AddTraceback("api.deleteTransaction()", "Error deleting the transaction "+fmt.Sprintf("%d", api.id))
-		log.Println("[ERROR]", e)
-		return
-	}
-
-	log.Printf("[INFO] api.deleteTransaction(): Transaction with ID %d was successfully deleted.\n", api.id)
-	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
-}
-
-/*
-	##############################
-	#                            #
-	#         Statistics         #
-	#                            #
-	##############################
-*/
-
-// Returns all Statistics
-func (api APIHandler) getStatistics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		fmt.Fprint(w, "{'error': '/api/statistics: Method must be GET.")
+		fmt.Fprint(w, errorGetID)
 		return
 	}
 
-	stats, e := GetAllStatistics(db)
+	before := auditSnapshot(m)
+	e := withTransaction(db, func(tx *sql.Tx) err.Error {
+		if e := m.Delete(tx); !e.Empty() {
+			return e
+		}
+		return LogAudit(tx, apiActor(api.key), AuditDelete, AuditImport, api.id, before, nil)
+	})
 	if !e.Empty() {
-		e.AddTraceback("api.getStatistics()", "Error while getting statistics.")
+		e.AddTraceback("api.deleteImportMapping()", "Error deleting the import mapping "+fmt.Sprintf("%d", api.id))
 		log.Println("[ERROR]", e)
-		fmt.Fprint(w, "{'error': 'Server error while getting the statistics.'}")
-		return
-	}
-
-	api.sendResult(w, stats.GetArray())
-}
-
-// Returns specific Statistic
-func (api APIHandler) getStatisticByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		fmt.Fprint(w, "{'error': '/api/statistics: Method must be GET.")
-		return
-	}
-	if api.id <= 0 {
-		fmt.Fprint(w, errorID)
-		return
-	}
-
-	s := Statistic{}
-	if e := s.FindByID(db, api.id); !e.Empty() {
-		e.AddTraceback("api.getStatisticByID()", "Error getting Statistic by ID.")
-		log.Println("[WARN]", e)
-		fmt.Fprint(w, errorGetID)
+		w.WriteHeader(500)
+		fmt.Fprint(w, "{'error': 'There was an unexpected error deleting the import mapping from the database'}")
 		return
 	}
 
-	api.sendResult(w, s)
+	log.Printf("[INFO] api.deleteImportMapping(): Import mapping with ID %d was successfully deleted.\n", api.id)
+	fmt.Fprintf(w, "{'success': 'The record with the id %d was successfully deleted.'}", api.id)
 }
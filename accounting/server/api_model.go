@@ -2,7 +2,6 @@ package main
 
 import (
 	"crypto/sha256"
-	"database/sql"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -46,6 +45,42 @@ func GetAllAccessRights() []string {
 		"category.read",
 		"category.write",
 		"category.delete",
+		"exchangerate.read",
+		"exchangerate.write",
+		"exchangerate.delete",
+		"recurring.read",
+		"recurring.write",
+		"recurring.delete",
+		"reconciliation.read",
+		"reconciliation.write",
+		"reconciliation.delete",
+		"ledger.read",
+		"ledger.write",
+		"audit.read",
+		"budget.read",
+		"budget.write",
+		"budget.delete",
+		"goal.read",
+		"goal.write",
+		"goal.delete",
+		"payee.read",
+		"payee.write",
+		"payee.delete",
+		"rule.read",
+		"rule.write",
+		"rule.delete",
+		"investment.read",
+		"investment.write",
+		"investment.delete",
+		"period.read",
+		"period.write",
+		"period.reopen",
+		"income.read",
+		"income.write",
+		"income.delete",
+		"import.read",
+		"import.write",
+		"import.delete",
 	}
 }
 
@@ -109,7 +144,7 @@ func (a *API) compute() {
 }
 
 // Create the current instance in the database
-func (a *API) Create(cr *sql.DB) err.Error {
+func (a *API) Create(cr Cursor) err.Error {
 	if a.ID > 0 {
 		var e err.Error
 		e.Init("API.Create()", "This object already has an ID.")
@@ -150,7 +185,7 @@ func (a *API) Create(cr *sql.DB) err.Error {
 }
 
 // Save the current instance in the database
-func (a *API) Save(cr *sql.DB) err.Error {
+func (a *API) Save(cr Cursor) err.Error {
 	if a.ID <= 0 {
 		var e err.Error
 		e.Init("API.Save()", "ID must be bigger than 0. ("+string(a.ID)+")")
@@ -228,7 +263,7 @@ func (a *API) GenerateAPIKey() string {
 }
 
 // FindByPrefix takes the given prefix and returns the corresponding API record
-func (a *API) FindByPrefix(cr *sql.DB, prefix string) err.Error {
+func (a *API) FindByPrefix(cr Cursor, prefix string) err.Error {
 	query := "SELECT id,active,name,create_date,last_update,last_use,api_key,api_prefix,local_key,access_rights"
 	query += " FROM api WHERE api_prefix=$1;"
 
@@ -258,7 +293,7 @@ func (a *API) FindByPrefix(cr *sql.DB, prefix string) err.Error {
 }
 
 // FindByID takes the given ID and returns the corresponding API record
-func (a *API) FindByID(cr *sql.DB, id int64) err.Error {
+func (a *API) FindByID(cr Cursor, id int64) err.Error {
 	query := "SELECT id,active,name,create_date,last_update,last_use,api_key,api_prefix,local_key,access_rights"
 	query += " FROM api WHERE id=$1;"
 
@@ -293,7 +328,7 @@ func (a *API) FormatAccessRights() string {
 }
 
 // GetLocalAPIKeys returns all local API Keys
-func GetLocalAPIKeys(cr *sql.DB) ([]API, err.Error) {
+func GetLocalAPIKeys(cr Cursor) ([]API, err.Error) {
 	var res []API
 
 	query := "SELECT api_prefix FROM api WHERE local_key='t';"
@@ -321,7 +356,7 @@ func GetLocalAPIKeys(cr *sql.DB) ([]API, err.Error) {
 }
 
 // GetAllAPIKeys returns all existing API keys
-func GetAllAPIKeys(cr *sql.DB) ([]API, err.Error) {
+func GetAllAPIKeys(cr Cursor) ([]API, err.Error) {
 	var res []API
 
 	query := "SELECT id FROM api;"
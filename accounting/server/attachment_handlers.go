@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+/*
+	##############################
+	#                            #
+	#         Attachments        #
+	#                            #
+	##############################
+*/
+
+// attachmentFormURL returns the form of the record the attachment belongs to
+func attachmentFormURL(a Attachment) string {
+	if a.AccountID > 0 {
+		return fmt.Sprintf("/accounts/form/?id=%d", a.AccountID)
+	}
+	return fmt.Sprintf("/transactions/form/?id=%d", a.TransactionID)
+}
+
+// serveAttachment writes the file of the attachment as download
+func serveAttachment(w http.ResponseWriter, r *http.Request, a Attachment) {
+	f, err := a.Open()
+	if !err.Empty() {
+		err.AddTraceback("serveAttachment()", "Error while opening the file of attachment: "+fmt.Sprintf("%d", a.ID))
+		log.Println("[ERROR]", err)
+		http.Error(w, "The file of the attachment is missing", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.FileName))
+	http.ServeContent(w, r, a.FileName, a.CreateDate, f)
+}
+
+// handleAttachmentDownload downloads the attachment with ?id=
+func handleAttachmentDownload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/attachments/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	if _, err := createContextFromSession(db, session); !err.Empty() {
+		err.AddTraceback("handleAttachmentDownload()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	id, e := strconv.ParseInt(r.URL.Query().Get("id"), 0, 64)
+	if e != nil {
+		http.Error(w, "Please provide a valid ID", http.StatusBadRequest)
+		return
+	}
+
+	a, err := FindAttachmentByID(db, id)
+	if !err.Empty() {
+		err.AddTraceback("handleAttachmentDownload()", "Error while finding attachment: "+fmt.Sprintf("%d", id))
+		log.Println("[WARN]", err)
+		handleNotFound(w, r)
+		return
+	}
+
+	serveAttachment(w, r, a)
+}
+
+// handleAttachmentUpload uploads the file of the form to the transaction or account of the form
+func handleAttachmentUpload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/attachments/upload/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	if _, err := createContextFromSession(db, session); !err.Empty() {
+		err.AddTraceback("handleAttachmentUpload()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	} else if r.Method != http.MethodPost {
+		http.Error(w, "Method must be POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	if e := r.ParseMultipartForm(1 << 20); e != nil {
+		http.Error(w, "The file could not be uploaded: "+e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a := EmptyAttachment()
+	a.TransactionID, _ = strconv.ParseInt(r.FormValue("transaction_id"), 0, 64)
+	a.AccountID, _ = strconv.ParseInt(r.FormValue("account_id"), 0, 64)
+
+	file, header, e := r.FormFile("file")
+	if e != nil {
+		http.Error(w, "Please choose a file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	a.FileName = header.Filename
+	a.ContentType = header.Header.Get("Content-Type")
+
+	if err := a.Create(db, file); !err.Empty() {
+		a.removeUnusedFile(db)
+		err.AddTraceback("handleAttachmentUpload()", "Error while creating the attachment.")
+		log.Println("[ERROR]", err)
+		http.Error(w, "The file could not be uploaded: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, attachmentFormURL(a), http.StatusSeeOther)
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// maxAttachmentSize is the biggest file which can be uploaded, 32 MB
+const maxAttachmentSize = 32 << 20
+
+// Attachment is a file like a receipt, an invoice or a contract which belongs to a transaction or an account
+// The files are stored under <app_dir>/attachments named by the SHA-256 Checksum of their content,
+// uploading the same file twice stores it once
+// Records with attachments can't be deleted, the attachments have to be deleted first
+type Attachment struct {
+	ID            int64
+	TransactionID int64
+	AccountID     int64
+	FileName      string
+	ContentType   string
+	Size          int64
+	Checksum      string
+	CreateDate    time.Time
+
+	// Computed fields
+	CreateDateStr string
+}
+
+// EmptyAttachment returns an empty attachment
+func EmptyAttachment() Attachment {
+	a := Attachment{
+		ID:            0,
+		TransactionID: 0,
+		AccountID:     0,
+		FileName:      "",
+		ContentType:   "",
+		Size:          0,
+		Checksum:      "",
+		CreateDate:    time.Now().Local(),
+	}
+
+	return a
+}
+
+// attachmentDir is the directory the files of the attachments are stored in
+func attachmentDir() string {
+	return filepath.Join(appDir, "attachments")
+}
+
+// filePath is the path of the file with the content of the attachment
+func (a *Attachment) filePath() string {
+	return filepath.Join(attachmentDir(), a.Checksum[:2], a.Checksum)
+}
+
+// storeFile writes the content into the attachment directory and sets Size and Checksum
+func (a *Attachment) storeFile(content io.Reader) err.Error {
+	var err err.Error
+
+	if e := os.MkdirAll(attachmentDir(), 0750); e != nil {
+		err.Init("Attachment.storeFile()", e.Error())
+		return err
+	}
+
+	tmp, e := ioutil.TempFile(attachmentDir(), "upload-")
+	if e != nil {
+		err.Init("Attachment.storeFile()", e.Error())
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, e := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, maxAttachmentSize+1))
+	tmp.Close()
+	if e != nil {
+		err.Init("Attachment.storeFile()", e.Error())
+		return err
+	} else if size == 0 {
+		err.Init("Attachment.storeFile()", "The file is empty")
+		return err
+	} else if size > maxAttachmentSize {
+		err.Init("Attachment.storeFile()", fmt.Sprintf("The file is bigger than %d MB", maxAttachmentSize>>20))
+		return err
+	}
+
+	a.Size = size
+	a.Checksum = fmt.Sprintf("%x", hash.Sum(nil))
+
+	// The same content is already stored
+	if _, e := os.Stat(a.filePath()); e == nil {
+		return err
+	}
+
+	if e := os.MkdirAll(filepath.Dir(a.filePath()), 0750); e != nil {
+		err.Init("Attachment.storeFile()", e.Error())
+		return err
+	}
+	if e := os.Rename(tmp.Name(), a.filePath()); e != nil {
+		err.Init("Attachment.storeFile()", e.Error())
+		return err
+	}
+
+	return err
+}
+
+// removeUnusedFile removes the file of the attachment if no other attachment has the same content
+// It takes the database instead of a transaction, so it only runs once the record was deleted or couldn't be created
+func (a *Attachment) removeUnusedFile(cr *sql.DB) {
+	var count int64
+
+	// The file was never stored
+	if a.Checksum == "" {
+		return
+	}
+
+	if e := cr.QueryRow("SELECT COUNT(*) FROM attachments WHERE checksum=$1", a.Checksum).Scan(&count); e != nil {
+		var err err.Error
+		err.Init("Attachment.removeUnusedFile()", e.Error())
+		log.Println("[WARN]", err)
+		return
+	}
+
+	if count == 0 {
+		if e := os.Remove(a.filePath()); e != nil && !os.IsNotExist(e) {
+			var err err.Error
+			err.Init("Attachment.removeUnusedFile()", e.Error())
+			log.Println("[WARN]", err)
+		}
+	}
+}
+
+// Create 's the attachment with the content, the file is stored before the record is created
+// If it fails the caller removes the stored file with removeUnusedFile
+func (a *Attachment) Create(cr Cursor, content io.Reader) err.Error {
+	if a.ID != 0 {
+		var err err.Error
+		err.Init("Attachment.Create()", "This object already has an id")
+		return err
+	} else if (a.TransactionID == 0) == (a.AccountID == 0) {
+		var err err.Error
+		err.Init("Attachment.Create()", "The attachment must belong to either a transaction or an account")
+		return err
+	} else if a.FileName == "" {
+		var err err.Error
+		err.Init("Attachment.Create()", "The attachment does not have a file name")
+		return err
+	}
+
+	if err := a.storeFile(content); !err.Empty() {
+		err.AddTraceback("Attachment.Create()", "Error while storing the file "+a.FileName)
+		return err
+	}
+
+	if a.ContentType == "" {
+		a.ContentType = "application/octet-stream"
+	}
+	a.CreateDate = time.Now().Local()
+
+	var transactionID, accountID interface{} = a.TransactionID, a.AccountID
+	if a.TransactionID == 0 {
+		transactionID = nil
+	}
+	if a.AccountID == 0 {
+		accountID = nil
+	}
+
+	query := "INSERT INTO attachments (transaction_id, account_id, file_name, content_type, size, checksum, create_date) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		transactionID,
+		accountID,
+		filepath.Base(a.FileName),
+		a.ContentType,
+		a.Size,
+		a.Checksum,
+		a.CreateDate,
+	).Scan(&a.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Attachment.Create()", e.Error())
+		return err
+	}
+
+	a.FileName = filepath.Base(a.FileName)
+	a.computeFields()
+
+	return err.Error{}
+}
+
+// Delete 's the attachment record, the caller removes the file with removeUnusedFile once the deletion is committed
+func (a *Attachment) Delete(cr Cursor) err.Error {
+	if a.ID <= 0 {
+		var err err.Error
+		err.Init("Attachment.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM attachments WHERE id=$1", a.ID); e != nil {
+		var err err.Error
+		err.Init("Attachment.Delete()", e.Error())
+		return err
+	}
+
+	a.ID = 0
+
+	return err.Error{}
+}
+
+// Open opens the file of the attachment for reading
+func (a *Attachment) Open() (*os.File, err.Error) {
+	f, e := os.Open(a.filePath())
+	if e != nil {
+		var err err.Error
+		err.Init("Attachment.Open()", e.Error())
+		return nil, err
+	}
+
+	return f, err.Error{}
+}
+
+func (a *Attachment) computeFields() {
+	a.CreateDateStr = a.CreateDate.Format(dtLayout)
+}
+
+// FindByID finds an attachment with it's id
+func (a *Attachment) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, transaction_id, account_id, file_name, content_type, size, checksum, create_date "
+	query += "FROM attachments WHERE id=$1"
+
+	var transactionID, accountID sql.NullInt64
+
+	e := cr.QueryRow(query, id).Scan(
+		&a.ID,
+		&transactionID,
+		&accountID,
+		&a.FileName,
+		&a.ContentType,
+		&a.Size,
+		&a.Checksum,
+		&a.CreateDate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Attachment.FindByID()", e.Error())
+		return err
+	}
+
+	a.TransactionID = transactionID.Int64
+	a.AccountID = accountID.Int64
+	a.computeFields()
+
+	return err.Error{}
+}
+
+// FindAttachmentByID is similar to FindByID but returns the attachment
+func FindAttachmentByID(cr Cursor, id int64) (Attachment, err.Error) {
+	a := EmptyAttachment()
+
+	if e := a.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindAttachmentByID()", "Error while finding attachment by ID: "+fmt.Sprintf("%d", id))
+		return a, e
+	}
+
+	return a, err.Error{}
+}
+
+// attachmentColumn returns the column of the attachments which references the model
+func attachmentColumn(model string) (string, bool) {
+	switch model {
+	case AuditTransaction:
+		return "transaction_id", true
+	case AuditAccount:
+		return "account_id", true
+	}
+	return "", false
+}
+
+// GetAttachments returns the attachments of a transaction or an account, oldest first
+// model is "transaction" or "account"
+func GetAttachments(cr Cursor, model string, recordID int64) ([]Attachment, err.Error) {
+	var ids []int64
+	var result []Attachment
+
+	column, ok := attachmentColumn(model)
+	if !ok {
+		var err err.Error
+		err.Init("GetAttachments()", "Records of this model can't have attachments: "+model)
+		return nil, err
+	}
+
+	rows, e := cr.Query("SELECT id FROM attachments WHERE "+column+"=$1 ORDER BY create_date, id", recordID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAttachments()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAttachments(): Skipping record")
+			log.Printf("[WARN] GetAttachments(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		a, err := FindAttachmentByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAttachments(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, a)
+	}
+
+	return result, err.Error{}
+}
+
+// checkNoAttachments returns an error if the record still has attachments
+// The attachments are kept for warranty and tax purposes until they are deleted on their own
+func checkNoAttachments(cr Cursor, model string, recordID int64, funcName string) err.Error {
+	var count int64
+
+	column, _ := attachmentColumn(model)
+	if e := cr.QueryRow("SELECT COUNT(*) FROM attachments WHERE "+column+"=$1", recordID).Scan(&count); e != nil {
+		var err err.Error
+		err.Init(funcName, e.Error())
+		return err
+	}
+
+	if count > 0 {
+		var err err.Error
+		err.Init(funcName, fmt.Sprintf("The %s has %d attachments, delete them first", model, count))
+		return err
+	}
+
+	return err.Error{}
+}
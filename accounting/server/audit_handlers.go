@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+/*
+	##############################
+	#                            #
+	#         Audit Log          #
+	#                            #
+	##############################
+*/
+
+// handleAuditLog shows the history of a record, e.g. /audit/?model=transaction&id=1
+// Without a model the latest changes of all records are shown
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/audit/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleAuditLog()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "History"
+
+	model := r.URL.Query().Get("model")
+	recordID, _ := strconv.ParseInt(r.URL.Query().Get("id"), 0, 64)
+
+	ctx["Model"] = model
+	ctx["RecordID"] = recordID
+
+	// The whole log can get long, only the history of a single record is shown completely
+	limit := -1
+	if model == "" || recordID <= 0 {
+		limit = 100
+	}
+
+	if ctx["AuditEntries"], e = GetAuditEntries(db, model, recordID, limit); !e.Empty() {
+		e.AddTraceback("handleAuditLog()", "Error while getting the audit log.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "audit.html", ctx); err != nil {
+		e.Init("handleAuditLog()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Actions of an audit entry
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	// AuditClose and AuditReopen are used for periods and reconciliations
+	AuditClose  = "close"
+	AuditReopen = "reopen"
+)
+
+// Models which are recorded in the audit log
+const (
+	AuditAccount        = "account"
+	AuditAccountGroup   = "account_group"
+	AuditTransaction    = "transaction"
+	AuditCategory       = "category"
+	AuditSettings       = "settings"
+	AuditAPIKey         = "api"
+	AuditPayee          = "payee"
+	AuditRule           = "rule"
+	AuditSecurity       = "security"
+	AuditTrade          = "trade"
+	AuditPeriod         = "period"
+	AuditIncome         = "income_schedule"
+	AuditImport         = "import_mapping"
+	AuditReconciliation = "reconciliation"
+)
+
+// auditIgnoredFields are not listed as changes, they change with every write
+var auditIgnoredFields = []string{"LastUpdate", "LastUse"}
+
+// AuditEntry is a change of a record, Before and After contain the record as JSON
+// Before is empty when the record was created, After when it was deleted
+type AuditEntry struct {
+	ID         int64
+	Model      string
+	RecordID   int64
+	Action     string
+	Actor      string
+	ChangeDate time.Time
+	Before     json.RawMessage
+	After      json.RawMessage
+
+	// Computed fields
+	ChangeDateStr string
+	Changes       []AuditChange
+}
+
+// AuditChange is a field which was changed in an audit entry
+type AuditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// schedulerActor is the actor of changes made by the background jobs
+const schedulerActor = "scheduler"
+
+// cmdlineActor is the actor of changes made with the command line, e.g. --check-ledger fix
+const cmdlineActor = "cmdline"
+
+// webActor is the actor of changes made in the web interface
+func webActor(ctx Context) string {
+	if settings, ok := ctx["Settings"].(Settings); ok && settings.Name != "" {
+		return "web:" + settings.Name
+	}
+	return "web"
+}
+
+// apiActor is the actor of changes made with an API key
+func apiActor(key API) string {
+	return "api:" + key.APIPrefix
+}
+
+// auditSnapshot returns the record as JSON, it's taken before a record is changed
+// because the models are changed in place
+func auditSnapshot(record interface{}) json.RawMessage {
+	data, e := json.Marshal(record)
+	if e != nil {
+		var err err.Error
+		err.Init("auditSnapshot()", e.Error())
+		log.Println("[WARN]", err)
+		return nil
+	}
+	return data
+}
+
+// LogAudit writes an entry to the audit log, before and after are the record before and after the change
+// nil is used for before when the record was created and for after when it was deleted
+func LogAudit(cr Cursor, actor, action, model string, recordID int64, before, after interface{}) err.Error {
+	var beforeJSON, afterJSON interface{}
+
+	// Snapshots which were taken of no record are stored as NULL
+	if data := auditSnapshot(before); len(data) > 0 && string(data) != "null" {
+		beforeJSON = string(data)
+	}
+	if data := auditSnapshot(after); len(data) > 0 && string(data) != "null" {
+		afterJSON = string(data)
+	}
+
+	query := "INSERT INTO audit_log (model, record_id, action, actor, change_date, before, after) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7);"
+
+	if _, e := cr.Exec(query, model, recordID, action, actor, time.Now().Local(), beforeJSON, afterJSON); e != nil {
+		var err err.Error
+		err.Init("LogAudit()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// computeFields compares Before and After
+func (a *AuditEntry) computeFields() {
+	a.ChangeDateStr = a.ChangeDate.Format("02.01.2006 - 15:04:05")
+	a.Changes = nil
+
+	before := make(map[string]interface{})
+	after := make(map[string]interface{})
+	if len(a.Before) > 0 {
+		json.Unmarshal(a.Before, &before)
+	}
+	if len(a.After) > 0 {
+		json.Unmarshal(a.After, &after)
+	}
+
+	var fields []string
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if contains(auditIgnoredFields, field) {
+			continue
+		}
+
+		old, hasOld := before[field]
+		cur, hasCur := after[field]
+		if hasOld && hasCur && reflect.DeepEqual(old, cur) {
+			continue
+		}
+
+		change := AuditChange{Field: field}
+		if hasOld {
+			change.Before = auditValue(old)
+		}
+		if hasCur {
+			change.After = auditValue(cur)
+		}
+		a.Changes = append(a.Changes, change)
+	}
+}
+
+// auditValue formats a JSON value for displaying it
+func auditValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, e := json.Marshal(value)
+	if e != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// GetAuditEntries returns the audit log, newest entries first
+// An empty model returns the entries of all models, a recordID of 0 the entries of all records of the model
+// limit < 0 returns all entries
+func GetAuditEntries(cr Cursor, model string, recordID int64, limit int) ([]AuditEntry, err.Error) {
+	var entries []AuditEntry
+	var args []interface{}
+
+	query := "SELECT id, model, record_id, action, actor, change_date, COALESCE(before::text, ''), COALESCE(after::text, '') "
+	query += "FROM audit_log WHERE true"
+	if model != "" {
+		args = append(args, model)
+		query += fmt.Sprintf(" AND model=$%d", len(args))
+	}
+	if recordID > 0 {
+		args = append(args, recordID)
+		query += fmt.Sprintf(" AND record_id=$%d", len(args))
+	}
+	query += " ORDER BY change_date DESC, id DESC"
+	if limit >= 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, e := cr.Query(query, args...)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAuditEntries()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a AuditEntry
+		var before, after string
+
+		if e = rows.Scan(&a.ID, &a.Model, &a.RecordID, &a.Action, &a.Actor, &a.ChangeDate, &before, &after); e != nil {
+			log.Println("[INFO] GetAuditEntries(): Skipping record")
+			log.Printf("[WARN] GetAuditEntries(): %s\n", e)
+			continue
+		}
+
+		if before != "" {
+			a.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			a.After = json.RawMessage(after)
+		}
+		a.computeFields()
+
+		entries = append(entries, a)
+	}
+
+	return entries, err.Error{}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+	##############################
+	#                            #
+	#           Budgets          #
+	#                            #
+	##############################
+*/
+
+// handleBudgetOverview compares the budgets with the spending of a period
+// ?date=DD.MM.YYYY shows the periods which contain the date instead of the current ones
+func handleBudgetOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/budgets/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleBudgetOverview()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Budgets"
+
+	date := time.Now().Local()
+	if val := r.URL.Query().Get("date"); val != "" {
+		var err error
+		if date, err = time.ParseInLocation(dateLayout, val, time.Local); err != nil {
+			e.Init("handleBudgetOverview()", err.Error())
+			log.Println("[WARN]", e)
+			date = time.Now().Local()
+		}
+	}
+
+	month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+	ctx["Month"] = month.Format("January 2006")
+	ctx["PrevDate"] = month.AddDate(0, -1, 0).Format(dateLayout)
+	ctx["NextDate"] = month.AddDate(0, 1, 0).Format(dateLayout)
+
+	budgets, e := GetAllBudgets(db, false)
+	if !e.Empty() {
+		e.AddTraceback("handleBudgetOverview()", "Error while getting all budgets.")
+		log.Println("[WARN]", e)
+	}
+	for i := range budgets {
+		if e = budgets[i].ComputeForDate(db, date); !e.Empty() {
+			e.AddTraceback("handleBudgetOverview()", "Error while computing budget: "+fmt.Sprintf("%d", budgets[i].ID))
+			log.Println("[WARN]", e)
+		}
+	}
+	ctx["Budgets"] = budgets
+
+	if err := tmpl.ExecuteTemplate(w, "budgets.html", ctx); err != nil {
+		e.Init("handleBudgetOverview()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+func handleBudgetForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/budgets/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleBudgetForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Budget"
+	ctx["Btn"] = "Create Budget"
+	ctx["Periods"] = GetAllBudgetPeriods()
+
+	b := EmptyBudget()
+
+	// Get the current budget
+	if budgetID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(budgetID[0])
+		if e != nil {
+			err.Init("handleBudgetForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = b.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleBudgetForm()", "Error finding budget: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			b = EmptyBudget()
+		} else {
+			ctx["Title"] = "Edit Budget"
+			ctx["Btn"] = "Save Budget"
+		}
+	}
+
+	ctx["Budget"] = b
+
+	if ctx["Categories"], err = GetAllCategories(db); !err.Empty() {
+		err.AddTraceback("handleBudgetForm()", "Error while getting the categories.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "budget_form.html", ctx); e != nil {
+			err.Init("handleBudgetForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	var e error
+
+	b.Active = r.FormValue("active") == "on"
+	b.Rollover = r.FormValue("rollover") == "on"
+	b.Period = r.FormValue("period")
+
+	if b.CategoryID, e = strconv.ParseInt(r.FormValue("category"), 0, 64); e != nil {
+		b.CategoryID = 0
+	}
+	if b.Amount, e = ParseMoney(r.FormValue("amount")); e != nil {
+		err.Init("handleBudgetForm()", e.Error())
+		log.Println("[WARN]", err)
+		b.Amount = 0
+	}
+	if b.StartDate, e = time.ParseInLocation(dateLayout, r.FormValue("start_date"), time.Local); e != nil {
+		err.Init("handleBudgetForm()", e.Error())
+		log.Println("[INFO] handleBudgetForm(): Using current date as start date.")
+		log.Println("[WARN]", err)
+		b.StartDate = time.Now().Local()
+	}
+
+	if b.ID == 0 {
+		err = b.Create(db)
+	} else {
+		err = b.Save(db)
+	}
+
+	if !err.Empty() {
+		err.AddTraceback("handleBudgetForm()", "Error while writing the budget to the database.")
+		log.Println("[ERROR]", err)
+
+		ctx["Budget"] = b
+		ctx["Error"] = "The budget could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "budget_form.html", ctx); e != nil {
+			err.Init("handleBudgetForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/budgets/", http.StatusSeeOther)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Periods of budgets
+const (
+	// BudgetMonthly budgets the calendar month
+	BudgetMonthly = "monthly"
+	// BudgetSalaryCycle budgets the time from one payday of the default income schedule to the next one
+	BudgetSalaryCycle = "salary_cycle"
+)
+
+// Budget is the amount which is planned to be spent in a category per period
+// If Rollover is true, the money which wasn't spent in a period is added to the next one,
+// starting with the period of the StartDate
+type Budget struct {
+	ID         int64
+	CategoryID int64
+	Amount     Money
+	Period     string
+	Rollover   bool
+	StartDate  time.Time
+	Active     bool
+	CreateDate time.Time
+	LastUpdate time.Time
+
+	// Computed fields
+	// The values are computed for the period of the current date or the date passed to ComputeForDate
+	CategoryName   string
+	CategoryHex    string
+	Currency       string
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	PeriodStartStr string
+	PeriodEndStr   string
+	StartDateStr   string
+	// Carried is the unspent money of the previous periods
+	Carried   Money
+	Available Money
+	Spent     Money
+	Remaining Money
+	Overspent bool
+	// Percent of the available money which was spent, capped at 100 for progress bars
+	Percent int64
+}
+
+// EmptyBudget returns an empty budget
+func EmptyBudget() Budget {
+	b := Budget{
+		ID:         0,
+		CategoryID: 0,
+		Amount:     0,
+		Period:     BudgetMonthly,
+		Rollover:   false,
+		StartDate:  time.Now().Local(),
+		Active:     true,
+		CreateDate: time.Now().Local(),
+		LastUpdate: time.Now().Local(),
+	}
+
+	return b
+}
+
+// GetAllBudgetPeriods returns all periods a budget can have
+func GetAllBudgetPeriods() []string {
+	return []string{
+		BudgetMonthly,
+		BudgetSalaryCycle,
+	}
+}
+
+// budgetPeriod returns the start and the end of the period which contains date
+// The end is the start of the next period, without a default income schedule the salary cycle is the calendar month
+func budgetPeriod(period string, income IncomeSchedule, date time.Time) (time.Time, time.Time) {
+	if period == BudgetSalaryCycle && income.ID != 0 {
+		return income.Cycle(date)
+	}
+
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+func (b *Budget) validate(funcName string) err.Error {
+	var err err.Error
+
+	if b.CategoryID <= 0 {
+		err.Init(funcName, "The budget does not belong to a category")
+	} else if b.Amount < 0 {
+		err.Init(funcName, "The amount of a budget can't be negative")
+	} else if b.Period != BudgetMonthly && b.Period != BudgetSalaryCycle {
+		err.Init(funcName, "Unknown period: "+b.Period)
+	}
+
+	return err
+}
+
+// Create 's the budget in the database
+func (b *Budget) Create(cr Cursor) err.Error {
+	if b.ID != 0 {
+		var err err.Error
+		err.Init("Budget.Create()", "This object already has an id")
+		return err
+	}
+	if err := b.validate("Budget.Create()"); !err.Empty() {
+		return err
+	}
+
+	b.CreateDate = time.Now().Local()
+	b.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO budgets (category_id, amount, period, rollover, start_date, active, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		b.CategoryID,
+		b.Amount,
+		b.Period,
+		b.Rollover,
+		b.StartDate,
+		b.Active,
+		b.CreateDate,
+		b.LastUpdate,
+	).Scan(&b.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Budget.Create()", e.Error())
+		return err
+	}
+
+	b.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the budget to the database
+func (b *Budget) Save(cr Cursor) err.Error {
+	if b.ID <= 0 {
+		var err err.Error
+		err.Init("Budget.Save()", "This budget has no ID, maybe create it first?")
+		return err
+	}
+	if err := b.validate("Budget.Save()"); !err.Empty() {
+		return err
+	}
+
+	b.LastUpdate = time.Now().Local()
+
+	query := "UPDATE budgets SET category_id=$2, amount=$3, period=$4, rollover=$5, start_date=$6, active=$7, "
+	query += "last_update=$8 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		b.ID,
+		b.CategoryID,
+		b.Amount,
+		b.Period,
+		b.Rollover,
+		b.StartDate,
+		b.Active,
+		b.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Budget.Save()", e.Error())
+		return err
+	}
+
+	b.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the budget
+func (b *Budget) Delete(cr Cursor) err.Error {
+	if b.ID <= 0 {
+		var err err.Error
+		err.Init("Budget.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM budgets WHERE id=$1", b.ID); e != nil {
+		var err err.Error
+		err.Init("Budget.Delete()", e.Error())
+		return err
+	}
+
+	b.ID = 0
+
+	return err.Error{}
+}
+
+// spentIn returns the amount of the active transactions in the category of the budget and it's subcategories between start and end
+// The amounts are converted into the base currency like in the statistics, refunds reduce the spent amount
+func (b *Budget) spentIn(cr Cursor, start, end time.Time) (Money, err.Error) {
+	var spent Money
+
+	query := "SELECT COALESCE(SUM(spent_amount(t.transaction_type, ca.base_amount)), 0) FROM category_tree AS ct "
+	query += "JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id "
+	query += "JOIN transactions AS t ON t.id=ca.transaction_id "
+	query += "WHERE ct.ancestor_id=$1 AND t.active=true AND t.transaction_date >= $2 AND t.transaction_date < $3"
+
+	if e := cr.QueryRow(query, b.CategoryID, start, end).Scan(&spent); e != nil {
+		var err err.Error
+		err.Init("Budget.spentIn()", e.Error())
+		return 0, err
+	}
+
+	return spent, err.Error{}
+}
+
+// ComputeForDate computes the budget for the period which contains date
+func (b *Budget) ComputeForDate(cr Cursor, date time.Time) err.Error {
+	income := EmptyIncomeSchedule()
+	if b.Period == BudgetSalaryCycle {
+		var err err.Error
+		if income, err = FindDefaultIncomeSchedule(cr); !err.Empty() {
+			err.AddTraceback("Budget.ComputeForDate()", "Error while getting the default income schedule.")
+			return err
+		}
+	}
+
+	if e := cr.QueryRow("SELECT base_currency();").Scan(&b.Currency); e != nil {
+		var err err.Error
+		err.Init("Budget.ComputeForDate()", e.Error())
+		return err
+	}
+
+	b.PeriodStart, b.PeriodEnd = budgetPeriod(b.Period, income, date)
+	b.PeriodStartStr = b.PeriodStart.Format(dateLayout)
+	b.PeriodEndStr = b.PeriodEnd.AddDate(0, 0, -1).Format(dateLayout)
+
+	// Unspent money of the previous periods, an overspent period doesn't reduce the next one
+	b.Carried = 0
+	if b.Rollover {
+		start, end := budgetPeriod(b.Period, income, b.StartDate)
+		for start.Before(b.PeriodStart) {
+			spent, spentErr := b.spentIn(cr, start, end)
+			if !spentErr.Empty() {
+				spentErr.AddTraceback("Budget.ComputeForDate()", "Error while computing the spent amount of the period "+start.Format(dateLayout))
+				return spentErr
+			}
+			if b.Carried += b.Amount - spent; b.Carried < 0 {
+				b.Carried = 0
+			}
+			start, end = budgetPeriod(b.Period, income, end)
+		}
+	}
+
+	spent, spentErr := b.spentIn(cr, b.PeriodStart, b.PeriodEnd)
+	if !spentErr.Empty() {
+		spentErr.AddTraceback("Budget.ComputeForDate()", "Error while computing the spent amount.")
+		return spentErr
+	}
+
+	b.Spent = spent
+	b.Available = b.Amount + b.Carried
+	b.Remaining = b.Available - b.Spent
+	b.Overspent = b.Remaining < 0
+
+	b.Percent = 100
+	if b.Available > 0 && b.Spent < b.Available {
+		b.Percent = int64(b.Spent) * 100 / int64(b.Available)
+	} else if b.Available <= 0 && b.Spent <= 0 {
+		b.Percent = 0
+	}
+
+	return err.Error{}
+}
+
+func (b *Budget) computeFields(cr Cursor) {
+	// Compute: CategoryName, CategoryHex
+	if b.CategoryID > 0 {
+		c, err := FindCategoryByID(cr, b.CategoryID)
+		if !err.Empty() {
+			err.AddTraceback("Budget.computeFields()", "Error while finding category by ID: "+fmt.Sprintf("%d", b.CategoryID))
+			log.Println("[WARN]", err)
+		}
+		b.CategoryName = c.Name
+		b.CategoryHex = c.Hex
+	}
+
+	b.StartDateStr = b.StartDate.Format(dateLayout)
+
+	// Compute: the values of the current period
+	if err := b.ComputeForDate(cr, time.Now().Local()); !err.Empty() {
+		err.AddTraceback("Budget.computeFields()", "Error while computing the current period.")
+		log.Println("[WARN]", err)
+	}
+}
+
+// FindByID finds a budget with it's id
+func (b *Budget) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, category_id, amount, period, rollover, start_date, active, create_date, last_update "
+	query += "FROM budgets WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&b.ID,
+		&b.CategoryID,
+		&b.Amount,
+		&b.Period,
+		&b.Rollover,
+		&b.StartDate,
+		&b.Active,
+		&b.CreateDate,
+		&b.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Budget.FindByID()", e.Error())
+		return err
+	}
+
+	b.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindBudgetByID is similar to FindByID but returns the budget
+func FindBudgetByID(cr Cursor, id int64) (Budget, err.Error) {
+	b := EmptyBudget()
+
+	if e := b.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindBudgetByID()", "Error while finding budget by ID: "+fmt.Sprintf("%d", id))
+		return b, e
+	}
+
+	return b, err.Error{}
+}
+
+// GetAllBudgets returns all budgets ordered by the name of their category
+// If activeOnly is true, inactive budgets are left out
+func GetAllBudgets(cr Cursor, activeOnly bool) ([]Budget, err.Error) {
+	var ids []int64
+	var result []Budget
+
+	query := "SELECT b.id FROM budgets AS b JOIN categories AS c ON c.id=b.category_id "
+	if activeOnly {
+		query += "WHERE b.active=true "
+	}
+	query += "ORDER BY b.active DESC, c.name, b.id"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllBudgets()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllBudgets(): Skipping record")
+			log.Printf("[WARN] GetAllBudgets(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		b, err := FindBudgetByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllBudgets(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, b)
+	}
+
+	return result, err.Error{}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetPeriod(t *testing.T) {
+	salary := EmptyIncomeSchedule()
+	salary.ID = 1
+	salary.AnchorDate = at(2026, 1, 25, 0, 0)
+
+	tests := []struct {
+		period     string
+		income     IncomeSchedule
+		date       time.Time
+		start, end time.Time
+	}{
+		{BudgetMonthly, salary, at(2026, 2, 15, 12, 0), at(2026, 2, 1, 0, 0), at(2026, 3, 1, 0, 0)},
+		{BudgetMonthly, salary, at(2026, 12, 31, 0, 0), at(2026, 12, 1, 0, 0), at(2027, 1, 1, 0, 0)},
+		{BudgetSalaryCycle, salary, at(2026, 2, 10, 0, 0), at(2026, 1, 25, 0, 0), at(2026, 2, 25, 0, 0)},
+		{BudgetSalaryCycle, salary, at(2026, 2, 25, 0, 0), at(2026, 2, 25, 0, 0), at(2026, 3, 25, 0, 0)},
+		// Without a default income schedule the salary cycle is the calendar month
+		{BudgetSalaryCycle, EmptyIncomeSchedule(), at(2026, 2, 10, 0, 0), at(2026, 2, 1, 0, 0), at(2026, 3, 1, 0, 0)},
+	}
+
+	for _, test := range tests {
+		start, end := budgetPeriod(test.period, test.income, test.date)
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("budgetPeriod(%s, %s) = %s - %s, expected %s - %s", test.period, test.date.Format(dtLayout),
+				start.Format(dateLayout), end.Format(dateLayout), test.start.Format(dateLayout), test.end.Format(dateLayout))
+		}
+	}
+}
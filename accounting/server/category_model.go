@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"time"
 
@@ -9,17 +10,25 @@ import (
 )
 
 // Category ...
+// ParentID makes the category a subcategory, 0 is a top-level category
 type Category struct {
 	ID         int64
 	Name       string
 	Hex        string
+	ParentID   int64
 	CreateDate time.Time
 	LastUpdate time.Time
 	Active     bool
 
 	// Computed fields
+	// The transactions of the category and all of it's subcategories
 	TransactionIDs   []int64
 	TransactionCount int
+	// Names from the top-level category down to this one, e.g. "Housing > Rent"
+	Path  string
+	Depth int
+	// Only set in the tree returned by GetCategoryTree
+	Children []Category
 }
 
 // EmptyCategory returns an empty category
@@ -28,6 +37,7 @@ func EmptyCategory() Category {
 		ID:         0,
 		Name:       "",
 		Hex:        "",
+		ParentID:   0,
 		CreateDate: time.Now(),
 		LastUpdate: time.Now(),
 		Active:     false,
@@ -37,7 +47,7 @@ func EmptyCategory() Category {
 }
 
 // Create a new category in the database
-func (c *Category) Create(cr *sql.DB) err.Error {
+func (c *Category) Create(cr Cursor) err.Error {
 	if c.ID > 0 {
 		var err err.Error
 		err.Init("Category.Create()", "This category already has an ID. Maybe try saving it?")
@@ -48,8 +58,13 @@ func (c *Category) Create(cr *sql.DB) err.Error {
 		return err
 	}
 
-	query := "INSERT INTO categories (name, create_date, last_update, active, hex) "
-	query += "VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+	if err := c.validateParent(cr); !err.Empty() {
+		err.AddTraceback("Category.Create()", "Invalid parent category.")
+		return err
+	}
+
+	query := "INSERT INTO categories (name, create_date, last_update, active, hex, parent_id) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
 
 	if c.Hex == "" {
 		c.Hex = "#ffffff"
@@ -61,6 +76,7 @@ func (c *Category) Create(cr *sql.DB) err.Error {
 		time.Now(),
 		true,
 		c.Hex,
+		c.parentID(),
 	).Scan(&c.ID)
 
 	if e != nil {
@@ -75,7 +91,7 @@ func (c *Category) Create(cr *sql.DB) err.Error {
 }
 
 // Save the current category to the database
-func (c *Category) Save(cr *sql.DB) err.Error {
+func (c *Category) Save(cr Cursor) err.Error {
 	if c.ID <= 0 {
 		var err err.Error
 		err.Init("Category.Save()", "This category has no ID. Maybe create it first?")
@@ -86,7 +102,12 @@ func (c *Category) Save(cr *sql.DB) err.Error {
 		return err
 	}
 
-	query := "UPDATE categories SET name=$1, hex=$2, last_update=$3, active=$4 WHERE id=$5"
+	if err := c.validateParent(cr); !err.Empty() {
+		err.AddTraceback("Category.Save()", "Invalid parent category.")
+		return err
+	}
+
+	query := "UPDATE categories SET name=$1, hex=$2, last_update=$3, active=$4, parent_id=$5 WHERE id=$6"
 
 	if c.Hex == "" {
 		c.Hex = "#ffffff"
@@ -97,6 +118,7 @@ func (c *Category) Save(cr *sql.DB) err.Error {
 		c.Hex,
 		time.Now(),
 		c.Active,
+		c.parentID(),
 		c.ID,
 	)
 
@@ -111,8 +133,45 @@ func (c *Category) Save(cr *sql.DB) err.Error {
 	return err.Error{}
 }
 
+// parentID returns the parent for the database, nil for top-level categories
+func (c *Category) parentID() interface{} {
+	if c.ParentID <= 0 {
+		return nil
+	}
+	return c.ParentID
+}
+
+// validateParent checks that the parent exists and is neither the category itself nor one of it's subcategories
+func (c *Category) validateParent(cr Cursor) err.Error {
+	var err err.Error
+
+	if c.ParentID <= 0 {
+		return err
+	} else if c.ParentID == c.ID {
+		err.Init("Category.validateParent()", "A category can't be it's own parent")
+		return err
+	}
+
+	var exists, isDescendant bool
+	query := "SELECT EXISTS (SELECT 1 FROM categories WHERE id=$1), "
+	query += "EXISTS (SELECT 1 FROM category_tree WHERE ancestor_id=$2 AND category_id=$1)"
+	if e := cr.QueryRow(query, c.ParentID, c.ID).Scan(&exists, &isDescendant); e != nil {
+		err.Init("Category.validateParent()", e.Error())
+		return err
+	}
+
+	if !exists {
+		err.Init("Category.validateParent()", fmt.Sprintf("The parent category %d does not exist", c.ParentID))
+	} else if isDescendant {
+		err.Init("Category.validateParent()", "A subcategory can't be the parent of it's own parent")
+	}
+
+	return err
+}
+
 // Delete the current category from the database
-func (c *Category) Delete(cr *sql.DB) err.Error {
+// The subcategories become top-level categories
+func (c *Category) Delete(cr Cursor) err.Error {
 	if c.ID <= 0 {
 		var err err.Error
 		err.Init("Category.Delete()", "ID must be bigger than 0")
@@ -134,12 +193,26 @@ func (c *Category) Delete(cr *sql.DB) err.Error {
 	return err.Error{}
 }
 
-func (c *Category) computeFields(cr *sql.DB) {
-	transQuery := "SELECT id FROM transactions where category_id=$1;"
+func (c *Category) computeFields(cr Cursor) {
+	pathQuery := "SELECT string_agg(a.name, ' > ' ORDER BY ct.depth DESC), MAX(ct.depth) "
+	pathQuery += "FROM category_tree AS ct JOIN categories AS a ON a.id=ct.ancestor_id WHERE ct.category_id=$1"
+	if e := cr.QueryRow(pathQuery, c.ID).Scan(&c.Path, &c.Depth); e != nil {
+		log.Printf("[WARN] Category.computeFields(): Error getting the path\n%s\n", e)
+		c.Path = c.Name
+		c.Depth = 0
+	}
+
+	// Split transactions belong to the categories of their splits
+	subQuery := "(SELECT category_id FROM category_tree WHERE ancestor_id=$1)"
+	transQuery := "SELECT id FROM transactions AS t WHERE category_id IN " + subQuery + " "
+	transQuery += "AND NOT EXISTS (SELECT 1 FROM transaction_splits AS s WHERE s.transaction_id=t.id) "
+	transQuery += "UNION SELECT transaction_id FROM transaction_splits WHERE category_id IN " + subQuery + ";"
 	res, e := cr.Query(transQuery, c.ID)
 	if e != nil {
 		log.Printf("[ERROR] Category.computeFields(): Error getting transaction IDs\n%s\n", e)
+		return
 	}
+	defer res.Close()
 
 	c.TransactionIDs = nil
 
@@ -156,14 +229,16 @@ func (c *Category) computeFields(cr *sql.DB) {
 }
 
 // FindByID finds a category in the database
-func (c *Category) FindByID(cr *sql.DB, id int64) err.Error {
+func (c *Category) FindByID(cr Cursor, id int64) err.Error {
 	if id <= 0 {
 		var err err.Error
 		err.Init("Category.FindByID()", "ID must be a positive number: "+string(id))
 		return err
 	}
 
-	query := "SELECT id,name,create_date,last_update,active,hex FROM categories WHERE id=$1;"
+	query := "SELECT id,name,create_date,last_update,active,hex,parent_id FROM categories WHERE id=$1;"
+
+	var parentID sql.NullInt64
 
 	e := cr.QueryRow(query, id).Scan(
 		&c.ID,
@@ -172,6 +247,7 @@ func (c *Category) FindByID(cr *sql.DB, id int64) err.Error {
 		&c.LastUpdate,
 		&c.Active,
 		&c.Hex,
+		&parentID,
 	)
 
 	if e != nil {
@@ -180,13 +256,15 @@ func (c *Category) FindByID(cr *sql.DB, id int64) err.Error {
 		return err
 	}
 
+	c.ParentID = parentID.Int64
+
 	c.computeFields(cr)
 
 	return err.Error{}
 }
 
 // FindCategoryByID is similar to FindByID but returns the category
-func FindCategoryByID(cr *sql.DB, categoryID int64) (Category, err.Error) {
+func FindCategoryByID(cr Cursor, categoryID int64) (Category, err.Error) {
 	t := EmptyCategory()
 
 	e := t.FindByID(cr, categoryID)
@@ -201,9 +279,11 @@ func FindCategoryByID(cr *sql.DB, categoryID int64) (Category, err.Error) {
 }
 
 // GetAllCategories returns all categories
-func GetAllCategories(cr *sql.DB) ([]Category, err.Error) {
+// Subcategories follow their parent category, all ordered by name
+func GetAllCategories(cr Cursor) ([]Category, err.Error) {
 	var categories []Category
-	query := "SELECT id FROM categories;"
+	query := "SELECT ct.category_id FROM category_tree AS ct JOIN categories AS a ON a.id=ct.ancestor_id "
+	query += "GROUP BY ct.category_id ORDER BY array_agg(a.name ORDER BY ct.depth DESC);"
 
 	res, e := cr.Query(query)
 
@@ -234,3 +314,29 @@ func GetAllCategories(cr *sql.DB) ([]Category, err.Error) {
 
 	return categories, err.Error{}
 }
+
+// GetCategoryTree returns the top-level categories with their subcategories in Children
+func GetCategoryTree(cr Cursor) ([]Category, err.Error) {
+	categories, err := GetAllCategories(cr)
+	if !err.Empty() {
+		err.AddTraceback("GetCategoryTree()", "Error while getting all categories.")
+		return nil, err
+	}
+
+	return buildCategoryTree(categories, 0), err
+}
+
+// buildCategoryTree returns the categories with the parent and their subcategories
+func buildCategoryTree(categories []Category, parentID int64) []Category {
+	var result []Category
+
+	for _, c := range categories {
+		if c.ParentID != parentID {
+			continue
+		}
+		c.Children = buildCategoryTree(categories, c.ID)
+		result = append(result, c)
+	}
+
+	return result
+}
@@ -11,6 +11,42 @@ import (
 
 var db *sql.DB
 
+// Cursor is implemented by *sql.DB and *sql.Tx
+// Models accept a Cursor for reading and single statement writes,
+// writes which consist of multiple statements require a *sql.Tx
+type Cursor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// withTransaction runs f inside of a database transaction
+// The transaction gets committed if f succeeds and rolled back on any error
+func withTransaction(cr *sql.DB, f func(tx *sql.Tx) err.Error) err.Error {
+	tx, e := cr.Begin()
+	if e != nil {
+		var err err.Error
+		err.Init("withTransaction()", e.Error())
+		return err
+	}
+
+	if err := f(tx); !err.Empty() {
+		if e = tx.Rollback(); e != nil {
+			log.Println("[ERROR] withTransaction(): Error during rollback:", e)
+		}
+		err.AddTraceback("withTransaction()", "Transaction was rolled back.")
+		return err
+	}
+
+	if e = tx.Commit(); e != nil {
+		var err err.Error
+		err.Init("withTransaction()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
 func dbInit(host, user, password, dbname, port string) *sql.DB {
 	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
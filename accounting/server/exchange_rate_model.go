@@ -0,0 +1,254 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// ExchangeRate is the rate for converting FromCurrency into ToCurrency, valid from RateDate on
+// Rates are looked up in both directions, so EUR->USD also converts USD into EUR
+type ExchangeRate struct {
+	ID           int64
+	FromCurrency string
+	ToCurrency   string
+	Rate         float64
+	RateDate     time.Time
+	CreateDate   time.Time
+	LastUpdate   time.Time
+
+	// Computed fields
+	RateDateStr string
+}
+
+// EmptyExchangeRate returns an empty exchange rate
+func EmptyExchangeRate() ExchangeRate {
+	r := ExchangeRate{
+		ID:           0,
+		FromCurrency: "",
+		ToCurrency:   "",
+		Rate:         0.0,
+		RateDate:     time.Now().Local(),
+		CreateDate:   time.Now().Local(),
+		LastUpdate:   time.Now().Local(),
+	}
+
+	return r
+}
+
+// ValidCurrency checks if code is an ISO 4217 like currency code (three upper case letters)
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// GetBaseCurrency returns the currency statistics are reported in
+func GetBaseCurrency(cr Cursor) (string, err.Error) {
+	var currency string
+
+	if e := cr.QueryRow("SELECT base_currency();").Scan(&currency); e != nil {
+		var err err.Error
+		err.Init("GetBaseCurrency()", e.Error())
+		return "", err
+	}
+
+	return currency, err.Error{}
+}
+
+// FindExchangeRate returns the rate for converting from into to at the given date
+// The latest rate dated on or before date is used
+func FindExchangeRate(cr Cursor, from, to string, date time.Time) (float64, err.Error) {
+	var rate float64
+
+	if from == to {
+		return 1.0, err.Error{}
+	}
+
+	if e := cr.QueryRow("SELECT exchange_rate($1, $2, $3);", from, to, date).Scan(&rate); e != nil {
+		var err err.Error
+		err.Init("FindExchangeRate()", e.Error())
+		return 0, err
+	}
+
+	return rate, err.Error{}
+}
+
+func (r *ExchangeRate) validate(funcName string) err.Error {
+	r.FromCurrency = strings.ToUpper(r.FromCurrency)
+	r.ToCurrency = strings.ToUpper(r.ToCurrency)
+
+	if !ValidCurrency(r.FromCurrency) || !ValidCurrency(r.ToCurrency) {
+		var err err.Error
+		err.Init(funcName, "Currencies must be three letter codes like EUR: "+r.FromCurrency+", "+r.ToCurrency)
+		return err
+	} else if r.FromCurrency == r.ToCurrency {
+		var err err.Error
+		err.Init(funcName, "An exchange rate needs two different currencies")
+		return err
+	} else if r.Rate <= 0 {
+		var err err.Error
+		err.Init(funcName, "The rate must be bigger than 0")
+		return err
+	}
+
+	return err.Error{}
+}
+
+// Create 's the exchange rate in the database
+func (r *ExchangeRate) Create(cr Cursor) err.Error {
+	if r.ID != 0 {
+		var err err.Error
+		err.Init("ExchangeRate.Create()", "This object already has an id")
+		return err
+	}
+	if err := r.validate("ExchangeRate.Create()"); !err.Empty() {
+		return err
+	}
+
+	query := "INSERT INTO exchange_rates (from_currency, to_currency, rate, rate_date, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
+
+	r.CreateDate = time.Now().Local()
+	r.LastUpdate = time.Now().Local()
+
+	e := cr.QueryRow(query,
+		r.FromCurrency,
+		r.ToCurrency,
+		r.Rate,
+		r.RateDate,
+		r.CreateDate,
+		r.LastUpdate,
+	).Scan(&r.ID)
+
+	if e != nil {
+		var err err.Error
+		err.Init("ExchangeRate.Create()", e.Error())
+		return err
+	}
+
+	r.computeFields()
+
+	return err.Error{}
+}
+
+// Save 's the exchange rate to the database
+func (r *ExchangeRate) Save(cr Cursor) err.Error {
+	if r.ID <= 0 {
+		var err err.Error
+		err.Init("ExchangeRate.Save()", "This exchange rate has no ID, maybe create it first?")
+		return err
+	}
+	if err := r.validate("ExchangeRate.Save()"); !err.Empty() {
+		return err
+	}
+
+	query := "UPDATE exchange_rates SET from_currency=$2, to_currency=$3, rate=$4, rate_date=$5, last_update=$6 WHERE id=$1"
+
+	r.LastUpdate = time.Now().Local()
+
+	if _, e := cr.Exec(query, r.ID, r.FromCurrency, r.ToCurrency, r.Rate, r.RateDate, r.LastUpdate); e != nil {
+		var err err.Error
+		err.Init("ExchangeRate.Save()", e.Error())
+		return err
+	}
+
+	r.computeFields()
+
+	return err.Error{}
+}
+
+// Delete 's the exchange rate
+func (r *ExchangeRate) Delete(cr Cursor) err.Error {
+	if r.ID <= 0 {
+		var err err.Error
+		err.Init("ExchangeRate.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM exchange_rates WHERE id=$1", r.ID); e != nil {
+		var err err.Error
+		err.Init("ExchangeRate.Delete()", e.Error())
+		return err
+	}
+
+	r.ID = 0
+
+	return err.Error{}
+}
+
+func (r *ExchangeRate) computeFields() {
+	r.RateDateStr = r.RateDate.Format(dateLayout)
+}
+
+// FindByID finds an exchange rate with it's id
+func (r *ExchangeRate) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, from_currency, to_currency, rate, rate_date, create_date, last_update "
+	query += "FROM exchange_rates WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&r.ID,
+		&r.FromCurrency,
+		&r.ToCurrency,
+		&r.Rate,
+		&r.RateDate,
+		&r.CreateDate,
+		&r.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("ExchangeRate.FindByID()", e.Error())
+		return err
+	}
+
+	r.computeFields()
+
+	return err.Error{}
+}
+
+// GetAllExchangeRates returns all exchange rates, the latest first
+func GetAllExchangeRates(cr Cursor) ([]ExchangeRate, err.Error) {
+	var rates []ExchangeRate
+
+	query := "SELECT id, from_currency, to_currency, rate, rate_date, create_date, last_update "
+	query += "FROM exchange_rates ORDER BY rate_date DESC, from_currency, to_currency"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllExchangeRates()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := EmptyExchangeRate()
+
+		if e = rows.Scan(
+			&r.ID,
+			&r.FromCurrency,
+			&r.ToCurrency,
+			&r.Rate,
+			&r.RateDate,
+			&r.CreateDate,
+			&r.LastUpdate,
+		); e != nil {
+			log.Println("[INFO] GetAllExchangeRates(): Skipping record")
+			log.Printf("[WARN] GetAllExchangeRates(): %s\n", e)
+			continue
+		}
+
+		r.computeFields()
+		rates = append(rates, r)
+	}
+
+	return rates, err.Error{}
+}
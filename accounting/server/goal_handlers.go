@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	##############################
+	#                            #
+	#        Savings Goals       #
+	#                            #
+	##############################
+*/
+
+// handleGoalForm creates and edits savings goals, they are listed on the accounts page
+func handleGoalForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/goals/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleGoalForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Goal"
+	ctx["Btn"] = "Create Goal"
+
+	g := EmptyGoal()
+
+	// Get the current goal
+	if goalID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(goalID[0])
+		if e != nil {
+			err.Init("handleGoalForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = g.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleGoalForm()", "Error finding goal: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			g = EmptyGoal()
+		} else {
+			ctx["Title"] = "Edit Goal"
+			ctx["Btn"] = "Save Goal"
+		}
+	}
+
+	ctx["Goal"] = g
+
+	if ctx["Accounts"], err = GetAllAccounts(db); !err.Empty() {
+		err.AddTraceback("handleGoalForm()", "Error while getting the accounts.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "goal_form.html", ctx); e != nil {
+			err.Init("handleGoalForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	r.ParseForm()
+
+	var e error
+
+	g.Name = r.FormValue("name")
+	g.Description = r.FormValue("description")
+	g.Active = r.FormValue("active") == "on"
+	// Empty currency: the goal is saved in the base currency
+	g.Currency = strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))
+
+	if g.TargetAmount, e = ParseMoney(r.FormValue("target_amount")); e != nil {
+		err.Init("handleGoalForm()", e.Error())
+		log.Println("[WARN]", err)
+		g.TargetAmount = 0
+	}
+	if g.Deadline, e = time.ParseInLocation(dateLayout, r.FormValue("deadline"), time.Local); e != nil {
+		err.Init("handleGoalForm()", e.Error())
+		log.Println("[WARN]", err)
+		g.Deadline = EmptyGoal().Deadline
+	}
+
+	g.AccountIDs = nil
+	for _, val := range r.Form["accounts"] {
+		if id, e := strconv.ParseInt(val, 0, 64); e == nil {
+			g.AccountIDs = append(g.AccountIDs, id)
+		}
+	}
+
+	create := g.ID == 0
+	if create {
+		err = withTransaction(db, g.Create)
+	} else {
+		err = withTransaction(db, g.Save)
+	}
+
+	if !err.Empty() {
+		err.AddTraceback("handleGoalForm()", "Error while writing the goal to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			g.ID = 0
+		}
+		ctx["Goal"] = g
+		ctx["Error"] = "The goal could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "goal_form.html", ctx); e != nil {
+			err.Init("handleGoalForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/accounts/", http.StatusSeeOther)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Goal is a savings target which is reached with the balances of the accounts in AccountIDs
+// The balances are converted into the Currency of the goal
+type Goal struct {
+	ID           int64
+	Name         string
+	Description  string
+	TargetAmount Money
+	Currency     string
+	Deadline     time.Time
+	Active       bool
+	CreateDate   time.Time
+	LastUpdate   time.Time
+	AccountIDs   []int64
+
+	// Computed fields
+	AccountNames  []string
+	CurrentAmount Money
+	Remaining     Money
+	// Percent of the target which is saved, capped at 100 for progress bars
+	Percent     int64
+	Reached     bool
+	Overdue     bool
+	MonthsLeft  int64
+	DeadlineStr string
+	// MonthlyContribution is the amount which has to be saved every month to reach the target until the deadline
+	MonthlyContribution Money
+}
+
+// EmptyGoal returns an empty goal
+func EmptyGoal() Goal {
+	g := Goal{
+		ID:           0,
+		Name:         "",
+		Description:  "",
+		TargetAmount: 0,
+		Currency:     "",
+		Deadline:     time.Now().Local().AddDate(1, 0, 0),
+		Active:       true,
+		CreateDate:   time.Now().Local(),
+		LastUpdate:   time.Now().Local(),
+	}
+
+	return g
+}
+
+func (g *Goal) validate(cr Cursor, funcName string) err.Error {
+	var err err.Error
+
+	// Goals without currency are saved in the base currency
+	if g.Currency == "" {
+		if e := cr.QueryRow("SELECT base_currency();").Scan(&g.Currency); e != nil {
+			err.Init(funcName, e.Error())
+			return err
+		}
+	}
+	g.Currency = strings.ToUpper(g.Currency)
+
+	if g.Name == "" {
+		err.Init(funcName, "The goal does not have a name")
+	} else if g.TargetAmount <= 0 {
+		err.Init(funcName, "The target amount of a goal must be bigger than 0")
+	} else if !ValidCurrency(g.Currency) {
+		err.Init(funcName, "The currency must be a three letter code like EUR: "+g.Currency)
+	} else if len(g.AccountIDs) == 0 {
+		err.Init(funcName, "The goal is not linked to an account")
+	}
+
+	return err
+}
+
+// writeAccounts replaces the linked accounts of the goal with AccountIDs
+func (g *Goal) writeAccounts(cr *sql.Tx) err.Error {
+	if _, e := cr.Exec("DELETE FROM goal_accounts WHERE goal_id=$1", g.ID); e != nil {
+		var err err.Error
+		err.Init("Goal.writeAccounts()", e.Error())
+		return err
+	}
+
+	for _, id := range g.AccountIDs {
+		if _, e := cr.Exec("INSERT INTO goal_accounts (goal_id, account_id) VALUES ($1, $2)", g.ID, id); e != nil {
+			var err err.Error
+			err.Init("Goal.writeAccounts()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+// Create 's the goal and links it's accounts, run it with withTransaction
+func (g *Goal) Create(cr *sql.Tx) err.Error {
+	if g.ID != 0 {
+		var err err.Error
+		err.Init("Goal.Create()", "This object already has an id")
+		return err
+	}
+	if err := g.validate(cr, "Goal.Create()"); !err.Empty() {
+		return err
+	}
+
+	g.CreateDate = time.Now().Local()
+	g.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO goals (name, description, target_amount, currency, deadline, active, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		g.Name,
+		g.Description,
+		g.TargetAmount,
+		g.Currency,
+		g.Deadline,
+		g.Active,
+		g.CreateDate,
+		g.LastUpdate,
+	).Scan(&g.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Goal.Create()", e.Error())
+		return err
+	}
+
+	if err := g.writeAccounts(cr); !err.Empty() {
+		err.AddTraceback("Goal.Create()", "Error while linking the accounts.")
+		return err
+	}
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the goal and replaces it's linked accounts, run it with withTransaction
+func (g *Goal) Save(cr *sql.Tx) err.Error {
+	if g.ID <= 0 {
+		var err err.Error
+		err.Init("Goal.Save()", "This goal has no ID, maybe create it first?")
+		return err
+	}
+	if err := g.validate(cr, "Goal.Save()"); !err.Empty() {
+		return err
+	}
+
+	g.LastUpdate = time.Now().Local()
+
+	query := "UPDATE goals SET name=$2, description=$3, target_amount=$4, currency=$5, deadline=$6, active=$7, "
+	query += "last_update=$8 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		g.ID,
+		g.Name,
+		g.Description,
+		g.TargetAmount,
+		g.Currency,
+		g.Deadline,
+		g.Active,
+		g.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Goal.Save()", e.Error())
+		return err
+	}
+
+	if err := g.writeAccounts(cr); !err.Empty() {
+		err.AddTraceback("Goal.Save()", "Error while linking the accounts.")
+		return err
+	}
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the goal, the links to the accounts are deleted with it
+func (g *Goal) Delete(cr Cursor) err.Error {
+	if g.ID <= 0 {
+		var err err.Error
+		err.Init("Goal.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM goals WHERE id=$1", g.ID); e != nil {
+		var err err.Error
+		err.Init("Goal.Delete()", e.Error())
+		return err
+	}
+
+	g.ID = 0
+
+	return err.Error{}
+}
+
+// monthsUntil returns the number of started months from now until the deadline
+func monthsUntil(now, deadline time.Time) int64 {
+	var months int64
+	for d := now; d.Before(deadline); d = d.AddDate(0, 1, 0) {
+		months++
+	}
+	return months
+}
+
+func (g *Goal) computeFields(cr Cursor) {
+	now := time.Now().Local()
+
+	// Compute: AccountNames
+	g.AccountNames = nil
+	for _, id := range g.AccountIDs {
+		a, err := FindAccountByID(cr, id)
+		if !err.Empty() {
+			err.AddTraceback("Goal.computeFields()", "Error while finding account by ID: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			continue
+		}
+		g.AccountNames = append(g.AccountNames, a.Name)
+	}
+
+	// Compute: CurrentAmount, the balances converted with today's exchange rate
+	query := "SELECT COALESCE(SUM(round(b.balance * exchange_rate(b.currency, $2, CURRENT_DATE), 2)), 0) "
+	query += "FROM account_balances AS b JOIN goal_accounts AS ga ON ga.account_id=b.account_id WHERE ga.goal_id=$1"
+
+	if e := cr.QueryRow(query, g.ID, g.Currency).Scan(&g.CurrentAmount); e != nil {
+		var err err.Error
+		err.Init("Goal.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+
+	// Compute: Remaining, Percent, Reached
+	g.Remaining = g.TargetAmount - g.CurrentAmount
+	if g.Remaining < 0 {
+		g.Remaining = 0
+	}
+	g.Reached = g.Remaining == 0
+	g.Percent = 100
+	if g.TargetAmount > 0 && !g.Reached {
+		g.Percent = int64(g.CurrentAmount) * 100 / int64(g.TargetAmount)
+		if g.Percent < 0 {
+			g.Percent = 0
+		}
+	}
+
+	// Compute: MonthsLeft, MonthlyContribution, Overdue
+	// Goals whose deadline has passed need the remaining amount right away
+	g.DeadlineStr = g.Deadline.Format(dateLayout)
+	g.MonthsLeft = monthsUntil(now, g.Deadline)
+	g.Overdue = !g.Reached && g.MonthsLeft == 0
+	g.MonthlyContribution = g.Remaining
+	if g.MonthsLeft > 1 {
+		// Round up, so the target is reached with the last contribution
+		g.MonthlyContribution = Money((int64(g.Remaining) + g.MonthsLeft - 1) / g.MonthsLeft)
+	}
+}
+
+// FindByID finds a goal with it's id
+func (g *Goal) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, description, target_amount, currency, deadline, active, create_date, last_update "
+	query += "FROM goals WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&g.ID,
+		&g.Name,
+		&g.Description,
+		&g.TargetAmount,
+		&g.Currency,
+		&g.Deadline,
+		&g.Active,
+		&g.CreateDate,
+		&g.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Goal.FindByID()", e.Error())
+		return err
+	}
+
+	rows, e := cr.Query("SELECT account_id FROM goal_accounts WHERE goal_id=$1 ORDER BY account_id", g.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Goal.FindByID()", e.Error())
+		return err
+	}
+
+	g.AccountIDs = nil
+	for rows.Next() {
+		var accountID int64
+		if e = rows.Scan(&accountID); e != nil {
+			log.Println("[INFO] Goal.FindByID(): Skipping account")
+			log.Printf("[WARN] Goal.FindByID(): %s\n", e)
+			continue
+		}
+		g.AccountIDs = append(g.AccountIDs, accountID)
+	}
+	rows.Close()
+
+	g.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindGoalByID is similar to FindByID but returns the goal
+func FindGoalByID(cr Cursor, id int64) (Goal, err.Error) {
+	g := EmptyGoal()
+
+	if e := g.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindGoalByID()", "Error while finding goal by ID: "+fmt.Sprintf("%d", id))
+		return g, e
+	}
+
+	return g, err.Error{}
+}
+
+// GetAllGoals returns all goals, the active ones ordered by their deadline first
+// If activeOnly is true, inactive goals are left out
+func GetAllGoals(cr Cursor, activeOnly bool) ([]Goal, err.Error) {
+	var ids []int64
+	var result []Goal
+
+	query := "SELECT id FROM goals "
+	if activeOnly {
+		query += "WHERE active=true "
+	}
+	query += "ORDER BY active DESC, deadline, id"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllGoals()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllGoals(): Skipping record")
+			log.Printf("[WARN] GetAllGoals(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		g, err := FindGoalByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllGoals(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, g)
+	}
+
+	return result, err.Error{}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#           Import           #
+	#                            #
+	##############################
+*/
+
+// handleTransactionImport previews the transactions of an uploaded statement with the chosen mapping and account
+// The preview posts the statement again with the ticked lines, which are booked then
+func handleTransactionImport(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/transactions/import/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleTransactionImport()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Import Transactions"
+	ctx["Booked"] = r.URL.Query().Get("booked")
+
+	m := EmptyImportMapping()
+	if id, parseErr := strconv.ParseInt(r.URL.Query().Get("mapping"), 10, 64); parseErr == nil {
+		if e = m.FindByID(db, id); !e.Empty() {
+			e.AddTraceback("handleTransactionImport()", "Error finding import mapping: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", e)
+			m = EmptyImportMapping()
+		}
+	}
+	accountID := m.AccountID
+
+	if r.Method == http.MethodPost {
+		var content string
+		var readErr error
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if readErr = r.ParseMultipartForm(1 << 20); readErr == nil {
+				if file, _, fileErr := r.FormFile("file"); fileErr != nil {
+					ctx["Error"] = "Please choose a statement"
+				} else {
+					content, readErr = readStatement(file)
+					file.Close()
+				}
+			}
+		} else {
+			r.ParseForm()
+			content = r.FormValue("content")
+		}
+
+		if readErr != nil {
+			ctx["Error"] = "The statement could not be uploaded: " + readErr.Error()
+		}
+
+		mappingID, _ := strconv.ParseInt(r.FormValue("mapping"), 10, 64)
+		accountID, _ = strconv.ParseInt(r.FormValue("account"), 10, 64)
+
+		if e = m.FindByID(db, mappingID); !e.Empty() {
+			e.AddTraceback("handleTransactionImport()", "Error finding import mapping: "+fmt.Sprintf("%d", mappingID))
+			log.Println("[WARN]", e)
+			ctx["Error"] = "Please choose the mapping of the bank"
+			m = EmptyImportMapping()
+		}
+
+		if ctx["Error"] == nil && r.FormValue("book") != "" {
+			selected := []int{}
+			for _, val := range r.Form["line"] {
+				if line, convErr := strconv.Atoi(val); convErr == nil {
+					selected = append(selected, line)
+				}
+			}
+
+			var booked []ImportLine
+
+			e = withTransaction(db, func(tx *sql.Tx) err.Error {
+				lines, importErr := ParseImport(tx, m, accountID, strings.NewReader(content))
+				if !importErr.Empty() {
+					return importErr
+				}
+				booked, importErr = BookImport(tx, webActor(ctx), lines, selected)
+				return importErr
+			})
+			if e.Empty() {
+				redirect := fmt.Sprintf("/transactions/import/?mapping=%d&booked=%d", m.ID, len(booked))
+				http.Redirect(w, r, redirect, http.StatusSeeOther)
+				return
+			}
+
+			e.AddTraceback("handleTransactionImport()", "Error while booking the statement.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The transactions could not be booked: " + e.Error()
+		} else if ctx["Error"] == nil {
+			if ctx["Lines"], e = ParseImport(db, m, accountID, strings.NewReader(content)); !e.Empty() {
+				e.AddTraceback("handleTransactionImport()", "Error while reading the statement.")
+				log.Println("[WARN]", e)
+				ctx["Error"] = "The statement could not be read: " + e.Error()
+			} else {
+				ctx["Content"] = content
+			}
+		}
+	}
+
+	ctx["Mapping"] = m
+	ctx["AccountID"] = accountID
+
+	if ctx["Mappings"], e = GetAllImportMappings(db); !e.Empty() {
+		e.AddTraceback("handleTransactionImport()", "Error while getting the import mappings.")
+		log.Println("[WARN]", e)
+	}
+	if ctx["Accounts"], e = GetAllAccounts(db); !e.Empty() {
+		e.AddTraceback("handleTransactionImport()", "Error while getting the accounts.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "transaction_import.html", ctx); err != nil {
+		e.Init("handleTransactionImport()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+// handleImportMappings lists the import mappings, the mapping ?id= is edited in the form
+// A POST creates or saves the mapping of the form or deletes the mapping of the field delete
+func handleImportMappings(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/transactions/import/mappings/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleImportMappings()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Import Mappings"
+	ctx["DateFormats"] = GetAllImportDateFormats()
+	ctx["Btn"] = "Create Mapping"
+
+	m := EmptyImportMapping()
+
+	if id, parseErr := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64); parseErr == nil {
+		if e = m.FindByID(db, id); !e.Empty() {
+			e.AddTraceback("handleImportMappings()", "Error finding import mapping: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", e)
+			m = EmptyImportMapping()
+		} else {
+			ctx["Btn"] = "Save Mapping"
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if id := r.FormValue("delete"); id != "" {
+			mappingID, _ := strconv.ParseInt(id, 10, 64)
+
+			deleted := EmptyImportMapping()
+			if e = deleted.FindByID(db, mappingID); e.Empty() {
+				before := auditSnapshot(deleted)
+				e = withTransaction(db, func(tx *sql.Tx) err.Error {
+					if e := deleted.Delete(tx); !e.Empty() {
+						return e
+					}
+					return LogAudit(tx, webActor(ctx), AuditDelete, AuditImport, mappingID, before, nil)
+				})
+			}
+		} else {
+			before := auditSnapshot(m)
+			create := m.ID == 0
+
+			m.Name = r.FormValue("name")
+			m.Delimiter = r.FormValue("delimiter")
+			m.DateFormat = r.FormValue("date_format")
+			m.DecimalSeparator = r.FormValue("decimal_separator")
+			m.SkipLines, _ = strconv.ParseInt(r.FormValue("skip_lines"), 10, 64)
+			m.DateColumn, _ = strconv.ParseInt(r.FormValue("date_column"), 10, 64)
+			m.AmountColumn, _ = strconv.ParseInt(r.FormValue("amount_column"), 10, 64)
+			m.NameColumn, _ = strconv.ParseInt(r.FormValue("name_column"), 10, 64)
+			m.CounterpartyColumn, _ = strconv.ParseInt(r.FormValue("counterparty_column"), 10, 64)
+			m.IbanColumn, _ = strconv.ParseInt(r.FormValue("iban_column"), 10, 64)
+			m.DescriptionColumn, _ = strconv.ParseInt(r.FormValue("description_column"), 10, 64)
+			m.AccountID, _ = strconv.ParseInt(r.FormValue("account"), 10, 64)
+
+			e = withTransaction(db, func(tx *sql.Tx) err.Error {
+				if create {
+					if e := m.Create(tx); !e.Empty() {
+						return e
+					}
+					return LogAudit(tx, webActor(ctx), AuditCreate, AuditImport, m.ID, nil, m)
+				}
+				if e := m.Save(tx); !e.Empty() {
+					return e
+				}
+				return LogAudit(tx, webActor(ctx), AuditUpdate, AuditImport, m.ID, before, m)
+			})
+			if !e.Empty() && create {
+				m.ID = 0
+			}
+		}
+
+		if !e.Empty() {
+			e.AddTraceback("handleImportMappings()", "Error while writing the import mapping.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The import mapping could not be saved or deleted: " + e.Error()
+		} else {
+			http.Redirect(w, r, "/transactions/import/mappings/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	ctx["ImportMapping"] = m
+
+	if ctx["Mappings"], e = GetAllImportMappings(db); !e.Empty() {
+		e.AddTraceback("handleImportMappings()", "Error while getting the import mappings.")
+		log.Println("[WARN]", e)
+	}
+	if ctx["Accounts"], e = GetAllAccounts(db); !e.Empty() {
+		e.AddTraceback("handleImportMappings()", "Error while getting the accounts.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "import_mappings.html", ctx); err != nil {
+		e.Init("handleImportMappings()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nitohu/err"
+)
+
+// GetAllImportDateFormats returns the date formats of bank statements as Go layouts
+func GetAllImportDateFormats() []string {
+	return []string{
+		"02.01.2006",
+		"02.01.06",
+		"2006-01-02",
+		"02/01/2006",
+		"01/02/2006",
+	}
+}
+
+// GetAllImportDelimiters returns the characters which can separate the columns of a statement
+func GetAllImportDelimiters() []string {
+	return []string{";", ",", "\t"}
+}
+
+// ImportMapping describes the CSV statements of a bank, e.g. "02.01.2006" and "1.234,56" for German banks
+// The columns are counted from 1, the ones which are 0 are not imported
+// SkipLines are the lines before the first transaction, like the header
+// AccountID is the account the statements are booked into unless another one is chosen, 0 for none
+type ImportMapping struct {
+	ID                 int64
+	Name               string
+	Delimiter          string
+	SkipLines          int64
+	DateFormat         string
+	DecimalSeparator   string
+	DateColumn         int64
+	AmountColumn       int64
+	NameColumn         int64
+	CounterpartyColumn int64
+	IbanColumn         int64
+	DescriptionColumn  int64
+	AccountID          int64
+	CreateDate         time.Time
+	LastUpdate         time.Time
+
+	// Computed fields
+	AccountName string
+}
+
+// ImportLine is a line of a statement and the transaction it's booked as
+// Amount is the signed amount of the statement, negative amounts are paid from the account
+// Lines with an Error can't be booked, Duplicate lines look like a transaction which was booked before
+type ImportLine struct {
+	Line        int
+	Amount      Money
+	Transaction Transaction
+	Duplicate   bool
+	Error       string
+
+	// Computed fields
+	CategoryName string
+}
+
+// EmptyImportMapping returns an empty import mapping with the format of German banks
+func EmptyImportMapping() ImportMapping {
+	m := ImportMapping{
+		ID:                 0,
+		Name:               "",
+		Delimiter:          ";",
+		SkipLines:          1,
+		DateFormat:         "02.01.2006",
+		DecimalSeparator:   ",",
+		DateColumn:         0,
+		AmountColumn:       0,
+		NameColumn:         0,
+		CounterpartyColumn: 0,
+		IbanColumn:         0,
+		DescriptionColumn:  0,
+		AccountID:          0,
+		CreateDate:         time.Now().Local(),
+		LastUpdate:         time.Now().Local(),
+	}
+
+	return m
+}
+
+func (m *ImportMapping) validate(funcName string) err.Error {
+	var err err.Error
+
+	m.Name = strings.TrimSpace(m.Name)
+
+	columns := []int64{m.DateColumn, m.AmountColumn, m.NameColumn, m.CounterpartyColumn, m.IbanColumn, m.DescriptionColumn}
+	negative := false
+	for _, c := range columns {
+		negative = negative || c < 0
+	}
+
+	if m.Name == "" {
+		err.Init(funcName, "The import mapping does not have a name")
+	} else if !StrContains(GetAllImportDelimiters(), m.Delimiter) {
+		err.Init(funcName, "Unknown delimiter: "+m.Delimiter)
+	} else if !StrContains(GetAllImportDateFormats(), m.DateFormat) {
+		err.Init(funcName, "Unknown date format: "+m.DateFormat)
+	} else if m.DecimalSeparator != "," && m.DecimalSeparator != "." {
+		err.Init(funcName, "The decimal separator must be a comma or a dot")
+	} else if m.SkipLines < 0 || negative {
+		err.Init(funcName, "The skipped lines and the columns can't be negative")
+	} else if m.DateColumn == 0 || m.AmountColumn == 0 {
+		err.Init(funcName, "The columns of the date and the amount are needed")
+	} else if m.NameColumn == 0 && m.CounterpartyColumn == 0 {
+		err.Init(funcName, "The column of the name or of the counterparty is needed")
+	}
+
+	return err
+}
+
+// accountID returns the account for the database, nil for mappings without an account
+func (m *ImportMapping) accountID() interface{} {
+	if m.AccountID <= 0 {
+		return nil
+	}
+	return m.AccountID
+}
+
+// Create 's the import mapping
+func (m *ImportMapping) Create(cr Cursor) err.Error {
+	if m.ID != 0 {
+		var err err.Error
+		err.Init("ImportMapping.Create()", "This object already has an id")
+		return err
+	} else if err := m.validate("ImportMapping.Create()"); !err.Empty() {
+		return err
+	}
+
+	m.CreateDate = time.Now().Local()
+	m.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO import_mappings (name, delimiter, skip_lines, date_format, decimal_separator, date_column, "
+	query += "amount_column, name_column, counterparty_column, iban_column, description_column, account_id, create_date, "
+	query += "last_update) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		m.Name,
+		m.Delimiter,
+		m.SkipLines,
+		m.DateFormat,
+		m.DecimalSeparator,
+		m.DateColumn,
+		m.AmountColumn,
+		m.NameColumn,
+		m.CounterpartyColumn,
+		m.IbanColumn,
+		m.DescriptionColumn,
+		m.accountID(),
+		m.CreateDate,
+		m.LastUpdate,
+	).Scan(&m.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("ImportMapping.Create()", e.Error())
+		return err
+	}
+
+	m.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the import mapping
+func (m *ImportMapping) Save(cr Cursor) err.Error {
+	if m.ID <= 0 {
+		var err err.Error
+		err.Init("ImportMapping.Save()", "This import mapping has no ID, maybe create it first?")
+		return err
+	} else if err := m.validate("ImportMapping.Save()"); !err.Empty() {
+		return err
+	}
+
+	m.LastUpdate = time.Now().Local()
+
+	query := "UPDATE import_mappings SET name=$2, delimiter=$3, skip_lines=$4, date_format=$5, decimal_separator=$6, "
+	query += "date_column=$7, amount_column=$8, name_column=$9, counterparty_column=$10, iban_column=$11, "
+	query += "description_column=$12, account_id=$13, last_update=$14 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		m.ID,
+		m.Name,
+		m.Delimiter,
+		m.SkipLines,
+		m.DateFormat,
+		m.DecimalSeparator,
+		m.DateColumn,
+		m.AmountColumn,
+		m.NameColumn,
+		m.CounterpartyColumn,
+		m.IbanColumn,
+		m.DescriptionColumn,
+		m.accountID(),
+		m.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("ImportMapping.Save()", e.Error())
+		return err
+	}
+
+	m.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the import mapping, the imported transactions are kept
+func (m *ImportMapping) Delete(cr Cursor) err.Error {
+	if m.ID <= 0 {
+		var err err.Error
+		err.Init("ImportMapping.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM import_mappings WHERE id=$1", m.ID); e != nil {
+		var err err.Error
+		err.Init("ImportMapping.Delete()", e.Error())
+		return err
+	}
+
+	m.ID = 0
+
+	return err.Error{}
+}
+
+func (m *ImportMapping) computeFields(cr Cursor) {
+	m.AccountName = ""
+
+	if m.AccountID == 0 {
+		return
+	}
+
+	if e := cr.QueryRow("SELECT name FROM accounts WHERE id=$1", m.AccountID).Scan(&m.AccountName); e != nil {
+		var err err.Error
+		err.Init("ImportMapping.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+}
+
+// FindByID finds an import mapping with it's id
+func (m *ImportMapping) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, delimiter, skip_lines, date_format, decimal_separator, date_column, amount_column, "
+	query += "name_column, counterparty_column, iban_column, description_column, account_id, create_date, last_update "
+	query += "FROM import_mappings WHERE id=$1"
+
+	var accountID sql.NullInt64
+
+	e := cr.QueryRow(query, id).Scan(
+		&m.ID,
+		&m.Name,
+		&m.Delimiter,
+		&m.SkipLines,
+		&m.DateFormat,
+		&m.DecimalSeparator,
+		&m.DateColumn,
+		&m.AmountColumn,
+		&m.NameColumn,
+		&m.CounterpartyColumn,
+		&m.IbanColumn,
+		&m.DescriptionColumn,
+		&accountID,
+		&m.CreateDate,
+		&m.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("ImportMapping.FindByID()", e.Error())
+		return err
+	}
+
+	m.AccountID = accountID.Int64
+
+	m.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindImportMappingByID is similar to FindByID but returns the import mapping
+func FindImportMappingByID(cr Cursor, id int64) (ImportMapping, err.Error) {
+	m := EmptyImportMapping()
+
+	if e := m.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindImportMappingByID()", "Error while finding import mapping by ID: "+fmt.Sprintf("%d", id))
+		return m, e
+	}
+
+	return m, err.Error{}
+}
+
+// GetAllImportMappings returns all import mappings ordered by their name
+func GetAllImportMappings(cr Cursor) ([]ImportMapping, err.Error) {
+	var ids []int64
+	var result []ImportMapping
+
+	rows, e := cr.Query("SELECT id FROM import_mappings ORDER BY name, id")
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllImportMappings()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllImportMappings(): Skipping record")
+			log.Printf("[WARN] GetAllImportMappings(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		m, err := FindImportMappingByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllImportMappings(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, m)
+	}
+
+	return result, err.Error{}
+}
+
+// column returns the value of a column of the record, an empty string if it's not mapped or missing
+func (m *ImportMapping) column(record []string, column int64) string {
+	if column <= 0 || int(column) > len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[column-1])
+}
+
+// parseAmount parses an amount in the format of the mapping, e.g. "-1.234,56" with the decimal separator ","
+func (m *ImportMapping) parseAmount(value string) (Money, error) {
+	thousands := "."
+	if m.DecimalSeparator == "." {
+		thousands = ","
+	}
+
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "'", "", thousands, "").Replace(value)
+	value = strings.Replace(value, m.DecimalSeparator, ".", 1)
+
+	return ParseMoney(value)
+}
+
+// parseDate parses a date in the format of the mapping as local date, e.g. "31.01.2026" with the format "02.01.2006"
+func (m *ImportMapping) parseDate(value string) (time.Time, error) {
+	return time.ParseInLocation(m.DateFormat, value, time.Local)
+}
+
+// readStatement returns the content of a statement as UTF-8
+// Banks often export in Latin-1, content which isn't valid UTF-8 is read as Latin-1
+func readStatement(content io.Reader) (string, error) {
+	data, e := ioutil.ReadAll(content)
+	if e != nil {
+		return "", e
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes), nil
+}
+
+// ParseImport reads a statement with the mapping and returns the transactions it books into the account
+// Negative amounts are paid from the account, positive ones are received
+// The transactions are previewed with their payee and the category and tags of the rules, nothing is written
+// A line is a duplicate if the account already has more transactions with the same date, amount and name
+// than the lines before it in the statement
+func ParseImport(cr Cursor, m ImportMapping, accountID int64, content io.Reader) ([]ImportLine, err.Error) {
+	var result []ImportLine
+
+	account, err := FindAccountByID(cr, accountID)
+	if !err.Empty() {
+		err.AddTraceback("ParseImport()", "Error while finding the account: "+fmt.Sprintf("%d", accountID))
+		return nil, err
+	} else if !account.Active {
+		err.Init("ParseImport()", "The account "+account.Name+" is closed")
+		return nil, err
+	}
+
+	statement, e := readStatement(content)
+	if e != nil {
+		err.Init("ParseImport()", e.Error())
+		return nil, err
+	}
+
+	rules, err := GetAllRules(cr, true)
+	if !err.Empty() {
+		err.AddTraceback("ParseImport()", "Error while getting the rules.")
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(statement))
+	reader.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	seen := make(map[string]int64)
+
+	for line := 1; ; line++ {
+		record, e := reader.Read()
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			err.Init("ParseImport()", e.Error())
+			return nil, err
+		}
+
+		if int64(line) <= m.SkipLines || strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		l := ImportLine{Line: line}
+		result = append(result, l)
+		r := &result[len(result)-1]
+
+		date, dateErr := m.parseDate(m.column(record, m.DateColumn))
+		amount, amountErr := m.parseAmount(m.column(record, m.AmountColumn))
+		name := m.column(record, m.NameColumn)
+		counterparty := m.column(record, m.CounterpartyColumn)
+		iban := strings.ToUpper(strings.ReplaceAll(m.column(record, m.IbanColumn), " ", ""))
+
+		if name == "" {
+			name = counterparty
+		}
+
+		if dateErr != nil {
+			r.Error = "Invalid date: " + m.column(record, m.DateColumn)
+			continue
+		} else if amountErr != nil || amount == 0 {
+			r.Error = "Invalid amount: " + m.column(record, m.AmountColumn)
+			continue
+		} else if name == "" {
+			r.Error = "The line has neither a name nor a counterparty"
+			continue
+		}
+
+		t := EmptyTransaction()
+		t.Active = true
+		t.Name = name
+		t.TransactionDate = date
+		t.TransactionDateStr = date.Format(dateLayout)
+		t.Amount = amount.Abs()
+		r.Amount = amount
+
+		if amount < 0 {
+			t.FromAccount = account.ID
+		} else {
+			t.ToAccount = account.ID
+		}
+
+		// The counterparty and it's IBAN are kept in the description unless they are the name
+		var description []string
+		if counterparty != "" && counterparty != name {
+			description = append(description, counterparty)
+		}
+		if iban != "" {
+			description = append(description, iban)
+		}
+		if d := m.column(record, m.DescriptionColumn); d != "" {
+			description = append(description, d)
+		}
+		t.Description = strings.Join(description, "\n")
+
+		// The payee is found by the IBAN, then by the counterparty and at last by the name when it's booked
+		if iban != "" {
+			if e = cr.QueryRow("SELECT id FROM payees WHERE active=true AND upper(replace(iban, ' ', ''))=$1 LIMIT 1", iban).Scan(&t.PayeeID); e != nil && e != sql.ErrNoRows {
+				err.Init("ParseImport()", e.Error())
+				return nil, err
+			}
+		}
+		if t.PayeeID == 0 && counterparty != "" {
+			if t.PayeeID, err = MatchPayee(cr, counterparty); !err.Empty() {
+				err.AddTraceback("ParseImport()", "Error while matching the payee of: "+counterparty)
+				return nil, err
+			}
+		}
+
+		if lineErr := t.validateType(); !lineErr.Empty() {
+			r.Error = lineErr.Error()
+			r.Transaction = t
+			continue
+		} else if lineErr = checkPeriodOpen(cr, t.TransactionDate, "ParseImport()"); !lineErr.Empty() {
+			r.Error = lineErr.Error()
+			r.Transaction = t
+			continue
+		} else if lineErr = t.resolveAmounts(cr); !lineErr.Empty() {
+			r.Error = lineErr.Error()
+			r.Transaction = t
+			continue
+		}
+
+		t.applyRules(rules)
+		if err = t.resolvePayee(cr); !err.Empty() {
+			err.AddTraceback("ParseImport()", "Error while finding the payee of: "+t.Name)
+			return nil, err
+		}
+
+		if t.PayeeID != 0 {
+			if e = cr.QueryRow("SELECT name FROM payees WHERE id=$1", t.PayeeID).Scan(&t.PayeeName); e != nil {
+				err.Init("ParseImport()", e.Error())
+				return nil, err
+			}
+		}
+		if t.CategoryID != 0 {
+			if e = cr.QueryRow("SELECT name FROM categories WHERE id=$1", t.CategoryID).Scan(&r.CategoryName); e != nil {
+				err.Init("ParseImport()", e.Error())
+				return nil, err
+			}
+		}
+
+		r.Transaction = t
+
+		// Duplicates
+		var booked int64
+
+		query := "SELECT COUNT(*) FROM transactions WHERE active=true AND transaction_date::date=$1::date "
+		query += "AND amount=$2 AND name=$3 AND COALESCE(account_id, 0)=$4 AND COALESCE(to_account, 0)=$5"
+
+		if e = cr.QueryRow(query, date.Format(dateInputLayout), t.Amount, t.Name, t.FromAccount, t.ToAccount).Scan(&booked); e != nil {
+			err.Init("ParseImport()", e.Error())
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s|%s|%s", date.Format(dateInputLayout), amount, t.Name)
+		r.Duplicate = seen[key] < booked
+		seen[key]++
+	}
+
+	return result, err
+}
+
+// BookImport creates the transactions of the lines, the new transactions are written to the audit log with actor
+// Without selected the lines which are neither invalid nor duplicates are booked, otherwise the lines with these numbers
+// Returns the booked lines with the ids of their transactions, run it with withTransaction
+func BookImport(cr *sql.Tx, actor string, lines []ImportLine, selected []int) ([]ImportLine, err.Error) {
+	var result []ImportLine
+
+	for _, l := range lines {
+		if l.Error != "" {
+			continue
+		} else if selected == nil && l.Duplicate {
+			continue
+		} else if selected != nil && !intContains(selected, l.Line) {
+			continue
+		}
+
+		t := l.Transaction
+		if err := t.Create(cr); !err.Empty() {
+			err.AddTraceback("BookImport()", fmt.Sprintf("Error while booking line %d: %s", l.Line, t.Name))
+			return nil, err
+		}
+		if err := LogAudit(cr, actor, AuditCreate, AuditTransaction, t.ID, nil, t); !err.Empty() {
+			err.AddTraceback("BookImport()", "Error while logging the creation of transaction: "+fmt.Sprintf("%d", t.ID))
+			return nil, err
+		}
+
+		l.Transaction = t
+		result = append(result, l)
+	}
+
+	return result, err.Error{}
+}
+
+// intContains returns true if a contains e
+func intContains(a []int, e int) bool {
+	for _, i := range a {
+		if i == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImportParseAmount(t *testing.T) {
+	tests := []struct {
+		separator string
+		input     string
+		want      Money
+		ok        bool
+	}{
+		// German statements
+		{",", "1.234,56", 123456, true},
+		{",", "-1.234,56", -123456, true},
+		{",", "-0,5", -50, true},
+		{",", "+12,00", 1200, true},
+		{",", "1 234,56", 123456, true},
+		{",", "1\u00a0234,56", 123456, true},
+		{",", "1.234", 123400, true},
+		{",", "1.234.567,89", 123456789, true},
+		{",", "0,005", 1, true},
+		{",", "1,2,3", 0, false},
+		// Swiss and English statements
+		{".", "1'234.56", 123456, true},
+		{".", "1,234.56", 123456, true},
+		{".", "-0.5", -50, true},
+		{".", "1.2.3", 0, false},
+		{",", "", 0, false},
+		{",", "abc", 0, false},
+	}
+
+	for _, test := range tests {
+		m := EmptyImportMapping()
+		m.DecimalSeparator = test.separator
+
+		got, e := m.parseAmount(test.input)
+		if test.ok && e != nil {
+			t.Errorf("parseAmount(%q) with %q returned error: %v", test.input, test.separator, e)
+		} else if !test.ok && e == nil {
+			t.Errorf("parseAmount(%q) with %q = %v, expected an error", test.input, test.separator, got)
+		} else if got != test.want {
+			t.Errorf("parseAmount(%q) with %q = %v, expected %v", test.input, test.separator, got, test.want)
+		}
+	}
+}
+
+func TestImportParseDate(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   time.Time
+		ok     bool
+	}{
+		{"02.01.2006", "31.01.2026", at(2026, 1, 31, 0, 0), true},
+		{"02.01.06", "31.01.26", at(2026, 1, 31, 0, 0), true},
+		{"2006-01-02", "2026-01-31", at(2026, 1, 31, 0, 0), true},
+		{"02/01/2006", "03/02/2026", at(2026, 2, 3, 0, 0), true},
+		{"01/02/2006", "03/02/2026", at(2026, 3, 2, 0, 0), true},
+		{"02.01.2006", "32.01.2026", time.Time{}, false},
+		{"02.01.2006", "2026-01-31", time.Time{}, false},
+		{"01/02/2006", "31/01/2026", time.Time{}, false},
+		{"02.01.2006", "", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		m := EmptyImportMapping()
+		m.DateFormat = test.format
+
+		got, e := m.parseDate(test.input)
+		if test.ok && e != nil {
+			t.Errorf("parseDate(%q) with %q returned error: %v", test.input, test.format, e)
+		} else if !test.ok && e == nil {
+			t.Errorf("parseDate(%q) with %q = %s, expected an error", test.input, test.format, got.Format(dateLayout))
+		} else if test.ok && !got.Equal(test.want) {
+			t.Errorf("parseDate(%q) with %q = %s, expected %s", test.input, test.format, got.Format(dateLayout), test.want.Format(dateLayout))
+		}
+	}
+}
+
+func TestImportDateFormats(t *testing.T) {
+	// Every format which can be chosen has to read the dates it writes
+	date := at(2026, 1, 31, 0, 0)
+
+	for _, format := range GetAllImportDateFormats() {
+		m := EmptyImportMapping()
+		m.DateFormat = format
+
+		if got, e := m.parseDate(date.Format(format)); e != nil || !got.Equal(date) {
+			t.Errorf("parseDate(%q) with %q = %s, %v, expected %s", date.Format(format), format, got.Format(dateLayout), e, date.Format(dateLayout))
+		}
+	}
+}
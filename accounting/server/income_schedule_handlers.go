@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#      Income Schedules      #
+	#                            #
+	##############################
+*/
+
+// handleIncomeSchedules lists the income schedules, the schedule ?id= is edited in the form
+// A POST creates or saves the schedule of the form or deletes the schedule of the field delete
+func handleIncomeSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/income/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleIncomeSchedules()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Income Schedules"
+	ctx["Frequencies"] = GetAllIncomeFrequencies()
+	ctx["WeekendRules"] = GetAllWeekendRules()
+	ctx["Btn"] = "Create Schedule"
+
+	s := EmptyIncomeSchedule()
+
+	if id, parseErr := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64); parseErr == nil {
+		if e = s.FindByID(db, id); !e.Empty() {
+			e.AddTraceback("handleIncomeSchedules()", "Error finding income schedule: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", e)
+			s = EmptyIncomeSchedule()
+		} else {
+			ctx["Btn"] = "Save Schedule"
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		if id := r.FormValue("delete"); id != "" {
+			scheduleID, _ := strconv.ParseInt(id, 10, 64)
+
+			deleted := EmptyIncomeSchedule()
+			if e = deleted.FindByID(db, scheduleID); e.Empty() {
+				before := auditSnapshot(deleted)
+				e = withTransaction(db, func(tx *sql.Tx) err.Error {
+					if e := deleted.Delete(tx); !e.Empty() {
+						return e
+					}
+					return LogAudit(tx, webActor(ctx), AuditDelete, AuditIncome, scheduleID, before, nil)
+				})
+			}
+		} else {
+			before := auditSnapshot(s)
+			create := s.ID == 0
+
+			s.Name = r.FormValue("name")
+			s.Active = r.FormValue("active") == "on"
+			s.Default = r.FormValue("default") == "on"
+			s.Frequency = r.FormValue("frequency")
+			s.WeekendRule = r.FormValue("weekend_rule")
+			if anchor, parseErr := time.ParseInLocation(dateInputLayout, r.FormValue("anchor_date"), time.Local); parseErr == nil {
+				s.AnchorDate = anchor
+			}
+
+			e = withTransaction(db, func(tx *sql.Tx) err.Error {
+				if create {
+					if e := s.Create(tx); !e.Empty() {
+						return e
+					}
+					return LogAudit(tx, webActor(ctx), AuditCreate, AuditIncome, s.ID, nil, s)
+				}
+				if e := s.Save(tx); !e.Empty() {
+					return e
+				}
+				return LogAudit(tx, webActor(ctx), AuditUpdate, AuditIncome, s.ID, before, s)
+			})
+			if !e.Empty() && create {
+				s.ID = 0
+			}
+		}
+
+		if !e.Empty() {
+			e.AddTraceback("handleIncomeSchedules()", "Error while writing the income schedule.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The income schedule could not be saved or deleted: " + e.Error()
+		} else {
+			http.Redirect(w, r, "/settings/income/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	ctx["Schedule"] = s
+	ctx["AnchorDate"] = s.AnchorDate.Format(dateInputLayout)
+
+	if ctx["Schedules"], e = GetAllIncomeSchedules(db); !e.Empty() {
+		e.AddTraceback("handleIncomeSchedules()", "Error while getting the income schedules.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "settings_income.html", ctx); err != nil {
+		e.Init("handleIncomeSchedules()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Frequencies of an income schedule, stored in Frequency
+const (
+	// IncomeWeekly is paid every 7 days from the anchor date
+	IncomeWeekly = "weekly"
+	// IncomeBiweekly is paid every 14 days from the anchor date
+	IncomeBiweekly = "biweekly"
+	// IncomeMonthly is paid on the day of the month of the anchor date, or the last day of shorter months
+	IncomeMonthly = "monthly"
+	// IncomeLastBusinessDay is paid on the last working day (Monday to Friday) of every month
+	IncomeLastBusinessDay = "last_business_day"
+)
+
+// Rules for paydays on a weekend, stored in WeekendRule
+const (
+	// WeekendKeep keeps paydays on saturdays and sundays
+	WeekendKeep = "keep"
+	// WeekendBefore pays on the friday before
+	WeekendBefore = "before"
+	// WeekendAfter pays on the monday after
+	WeekendAfter = "after"
+)
+
+// GetAllIncomeFrequencies returns all frequencies an income schedule can have
+func GetAllIncomeFrequencies() []string {
+	return []string{
+		IncomeWeekly,
+		IncomeBiweekly,
+		IncomeMonthly,
+		IncomeLastBusinessDay,
+	}
+}
+
+// GetAllWeekendRules returns all rules for paydays on a weekend
+func GetAllWeekendRules() []string {
+	return []string{
+		WeekendKeep,
+		WeekendBefore,
+		WeekendAfter,
+	}
+}
+
+// IncomeSchedule are the paydays of an income, e.g. the salary of one earner
+// The paydays are computed from the AnchorDate, which is any past or future payday
+// Accounts and account groups can use a schedule, all others use the Default schedule
+// NextDate is the next payday, it's shifted by ShiftIncomeSchedules and used by the statistics
+type IncomeSchedule struct {
+	ID          int64
+	Name        string
+	Active      bool
+	Frequency   string
+	AnchorDate  time.Time
+	WeekendRule string
+	Default     bool
+	NextDate    time.Time
+	CreateDate  time.Time
+	LastUpdate  time.Time
+
+	// Computed fields
+	AnchorDateStr string
+	NextDateStr   string
+}
+
+// EmptyIncomeSchedule returns an empty income schedule
+func EmptyIncomeSchedule() IncomeSchedule {
+	today := time.Now().Local()
+
+	s := IncomeSchedule{
+		ID:          0,
+		Name:        "",
+		Active:      true,
+		Frequency:   IncomeMonthly,
+		AnchorDate:  time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local),
+		WeekendRule: WeekendKeep,
+		Default:     false,
+		CreateDate:  today,
+		LastUpdate:  today,
+	}
+
+	return s
+}
+
+// payday returns the n-th payday counted from the anchor date, n can be negative
+func (s *IncomeSchedule) payday(n int) time.Time {
+	anchor := time.Date(s.AnchorDate.Year(), s.AnchorDate.Month(), s.AnchorDate.Day(), 0, 0, 0, 0, time.Local)
+
+	switch s.Frequency {
+	case IncomeWeekly:
+		return s.adjustWeekend(anchor.AddDate(0, 0, 7*n))
+	case IncomeBiweekly:
+		return s.adjustWeekend(anchor.AddDate(0, 0, 14*n))
+	case IncomeLastBusinessDay:
+		// The last day of the month, moved back to the friday if it's on the weekend
+		day := time.Date(anchor.Year(), anchor.Month()+time.Month(n)+1, 0, 0, 0, 0, 0, time.Local)
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, -1)
+		}
+		return day
+	}
+
+	// Monthly: the day of the anchor date, the last day of the month if the month is shorter
+	first := time.Date(anchor.Year(), anchor.Month()+time.Month(n), 1, 0, 0, 0, 0, time.Local)
+	last := first.AddDate(0, 1, -1)
+	if anchor.Day() > last.Day() {
+		return s.adjustWeekend(last)
+	}
+	return s.adjustWeekend(first.AddDate(0, 0, anchor.Day()-1))
+}
+
+// adjustWeekend moves a payday on a weekend with the weekend rule of the schedule
+func (s *IncomeSchedule) adjustWeekend(day time.Time) time.Time {
+	step := 0
+	if s.WeekendRule == WeekendBefore {
+		step = -1
+	} else if s.WeekendRule == WeekendAfter {
+		step = 1
+	}
+
+	for step != 0 && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+		day = day.AddDate(0, 0, step)
+	}
+	return day
+}
+
+// Cycle returns the last payday on or before date and the next payday after it
+func (s *IncomeSchedule) Cycle(date time.Time) (time.Time, time.Time) {
+	n := 0
+	for s.payday(n).After(date) {
+		n--
+	}
+	for !s.payday(n + 1).After(date) {
+		n++
+	}
+
+	return s.payday(n), s.payday(n + 1)
+}
+
+func (s *IncomeSchedule) validate(funcName string) err.Error {
+	var err err.Error
+
+	if s.Name == "" {
+		err.Init(funcName, "The income schedule does not have a name")
+		return err
+	}
+
+	valid := false
+	for _, f := range GetAllIncomeFrequencies() {
+		valid = valid || f == s.Frequency
+	}
+	if !valid {
+		err.Init(funcName, "Unknown frequency: "+s.Frequency)
+		return err
+	}
+
+	valid = false
+	for _, r := range GetAllWeekendRules() {
+		valid = valid || r == s.WeekendRule
+	}
+	if !valid {
+		err.Init(funcName, "Unknown weekend rule: "+s.WeekendRule)
+		return err
+	}
+
+	if s.AnchorDate.IsZero() {
+		err.Init(funcName, "The income schedule needs the date of a payday")
+		return err
+	}
+
+	return err
+}
+
+// clearDefault makes the schedule the only default one
+func (s *IncomeSchedule) clearDefault(cr Cursor, funcName string) err.Error {
+	if !s.Default {
+		return err.Error{}
+	}
+
+	if _, e := cr.Exec("UPDATE income_schedules SET is_default=false WHERE id<>$1", s.ID); e != nil {
+		var err err.Error
+		err.Init(funcName, e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// Create 's the income schedule
+func (s *IncomeSchedule) Create(cr Cursor) err.Error {
+	if s.ID != 0 {
+		var err err.Error
+		err.Init("IncomeSchedule.Create()", "This object already has an id")
+		return err
+	} else if err := s.validate("IncomeSchedule.Create()"); !err.Empty() {
+		return err
+	}
+
+	s.CreateDate = time.Now().Local()
+	s.LastUpdate = time.Now().Local()
+	_, s.NextDate = s.Cycle(time.Now().Local())
+
+	query := "INSERT INTO income_schedules (name, active, frequency, anchor_date, weekend_rule, is_default, next_date, "
+	query += "create_date, last_update) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		s.Name,
+		s.Active,
+		s.Frequency,
+		s.AnchorDate,
+		s.WeekendRule,
+		s.Default,
+		s.NextDate,
+		s.CreateDate,
+		s.LastUpdate,
+	).Scan(&s.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("IncomeSchedule.Create()", e.Error())
+		return err
+	}
+
+	if err := s.clearDefault(cr, "IncomeSchedule.Create()"); !err.Empty() {
+		return err
+	}
+
+	s.computeFields()
+
+	return err.Error{}
+}
+
+// Save 's the income schedule, the next payday is computed again
+func (s *IncomeSchedule) Save(cr Cursor) err.Error {
+	if s.ID <= 0 {
+		var err err.Error
+		err.Init("IncomeSchedule.Save()", "This income schedule has no ID, maybe create it first?")
+		return err
+	} else if err := s.validate("IncomeSchedule.Save()"); !err.Empty() {
+		return err
+	}
+
+	s.LastUpdate = time.Now().Local()
+	_, s.NextDate = s.Cycle(time.Now().Local())
+
+	query := "UPDATE income_schedules SET name=$2, active=$3, frequency=$4, anchor_date=$5, weekend_rule=$6, "
+	query += "is_default=$7, next_date=$8, last_update=$9 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		s.ID,
+		s.Name,
+		s.Active,
+		s.Frequency,
+		s.AnchorDate,
+		s.WeekendRule,
+		s.Default,
+		s.NextDate,
+		s.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("IncomeSchedule.Save()", e.Error())
+		return err
+	}
+
+	if err := s.clearDefault(cr, "IncomeSchedule.Save()"); !err.Empty() {
+		return err
+	}
+
+	s.computeFields()
+
+	return err.Error{}
+}
+
+// Delete 's the income schedule, it's accounts and groups use the default schedule afterwards
+func (s *IncomeSchedule) Delete(cr Cursor) err.Error {
+	if s.ID <= 0 {
+		var err err.Error
+		err.Init("IncomeSchedule.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM income_schedules WHERE id=$1", s.ID); e != nil {
+		var err err.Error
+		err.Init("IncomeSchedule.Delete()", e.Error())
+		return err
+	}
+
+	s.ID = 0
+
+	return err.Error{}
+}
+
+func (s *IncomeSchedule) computeFields() {
+	s.AnchorDateStr = s.AnchorDate.Format(dateLayout)
+	s.NextDateStr = s.NextDate.Format(dateLayout)
+}
+
+// FindByID finds an income schedule with it's id
+func (s *IncomeSchedule) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, active, frequency, anchor_date, weekend_rule, is_default, next_date, create_date, last_update "
+	query += "FROM income_schedules WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&s.ID,
+		&s.Name,
+		&s.Active,
+		&s.Frequency,
+		&s.AnchorDate,
+		&s.WeekendRule,
+		&s.Default,
+		&s.NextDate,
+		&s.CreateDate,
+		&s.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("IncomeSchedule.FindByID()", e.Error())
+		return err
+	}
+
+	s.computeFields()
+
+	return err.Error{}
+}
+
+// FindIncomeScheduleByID is similar to FindByID but returns the income schedule
+func FindIncomeScheduleByID(cr Cursor, id int64) (IncomeSchedule, err.Error) {
+	s := EmptyIncomeSchedule()
+
+	if e := s.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindIncomeScheduleByID()", "Error while finding income schedule by ID: "+fmt.Sprintf("%d", id))
+		return s, e
+	}
+
+	return s, err.Error{}
+}
+
+// FindDefaultIncomeSchedule returns the active default income schedule
+// The ID is 0 if there is no default schedule
+func FindDefaultIncomeSchedule(cr Cursor) (IncomeSchedule, err.Error) {
+	var id int64
+
+	s := EmptyIncomeSchedule()
+
+	rows, e := cr.Query("SELECT id FROM income_schedules WHERE is_default=true AND active=true LIMIT 1")
+	if e != nil {
+		var err err.Error
+		err.Init("FindDefaultIncomeSchedule()", e.Error())
+		return s, err
+	}
+	for rows.Next() {
+		if e = rows.Scan(&id); e != nil {
+			var err err.Error
+			err.Init("FindDefaultIncomeSchedule()", e.Error())
+			rows.Close()
+			return s, err
+		}
+	}
+	rows.Close()
+
+	if id == 0 {
+		return s, err.Error{}
+	}
+
+	return FindIncomeScheduleByID(cr, id)
+}
+
+// GetAllIncomeSchedules returns all income schedules, the default one first
+func GetAllIncomeSchedules(cr Cursor) ([]IncomeSchedule, err.Error) {
+	var ids []int64
+	var result []IncomeSchedule
+
+	rows, e := cr.Query("SELECT id FROM income_schedules ORDER BY is_default DESC, active DESC, name, id")
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllIncomeSchedules()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllIncomeSchedules(): Skipping record")
+			log.Printf("[WARN] GetAllIncomeSchedules(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		s, err := FindIncomeScheduleByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllIncomeSchedules(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, s)
+	}
+
+	return result, err.Error{}
+}
+
+// ShiftIncomeSchedules moves the next payday of the active schedules which are due into the future
+func ShiftIncomeSchedules(cr Cursor) err.Error {
+	schedules, e := GetAllIncomeSchedules(cr)
+	if !e.Empty() {
+		e.AddTraceback("ShiftIncomeSchedules()", "Error while getting the income schedules.")
+		return e
+	}
+
+	now := time.Now().Local()
+	for _, s := range schedules {
+		if !s.Active || now.Before(s.NextDate) {
+			continue
+		}
+
+		_, s.NextDate = s.Cycle(now)
+
+		if _, e := cr.Exec("UPDATE income_schedules SET next_date=$2 WHERE id=$1", s.ID, s.NextDate); e != nil {
+			var err err.Error
+			err.Init("ShiftIncomeSchedules()", e.Error())
+			return err
+		}
+		log.Printf("[INFO] ShiftIncomeSchedules(): Next payday of %s shifted to %s.\n", s.Name, s.NextDate.Format(dateLayout))
+	}
+
+	return err.Error{}
+}
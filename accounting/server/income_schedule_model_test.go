@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIncomeScheduleCycle(t *testing.T) {
+	tests := []struct {
+		frequency   string
+		anchor      time.Time
+		weekendRule string
+		date        time.Time
+		start, end  time.Time
+	}{
+		// Monthly on the 31st, shorter months are paid on their last day
+		{IncomeMonthly, at(2026, 1, 31, 0, 0), WeekendKeep, at(2026, 2, 15, 0, 0), at(2026, 1, 31, 0, 0), at(2026, 2, 28, 0, 0)},
+		{IncomeMonthly, at(2026, 1, 31, 0, 0), WeekendKeep, at(2026, 2, 28, 0, 0), at(2026, 2, 28, 0, 0), at(2026, 3, 31, 0, 0)},
+		{IncomeMonthly, at(2026, 1, 31, 0, 0), WeekendKeep, at(2026, 3, 30, 12, 0), at(2026, 2, 28, 0, 0), at(2026, 3, 31, 0, 0)},
+		// The 15th of February and March 2026 are sundays
+		{IncomeMonthly, at(2026, 1, 15, 0, 0), WeekendBefore, at(2026, 2, 14, 0, 0), at(2026, 2, 13, 0, 0), at(2026, 3, 13, 0, 0)},
+		{IncomeMonthly, at(2026, 1, 15, 0, 0), WeekendAfter, at(2026, 2, 14, 0, 0), at(2026, 1, 15, 0, 0), at(2026, 2, 16, 0, 0)},
+		{IncomeMonthly, at(2026, 1, 15, 0, 0), WeekendKeep, at(2026, 2, 14, 0, 0), at(2026, 1, 15, 0, 0), at(2026, 2, 15, 0, 0)},
+		// Weekly and biweekly count from the anchor date, also backwards
+		{IncomeWeekly, at(2026, 1, 5, 0, 0), WeekendKeep, at(2026, 1, 5, 0, 0), at(2026, 1, 5, 0, 0), at(2026, 1, 12, 0, 0)},
+		{IncomeBiweekly, at(2026, 1, 2, 0, 0), WeekendKeep, at(2026, 1, 20, 0, 0), at(2026, 1, 16, 0, 0), at(2026, 1, 30, 0, 0)},
+		{IncomeBiweekly, at(2026, 1, 2, 0, 0), WeekendKeep, at(2025, 12, 25, 0, 0), at(2025, 12, 19, 0, 0), at(2026, 1, 2, 0, 0)},
+		// The 31st of January and the 28th of February 2026 are saturdays, the 31st of May a sunday
+		{IncomeLastBusinessDay, at(2026, 1, 10, 0, 0), WeekendKeep, at(2026, 2, 10, 0, 0), at(2026, 1, 30, 0, 0), at(2026, 2, 27, 0, 0)},
+		{IncomeLastBusinessDay, at(2026, 1, 10, 0, 0), WeekendKeep, at(2026, 5, 30, 0, 0), at(2026, 5, 29, 0, 0), at(2026, 6, 30, 0, 0)},
+	}
+
+	for _, test := range tests {
+		s := EmptyIncomeSchedule()
+		s.Frequency = test.frequency
+		s.AnchorDate = test.anchor
+		s.WeekendRule = test.weekendRule
+
+		start, end := s.Cycle(test.date)
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("%s cycle (%s) of %s = %s - %s, expected %s - %s", test.frequency, test.weekendRule, test.date.Format(dtLayout),
+				start.Format(dateLayout), end.Format(dateLayout), test.start.Format(dateLayout), test.end.Format(dateLayout))
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#         Investments        #
+	#                            #
+	##############################
+*/
+
+// handleInvestmentOverview lists the holdings, trades and securities
+// A POST imports the prices of the uploaded CSV file
+func handleInvestmentOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/investments/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleInvestmentOverview()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Investments"
+
+	if r.Method == http.MethodPost {
+		if parseErr := r.ParseMultipartForm(1 << 20); parseErr != nil {
+			ctx["Error"] = "The file could not be uploaded: " + parseErr.Error()
+		} else if file, _, fileErr := r.FormFile("file"); fileErr != nil {
+			ctx["Error"] = "Please choose a price file"
+		} else {
+			var result PriceImport
+
+			e = withTransaction(db, func(tx *sql.Tx) err.Error {
+				var importErr err.Error
+				result, importErr = ImportPrices(tx, file)
+				return importErr
+			})
+			file.Close()
+
+			if !e.Empty() {
+				e.AddTraceback("handleInvestmentOverview()", "Error while importing the prices.")
+				log.Println("[ERROR]", e)
+				ctx["Error"] = "The prices could not be imported: " + e.Error()
+			} else {
+				ctx["Import"] = result
+			}
+		}
+	}
+
+	if ctx["Holdings"], e = GetHoldings(db, 0); !e.Empty() {
+		e.AddTraceback("handleInvestmentOverview()", "Error while getting the holdings.")
+		log.Println("[WARN]", e)
+	}
+	if ctx["Trades"], e = GetTradesByAccount(db, 0); !e.Empty() {
+		e.AddTraceback("handleInvestmentOverview()", "Error while getting the trades.")
+		log.Println("[WARN]", e)
+	}
+	if ctx["Securities"], e = GetAllSecurities(db); !e.Empty() {
+		e.AddTraceback("handleInvestmentOverview()", "Error while getting the securities.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "investments.html", ctx); err != nil {
+		e.Init("handleInvestmentOverview()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+func handleSecurityForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/investments/securities/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleSecurityForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Security"
+	ctx["Btn"] = "Create Security"
+
+	s := EmptySecurity()
+
+	if securityID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(securityID[0])
+		if e != nil {
+			err.Init("handleSecurityForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = s.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleSecurityForm()", "Error finding security: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			s = EmptySecurity()
+		} else {
+			ctx["Title"] = "Edit Security"
+			ctx["Btn"] = "Save Security"
+		}
+	}
+
+	ctx["Security"] = s
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "security_form.html", ctx); e != nil {
+			err.Init("handleSecurityForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	before := auditSnapshot(s)
+
+	s.Name = r.FormValue("name")
+	s.Symbol = r.FormValue("symbol")
+	s.Currency = strings.ToUpper(strings.TrimSpace(r.FormValue("currency")))
+
+	create := s.ID == 0
+	err = writeSecurity(&s, webActor(ctx), before)
+
+	if !err.Empty() {
+		err.AddTraceback("handleSecurityForm()", "Error while writing the security to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			s.ID = 0
+		}
+		ctx["Security"] = s
+		ctx["Error"] = "The security could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "security_form.html", ctx); e != nil {
+			err.Init("handleSecurityForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/investments/", http.StatusSeeOther)
+}
+
+// writeSecurity creates or saves the security, the change is logged in the same database transaction
+func writeSecurity(s *Security, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if s.ID == 0 {
+			if err := s.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, actor, AuditCreate, AuditSecurity, s.ID, nil, s)
+		}
+		if err := s.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditSecurity, s.ID, before, s)
+	})
+}
+
+// handleTradeForm creates a trade, ?account= preselects the investment account
+func handleTradeForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/investments/trades/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleTradeForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Add Trade"
+	ctx["TradeTypes"] = GetAllTradeTypes()
+
+	t := EmptyTrade()
+	t.AccountID, _ = strconv.ParseInt(r.URL.Query().Get("account"), 0, 64)
+
+	var accounts []Account
+	all, err := GetAllAccounts(db)
+	if !err.Empty() {
+		err.AddTraceback("handleTradeForm()", "Error while getting the accounts.")
+		log.Println("[WARN]", err)
+	}
+	for _, a := range all {
+		if a.BankType == AccountInvestment && a.Active {
+			accounts = append(accounts, a)
+		}
+	}
+	ctx["Accounts"] = accounts
+
+	if ctx["Securities"], err = GetAllSecurities(db); !err.Empty() {
+		err.AddTraceback("handleTradeForm()", "Error while getting the securities.")
+		log.Println("[WARN]", err)
+	}
+
+	ctx["Trade"] = t
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "trade_form.html", ctx); e != nil {
+			err.Init("handleTradeForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	t.AccountID, _ = strconv.ParseInt(r.FormValue("account"), 0, 64)
+	t.SecurityID, _ = strconv.ParseInt(r.FormValue("security"), 0, 64)
+	t.TradeType = r.FormValue("type")
+
+	var e error
+	if t.TradeDate, e = time.ParseInLocation(dateLayout, r.FormValue("date"), time.Local); e != nil {
+		t.TradeDate = time.Now().Local()
+	}
+	if t.Quantity, e = ParseQuantity(r.FormValue("quantity")); e != nil {
+		t.Quantity = 0
+	}
+	// Empty amounts are 0
+	if t.Price, e = ParseMoney(r.FormValue("price")); e != nil {
+		t.Price = 0
+	}
+	if t.Fees, e = ParseMoney(r.FormValue("fees")); e != nil {
+		t.Fees = 0
+	}
+	if t.Amount, e = ParseMoney(r.FormValue("amount")); e != nil {
+		t.Amount = 0
+	}
+
+	if err = writeTrade(&t, webActor(ctx)); !err.Empty() {
+		err.AddTraceback("handleTradeForm()", "Error while writing the trade to the database.")
+		log.Println("[ERROR]", err)
+
+		t.ID = 0
+		ctx["Trade"] = t
+		ctx["Error"] = "The trade could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "trade_form.html", ctx); e != nil {
+			err.Init("handleTradeForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/accounts/form/?id=%d", t.AccountID), http.StatusSeeOther)
+}
+
+// writeTrade creates the trade, it's logged in the same database transaction
+func writeTrade(t *Trade, actor string) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if err := t.Create(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditCreate, AuditTrade, t.ID, nil, t)
+	})
+}
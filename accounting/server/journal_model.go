@@ -0,0 +1,266 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// JournalEntry groups the balanced debit and credit lines of a single booking
+// Every transaction has exactly one journal entry, entries without a
+// transaction are used for the cash of trades
+type JournalEntry struct {
+	ID            int64
+	TransactionID int64
+	Name          string
+	EntryDate     time.Time
+	CreateDate    time.Time
+
+	Lines []JournalLine
+}
+
+// JournalLine is a single debit or credit posting on an account
+// AccountID 0 represents the external account (money coming from or leaving the books)
+// Debit and Credit are in Currency, which is the currency of the account
+type JournalLine struct {
+	ID        int64
+	EntryID   int64
+	AccountID int64
+	Debit     Money
+	Credit    Money
+	Currency  string
+	Booked    bool
+
+	// Computed fields
+	TransactionID int64
+	Name          string
+	EntryDate     time.Time
+}
+
+// EmptyJournalEntry returns an empty journal entry
+func EmptyJournalEntry() JournalEntry {
+	je := JournalEntry{
+		ID:            0,
+		TransactionID: 0,
+		Name:          "",
+		EntryDate:     time.Now().Local(),
+		CreateDate:    time.Now().Local(),
+	}
+
+	return je
+}
+
+// AddLine appends a line which moves amount in the given currency from the account origin to the account dest
+// Negative amounts are posted the other way round, so debit and credit are never negative
+func (je *JournalEntry) AddLine(origin, dest int64, amount Money, currency string, booked bool) {
+	if amount < 0 {
+		origin, dest = dest, origin
+		amount = amount * -1
+	}
+
+	je.Lines = append(je.Lines,
+		JournalLine{AccountID: origin, Credit: amount, Currency: currency, Booked: booked},
+		JournalLine{AccountID: dest, Debit: amount, Currency: currency, Booked: booked},
+	)
+}
+
+// Balanced returns true if the sum of all debits equals the sum of all credits
+// Amounts of different currencies can't be added up, so every currency has to be balanced
+func (je *JournalEntry) Balanced() bool {
+	sums := make(map[string]Money)
+
+	for _, l := range je.Lines {
+		sums[l.Currency] += l.Debit - l.Credit
+	}
+
+	for _, sum := range sums {
+		if sum != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Create 's the journal entry and all of it's lines in the database
+func (je *JournalEntry) Create(cr *sql.Tx) err.Error {
+	if je.ID != 0 {
+		var err err.Error
+		err.Init("JournalEntry.Create()", "This journal entry already has an id")
+		return err
+	} else if len(je.Lines) == 0 {
+		var err err.Error
+		err.Init("JournalEntry.Create()", "The journal entry "+je.Name+" has no lines")
+		return err
+	} else if !je.Balanced() {
+		var err err.Error
+		err.Init("JournalEntry.Create()", "The journal entry "+je.Name+" is not balanced")
+		return err
+	}
+
+	var transID interface{}
+
+	transID = je.TransactionID
+
+	if je.TransactionID == 0 {
+		transID = nil
+	}
+
+	query := "INSERT INTO journal_entries (transaction_id, name, entry_date, create_date) "
+	query += "VALUES ($1, $2, $3, $4) RETURNING id;"
+
+	je.CreateDate = time.Now().Local()
+
+	e := cr.QueryRow(query,
+		transID,
+		je.Name,
+		je.EntryDate,
+		je.CreateDate,
+	).Scan(&je.ID)
+
+	if e != nil {
+		var err err.Error
+		err.Init("JournalEntry.Create()", e.Error())
+		return err
+	}
+
+	query = "INSERT INTO journal_lines (entry_id, account_id, debit, credit, currency, booked) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
+
+	for i := range je.Lines {
+		l := &je.Lines[i]
+		var accountID interface{}
+
+		accountID = l.AccountID
+
+		if l.AccountID == 0 {
+			accountID = nil
+		}
+
+		l.EntryID = je.ID
+
+		if e = cr.QueryRow(query, l.EntryID, accountID, l.Debit, l.Credit, l.Currency, l.Booked).Scan(&l.ID); e != nil {
+			var err err.Error
+			err.Init("JournalEntry.Create()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+// Delete 's the journal entry, the lines are deleted by the database
+func (je *JournalEntry) Delete(cr Cursor) err.Error {
+	if je.ID == 0 {
+		var err err.Error
+		err.Init("JournalEntry.Delete()", "The journal entry you want to delete does not have an id")
+		return err
+	}
+
+	query := "DELETE FROM journal_entries WHERE id=$1"
+
+	if _, e := cr.Exec(query, je.ID); e != nil {
+		var err err.Error
+		err.Init("JournalEntry.Delete()", e.Error())
+		return err
+	}
+
+	je.ID = 0
+
+	return err.Error{}
+}
+
+// deleteJournalEntries deletes the journal entries of the transaction with the given id
+func deleteJournalEntries(cr Cursor, transactionID int64) err.Error {
+	query := "DELETE FROM journal_entries WHERE transaction_id=$1"
+
+	if _, e := cr.Exec(query, transactionID); e != nil {
+		var err err.Error
+		err.Init("deleteJournalEntries()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// BookDueJournalLines books the pending lines of all entries which are due at the given time
+// Afterwards the lines count in the Balance of the accounts and not only in the BalanceForecast
+func BookDueJournalLines(cr *sql.Tx, now time.Time) err.Error {
+	query := "UPDATE journal_lines SET booked=true WHERE booked=false "
+	query += "AND entry_id IN (SELECT id FROM journal_entries WHERE entry_date <= $1)"
+
+	res, e := cr.Exec(query, now)
+	if e != nil {
+		var err err.Error
+		err.Init("BookDueJournalLines()", e.Error())
+		return err
+	}
+
+	query = "UPDATE transactions SET origin_booked=true, dest_booked=true "
+	query += "WHERE (origin_booked=false OR dest_booked=false) AND transaction_date <= $1 "
+	query += "AND EXISTS (SELECT 1 FROM journal_entries AS e WHERE e.transaction_id=transactions.id)"
+
+	if _, e = cr.Exec(query, now); e != nil {
+		var err err.Error
+		err.Init("BookDueJournalLines()", e.Error())
+		return err
+	}
+
+	if n, e := res.RowsAffected(); e == nil && n > 0 {
+		log.Printf("[INFO] BookDueJournalLines(): Booked %d journal lines.\n", n)
+	}
+
+	return err.Error{}
+}
+
+// GetJournalLinesByAccount returns all lines posted on the account, oldest first
+// This is the audit trail of the balance of an account
+func GetJournalLinesByAccount(cr Cursor, accountID int64) ([]JournalLine, err.Error) {
+	var lines []JournalLine
+
+	query := "SELECT l.id, l.entry_id, l.account_id, l.debit, l.credit, l.currency, l.booked, "
+	query += "e.transaction_id, e.name, e.entry_date "
+	query += "FROM journal_lines AS l JOIN journal_entries AS e ON e.id=l.entry_id "
+	query += "WHERE l.account_id=$1 ORDER BY e.entry_date, l.id"
+
+	rows, e := cr.Query(query, accountID)
+
+	if e != nil {
+		var err err.Error
+		err.Init("GetJournalLinesByAccount()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l JournalLine
+		var transID interface{}
+
+		if e = rows.Scan(
+			&l.ID,
+			&l.EntryID,
+			&l.AccountID,
+			&l.Debit,
+			&l.Credit,
+			&l.Currency,
+			&l.Booked,
+			&transID,
+			&l.Name,
+			&l.EntryDate,
+		); e != nil {
+			log.Println("[INFO] GetJournalLinesByAccount(): Skipping record")
+			log.Printf("[WARN] GetJournalLinesByAccount(): %s\n", e)
+			continue
+		}
+
+		if transID != nil {
+			l.TransactionID = transID.(int64)
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, err.Error{}
+}
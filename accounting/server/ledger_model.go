@@ -0,0 +1,425 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Kinds of ledger issues
+const (
+	// LedgerMissingReference a transaction references an account or category which does not exist
+	LedgerMissingReference = "missing_reference"
+	// LedgerJournalMismatch the journal entry of a transaction is missing or differs from the transaction
+	LedgerJournalMismatch = "journal_mismatch"
+	// LedgerUnbalancedEntry an opening balance entry which is not balanced
+	LedgerUnbalancedEntry = "unbalanced_entry"
+)
+
+// LedgerIssue is an inconsistency found by CheckLedger
+// Fixed is true if it was repaired during the check
+type LedgerIssue struct {
+	Kind          string
+	TransactionID int64
+	EntryID       int64
+	Message       string
+	Fixed         bool
+}
+
+// LedgerAccountBalance compares the balances of an account in the journal with the
+// balances rebuilt from the transactions and the opening balance
+type LedgerAccountBalance struct {
+	AccountID              int64
+	Name                   string
+	Currency               string
+	Balance                Money
+	BalanceForecast        Money
+	RebuiltBalance         Money
+	RebuiltBalanceForecast Money
+}
+
+// LedgerReport is the result of CheckLedger
+type LedgerReport struct {
+	Fix              bool
+	CheckDate        time.Time
+	TransactionCount int
+	Issues           []LedgerIssue
+	Accounts         []LedgerAccountBalance
+}
+
+// ledgerReference is a nullable reference of a transaction which is checked for missing records
+type ledgerReference struct {
+	table       string
+	column      string
+	refTable    string
+	transColumn string
+	name        string
+}
+
+var ledgerReferences = []ledgerReference{
+	{"transactions", "account_id", "accounts", "id", "origin account"},
+	{"transactions", "to_account", "accounts", "id", "recipient account"},
+	{"transactions", "category_id", "categories", "id", "category"},
+	{"transaction_splits", "category_id", "categories", "transaction_id", "category of a split"},
+}
+
+// CheckLedger recalculates the balances of all accounts from their transactions and
+// compares them with the journal
+// Missing references are set to NULL and the journal entries of transactions which
+// differ are posted again, but only if fix is true. Reconciled transactions and transactions in closed periods are only reported
+// The fixed references are logged with actor
+func CheckLedger(cr *sql.DB, fix bool, actor string) (LedgerReport, err.Error) {
+	report := LedgerReport{
+		Fix:       fix,
+		CheckDate: time.Now().Local(),
+	}
+
+	if e := checkLedgerReferences(cr, &report, actor); !e.Empty() {
+		e.AddTraceback("CheckLedger()", "Error while checking the references of the transactions.")
+		return report, e
+	}
+
+	rebuilt, e := checkLedgerJournal(cr, &report)
+	if !e.Empty() {
+		e.AddTraceback("CheckLedger()", "Error while checking the journal.")
+		return report, e
+	}
+
+	if e := checkLedgerOpeningBalances(cr, &report, rebuilt); !e.Empty() {
+		e.AddTraceback("CheckLedger()", "Error while checking the opening balances.")
+		return report, e
+	}
+
+	accounts, e := GetAllAccounts(cr)
+	if !e.Empty() {
+		e.AddTraceback("CheckLedger()", "Error while getting the accounts.")
+		return report, e
+	}
+
+	// The market value of the holdings is not part of the journal
+	for _, a := range accounts {
+		report.Accounts = append(report.Accounts, LedgerAccountBalance{
+			AccountID:              a.ID,
+			Name:                   a.Name,
+			Currency:               a.Currency,
+			Balance:                a.Balance - a.MarketValue,
+			BalanceForecast:        a.BalanceForecast - a.MarketValue,
+			RebuiltBalance:         rebuilt[a.ID][0],
+			RebuiltBalanceForecast: rebuilt[a.ID][1],
+		})
+	}
+
+	return report, err.Error{}
+}
+
+// checkLedgerReferences reports transactions and splits which reference records that don't exist
+// With Fix the references of every transaction are set to NULL and it's journal entry is posted again,
+// reconciled transactions and transactions in closed periods are only reported
+func checkLedgerReferences(cr *sql.DB, report *LedgerReport, actor string) err.Error {
+	first := len(report.Issues)
+
+	for _, ref := range ledgerReferences {
+		query := fmt.Sprintf("SELECT t.%s, t.%s FROM %s AS t WHERE t.%s IS NOT NULL "+
+			"AND NOT EXISTS (SELECT 1 FROM %s AS r WHERE r.id=t.%s) ORDER BY t.id",
+			ref.transColumn, ref.column, ref.table, ref.column, ref.refTable, ref.column)
+
+		rows, e := cr.Query(query)
+		if e != nil {
+			var err err.Error
+			err.Init("checkLedgerReferences()", e.Error())
+			return err
+		}
+
+		for rows.Next() {
+			var issue LedgerIssue
+			var refID int64
+
+			if e = rows.Scan(&issue.TransactionID, &refID); e != nil {
+				log.Println("[INFO] checkLedgerReferences(): Skipping record")
+				log.Printf("[WARN] checkLedgerReferences(): %s\n", e)
+				continue
+			}
+
+			issue.Kind = LedgerMissingReference
+			issue.Message = fmt.Sprintf("The %s %d of transaction %d does not exist", ref.name, refID, issue.TransactionID)
+			report.Issues = append(report.Issues, issue)
+		}
+		rows.Close()
+	}
+
+	if !report.Fix {
+		return err.Error{}
+	}
+
+	// A transaction can miss several references, all of them are fixed at once
+	results := make(map[int64]string)
+	for i := first; i < len(report.Issues); i++ {
+		issue := &report.Issues[i]
+
+		result, done := results[issue.TransactionID]
+		if !done {
+			result = fixLedgerReferences(cr, issue.TransactionID, actor)
+			results[issue.TransactionID] = result
+		}
+
+		if result == "" {
+			issue.Fixed = true
+		} else {
+			issue.Message += result
+		}
+	}
+
+	return err.Error{}
+}
+
+// fixLedgerReferences sets the missing references of the transaction to NULL, posts it again and logs the change
+// It returns what's added to the message of the issues if the transaction couldn't be fixed
+func fixLedgerReferences(cr *sql.DB, transactionID int64, actor string) string {
+	t, e := FindTransactionByID(cr, transactionID)
+	if !e.Empty() {
+		e.AddTraceback("fixLedgerReferences()", "Error while finding transaction: "+fmt.Sprintf("%d", transactionID))
+		log.Println("[ERROR]", e)
+		return ", it can't be fixed: " + e.Error()
+	}
+
+	// Reconciled transactions and transactions in closed periods are locked, their journal entry can't change
+	if err := t.checkUnreconciled(cr, "fixLedgerReferences()"); !err.Empty() {
+		return ", it can't be fixed: " + err.Error()
+	} else if err := t.checkPeriodsOpen(cr, "fixLedgerReferences()"); !err.Empty() {
+		return ", it can't be fixed: " + err.Error()
+	}
+
+	before := auditSnapshot(t)
+	e = withTransaction(cr, func(tx *sql.Tx) err.Error {
+		for _, ref := range ledgerReferences {
+			query := fmt.Sprintf("UPDATE %s AS t SET %s=NULL WHERE t.%s=$1 AND t.%s IS NOT NULL "+
+				"AND NOT EXISTS (SELECT 1 FROM %s AS r WHERE r.id=t.%s)",
+				ref.table, ref.column, ref.transColumn, ref.column, ref.refTable, ref.column)
+
+			if _, e := tx.Exec(query, transactionID); e != nil {
+				var err err.Error
+				err.Init("fixLedgerReferences()", e.Error())
+				return err
+			}
+		}
+
+		if err := t.FindByID(tx, transactionID); !err.Empty() {
+			return err
+		}
+		if err := t.resolveAmounts(tx); !err.Empty() {
+			return err
+		}
+		if err := t.post(tx); !err.Empty() {
+			return err
+		}
+
+		return LogAudit(tx, actor, AuditUpdate, AuditTransaction, t.ID, before, t)
+	})
+	if !e.Empty() {
+		e.AddTraceback("fixLedgerReferences()", "Error while fixing transaction: "+fmt.Sprintf("%d", transactionID))
+		log.Println("[ERROR]", e)
+		return ", fixing it failed: " + e.Error()
+	}
+
+	return ""
+}
+
+// ledgerKey identifies the lines of an account in a currency
+type ledgerKey struct {
+	accountID int64
+	currency  string
+}
+
+// checkLedgerJournal compares the journal entry of every transaction with the entry it should have
+// It returns the rebuilt balance and forecast of the accounts, indexed by the account id
+func checkLedgerJournal(cr *sql.DB, report *LedgerReport) (map[int64][2]Money, err.Error) {
+	rebuilt := make(map[int64][2]Money)
+	posted := make(map[int64]map[ledgerKey]Money)
+	entryCount := make(map[int64]int64)
+
+	query := "SELECT e.transaction_id, COALESCE(l.account_id, 0), l.currency, SUM(l.debit - l.credit), COUNT(DISTINCT e.id) "
+	query += "FROM journal_entries AS e JOIN journal_lines AS l ON l.entry_id=e.id "
+	query += "WHERE e.transaction_id IS NOT NULL "
+	query += "GROUP BY e.transaction_id, COALESCE(l.account_id, 0), l.currency"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("checkLedgerJournal()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var transactionID, entries int64
+		var key ledgerKey
+		var sum Money
+
+		if e = rows.Scan(&transactionID, &key.accountID, &key.currency, &sum, &entries); e != nil {
+			log.Println("[INFO] checkLedgerJournal(): Skipping record")
+			log.Printf("[WARN] checkLedgerJournal(): %s\n", e)
+			continue
+		}
+
+		if posted[transactionID] == nil {
+			posted[transactionID] = make(map[ledgerKey]Money)
+		}
+		posted[transactionID][key] = sum
+		if entries > entryCount[transactionID] {
+			entryCount[transactionID] = entries
+		}
+	}
+	rows.Close()
+
+	transactions, getErr := GetAllTransactions(cr)
+	if !getErr.Empty() {
+		getErr.AddTraceback("checkLedgerJournal()", "Error while getting the transactions.")
+		return nil, getErr
+	}
+
+	report.TransactionCount = len(transactions)
+
+	for i := range transactions {
+		t := &transactions[i]
+
+		if err := t.resolveAmounts(cr); !err.Empty() {
+			report.Issues = append(report.Issues, LedgerIssue{
+				Kind:          LedgerJournalMismatch,
+				TransactionID: t.ID,
+				Message:       "The amounts of the transaction can't be resolved: " + err.Error(),
+			})
+			continue
+		}
+
+		expected := make(map[ledgerKey]Money)
+		for _, l := range t.journalEntry().Lines {
+			expected[ledgerKey{l.AccountID, l.Currency}] += l.Debit - l.Credit
+
+			if l.AccountID == 0 {
+				continue
+			}
+			balances := rebuilt[l.AccountID]
+			if l.Booked {
+				balances[0] += l.Debit - l.Credit
+			}
+			balances[1] += l.Debit - l.Credit
+			rebuilt[l.AccountID] = balances
+		}
+
+		message := ""
+		if entryCount[t.ID] == 0 {
+			message = fmt.Sprintf("Transaction %d (%s) has no journal entry", t.ID, t.Name)
+		} else if entryCount[t.ID] > 1 {
+			message = fmt.Sprintf("Transaction %d (%s) has %d journal entries", t.ID, t.Name, entryCount[t.ID])
+		} else if !sameLedgerSums(expected, posted[t.ID]) {
+			message = fmt.Sprintf("The journal entry of transaction %d (%s) does not match it's amounts or accounts", t.ID, t.Name)
+		}
+
+		if message == "" {
+			continue
+		}
+
+		issue := LedgerIssue{Kind: LedgerJournalMismatch, TransactionID: t.ID, Message: message}
+
+		if report.Fix {
+			// Reconciled transactions and transactions in closed periods are locked, posting them again would change
+			// finished reconciliations or the closed books
+			if err := t.checkUnreconciled(cr, "checkLedgerJournal()"); !err.Empty() {
+				issue.Message += ", it can't be fixed: " + err.Error()
+			} else if err := t.checkPeriodsOpen(cr, "checkLedgerJournal()"); !err.Empty() {
+				issue.Message += ", it can't be fixed: " + err.Error()
+			} else if err := withTransaction(cr, t.post); !err.Empty() {
+				err.AddTraceback("checkLedgerJournal()", "Error while posting transaction: "+fmt.Sprintf("%d", t.ID))
+				log.Println("[ERROR]", err)
+				issue.Message += ", posting it again failed: " + err.Error()
+			} else {
+				issue.Fixed = true
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return rebuilt, err.Error{}
+}
+
+// sameLedgerSums returns true if both maps contain the same non-zero sums
+func sameLedgerSums(a, b map[ledgerKey]Money) bool {
+	for key, sum := range a {
+		if b[key] != sum {
+			return false
+		}
+	}
+	for key, sum := range b {
+		if a[key] != sum {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLedgerOpeningBalances adds the opening balances to the rebuilt balances
+// and reports opening balance entries which are not balanced
+func checkLedgerOpeningBalances(cr *sql.DB, report *LedgerReport, rebuilt map[int64][2]Money) err.Error {
+	query := "SELECT l.account_id, COALESCE(SUM(l.debit - l.credit) FILTER (WHERE l.booked), 0), SUM(l.debit - l.credit) "
+	query += "FROM journal_entries AS e JOIN journal_lines AS l ON l.entry_id=e.id "
+	query += "WHERE e.transaction_id IS NULL AND l.account_id IS NOT NULL GROUP BY l.account_id"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("checkLedgerOpeningBalances()", e.Error())
+		return err
+	}
+
+	for rows.Next() {
+		var accountID int64
+		var booked, sum Money
+
+		if e = rows.Scan(&accountID, &booked, &sum); e != nil {
+			log.Println("[INFO] checkLedgerOpeningBalances(): Skipping record")
+			log.Printf("[WARN] checkLedgerOpeningBalances(): %s\n", e)
+			continue
+		}
+
+		balances := rebuilt[accountID]
+		balances[0] += booked
+		balances[1] += sum
+		rebuilt[accountID] = balances
+	}
+	rows.Close()
+
+	query = "SELECT e.id, e.name, l.currency, SUM(l.debit - l.credit) "
+	query += "FROM journal_entries AS e JOIN journal_lines AS l ON l.entry_id=e.id "
+	query += "WHERE e.transaction_id IS NULL "
+	query += "GROUP BY e.id, e.name, l.currency HAVING SUM(l.debit - l.credit) <> 0 ORDER BY e.id"
+
+	rows, e = cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("checkLedgerOpeningBalances()", e.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var issue LedgerIssue
+		var name, currency string
+		var sum Money
+
+		if e = rows.Scan(&issue.EntryID, &name, &currency, &sum); e != nil {
+			log.Println("[INFO] checkLedgerOpeningBalances(): Skipping record")
+			log.Printf("[WARN] checkLedgerOpeningBalances(): %s\n", e)
+			continue
+		}
+
+		issue.Kind = LedgerUnbalancedEntry
+		issue.Message = fmt.Sprintf("The journal entry %d (%s) is off by %s %s", issue.EntryID, name, sum, currency)
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return err.Error{}
+}
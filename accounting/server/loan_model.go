@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// LoanPayment is a monthly installment of a loan, split into Interest and Principal
+// Remaining is the debt after the payment, Paid is true once the debt of the account is at or below it
+type LoanPayment struct {
+	Number    int64
+	Date      time.Time
+	Payment   Money
+	Interest  Money
+	Principal Money
+	Remaining Money
+	Paid      bool
+
+	// Computed fields
+	DateStr string
+}
+
+// monthlyInterest returns the interest of one month on the debt, rate is yearly in percent
+func monthlyInterest(debt Money, rate float64) Money {
+	return debt.Convert(rate / 100 / 12)
+}
+
+// annuityPayment returns the fixed monthly payment which pays off the principal with interest in the given months
+// The payment is rounded up to the next cent, so it always pays off some of the principal
+func annuityPayment(principal Money, rate float64, months int64) Money {
+	if months <= 0 {
+		return principal
+	}
+	if rate == 0 {
+		return Money(math.Ceil(float64(principal) / float64(months)))
+	}
+
+	r := rate / 100 / 12
+	return Money(math.Ceil(float64(principal) * r / (1 - math.Pow(1+r, float64(-months)))))
+}
+
+// amortise returns the schedule of the monthly payments which pay off the debt, the first one is due at start
+// The payment in the last month pays the rest of the debt, so the rounding of the payments is evened out
+func amortise(debt Money, rate float64, payment Money, start time.Time, months int64) []LoanPayment {
+	var schedule []LoanPayment
+
+	for n := int64(1); debt > 0 && n <= months; n++ {
+		p := LoanPayment{
+			Number:   n,
+			Date:     start.AddDate(0, int(n-1), 0),
+			Interest: monthlyInterest(debt, rate),
+		}
+
+		p.Principal = payment - p.Interest
+		if p.Principal >= debt || n == months {
+			p.Principal = debt
+		} else if p.Principal <= 0 {
+			// The payment doesn't even cover the interest, the debt is never paid off
+			break
+		}
+		p.Payment = p.Interest + p.Principal
+
+		debt -= p.Principal
+		p.Remaining = debt
+		p.DateStr = p.Date.Format(dateLayout)
+
+		schedule = append(schedule, p)
+	}
+
+	return schedule
+}
+
+// computeLoan computes MonthlyPayment, Schedule, NextPayment and PayoffDate of loan accounts
+// The schedule is the plan from the terms of the loan, an installment is paid once the RemainingDebt
+// is at or below it's Remaining, so extra payments cover the following installments
+// The payoff date is projected from the RemainingDebt and the open installments
+func (a *Account) computeLoan() {
+	a.MonthlyPayment = 0
+	a.Schedule = nil
+	a.NextPayment = LoanPayment{}
+	a.PayoffDate = time.Time{}
+	a.PayoffDateStr = ""
+
+	if a.BankType != AccountLoan || a.TermMonths <= 0 {
+		return
+	}
+
+	a.MonthlyPayment = annuityPayment(a.Principal, a.InterestRate, a.TermMonths)
+	a.Schedule = amortise(a.Principal, a.InterestRate, a.MonthlyPayment, a.FirstPaymentDate, a.TermMonths)
+	if len(a.Schedule) == 0 {
+		// The payment doesn't cover the interest, there is no plan to pay off the loan
+		return
+	}
+
+	var openPayments int64
+	for i := range a.Schedule {
+		a.Schedule[i].Paid = a.Schedule[i].Remaining >= a.RemainingDebt
+		if !a.Schedule[i].Paid {
+			if a.NextPayment.Number == 0 {
+				a.NextPayment = a.Schedule[i]
+			}
+			openPayments++
+		}
+	}
+
+	if a.RemainingDebt <= 0 {
+		return
+	}
+
+	// Debt which is left after the last planned payment is due right away
+	if a.NextPayment.Number == 0 {
+		last := a.Schedule[len(a.Schedule)-1]
+		a.PayoffDate = last.Date
+		a.PayoffDateStr = last.DateStr
+		return
+	}
+
+	projection := amortise(a.RemainingDebt, a.InterestRate, a.MonthlyPayment, a.NextPayment.Date, openPayments)
+	if len(projection) > 0 {
+		a.PayoffDate = projection[len(projection)-1].Date
+		a.PayoffDateStr = a.PayoffDate.Format(dateLayout)
+	}
+}
+
+// BookPayment books the next installment of the loan, paid from the account fromAccount on the date
+// The interest is computed from the RemainingDebt and booked as expense, the principal as transfer
+// into the loan account, which reduces the debt
+func (a *Account) BookPayment(cr *sql.Tx, actor string, fromAccount int64, date time.Time) ([]Transaction, err.Error) {
+	var result []Transaction
+
+	if a.BankType != AccountLoan {
+		var err err.Error
+		err.Init("Account.BookPayment()", "Payments can only be booked for loan accounts")
+		return nil, err
+	} else if a.RemainingDebt <= 0 {
+		var err err.Error
+		err.Init("Account.BookPayment()", "The loan "+a.Name+" is already paid off")
+		return nil, err
+	} else if fromAccount <= 0 || fromAccount == a.ID {
+		var err err.Error
+		err.Init("Account.BookPayment()", "Please choose the account the payment is made from")
+		return nil, err
+	}
+
+	// The amounts are computed in the currency of the loan
+	currency, currencyErr := accountCurrency(cr, fromAccount)
+	if !currencyErr.Empty() {
+		currencyErr.AddTraceback("Account.BookPayment()", "Error while getting the currency of account: "+fmt.Sprintf("%d", fromAccount))
+		return nil, currencyErr
+	} else if currency != a.Currency {
+		currencyErr.Init("Account.BookPayment()", "The payment must be made from an account in "+a.Currency)
+		return nil, currencyErr
+	}
+
+	interest := monthlyInterest(a.RemainingDebt, a.InterestRate)
+	principal := a.MonthlyPayment - interest
+	if principal > a.RemainingDebt || a.NextPayment.Number == a.TermMonths || a.NextPayment.Number == 0 {
+		principal = a.RemainingDebt
+	}
+	if principal <= 0 {
+		var err err.Error
+		err.Init("Account.BookPayment()", "The monthly payment does not cover the interest of "+interest.String())
+		return nil, err
+	}
+
+	payment := EmptyTransaction()
+	payment.Name = fmt.Sprintf("%s: principal payment %d", a.Name, a.NextPayment.Number)
+	payment.Active = true
+	payment.TransactionDate = date
+	payment.Amount = principal
+	payment.FromAccount = fromAccount
+	payment.ToAccount = a.ID
+	payment.TransactionType = TransactionTransfer
+	result = append(result, payment)
+
+	if interest > 0 {
+		t := EmptyTransaction()
+		t.Name = fmt.Sprintf("%s: interest payment %d", a.Name, a.NextPayment.Number)
+		t.Active = true
+		t.TransactionDate = date
+		t.Amount = interest
+		t.FromAccount = fromAccount
+		t.TransactionType = TransactionExpense
+		result = append(result, t)
+	}
+
+	for i := range result {
+		if err := result[i].Create(cr); !err.Empty() {
+			err.AddTraceback("Account.BookPayment()", "Error while booking "+result[i].Name)
+			return nil, err
+		}
+		if err := LogAudit(cr, actor, AuditCreate, AuditTransaction, result[i].ID, nil, result[i]); !err.Empty() {
+			err.AddTraceback("Account.BookPayment()", "Error while logging the booking of "+result[i].Name)
+			return nil, err
+		}
+	}
+
+	return result, err.Error{}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthlyInterest(t *testing.T) {
+	tests := []struct {
+		debt Money
+		rate float64
+		want Money
+	}{
+		{1000000, 6, 5000},
+		{918933, 6, 4595},
+		{100, 6, 1},
+		{99, 6, 0},
+		{1000000, 0, 0},
+		{0, 6, 0},
+	}
+
+	for _, test := range tests {
+		if got := monthlyInterest(test.debt, test.rate); got != test.want {
+			t.Errorf("monthlyInterest(%v, %v) = %v, expected %v", test.debt, test.rate, got, test.want)
+		}
+	}
+}
+
+func TestAnnuityPayment(t *testing.T) {
+	tests := []struct {
+		principal Money
+		rate      float64
+		months    int64
+		want      Money
+	}{
+		// 860.664... is rounded up, so every payment pays off some of the principal
+		{1000000, 6, 12, 86067},
+		{20000000, 3.5, 240, 115992},
+		{100, 12, 1, 101},
+		{100000, 0, 3, 33334},
+		{90000, 0, 3, 30000},
+		{500000, 6, 0, 500000},
+		{500000, 6, -1, 500000},
+	}
+
+	for _, test := range tests {
+		if got := annuityPayment(test.principal, test.rate, test.months); got != test.want {
+			t.Errorf("annuityPayment(%v, %v, %d) = %v, expected %v", test.principal, test.rate, test.months, got, test.want)
+		}
+	}
+}
+
+func TestAmortise(t *testing.T) {
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		debt     Money
+		rate     float64
+		payment  Money
+		months   int64
+		payments int
+		last     Money
+	}{
+		// The last payment pays the rest, which is less than the rounded up payment
+		{1000000, 6, 86067, 12, 12, 86059},
+		{100000, 0, 33334, 3, 3, 33332},
+		// Paid off before the term ends
+		{100000, 0, 60000, 3, 2, 40000},
+		// The rest of the debt is due with the last month of the term
+		{100000, 0, 10000, 3, 3, 80000},
+		// The payment doesn't cover the interest of 100.00
+		{1000000, 12, 5000, 12, 0, 0},
+		{0, 6, 10000, 12, 0, 0},
+	}
+
+	for _, test := range tests {
+		schedule := amortise(test.debt, test.rate, test.payment, start, test.months)
+		if len(schedule) != test.payments {
+			t.Errorf("amortise(%v, %v, %v, %d) has %d payments, expected %d", test.debt, test.rate, test.payment, test.months, len(schedule), test.payments)
+			continue
+		} else if len(schedule) == 0 {
+			continue
+		}
+
+		var principal Money
+		for i, p := range schedule {
+			principal += p.Principal
+			if p.Payment != p.Interest+p.Principal {
+				t.Errorf("amortise(%v): payment %d is %v, expected interest %v plus principal %v", test.debt, p.Number, p.Payment, p.Interest, p.Principal)
+			}
+			if i < len(schedule)-1 && p.Payment != test.payment {
+				t.Errorf("amortise(%v): payment %d is %v, expected %v", test.debt, p.Number, p.Payment, test.payment)
+			}
+			if want := start.AddDate(0, i, 0); !p.Date.Equal(want) {
+				t.Errorf("amortise(%v): payment %d is due at %s, expected %s", test.debt, p.Number, p.DateStr, want.Format(dateLayout))
+			}
+		}
+
+		last := schedule[len(schedule)-1]
+		if last.Payment != test.last {
+			t.Errorf("amortise(%v): the last payment is %v, expected %v", test.debt, last.Payment, test.last)
+		}
+		if last.Remaining != 0 || principal != test.debt {
+			t.Errorf("amortise(%v): %v of the principal is paid and %v remains, expected all of it", test.debt, principal, last.Remaining)
+		}
+	}
+}
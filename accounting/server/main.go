@@ -20,14 +20,17 @@ var (
 	appDir       = ""
 	logFile      = os.File{}
 
+	// Mode of the ledger check, the application only checks the ledger and exits if set
+	ledgerCheckMode = ""
+
 	key   = []byte("087736079f8d9e4c7fc7b642bb4c7afa")
 	store = sessions.NewCookieStore(key)
 
 	// datetime form layout
-	dateSettingsLayout = "Monday 02 January 2006"
-	dtLayout           = "02.01.2006 - 15:04"
-	dateLayout         = "02.01.2006"
-	dbTimeLayout       = "2006-01-02 15:04:00"
+	dtLayout        = "02.01.2006 - 15:04"
+	dateLayout      = "02.01.2006"
+	dateInputLayout = "2006-01-02"
+	dbTimeLayout    = "2006-01-02 15:04:00"
 )
 
 func logging(f http.HandlerFunc) http.HandlerFunc {
@@ -38,7 +41,9 @@ func logging(f http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func init() {
+// setupApp reads the command line, connects to the database and loads the templates
+// It's called by main and not in init, so the tests of the package run without a database
+func setupApp() {
 	data, err := getCmdLineArgs(os.Args)
 	if !err.Empty() {
 		log.Fatalln(err)
@@ -47,7 +52,7 @@ func init() {
 	if val, ok := data["logfile"]; ok {
 		logFile, err := os.OpenFile(val, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
-			log.Fatalf("[FATAL] init(): Error opening log file: %s\n%s\n", data["logfile"], err)
+			log.Fatalf("[FATAL] setupApp(): Error opening log file: %s\n%s\n", data["logfile"], err)
 		}
 
 		log.SetOutput(logFile)
@@ -55,6 +60,8 @@ func init() {
 	// Set up database
 	db = dbInit(data["dbhost"], data["dbuser"], data["dbpassword"], data["dbdatabase"], data["dbport"])
 
+	ledgerCheckMode = data["check_ledger"]
+
 	// Set app dir and load templates
 	appDir = data["app_dir"]
 	tmpl = template.Must(template.ParseGlob(appDir + "/templates/*"))
@@ -73,7 +80,7 @@ func init() {
 	// Check if API access exists for this application
 	apiAccess, err := GetLocalAPIKeys(db)
 	if !err.Empty() {
-		log.Fatalf("[FATAL] init(): Error while getting api local keys:\n%s\n", err)
+		log.Fatalf("[FATAL] setupApp(): Error while getting api local keys:\n%s\n", err)
 	}
 	if len(apiAccess) == 0 {
 		a := API{
@@ -84,12 +91,20 @@ func init() {
 		}
 		a.GenerateAPIKey()
 		if err = a.Create(db); !err.Empty() {
-			log.Fatalf("[FATAL] init(): Error while creating master api key:\n%s\n", err)
+			log.Fatalf("[FATAL] setupApp(): Error while creating master api key:\n%s\n", err)
 		}
 	}
 }
 
 func main() {
+	setupApp()
+
+	if ledgerCheckMode != "" {
+		exitCode := runLedgerCheck(db, ledgerCheckMode)
+		db.Close()
+		os.Exit(exitCode)
+	}
+
 	defer db.Close()
 	defer logFile.Close()
 	http.Handle(
@@ -98,6 +113,9 @@ func main() {
 		),
 	)
 
+	// Book recurring transactions in the background
+	go runScheduler(db, schedulerInterval)
+
 	var api APIHandler
 
 	http.Handle("/api/", api)
@@ -107,17 +125,55 @@ func main() {
 	http.HandleFunc("/settings/", logging(handleSettings))
 	http.HandleFunc("/settings/api/", logging(handleAPISettingsOverview))
 	http.HandleFunc("/settings/api/form/", logging(handleAPISettings))
+	http.HandleFunc("/settings/exchangerates/", logging(handleExchangeRates))
+	http.HandleFunc("/settings/periods/", logging(handlePeriods))
+	http.HandleFunc("/settings/income/", logging(handleIncomeSchedules))
+	http.HandleFunc("/audit/", logging(handleAuditLog))
 	http.HandleFunc("/login/", logging(handleLogin))
 	http.HandleFunc("/logout/", logging(handleLogout))
 
 	// Accounts
 	http.HandleFunc("/accounts/", logging(handleAccountOverview))
 	http.HandleFunc("/accounts/form/", logging(handleAccountForm))
+	http.HandleFunc("/accounts/payment/", logging(handleLoanPayment))
+	http.HandleFunc("/accounts/close/", logging(handleAccountClose))
+	http.HandleFunc("/accounts/reconcile/", logging(handleReconciliationOverview))
+	http.HandleFunc("/accounts/reconcile/form/", logging(handleReconciliationForm))
+	http.HandleFunc("/accounts/goals/form/", logging(handleGoalForm))
+	http.HandleFunc("/accounts/groups/form/", logging(handleAccountGroupForm))
+
+	// Investments
+	http.HandleFunc("/investments/", logging(handleInvestmentOverview))
+	http.HandleFunc("/investments/securities/form/", logging(handleSecurityForm))
+	http.HandleFunc("/investments/trades/form/", logging(handleTradeForm))
 
 	// Transactions
 	http.HandleFunc("/transactions/", logging(handleTransactionOverview))
 	http.HandleFunc("/transactions/form/", logging(handleTransactionForm))
 	http.HandleFunc("/transactions/delete/{id}/", logging(handleTransactionDeletion))
+	http.HandleFunc("/transactions/unreconcile/", logging(handleTransactionUnreconcile))
+	http.HandleFunc("/transactions/import/", logging(handleTransactionImport))
+	http.HandleFunc("/transactions/import/mappings/", logging(handleImportMappings))
+
+	// Attachments
+	http.HandleFunc("/attachments/", logging(handleAttachmentDownload))
+	http.HandleFunc("/attachments/upload/", logging(handleAttachmentUpload))
+
+	// Recurring Transactions
+	http.HandleFunc("/recurring/", logging(handleRecurringOverview))
+	http.HandleFunc("/recurring/form/", logging(handleRecurringForm))
+
+	// Budgets
+	http.HandleFunc("/budgets/", logging(handleBudgetOverview))
+	http.HandleFunc("/budgets/form/", logging(handleBudgetForm))
+
+	// Payees
+	http.HandleFunc("/payees/", logging(handlePayeeOverview))
+	http.HandleFunc("/payees/form/", logging(handlePayeeForm))
+
+	// Rules
+	http.HandleFunc("/rules/", logging(handleRuleOverview))
+	http.HandleFunc("/rules/form/", logging(handleRuleForm))
 
 	// Statistics
 	http.HandleFunc("/statistics/", logging(handleStatisticsOverview))
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
@@ -36,14 +37,25 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		err.AddTraceback("handleRoot", "Error while getting the latest transactions.")
 		log.Println("[WARN]", err)
 	}
-	if ctx["Accounts"], err = GetLimitAccounts(db, 4); !err.Empty() {
-		err.AddTraceback("handleRoot", "Error while getting accounts.")
-		log.Println("[WARN]", err)
+	groups, groupErr := GetAllAccountGroups(db)
+	if !groupErr.Empty() {
+		groupErr.AddTraceback("handleRoot", "Error while getting the account groups.")
+		log.Println("[WARN]", groupErr)
 	}
+	ctx["Groups"] = groups
+	ctx["NetWorth"] = NetWorth(groups)
 	if ctx["Statistics"], err = GetAllStatistics(db); !err.Empty() {
 		err.AddTraceback("handleRoot", "Error while getting statistics.")
 		log.Println("[WARN]", err)
 	}
+	if ctx["Budgets"], err = GetAllBudgets(db, true); !err.Empty() {
+		err.AddTraceback("handleRoot", "Error while getting budgets.")
+		log.Println("[WARN]", err)
+	}
+	if ctx["Goals"], err = GetAllGoals(db, true); !err.Empty() {
+		err.AddTraceback("handleRoot", "Error while getting goals.")
+		log.Println("[WARN]", err)
+	}
 
 	e := tmpl.ExecuteTemplate(w, "index.html", ctx)
 
@@ -72,6 +84,7 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	settings := ctx["Settings"].(Settings)
+	before := auditSnapshot(settings)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -104,7 +117,7 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	settings.Currency = r.FormValue("currency")
-	sdate := r.FormValue("salary_date")
+	settings.BaseCurrency = strings.ToUpper(strings.TrimSpace(r.FormValue("base_currency")))
 	interval := r.FormValue("calc_interval")
 	settings.CalcUoM = r.FormValue("calc_uom")
 	// settings.SetAPIKey(r.FormValue("api_key"))
@@ -112,21 +125,11 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 
 	// Converting the hashed password to a string
 	// password := fmt.Sprintf("%X", pw)
-	startDate, e := time.Parse(dateSettingsLayout, sdate)
 
 	settings.CalcInterval, _ = strconv.ParseInt(interval, 10, 64)
 
-	if e != nil {
-		err.Init("handleSettings", e.Error())
-		log.Println("[INFO] Using current time as start date.")
-		log.Println("[WARN]", err)
-		startDate = time.Now()
-	}
-
-	settings.SalaryDate = startDate
-
 	// err = settings.Save(db, password)
-	err = settings.Save(db)
+	err = writeSettings(&settings, webActor(ctx), before)
 
 	ctx["Settings"] = settings
 	ctx["Success"] = "Settings saved."
@@ -138,14 +141,79 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 		log.Println("[ERROR]", err)
 	}
 
-	e = tmpl.ExecuteTemplate(w, "settings.html", ctx)
-
-	if e != nil {
+	if e := tmpl.ExecuteTemplate(w, "settings.html", ctx); e != nil {
 		err.Init("handleSettings()", e.Error())
 		log.Println("[ERROR]", err)
 	}
 }
 
+// writeSettings saves the settings, the change is logged in the same database transaction
+func writeSettings(settings *Settings, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if err := settings.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditSettings, 0, before, settings)
+	})
+}
+
+// Exchange Rates
+// Lists the exchange rates, POST creates a new rate or deletes the one given in "delete"
+func handleExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/exchangerates/" {
+		handleNotFound(w, r)
+		return
+	}
+
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleExchangeRates", "Error while creating the context.")
+		log.Println("[WARN]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	ctx["Title"] = "Exchange Rates"
+
+	if r.Method == http.MethodPost {
+		rate := EmptyExchangeRate()
+
+		if id := r.FormValue("delete"); id != "" {
+			rateID, _ := strconv.ParseInt(id, 10, 64)
+			if err = rate.FindByID(db, rateID); err.Empty() {
+				err = rate.Delete(db)
+			}
+		} else {
+			rate.FromCurrency = strings.TrimSpace(r.FormValue("from_currency"))
+			rate.ToCurrency = strings.TrimSpace(r.FormValue("to_currency"))
+			rate.Rate, _ = strconv.ParseFloat(r.FormValue("rate"), 64)
+			if d, e := time.Parse(dateInputLayout, r.FormValue("rate_date")); e == nil {
+				rate.RateDate = d
+			}
+			err = rate.Create(db)
+		}
+
+		if !err.Empty() {
+			err.AddTraceback("handleExchangeRates", "Error while writing the exchange rate.")
+			log.Println("[ERROR]", err)
+			ctx["Error"] = "The exchange rate could not be saved: " + err.Error()
+		}
+	}
+
+	if ctx["ExchangeRates"], err = GetAllExchangeRates(db); !err.Empty() {
+		err.AddTraceback("handleExchangeRates", "Error while fetching the exchange rates.")
+		log.Println("[ERROR]", err)
+	}
+
+	if e := tmpl.ExecuteTemplate(w, "settings_exchange_rates.html", ctx); e != nil {
+		err.Init("handleExchangeRates", e.Error())
+		log.Println("[ERROR]", err)
+	}
+}
+
 // API Settings Overview
 func handleAPISettingsOverview(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/settings/api/" {
@@ -217,6 +285,7 @@ func handleAPISettings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	ctx["API"] = key
+	before := auditSnapshot(key)
 
 	// Format access rights for rendering
 	var arf [][]string
@@ -276,7 +345,13 @@ func handleAPISettings(w http.ResponseWriter, r *http.Request) {
 
 	// Save the key and either render the next page
 	if key.ID > 0 {
-		if e = key.Save(db); !e.Empty() {
+		e = withTransaction(db, func(tx *sql.Tx) err.Error {
+			if e := key.Save(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, webActor(ctx), AuditUpdate, AuditAPIKey, int64(key.ID), before, key)
+		})
+		if !e.Empty() {
 			fmt.Println("[WARN]", e.Error())
 			ctx["Error"] = "There was an error while saving this item to the database, please check the logs."
 
@@ -291,7 +366,13 @@ func handleAPISettings(w http.ResponseWriter, r *http.Request) {
 	} else {
 		ctx["RawKey"] = key.GenerateAPIKey()
 
-		if e = key.Create(db); !e.Empty() {
+		e = withTransaction(db, func(tx *sql.Tx) err.Error {
+			if e := key.Create(tx); !e.Empty() {
+				return e
+			}
+			return LogAudit(tx, webActor(ctx), AuditCreate, AuditAPIKey, int64(key.ID), nil, key)
+		})
+		if !e.Empty() {
 			ctx["Error"] = "There was an error while saving this item to the database, please check the logs."
 			fmt.Println("[WARN]", e.Error())
 		} else {
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of money in minor units (cents)
+// In the database amounts are stored as numeric(15,2), in JSON as a number with two decimals
+type Money int64
+
+// moneyScale is the number of minor units in one major unit
+const moneyScale = 100
+
+// maxMoney is the largest amount which fits into numeric(15,2)
+const maxMoney = Money(999999999999999)
+
+// ParseMoney parses a decimal string like "-1234.56" into Money
+// More than two decimals are rounded half away from zero, amounts which don't fit into numeric(15,2) are rejected
+func ParseMoney(s string) (Money, error) {
+	v, e := parseDecimal("ParseMoney()", "amount", s, 2, int64(maxMoney))
+	return Money(v), e
+}
+
+// parseDecimal parses a decimal string into an integer with the given number of decimals, e.g. "1.5" with 2 decimals is 150
+// More decimals are rounded half away from zero, values above max are rejected
+// funcName and what are used in the errors
+func parseDecimal(funcName, what, s string, decimals int, max int64) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("%s: empty %s", funcName, what)
+	}
+	input := s
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("%s: invalid %s %q", funcName, what, input)
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%s: invalid %s %q", funcName, what, input)
+		}
+	}
+
+	scale := int64(1)
+	for i := 0; i < decimals; i++ {
+		scale *= 10
+	}
+
+	// Leading zeros don't count, everything else has to stay below the limit before it's scaled
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	units, e := strconv.ParseInt(intPart, 10, 64)
+	if e != nil || units > max/scale {
+		return 0, fmt.Errorf("%s: %s %q is too large", funcName, what, input)
+	}
+
+	// Pad the decimals by one more digit, which is used for rounding
+	fracPart += strings.Repeat("0", decimals+1)
+	frac, _ := strconv.ParseInt("0"+fracPart[:decimals], 10, 64)
+	if fracPart[decimals] >= '5' {
+		frac++
+	}
+
+	v := units*scale + frac
+	if v > max {
+		return 0, fmt.Errorf("%s: %s %q is too large", funcName, what, input)
+	}
+	if negative {
+		v = v * -1
+	}
+
+	return v, nil
+}
+
+// mulDivRound returns a * b / c rounded half away from zero, the product is computed without overflow
+func mulDivRound(a, b, c int64) int64 {
+	p := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	d := big.NewInt(c)
+
+	q, r := new(big.Int).QuoRem(p, d, new(big.Int))
+	// Round up if the remainder is at least half of the divisor
+	if new(big.Int).Abs(new(big.Int).Mul(r, big.NewInt(2))).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if p.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return q.Int64()
+}
+
+// MoneyFromFloat converts a float into Money, rounded to the nearest cent
+// Only use this for values which are floats by nature, e.g. exchange rates or statistics
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// Convert converts the amount with an exchange rate, rounded to the nearest cent
+func (m Money) Convert(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// Float64 returns the amount as float, only use it for displaying the value
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// String formats the amount with two decimals, e.g. "-1234.56"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = m * -1
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, int64(m)/moneyScale, int64(m)%moneyScale)
+}
+
+// Abs returns the absolute amount
+func (m Money) Abs() Money {
+	if m < 0 {
+		return m * -1
+	}
+	return m
+}
+
+// MarshalJSON writes the amount as JSON number with two decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads the amount from a JSON number or string without going through a float
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), "\"")
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+
+	v, e := ParseMoney(s)
+	if e != nil {
+		return e
+	}
+
+	*m = v
+	return nil
+}
+
+// Scan implements the sql.Scanner interface for numeric columns
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.UnmarshalJSON(v)
+	case string:
+		return m.UnmarshalJSON([]byte(v))
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		return fmt.Errorf("Money.Scan(): unsupported type %T", src)
+	}
+
+	return nil
+}
+
+// Value implements the driver.Valuer interface, the amount is passed as exact decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
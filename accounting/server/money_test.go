@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Money
+		ok    bool
+	}{
+		{"0", 0, true},
+		{"12", 1200, true},
+		{"12.3", 1230, true},
+		{"-1234.56", -123456, true},
+		{"+5.50", 550, true},
+		{" 7.05 ", 705, true},
+		{".5", 50, true},
+		{"5.", 500, true},
+		{"0.005", 1, true},
+		{"-0.005", -1, true},
+		{"1.994", 199, true},
+		{"1.995", 200, true},
+		{"0009.10", 910, true},
+		{"9999999999999.99", 999999999999999, true},
+		{"-9999999999999.99", -999999999999999, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"+", 0, false},
+		{".", 0, false},
+		{"-.", 0, false},
+		{"--5", 0, false},
+		{"+-5.50", 0, false},
+		{"-+5", 0, false},
+		{"5.-5", 0, false},
+		{"1,50", 0, false},
+		{"1.2.3", 0, false},
+		{"abc", 0, false},
+		{"1e5", 0, false},
+		{"10000000000000", 0, false},
+		{"9999999999999.995", 0, false},
+		{"99999999999999999.99", 0, false},
+		{"999999999999999999999", 0, false},
+	}
+
+	for _, test := range tests {
+		got, e := ParseMoney(test.input)
+		if test.ok && e != nil {
+			t.Errorf("ParseMoney(%q) returned error: %v", test.input, e)
+		} else if !test.ok && e == nil {
+			t.Errorf("ParseMoney(%q) = %v, expected an error", test.input, got)
+		} else if got != test.want {
+			t.Errorf("ParseMoney(%q) = %v, expected %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		input Money
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{123456, "1234.56"},
+		{-123456, "-1234.56"},
+	}
+
+	for _, test := range tests {
+		if got := test.input.String(); got != test.want {
+			t.Errorf("Money(%d).String() = %q, expected %q", int64(test.input), got, test.want)
+		}
+	}
+}
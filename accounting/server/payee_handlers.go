@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#           Payees           #
+	#                            #
+	##############################
+*/
+
+// handlePayeeOverview lists the payees with their spending in a month
+// ?date=DD.MM.YYYY shows the month which contains the date instead of the current one
+func handlePayeeOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/payees/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handlePayeeOverview()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Payees"
+
+	date := time.Now().Local()
+	if val := r.URL.Query().Get("date"); val != "" {
+		var err error
+		if date, err = time.ParseInLocation(dateLayout, val, time.Local); err != nil {
+			e.Init("handlePayeeOverview()", err.Error())
+			log.Println("[WARN]", e)
+			date = time.Now().Local()
+		}
+	}
+
+	month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+	ctx["Month"] = month.Format("January 2006")
+	ctx["PrevDate"] = month.AddDate(0, -1, 0).Format(dateLayout)
+	ctx["NextDate"] = month.AddDate(0, 1, 0).Format(dateLayout)
+
+	payees, e := GetAllPayees(db, false)
+	if !e.Empty() {
+		e.AddTraceback("handlePayeeOverview()", "Error while getting all payees.")
+		log.Println("[WARN]", e)
+	}
+	for i := range payees {
+		if e = payees[i].ComputeForPeriod(db, month, month.AddDate(0, 1, 0)); !e.Empty() {
+			e.AddTraceback("handlePayeeOverview()", "Error while computing payee: "+fmt.Sprintf("%d", payees[i].ID))
+			log.Println("[WARN]", e)
+		}
+	}
+	ctx["Payees"] = payees
+
+	if err := tmpl.ExecuteTemplate(w, "payees.html", ctx); err != nil {
+		e.Init("handlePayeeOverview()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+func handlePayeeForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/payees/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handlePayeeForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Payee"
+	ctx["Btn"] = "Create Payee"
+
+	p := EmptyPayee()
+
+	// Get the current payee
+	if payeeID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(payeeID[0])
+		if e != nil {
+			err.Init("handlePayeeForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = p.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handlePayeeForm()", "Error finding payee: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			p = EmptyPayee()
+		} else {
+			ctx["Title"] = "Edit Payee"
+			ctx["Btn"] = "Save Payee"
+
+			if ctx["Transactions"], err = GetTransactionsByPayee(db, p.ID, 20); !err.Empty() {
+				err.AddTraceback("handlePayeeForm()", "Error while getting the transactions of payee: "+fmt.Sprintf("%d", id))
+				log.Println("[WARN]", err)
+			}
+		}
+	}
+
+	ctx["Payee"] = p
+
+	if ctx["Categories"], err = GetAllCategories(db); !err.Empty() {
+		err.AddTraceback("handlePayeeForm()", "Error while getting the categories.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "payee_form.html", ctx); e != nil {
+			err.Init("handlePayeeForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	before := auditSnapshot(p)
+
+	p.Name = r.FormValue("name")
+	p.Aliases = ParseTags(r.FormValue("aliases"))
+	p.Iban = r.FormValue("iban")
+	p.BankCode = r.FormValue("bankCode")
+	p.BankName = r.FormValue("bankName")
+	p.Active = r.FormValue("active") == "on"
+
+	var e error
+	if p.CategoryID, e = strconv.ParseInt(r.FormValue("category"), 0, 64); e != nil {
+		p.CategoryID = 0
+	}
+
+	create := p.ID == 0
+	err = writePayee(&p, webActor(ctx), before)
+
+	if !err.Empty() {
+		err.AddTraceback("handlePayeeForm()", "Error while writing the payee to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			p.ID = 0
+		}
+		ctx["Payee"] = p
+		ctx["Error"] = "The payee could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "payee_form.html", ctx); e != nil {
+			err.Init("handlePayeeForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/payees/", http.StatusSeeOther)
+}
+
+// writePayee creates or saves the payee, the change is logged in the same database transaction
+func writePayee(p *Payee, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if p.ID == 0 {
+			if err := p.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, actor, AuditCreate, AuditPayee, p.ID, nil, p)
+		}
+		if err := p.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditPayee, p.ID, before, p)
+	})
+}
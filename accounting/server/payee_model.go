@@ -0,0 +1,463 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Payee is a counterparty of transactions like a shop or an employer
+// Transactions are linked to the payee whose name is their reference or one of whose Aliases
+// is part of it, e.g. "REWE SAGT DANKE" with the alias "rewe"
+// CategoryID is used for linked transactions which were created without a category
+// The bank fields are the same as the ones of the accounts, BankCode holds the BIC
+type Payee struct {
+	ID         int64
+	Name       string
+	Aliases    []string
+	CategoryID int64
+	Iban       string
+	BankCode   string
+	BankName   string
+	Active     bool
+	CreateDate time.Time
+	LastUpdate time.Time
+
+	// Computed fields
+	CategoryName     string
+	CategoryHex      string
+	Currency         string
+	TransactionCount int64
+	// Spent and Received are the totals of the active transactions in the base currency,
+	// expenses and fees less refunds and the income
+	Spent    Money
+	Received Money
+
+	// Computed for the period of ComputeForPeriod, the end is the start of the next period
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	PeriodCount    int64
+	PeriodSpent    Money
+	PeriodReceived Money
+}
+
+// EmptyPayee returns an empty payee
+func EmptyPayee() Payee {
+	p := Payee{
+		ID:         0,
+		Name:       "",
+		CategoryID: 0,
+		Iban:       "",
+		BankCode:   "",
+		BankName:   "",
+		Active:     true,
+		CreateDate: time.Now().Local(),
+		LastUpdate: time.Now().Local(),
+	}
+
+	return p
+}
+
+func (p *Payee) validate(funcName string) err.Error {
+	var err err.Error
+
+	p.Name = strings.TrimSpace(p.Name)
+	p.Aliases = normalizeTags(p.Aliases)
+
+	if p.Name == "" {
+		err.Init(funcName, "The payee does not have a name")
+	}
+
+	return err
+}
+
+// writeAliases replaces the aliases of the payee with Aliases
+func (p *Payee) writeAliases(cr *sql.Tx) err.Error {
+	if _, e := cr.Exec("DELETE FROM payee_aliases WHERE payee_id=$1", p.ID); e != nil {
+		var err err.Error
+		err.Init("Payee.writeAliases()", e.Error())
+		return err
+	}
+
+	for _, alias := range p.Aliases {
+		if _, e := cr.Exec("INSERT INTO payee_aliases (payee_id, alias) VALUES ($1, $2)", p.ID, alias); e != nil {
+			var err err.Error
+			err.Init("Payee.writeAliases()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+// Create 's the payee with it's aliases, run it with withTransaction
+func (p *Payee) Create(cr *sql.Tx) err.Error {
+	if p.ID != 0 {
+		var err err.Error
+		err.Init("Payee.Create()", "This object already has an id")
+		return err
+	}
+	if err := p.validate("Payee.Create()"); !err.Empty() {
+		return err
+	}
+
+	p.CreateDate = time.Now().Local()
+	p.LastUpdate = time.Now().Local()
+
+	var categID interface{} = p.CategoryID
+	if p.CategoryID == 0 {
+		categID = nil
+	}
+
+	query := "INSERT INTO payees (name, category_id, iban, bank_code, bank_name, active, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		p.Name,
+		categID,
+		p.Iban,
+		p.BankCode,
+		p.BankName,
+		p.Active,
+		p.CreateDate,
+		p.LastUpdate,
+	).Scan(&p.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Payee.Create()", e.Error())
+		return err
+	}
+
+	if err := p.writeAliases(cr); !err.Empty() {
+		err.AddTraceback("Payee.Create()", "Error while writing the aliases.")
+		return err
+	}
+
+	p.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the payee and replaces it's aliases, run it with withTransaction
+func (p *Payee) Save(cr *sql.Tx) err.Error {
+	if p.ID <= 0 {
+		var err err.Error
+		err.Init("Payee.Save()", "This payee has no ID, maybe create it first?")
+		return err
+	}
+	if err := p.validate("Payee.Save()"); !err.Empty() {
+		return err
+	}
+
+	p.LastUpdate = time.Now().Local()
+
+	var categID interface{} = p.CategoryID
+	if p.CategoryID == 0 {
+		categID = nil
+	}
+
+	query := "UPDATE payees SET name=$2, category_id=$3, iban=$4, bank_code=$5, bank_name=$6, active=$7, "
+	query += "last_update=$8 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		p.ID,
+		p.Name,
+		categID,
+		p.Iban,
+		p.BankCode,
+		p.BankName,
+		p.Active,
+		p.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Payee.Save()", e.Error())
+		return err
+	}
+
+	if err := p.writeAliases(cr); !err.Empty() {
+		err.AddTraceback("Payee.Save()", "Error while writing the aliases.")
+		return err
+	}
+
+	p.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the payee, it's transactions are kept without a payee
+func (p *Payee) Delete(cr Cursor) err.Error {
+	if p.ID <= 0 {
+		var err err.Error
+		err.Init("Payee.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM payees WHERE id=$1", p.ID); e != nil {
+		var err err.Error
+		err.Init("Payee.Delete()", e.Error())
+		return err
+	}
+
+	p.ID = 0
+
+	return err.Error{}
+}
+
+// amountsBetween returns the number of active transactions of the payee and the amounts
+// spent and received between start and end, a zero start or end leaves the period open
+func (p *Payee) amountsBetween(cr Cursor, start, end time.Time) (int64, Money, Money, err.Error) {
+	var count int64
+	var spent, received Money
+
+	query := "SELECT COUNT(*), "
+	query += "COALESCE(SUM(spent_amount(t.transaction_type, ta.base_amount)), 0), "
+	query += "COALESCE(SUM(ta.base_amount) FILTER (WHERE t.transaction_type='income'), 0) "
+	query += "FROM transactions AS t JOIN transaction_amounts AS ta ON ta.transaction_id=t.id "
+	query += "WHERE t.payee_id=$1 AND t.active=true "
+	query += "AND ($2::timestamp IS NULL OR t.transaction_date >= $2) AND ($3::timestamp IS NULL OR t.transaction_date < $3)"
+
+	var from, to interface{} = start, end
+	if start.IsZero() {
+		from = nil
+	}
+	if end.IsZero() {
+		to = nil
+	}
+
+	if e := cr.QueryRow(query, p.ID, from, to).Scan(&count, &spent, &received); e != nil {
+		var err err.Error
+		err.Init("Payee.amountsBetween()", e.Error())
+		return 0, 0, 0, err
+	}
+
+	return count, spent, received, err.Error{}
+}
+
+// ComputeForPeriod computes the transactions of the payee between start and end
+func (p *Payee) ComputeForPeriod(cr Cursor, start, end time.Time) err.Error {
+	p.PeriodStart = start
+	p.PeriodEnd = end
+
+	var err err.Error
+	if p.PeriodCount, p.PeriodSpent, p.PeriodReceived, err = p.amountsBetween(cr, start, end); !err.Empty() {
+		err.AddTraceback("Payee.ComputeForPeriod()", "Error while computing the amounts of the period.")
+		return err
+	}
+
+	return err
+}
+
+func (p *Payee) computeFields(cr Cursor) {
+	// Compute: CategoryName, CategoryHex
+	if p.CategoryID > 0 {
+		c, err := FindCategoryByID(cr, p.CategoryID)
+		if !err.Empty() {
+			err.AddTraceback("Payee.computeFields()", "Error while finding category by ID: "+fmt.Sprintf("%d", p.CategoryID))
+			log.Println("[WARN]", err)
+		}
+		p.CategoryName = c.Name
+		p.CategoryHex = c.Hex
+	}
+
+	// Compute: Currency
+	if e := cr.QueryRow("SELECT base_currency();").Scan(&p.Currency); e != nil {
+		var err err.Error
+		err.Init("Payee.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+
+	// Compute: TransactionCount, Spent, Received
+	var err err.Error
+	if p.TransactionCount, p.Spent, p.Received, err = p.amountsBetween(cr, time.Time{}, time.Time{}); !err.Empty() {
+		err.AddTraceback("Payee.computeFields()", "Error while computing the totals of payee: "+fmt.Sprintf("%d", p.ID))
+		log.Println("[WARN]", err)
+	}
+}
+
+// FindByID finds a payee with it's id
+func (p *Payee) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, category_id, iban, bank_code, bank_name, active, create_date, last_update "
+	query += "FROM payees WHERE id=$1"
+
+	var categID interface{}
+
+	e := cr.QueryRow(query, id).Scan(
+		&p.ID,
+		&p.Name,
+		&categID,
+		&p.Iban,
+		&p.BankCode,
+		&p.BankName,
+		&p.Active,
+		&p.CreateDate,
+		&p.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Payee.FindByID()", e.Error())
+		return err
+	}
+
+	p.CategoryID = 0
+	if categID != nil {
+		p.CategoryID = categID.(int64)
+	}
+
+	rows, e := cr.Query("SELECT alias FROM payee_aliases WHERE payee_id=$1 ORDER BY alias", p.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Payee.FindByID()", e.Error())
+		return err
+	}
+
+	p.Aliases = nil
+	for rows.Next() {
+		var alias string
+		if e = rows.Scan(&alias); e != nil {
+			log.Println("[INFO] Payee.FindByID(): Skipping alias")
+			log.Printf("[WARN] Payee.FindByID(): %s\n", e)
+			continue
+		}
+		p.Aliases = append(p.Aliases, alias)
+	}
+	rows.Close()
+
+	p.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindPayeeByID is similar to FindByID but returns the payee
+func FindPayeeByID(cr Cursor, id int64) (Payee, err.Error) {
+	p := EmptyPayee()
+
+	if e := p.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindPayeeByID()", "Error while finding payee by ID: "+fmt.Sprintf("%d", id))
+		return p, e
+	}
+
+	return p, err.Error{}
+}
+
+// MatchPayee returns the id of the active payee for the reference of a transaction, 0 if there is none
+// The reference matches if it's the name of the payee or contains one of it's aliases, ignoring the case
+// The payee with the longest matching alias wins
+func MatchPayee(cr Cursor, reference string) (int64, err.Error) {
+	var id int64
+
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return 0, err.Error{}
+	}
+
+	query := "SELECT p.id FROM payees AS p LEFT JOIN payee_aliases AS a ON a.payee_id=p.id "
+	query += "WHERE p.active=true AND (lower(p.name)=lower($1) OR strpos(lower($1), lower(a.alias)) > 0) "
+	query += "ORDER BY lower(p.name)=lower($1) DESC, length(a.alias) DESC NULLS LAST, p.id LIMIT 1"
+
+	e := cr.QueryRow(query, reference).Scan(&id)
+	if e == sql.ErrNoRows {
+		return 0, err.Error{}
+	} else if e != nil {
+		var err err.Error
+		err.Init("MatchPayee()", e.Error())
+		return 0, err
+	}
+
+	return id, err.Error{}
+}
+
+// GetAllPayees returns all payees ordered by their name
+// If activeOnly is true, inactive payees are left out
+func GetAllPayees(cr Cursor, activeOnly bool) ([]Payee, err.Error) {
+	var ids []int64
+	var result []Payee
+
+	query := "SELECT id FROM payees "
+	if activeOnly {
+		query += "WHERE active=true "
+	}
+	query += "ORDER BY active DESC, lower(name), id"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllPayees()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllPayees(): Skipping record")
+			log.Printf("[WARN] GetAllPayees(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		p, err := FindPayeeByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllPayees(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, p)
+	}
+
+	return result, err.Error{}
+}
+
+// GetTransactionsByPayee returns the latest transactions of the payee
+// limit <= 0 returns all of them
+func GetTransactionsByPayee(cr Cursor, payeeID int64, limit int) ([]Transaction, err.Error) {
+	var ids []int64
+	var transactions []Transaction
+
+	query := "SELECT id FROM transactions WHERE payee_id=$1 ORDER BY transaction_date DESC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, e := cr.Query(query, payeeID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetTransactionsByPayee()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetTransactionsByPayee(): Skipping record")
+			log.Printf("[WARN] GetTransactionsByPayee(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		t, err := FindTransactionByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetTransactionsByPayee(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, err.Error{}
+}
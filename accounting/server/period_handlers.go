@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#       Closed Periods       #
+	#                            #
+	##############################
+*/
+
+// handlePeriods lists the closed periods
+// A POST closes the period of the form or reopens the period of the field reopen
+func handlePeriods(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/settings/periods/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handlePeriods()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Closed Periods"
+	ctx["PeriodTypes"] = GetAllPeriodTypes()
+	// The last month is the one which is usually closed next
+	ctx["PeriodDate"] = time.Now().Local().AddDate(0, -1, 0).Format(dateInputLayout)
+
+	// Reopening needs the admin right of the API, the web interface acts with the key of the application
+	settings := ctx["Settings"].(Settings)
+	ctx["CanReopen"] = StrContains(settings.APIKey.AccessRights, "period.reopen")
+
+	if r.Method == http.MethodPost {
+		if id := r.FormValue("reopen"); id != "" {
+			periodID, _ := strconv.ParseInt(id, 10, 64)
+
+			p := EmptyPeriod()
+			if ctx["CanReopen"] != true {
+				e.Init("handlePeriods()", "Reopening needs the right period.reopen, please grant it to the key of the application")
+			} else if e = p.FindByID(db, periodID); e.Empty() {
+				e = withTransaction(db, func(tx *sql.Tx) err.Error {
+					return p.Reopen(tx, webActor(ctx))
+				})
+			}
+		} else if date, parseErr := time.ParseInLocation(dateInputLayout, r.FormValue("period_date"), time.Local); parseErr != nil {
+			e.Init("handlePeriods()", "Please enter a valid date in the period: "+r.FormValue("period_date"))
+		} else {
+			e = withTransaction(db, func(tx *sql.Tx) err.Error {
+				_, closeErr := ClosePeriod(tx, webActor(ctx), r.FormValue("period_type"), date)
+				return closeErr
+			})
+		}
+
+		if !e.Empty() {
+			e.AddTraceback("handlePeriods()", "Error while closing/reopening the period.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The period could not be closed or reopened: " + e.Error()
+		}
+	}
+
+	if ctx["Periods"], e = GetAllPeriods(db); !e.Empty() {
+		e.AddTraceback("handlePeriods()", "Error while getting the periods.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "settings_periods.html", ctx); err != nil {
+		e.Init("handlePeriods()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
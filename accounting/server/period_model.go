@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Types of periods, stored in PeriodType
+const (
+	// PeriodMonth is a calendar month
+	PeriodMonth = "month"
+	// PeriodYear is a calendar year
+	PeriodYear = "year"
+)
+
+// GetAllPeriodTypes returns all types a period can have
+func GetAllPeriodTypes() []string {
+	return []string{
+		PeriodMonth,
+		PeriodYear,
+	}
+}
+
+// Period is a closed month or year, transactions and trades dated inside it can't be created, changed or deleted
+// Balances are the balances of the accounts at the EndDate, taken from the journal when the period was closed
+// Periods are only reopened by deleting them, both is written to the audit log
+type Period struct {
+	ID         int64
+	Name       string
+	PeriodType string
+	StartDate  time.Time
+	EndDate    time.Time
+	CloseDate  time.Time
+	ClosedBy   string
+	Balances   []PeriodBalance
+
+	// Computed fields
+	StartDateStr string
+	EndDateStr   string
+	CloseDateStr string
+}
+
+// PeriodBalance is the balance of an account at the end of a closed period
+// The securities of investment accounts are not part of it, their past prices are unknown
+type PeriodBalance struct {
+	AccountID   int64
+	AccountName string
+	Currency    string
+	Balance     Money
+}
+
+// EmptyPeriod returns an empty period
+func EmptyPeriod() Period {
+	p := Period{
+		ID:         0,
+		Name:       "",
+		PeriodType: "",
+		CloseDate:  time.Now().Local(),
+		ClosedBy:   "",
+	}
+
+	return p
+}
+
+// periodBounds returns the first and the last day and the name of the period of the type which contains the date
+func periodBounds(periodType string, date time.Time) (time.Time, time.Time, string) {
+	if periodType == PeriodYear {
+		start := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+		return start, start.AddDate(1, 0, -1), start.Format("2006")
+	}
+
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.Local)
+	return start, start.AddDate(0, 1, -1), start.Format("01.2006")
+}
+
+// checkPeriodOpen returns an error if the date is inside of a closed period
+func checkPeriodOpen(cr Cursor, date time.Time, funcName string) err.Error {
+	var name string
+
+	query := "SELECT name FROM periods WHERE $1::date BETWEEN start_date AND end_date LIMIT 1"
+
+	e := cr.QueryRow(query, date.Format(dateInputLayout)).Scan(&name)
+	if e == sql.ErrNoRows {
+		return err.Error{}
+	} else if e != nil {
+		var err err.Error
+		err.Init(funcName, e.Error())
+		return err
+	}
+
+	var err err.Error
+	err.Init(funcName, "The period "+name+" is closed, nothing dated "+date.Format(dateLayout)+" can be changed")
+	return err
+}
+
+// ClosePeriod closes the month or year (periodType) which contains the date and takes the balances of the accounts
+// Only past periods which don't overlap with closed ones can be closed, the closing is logged with actor
+func ClosePeriod(cr *sql.Tx, actor, periodType string, date time.Time) (Period, err.Error) {
+	p := EmptyPeriod()
+
+	valid := false
+	for _, t := range GetAllPeriodTypes() {
+		valid = valid || t == periodType
+	}
+	if !valid {
+		var err err.Error
+		err.Init("ClosePeriod()", "Unknown period type: "+periodType)
+		return p, err
+	}
+
+	p.PeriodType = periodType
+	p.ClosedBy = actor
+	p.StartDate, p.EndDate, p.Name = periodBounds(periodType, date)
+
+	today := time.Now().Local()
+	if !p.EndDate.Before(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)) {
+		var err err.Error
+		err.Init("ClosePeriod()", "The period "+p.Name+" isn't over yet")
+		return p, err
+	}
+
+	var overlapping string
+
+	query := "SELECT name FROM periods WHERE start_date <= $2::date AND end_date >= $1::date LIMIT 1"
+
+	e := cr.QueryRow(query, p.StartDate.Format(dateInputLayout), p.EndDate.Format(dateInputLayout)).Scan(&overlapping)
+	if e != nil && e != sql.ErrNoRows {
+		var err err.Error
+		err.Init("ClosePeriod()", e.Error())
+		return p, err
+	} else if e == nil {
+		var err err.Error
+		err.Init("ClosePeriod()", "The period "+p.Name+" overlaps with the closed period "+overlapping)
+		return p, err
+	}
+
+	query = "INSERT INTO periods (name, period_type, start_date, end_date, close_date, closed_by) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+
+	e = cr.QueryRow(query,
+		p.Name,
+		p.PeriodType,
+		p.StartDate.Format(dateInputLayout),
+		p.EndDate.Format(dateInputLayout),
+		p.CloseDate,
+		p.ClosedBy,
+	).Scan(&p.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("ClosePeriod()", e.Error())
+		return p, err
+	}
+
+	// The balances contain every journal line up to the end of the period
+	query = "INSERT INTO period_balances (period_id, account_id, currency, balance) "
+	query += "SELECT $1, a.id, a.currency, COALESCE(SUM(l.debit - l.credit), 0) FROM accounts AS a "
+	query += "LEFT JOIN (journal_lines AS l JOIN journal_entries AS e ON e.id=l.entry_id AND e.entry_date < $2::date) "
+	query += "ON l.account_id=a.id "
+	query += "WHERE a.create_date < $2::date GROUP BY a.id, a.currency"
+
+	if _, e = cr.Exec(query, p.ID, p.EndDate.AddDate(0, 0, 1).Format(dateInputLayout)); e != nil {
+		var err err.Error
+		err.Init("ClosePeriod()", e.Error())
+		return p, err
+	}
+
+	if err := p.FindByID(cr, p.ID); !err.Empty() {
+		err.AddTraceback("ClosePeriod()", "Error while reading the closed period: "+fmt.Sprintf("%d", p.ID))
+		return p, err
+	}
+
+	if err := LogAudit(cr, actor, AuditClose, AuditPeriod, p.ID, nil, p); !err.Empty() {
+		err.AddTraceback("ClosePeriod()", "Error while logging the closing of period "+p.Name)
+		return p, err
+	}
+
+	return p, err.Error{}
+}
+
+// Reopen 's the period by deleting it with it's balances, the reopening is logged with actor
+func (p *Period) Reopen(cr *sql.Tx, actor string) err.Error {
+	if p.ID <= 0 {
+		var err err.Error
+		err.Init("Period.Reopen()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM periods WHERE id=$1", p.ID); e != nil {
+		var err err.Error
+		err.Init("Period.Reopen()", e.Error())
+		return err
+	}
+
+	if err := LogAudit(cr, actor, AuditReopen, AuditPeriod, p.ID, p, nil); !err.Empty() {
+		err.AddTraceback("Period.Reopen()", "Error while logging the reopening of period "+p.Name)
+		return err
+	}
+
+	p.ID = 0
+
+	return err.Error{}
+}
+
+func (p *Period) computeFields(cr Cursor) {
+	p.StartDateStr = p.StartDate.Format(dateLayout)
+	p.EndDateStr = p.EndDate.Format(dateLayout)
+	p.CloseDateStr = p.CloseDate.Format(dtLayout)
+
+	p.Balances = nil
+
+	query := "SELECT b.account_id, a.name, b.currency, b.balance FROM period_balances AS b "
+	query += "JOIN accounts AS a ON a.id=b.account_id WHERE b.period_id=$1 ORDER BY a.name"
+
+	rows, e := cr.Query(query, p.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Period.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b PeriodBalance
+
+		if e = rows.Scan(&b.AccountID, &b.AccountName, &b.Currency, &b.Balance); e != nil {
+			log.Println("[INFO] Period.computeFields(): Skipping balance")
+			log.Printf("[WARN] Period.computeFields(): %s\n", e)
+			continue
+		}
+
+		p.Balances = append(p.Balances, b)
+	}
+}
+
+// FindByID finds a period with it's id
+func (p *Period) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, period_type, start_date, end_date, close_date, closed_by FROM periods WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&p.ID,
+		&p.Name,
+		&p.PeriodType,
+		&p.StartDate,
+		&p.EndDate,
+		&p.CloseDate,
+		&p.ClosedBy,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Period.FindByID()", e.Error())
+		return err
+	}
+
+	p.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindPeriodByID is similar to FindByID but returns the period
+func FindPeriodByID(cr Cursor, id int64) (Period, err.Error) {
+	p := EmptyPeriod()
+
+	if e := p.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindPeriodByID()", "Error while finding period by ID: "+fmt.Sprintf("%d", id))
+		return p, e
+	}
+
+	return p, err.Error{}
+}
+
+// GetAllPeriods returns all closed periods, the latest first
+func GetAllPeriods(cr Cursor) ([]Period, err.Error) {
+	var ids []int64
+	var result []Period
+
+	rows, e := cr.Query("SELECT id FROM periods ORDER BY start_date DESC, id DESC")
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllPeriods()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllPeriods(): Skipping record")
+			log.Printf("[WARN] GetAllPeriods(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		p, err := FindPeriodByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllPeriods(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, p)
+	}
+
+	return result, err.Error{}
+}
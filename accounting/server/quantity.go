@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Quantity is an exact number of securities in millionths
+// In the database quantities are stored as numeric(18,6), in JSON as a number with up to six decimals
+type Quantity int64
+
+// quantityScale is the number of millionths in one security
+const quantityScale = 1000000
+
+// maxQuantity is the largest quantity which fits into numeric(18,6)
+const maxQuantity = Quantity(999999999999999999)
+
+// ParseQuantity parses a decimal string like "12.5" into a Quantity
+// More than six decimals are rounded half away from zero, quantities which don't fit into numeric(18,6) are rejected
+func ParseQuantity(s string) (Quantity, error) {
+	v, e := parseDecimal("ParseQuantity()", "quantity", s, 6, int64(maxQuantity))
+	return Quantity(v), e
+}
+
+// Times returns the value of the quantity at the price, rounded half away from zero to the cent
+func (q Quantity) Times(price Money) Money {
+	return Money(mulDivRound(int64(q), int64(price), quantityScale))
+}
+
+// Share returns the part of the amount which belongs to part of the quantity whole, rounded to the cent
+func (m Money) Share(part, whole Quantity) Money {
+	return Money(mulDivRound(int64(m), int64(part), int64(whole)))
+}
+
+// String formats the quantity without trailing zeros, e.g. "12.5" or "-3"
+func (q Quantity) String() string {
+	sign := ""
+	if q < 0 {
+		sign = "-"
+		q = q * -1
+	}
+
+	s := fmt.Sprintf("%s%d", sign, int64(q)/quantityScale)
+	if frac := int64(q) % quantityScale; frac != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%06d", frac), "0")
+	}
+
+	return s
+}
+
+// MarshalJSON writes the quantity as JSON number
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalJSON reads the quantity from a JSON number or string without going through a float
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), "\"")
+	if s == "null" || s == "" {
+		*q = 0
+		return nil
+	}
+
+	v, e := ParseQuantity(s)
+	if e != nil {
+		return e
+	}
+
+	*q = v
+	return nil
+}
+
+// Scan implements the sql.Scanner interface for numeric columns
+func (q *Quantity) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*q = 0
+	case []byte:
+		return q.UnmarshalJSON(v)
+	case string:
+		return q.UnmarshalJSON([]byte(v))
+	case int64:
+		*q = Quantity(v * quantityScale)
+	default:
+		return fmt.Errorf("Quantity.Scan(): unsupported type %T", src)
+	}
+
+	return nil
+}
+
+// Value implements the driver.Valuer interface, the quantity is passed as exact decimal string
+func (q Quantity) Value() (driver.Value, error) {
+	return q.String(), nil
+}
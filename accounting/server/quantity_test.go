@@ -0,0 +1,109 @@
+package main
+
+import "testing"
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Quantity
+		ok    bool
+	}{
+		{"0", 0, true},
+		{"12", 12000000, true},
+		{"0.1", 100000, true},
+		{"1.234567", 1234567, true},
+		{"1.2345675", 1234568, true},
+		{"-2.5", -2500000, true},
+		{"999999999999.999999", 999999999999999999, true},
+		{"", 0, false},
+		{"-", 0, false},
+		{"1,5", 0, false},
+		{"1e3", 0, false},
+		{"1000000000000", 0, false},
+	}
+
+	for _, test := range tests {
+		got, e := ParseQuantity(test.input)
+		if test.ok && e != nil {
+			t.Errorf("ParseQuantity(%q) returned error: %v", test.input, e)
+		} else if !test.ok && e == nil {
+			t.Errorf("ParseQuantity(%q) = %v, expected an error", test.input, got)
+		} else if got != test.want {
+			t.Errorf("ParseQuantity(%q) = %v, expected %v", test.input, int64(got), int64(test.want))
+		}
+	}
+}
+
+func TestQuantityString(t *testing.T) {
+	tests := []struct {
+		input Quantity
+		want  string
+	}{
+		{0, "0"},
+		{12000000, "12"},
+		{1500000, "1.5"},
+		{1, "0.000001"},
+		{-2500000, "-2.5"},
+	}
+
+	for _, test := range tests {
+		if got := test.input.String(); got != test.want {
+			t.Errorf("Quantity(%d).String() = %q, expected %q", int64(test.input), got, test.want)
+		}
+	}
+}
+
+func TestQuantityTimes(t *testing.T) {
+	tests := []struct {
+		quantity string
+		price    Money
+		want     Money
+	}{
+		{"10", 1234, 12340},
+		{"0.5", 101, 51},
+		{"0.5", 99, 50},
+		{"0.333333", 300, 100},
+		{"3", 3333, 9999},
+		{"999999999999", 99999, 99999 * 999999999999},
+	}
+
+	for _, test := range tests {
+		q, _ := ParseQuantity(test.quantity)
+		if got := q.Times(test.price); got != test.want {
+			t.Errorf("%s times %v = %v, expected %v", test.quantity, test.price, got, test.want)
+		}
+	}
+}
+
+func TestMoneyShare(t *testing.T) {
+	tests := []struct {
+		amount      Money
+		part, whole string
+		want        Money
+	}{
+		{1000, "1", "3", 333},
+		{1000, "2", "3", 667},
+		{1000, "3", "3", 1000},
+		{-1000, "1", "3", -333},
+		{1001, "0.1", "0.2", 501},
+	}
+
+	for _, test := range tests {
+		part, _ := ParseQuantity(test.part)
+		whole, _ := ParseQuantity(test.whole)
+		if got := test.amount.Share(part, whole); got != test.want {
+			t.Errorf("%v.Share(%s, %s) = %v, expected %v", test.amount, test.part, test.whole, got, test.want)
+		}
+	}
+}
+
+func TestQuantitySum(t *testing.T) {
+	// Bought in two parts and sold at once, a float would keep a remainder
+	a, _ := ParseQuantity("0.1")
+	b, _ := ParseQuantity("0.2")
+	sold, _ := ParseQuantity("0.3")
+
+	if held := a + b; sold > held || held-sold != 0 {
+		t.Errorf("0.1 + 0.2 - 0.3 = %v, expected 0", held-sold)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#       Reconciliation       #
+	#                            #
+	##############################
+*/
+
+// handleReconciliationOverview lists the reconciliations of an account and starts new ones
+func handleReconciliationOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/reconcile/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleReconciliationOverview()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Reconciliation"
+
+	var accountID int64
+	if val, ok := r.URL.Query()["account"]; ok {
+		accountID, _ = strconv.ParseInt(val[0], 0, 64)
+	}
+	if r.Method == http.MethodPost {
+		accountID, _ = strconv.ParseInt(r.FormValue("account"), 0, 64)
+	}
+
+	ctx["AccountID"] = accountID
+
+	if ctx["Accounts"], e = GetAllAccounts(db); !e.Empty() {
+		e.AddTraceback("handleReconciliationOverview()", "Error while getting the accounts.")
+		log.Println("[WARN]", e)
+	}
+
+	// Start a new reconciliation with the statement
+	if r.Method == http.MethodPost {
+		rec := EmptyReconciliation()
+		rec.AccountID = accountID
+
+		var err error
+		if rec.StatementDate, err = time.ParseInLocation(dtLayout, r.FormValue("statement_date"), time.Local); err != nil {
+			rec.StatementDate = time.Now().Local()
+		}
+		if rec.ClosingBalance, err = ParseMoney(r.FormValue("closing_balance")); err != nil {
+			e.Init("handleReconciliationOverview()", err.Error())
+			log.Println("[WARN]", e)
+			ctx["Error"] = "The closing balance is not a valid amount: " + r.FormValue("closing_balance")
+		} else if e = writeReconciliation(&rec, AuditCreate, webActor(ctx), nil); !e.Empty() {
+			e.AddTraceback("handleReconciliationOverview()", "Error while creating the reconciliation.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The reconciliation could not be started: " + e.Error()
+		} else {
+			http.Redirect(w, r, "/accounts/reconcile/form/?id="+fmt.Sprintf("%d", rec.ID), http.StatusSeeOther)
+			return
+		}
+	}
+
+	if ctx["Reconciliations"], e = GetReconciliationsByAccount(db, accountID); !e.Empty() {
+		e.AddTraceback("handleReconciliationOverview()", "Error while getting the reconciliations.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "reconciliation.html", ctx); err != nil {
+		e.Init("handleReconciliationOverview()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+// handleReconciliationForm ticks off the transactions of a statement
+// The action of the form decides if the reconciliation is saved, finished or reopened
+func handleReconciliationForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/accounts/reconcile/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleReconciliationForm()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Reconciliation"
+
+	rec := EmptyReconciliation()
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 0, 64)
+	if err != nil {
+		e.Init("handleReconciliationForm()", err.Error())
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/accounts/reconcile/", http.StatusSeeOther)
+		return
+	}
+	if e = rec.FindByID(db, id); !e.Empty() {
+		e.AddTraceback("handleReconciliationForm()", "Error while finding reconciliation: "+fmt.Sprintf("%d", id))
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/accounts/reconcile/", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		before := auditSnapshot(rec)
+
+		switch r.FormValue("action") {
+		case "reopen":
+			e = writeReconciliation(&rec, AuditReopen, webActor(ctx), before)
+		default:
+			if rec.StatementDate, err = time.ParseInLocation(dtLayout, r.FormValue("statement_date"), time.Local); err != nil {
+				e.Init("handleReconciliationForm()", err.Error())
+				log.Println("[WARN]", e)
+				rec.StatementDate = time.Now().Local()
+			}
+			if rec.ClosingBalance, err = ParseMoney(r.FormValue("closing_balance")); err != nil {
+				e.Init("handleReconciliationForm()", err.Error())
+				log.Println("[WARN]", e)
+			}
+
+			rec.TransactionIDs = nil
+			for _, val := range r.Form["ticked"] {
+				if tid, err := strconv.ParseInt(val, 0, 64); err == nil {
+					rec.TransactionIDs = append(rec.TransactionIDs, tid)
+				}
+			}
+
+			action := AuditUpdate
+			if r.FormValue("action") == "finish" {
+				action = AuditClose
+			}
+			e = writeReconciliation(&rec, action, webActor(ctx), before)
+		}
+
+		if !e.Empty() {
+			e.AddTraceback("handleReconciliationForm()", "Error while writing the reconciliation.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = e.Error()
+		}
+
+		// Show the values of the database, failed changes were rolled back
+		if e = rec.FindByID(db, id); !e.Empty() {
+			e.AddTraceback("handleReconciliationForm()", "Error while reading the reconciliation.")
+			log.Println("[WARN]", e)
+		}
+	}
+
+	ctx["Reconciliation"] = rec
+
+	if err := tmpl.ExecuteTemplate(w, "reconciliation_form.html", ctx); err != nil {
+		e.Init("handleReconciliationForm()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+// writeReconciliation creates, saves, finishes (AuditClose) or reopens the reconciliation depending on the action
+// All writes and the audit entry share one database transaction, so a statement which doesn't match isn't saved half
+func writeReconciliation(rec *Reconciliation, action, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		switch action {
+		case AuditCreate:
+			if err := rec.Create(tx); !err.Empty() {
+				return err
+			}
+		case AuditReopen:
+			if err := rec.Reopen(tx); !err.Empty() {
+				return err
+			}
+		default:
+			if err := rec.Save(tx); !err.Empty() {
+				return err
+			}
+			if action == AuditClose {
+				if err := rec.Finish(tx); !err.Empty() {
+					return err
+				}
+			}
+		}
+		return LogAudit(tx, actor, action, AuditReconciliation, rec.ID, before, rec)
+	})
+}
+
+// handleTransactionUnreconcile removes a transaction from it's reconciliations, so it can be edited again
+func handleTransactionUnreconcile(w http.ResponseWriter, r *http.Request) {
+	session, _ := store.Get(r, "session")
+
+	_, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleTransactionUnreconcile()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/transactions/", http.StatusSeeOther)
+		return
+	}
+
+	id, convErr := strconv.ParseInt(r.FormValue("id"), 0, 64)
+	if convErr != nil {
+		e.Init("handleTransactionUnreconcile()", convErr.Error())
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/transactions/", http.StatusSeeOther)
+		return
+	}
+
+	e = withTransaction(db, func(tx *sql.Tx) err.Error {
+		return UnreconcileTransaction(tx, id)
+	})
+	if !e.Empty() {
+		e.AddTraceback("handleTransactionUnreconcile()", "Error while un-reconciling transaction: "+fmt.Sprintf("%d", id))
+		log.Println("[ERROR]", e)
+	}
+
+	http.Redirect(w, r, "/transactions/form/?id="+fmt.Sprintf("%d", id), http.StatusSeeOther)
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// States of a reconciliation
+const (
+	// ReconciliationOpen transactions can still be ticked off
+	ReconciliationOpen = "open"
+	// ReconciliationDone the statement matches the ticked transactions
+	ReconciliationDone = "done"
+)
+
+// Reconciliation compares an account with a bank statement
+// The transactions covered by the statement are ticked off by tagging their journal
+// lines on the account, ticked transactions can't be edited or deleted until they
+// are un-reconciled
+type Reconciliation struct {
+	ID             int64
+	AccountID      int64
+	StatementDate  time.Time
+	ClosingBalance Money
+	State          string
+	CreateDate     time.Time
+	LastUpdate     time.Time
+	TransactionIDs []int64
+
+	// Computed fields
+	AccountName      string
+	Currency         string
+	ClearedBalance   Money
+	Difference       Money
+	StatementDateStr string
+	Items            []ReconciliationItem
+}
+
+// ReconciliationItem is a transaction which can be ticked off in a reconciliation
+// Amount is what the transaction adds to the balance of the account
+type ReconciliationItem struct {
+	TransactionID      int64
+	Name               string
+	TransactionDateStr string
+	Amount             Money
+	Ticked             bool
+}
+
+// EmptyReconciliation returns an empty reconciliation
+func EmptyReconciliation() Reconciliation {
+	rec := Reconciliation{
+		ID:             0,
+		AccountID:      0,
+		StatementDate:  time.Now().Local(),
+		ClosingBalance: 0,
+		State:          ReconciliationOpen,
+		CreateDate:     time.Now().Local(),
+		LastUpdate:     time.Now().Local(),
+	}
+
+	return rec
+}
+
+// Create 's the reconciliation in the database, the ticked transactions are written by Save
+func (rec *Reconciliation) Create(cr Cursor) err.Error {
+	if rec.ID != 0 {
+		var err err.Error
+		err.Init("Reconciliation.Create()", "This object already has an id")
+		return err
+	} else if rec.AccountID <= 0 {
+		var err err.Error
+		err.Init("Reconciliation.Create()", "The reconciliation does not belong to an account")
+		return err
+	}
+
+	rec.State = ReconciliationOpen
+	rec.CreateDate = time.Now().Local()
+	rec.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO reconciliations (account_id, statement_date, closing_balance, state, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		rec.AccountID,
+		rec.StatementDate,
+		rec.ClosingBalance,
+		rec.State,
+		rec.CreateDate,
+		rec.LastUpdate,
+	).Scan(&rec.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Reconciliation.Create()", e.Error())
+		return err
+	}
+
+	rec.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the statement and ticks off the transactions in TransactionIDs
+// Transactions which are no longer part of TransactionIDs are un-reconciled
+func (rec *Reconciliation) Save(cr *sql.Tx) err.Error {
+	if rec.ID <= 0 {
+		var err err.Error
+		err.Init("Reconciliation.Save()", "This reconciliation has no ID, maybe create it first?")
+		return err
+	} else if rec.State != ReconciliationOpen {
+		var err err.Error
+		err.Init("Reconciliation.Save()", "The reconciliation is finished, reopen it before changing it")
+		return err
+	}
+
+	rec.LastUpdate = time.Now().Local()
+
+	query := "UPDATE reconciliations SET statement_date=$2, closing_balance=$3, last_update=$4 WHERE id=$1"
+
+	if _, e := cr.Exec(query, rec.ID, rec.StatementDate, rec.ClosingBalance, rec.LastUpdate); e != nil {
+		var err err.Error
+		err.Init("Reconciliation.Save()", e.Error())
+		return err
+	}
+
+	if _, e := cr.Exec("UPDATE journal_lines SET reconciliation_id=NULL WHERE reconciliation_id=$1", rec.ID); e != nil {
+		var err err.Error
+		err.Init("Reconciliation.Save()", e.Error())
+		return err
+	}
+
+	query = "UPDATE journal_lines SET reconciliation_id=$1 "
+	query += "WHERE account_id=$2 AND reconciliation_id IS NULL "
+	query += "AND entry_id IN (SELECT id FROM journal_entries WHERE transaction_id=$3 AND entry_date <= $4)"
+
+	for _, id := range rec.TransactionIDs {
+		res, e := cr.Exec(query, rec.ID, rec.AccountID, id, rec.StatementDate)
+		if e != nil {
+			var err err.Error
+			err.Init("Reconciliation.Save()", e.Error())
+			return err
+		}
+
+		if n, e := res.RowsAffected(); e == nil && n == 0 {
+			var err err.Error
+			err.Init("Reconciliation.Save()", "The transaction "+fmt.Sprintf("%d", id)+" is not on the account before the statement date or already reconciled")
+			return err
+		}
+	}
+
+	rec.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Finish 's the reconciliation if the ticked transactions match the closing balance
+func (rec *Reconciliation) Finish(cr Cursor) err.Error {
+	rec.computeFields(cr)
+
+	if rec.State != ReconciliationOpen {
+		var err err.Error
+		err.Init("Reconciliation.Finish()", "The reconciliation is already finished")
+		return err
+	} else if rec.Difference != 0 {
+		var err err.Error
+		err.Init("Reconciliation.Finish()", "The statement differs by "+rec.Difference.String()+" from the ticked transactions")
+		return err
+	}
+
+	return rec.setState(cr, ReconciliationDone)
+}
+
+// Reopen 's a finished reconciliation, so transactions can be ticked off again
+func (rec *Reconciliation) Reopen(cr Cursor) err.Error {
+	return rec.setState(cr, ReconciliationOpen)
+}
+
+func (rec *Reconciliation) setState(cr Cursor, state string) err.Error {
+	rec.LastUpdate = time.Now().Local()
+
+	query := "UPDATE reconciliations SET state=$2, last_update=$3 WHERE id=$1"
+
+	if _, e := cr.Exec(query, rec.ID, state, rec.LastUpdate); e != nil {
+		var err err.Error
+		err.Init("Reconciliation.setState()", e.Error())
+		return err
+	}
+
+	rec.State = state
+
+	return err.Error{}
+}
+
+// Delete 's the reconciliation, all of it's transactions are un-reconciled by the database
+func (rec *Reconciliation) Delete(cr Cursor) err.Error {
+	if rec.ID <= 0 {
+		var err err.Error
+		err.Init("Reconciliation.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM reconciliations WHERE id=$1", rec.ID); e != nil {
+		var err err.Error
+		err.Init("Reconciliation.Delete()", e.Error())
+		return err
+	}
+
+	rec.ID = 0
+
+	return err.Error{}
+}
+
+func (rec *Reconciliation) computeFields(cr Cursor) {
+	// Compute: AccountName, Currency
+	a, e := FindAccountByID(cr, rec.AccountID)
+	if !e.Empty() {
+		e.AddTraceback("Reconciliation.computeFields()", "Error while finding the account by ID.")
+		log.Println("[WARN]", e)
+	}
+	rec.AccountName = a.Name
+	rec.Currency = a.Currency
+
+	// Compute: StatementDateStr
+	rec.StatementDateStr = rec.StatementDate.Format(dtLayout)
+
+	// Compute: ClearedBalance, Difference
+	// Lines which can't be ticked off, like the cash of trades or balances from before the journal,
+	// are cleared until the statement date, the transactions of earlier finished statements as well
+	query := "SELECT COALESCE(SUM(l.debit - l.credit), 0) FROM journal_lines AS l "
+	query += "JOIN journal_entries AS e ON e.id=l.entry_id "
+	query += "WHERE l.account_id=$1 AND ((e.transaction_id IS NULL AND e.entry_date <= $3) OR l.reconciliation_id IN ("
+	query += "SELECT id FROM reconciliations WHERE account_id=$1 "
+	query += "AND (id=$2 OR (state='done' AND statement_date <= $3))))"
+
+	if e := cr.QueryRow(query, rec.AccountID, rec.ID, rec.StatementDate).Scan(&rec.ClearedBalance); e != nil {
+		var err err.Error
+		err.Init("Reconciliation.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+
+	rec.Difference = rec.ClosingBalance - rec.ClearedBalance
+
+	// Compute: Items, TransactionIDs
+	if rec.Items, e = getReconciliationItems(cr, rec); !e.Empty() {
+		e.AddTraceback("Reconciliation.computeFields()", "Error while getting the transactions of the account.")
+		log.Println("[WARN]", e)
+	}
+
+	rec.TransactionIDs = nil
+	for _, item := range rec.Items {
+		if item.Ticked {
+			rec.TransactionIDs = append(rec.TransactionIDs, item.TransactionID)
+		}
+	}
+}
+
+// getReconciliationItems returns the transactions of the account until the statement date
+// which are not reconciled by another reconciliation
+func getReconciliationItems(cr Cursor, rec *Reconciliation) ([]ReconciliationItem, err.Error) {
+	var items []ReconciliationItem
+
+	query := "SELECT t.id, t.name, t.transaction_date, SUM(l.debit - l.credit), bool_or(l.reconciliation_id IS NOT NULL) "
+	query += "FROM journal_lines AS l "
+	query += "JOIN journal_entries AS e ON e.id=l.entry_id "
+	query += "JOIN transactions AS t ON t.id=e.transaction_id "
+	query += "WHERE l.account_id=$1 AND e.entry_date <= $3 "
+	query += "AND (l.reconciliation_id IS NULL OR l.reconciliation_id=$2) "
+	query += "GROUP BY t.id, t.name, t.transaction_date ORDER BY t.transaction_date, t.id"
+
+	rows, e := cr.Query(query, rec.AccountID, rec.ID, rec.StatementDate)
+	if e != nil {
+		var err err.Error
+		err.Init("getReconciliationItems()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item ReconciliationItem
+		var transactionDate time.Time
+
+		if e = rows.Scan(&item.TransactionID, &item.Name, &transactionDate, &item.Amount, &item.Ticked); e != nil {
+			log.Println("[INFO] getReconciliationItems(): Skipping record")
+			log.Printf("[WARN] getReconciliationItems(): %s\n", e)
+			continue
+		}
+
+		item.TransactionDateStr = transactionDate.Format(dtLayout)
+		items = append(items, item)
+	}
+
+	return items, err.Error{}
+}
+
+// FindByID finds a reconciliation with it's id
+func (rec *Reconciliation) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, account_id, statement_date, closing_balance, state, create_date, last_update "
+	query += "FROM reconciliations WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&rec.ID,
+		&rec.AccountID,
+		&rec.StatementDate,
+		&rec.ClosingBalance,
+		&rec.State,
+		&rec.CreateDate,
+		&rec.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Reconciliation.FindByID()", e.Error())
+		return err
+	}
+
+	rec.computeFields(cr)
+
+	return err.Error{}
+}
+
+// GetReconciliationsByAccount returns the reconciliations of the account, the latest statement first
+// accountID 0 returns the reconciliations of all accounts
+func GetReconciliationsByAccount(cr Cursor, accountID int64) ([]Reconciliation, err.Error) {
+	var result []Reconciliation
+	var ids []int64
+
+	query := "SELECT id FROM reconciliations WHERE $1=0 OR account_id=$1 ORDER BY statement_date DESC"
+
+	rows, e := cr.Query(query, accountID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetReconciliationsByAccount()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetReconciliationsByAccount(): Skipping record")
+			log.Printf("[WARN] GetReconciliationsByAccount(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		rec := EmptyReconciliation()
+
+		if err := rec.FindByID(cr, id); !err.Empty() {
+			log.Printf("[INFO] GetReconciliationsByAccount(): Skipping record with ID %d\n", id)
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, rec)
+	}
+
+	return result, err.Error{}
+}
+
+// transactionReconciled returns true if the transaction is ticked off in a reconciliation
+func transactionReconciled(cr Cursor, transactionID int64) (bool, err.Error) {
+	var reconciled bool
+
+	query := "SELECT EXISTS (SELECT 1 FROM journal_lines AS l JOIN journal_entries AS e ON e.id=l.entry_id "
+	query += "WHERE e.transaction_id=$1 AND l.reconciliation_id IS NOT NULL)"
+
+	if e := cr.QueryRow(query, transactionID).Scan(&reconciled); e != nil {
+		var err err.Error
+		err.Init("transactionReconciled()", e.Error())
+		return false, err
+	}
+
+	return reconciled, err.Error{}
+}
+
+// UnreconcileTransaction removes the transaction from all reconciliations, so it can be edited again
+// Finished reconciliations which contained the transaction are reopened, because they don't match anymore
+func UnreconcileTransaction(cr *sql.Tx, transactionID int64) err.Error {
+	query := "UPDATE reconciliations SET state=$2, last_update=$3 WHERE id IN ("
+	query += "SELECT l.reconciliation_id FROM journal_lines AS l JOIN journal_entries AS e ON e.id=l.entry_id "
+	query += "WHERE e.transaction_id=$1)"
+
+	if _, e := cr.Exec(query, transactionID, ReconciliationOpen, time.Now().Local()); e != nil {
+		var err err.Error
+		err.Init("UnreconcileTransaction()", e.Error())
+		return err
+	}
+
+	query = "UPDATE journal_lines SET reconciliation_id=NULL "
+	query += "WHERE entry_id IN (SELECT id FROM journal_entries WHERE transaction_id=$1)"
+
+	if _, e := cr.Exec(query, transactionID); e != nil {
+		var err err.Error
+		err.Init("UnreconcileTransaction()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+	##############################
+	#                            #
+	#   Recurring Transactions   #
+	#                            #
+	##############################
+*/
+
+func handleRecurringOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/recurring/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleRecurringOverview()", "Error while creating the context.")
+		fmt.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Recurring Transactions"
+	if ctx["RecurringTransactions"], e = GetAllRecurringTransactions(db); !e.Empty() {
+		e.AddTraceback("handleRecurringOverview()", "Error while getting all recurring transactions.")
+		fmt.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "recurring.html", ctx); err != nil {
+		e.Init("handleRecurringOverview", err.Error())
+		fmt.Println("[ERROR]", e)
+	}
+}
+
+func handleRecurringForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/recurring/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleRecurringForm()", "Error while creating the context.")
+		fmt.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Recurring Transaction"
+	ctx["Btn"] = "Create Recurring Transaction"
+	ctx["Schedules"] = GetAllSchedules()
+	ctx["TransactionTypes"] = GetAllTransactionTypes()
+
+	vars := r.URL.Query()
+
+	rt := EmptyRecurringTransaction()
+
+	// Get the current recurring transaction
+	if recurringID, ok := vars["id"]; ok {
+		id, e := strconv.Atoi(recurringID[0])
+		if e != nil {
+			err.Init("handleRecurringForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = rt.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleRecurringForm()", "Error finding recurring transaction: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			rt = EmptyRecurringTransaction()
+		} else {
+			ctx["Title"] = "Edit " + rt.Name
+			ctx["Btn"] = "Save Recurring Transaction"
+		}
+	}
+
+	ctx["RecurringTransaction"] = rt
+
+	// Get the accounts
+	if ctx["Accounts"], err = GetAllAccounts(db); !err.Empty() {
+		err.AddTraceback("handleRecurringForm()", "Error while getting the accounts.")
+		log.Println("[WARN]", err)
+	}
+
+	// Get Categories
+	if ctx["Categories"], err = GetAllCategories(db); !err.Empty() {
+		err.AddTraceback("handleRecurringForm()", "Error while getting the categories.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "recurring_form.html", ctx); e != nil {
+			err.Init("handleRecurringForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	var e error
+
+	rt.Name = r.FormValue("name")
+	rt.Description = r.FormValue("description")
+	rt.Active = r.FormValue("active") == "on"
+	rt.Schedule = r.FormValue("schedule")
+	// An empty type is detected from the accounts when a transaction is booked
+	rt.TransactionType = r.FormValue("type")
+
+	if rt.Amount, e = ParseMoney(r.FormValue("amount")); e != nil {
+		err.Init("handleRecurringForm()", e.Error())
+		log.Println("[WARN]", err)
+		rt.Amount = 0
+	}
+	rt.ToAmount = 0
+	if r.FormValue("to_amount") != "" {
+		if rt.ToAmount, e = ParseMoney(r.FormValue("to_amount")); e != nil {
+			err.Init("handleRecurringForm()", e.Error())
+			log.Println("[WARN]", err)
+			rt.ToAmount = 0
+		}
+	}
+	if rt.FromAccount, e = strconv.ParseInt(r.FormValue("fromAccount"), 0, 64); e != nil {
+		rt.FromAccount = 0
+	}
+	if rt.ToAccount, e = strconv.ParseInt(r.FormValue("toAccount"), 0, 64); e != nil {
+		rt.ToAccount = 0
+	}
+	if rt.CategoryID, e = strconv.ParseInt(r.FormValue("category"), 0, 64); e != nil {
+		rt.CategoryID = 0
+	}
+	if rt.Day, e = strconv.ParseInt(r.FormValue("day"), 0, 64); e != nil {
+		rt.Day = 1
+	}
+	if rt.StartDate, e = time.ParseInLocation(dtLayout, r.FormValue("start_date"), time.Local); e != nil {
+		err.Init("handleRecurringForm()", e.Error())
+		log.Println("[INFO] handleRecurringForm(): Using current time as start date.")
+		log.Println("[WARN]", err)
+		rt.StartDate = time.Now().Local()
+	}
+	rt.EndDate = time.Time{}
+	if r.FormValue("end_date") != "" {
+		if rt.EndDate, e = time.ParseInLocation(dtLayout, r.FormValue("end_date"), time.Local); e != nil {
+			err.Init("handleRecurringForm()", e.Error())
+			log.Println("[WARN]", err)
+			rt.EndDate = time.Time{}
+		}
+	}
+
+	if rt.ID == 0 {
+		err = rt.Create(db)
+	} else {
+		err = rt.Save(db)
+	}
+
+	if !err.Empty() {
+		err.AddTraceback("handleRecurringForm()", "Error while writing the recurring transaction to the database.")
+		log.Println("[ERROR]", err)
+
+		ctx["RecurringTransaction"] = rt
+		ctx["Error"] = "The recurring transaction could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "recurring_form.html", ctx); e != nil {
+			err.Init("handleRecurringForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	// Book the dates which are already due, instead of waiting for the next run of the scheduler
+	if err = BookDueRecurringTransactions(db, time.Now().Local()); !err.Empty() {
+		err.AddTraceback("handleRecurringForm()", "Error while booking the due recurring transactions.")
+		log.Println("[WARN]", err)
+	}
+
+	http.Redirect(w, r, "/recurring/", http.StatusSeeOther)
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Schedules of recurring transactions
+const (
+	// ScheduleMonthly is due every month on Day, shorter months use their last day
+	ScheduleMonthly = "monthly"
+	// ScheduleWeekly is due every 7 days from the StartDate on
+	ScheduleWeekly = "weekly"
+	// ScheduleYearly is due every year on the day and month of the StartDate
+	ScheduleYearly = "yearly"
+	// ScheduleLastBusinessDay is due on the last weekday (monday to friday) of every month
+	ScheduleLastBusinessDay = "last_business_day"
+)
+
+// RecurringTransaction is the definition of a standing order
+// The scheduler creates a Transaction with these values on every due date,
+// NextDate is the next due date which was not booked yet
+// An empty TransactionType is detected from the accounts when a transaction is booked
+type RecurringTransaction struct {
+	ID              int64
+	Name            string
+	Description     string
+	Active          bool
+	Amount          Money
+	ToAmount        Money
+	FromAccount     int64
+	ToAccount       int64
+	CategoryID      int64
+	TransactionType string
+	Schedule        string
+	Day             int64
+	StartDate       time.Time
+	EndDate         time.Time
+	NextDate        time.Time
+	LastRun         time.Time
+	CreateDate      time.Time
+	LastUpdate      time.Time
+
+	// Computed fields
+	FromAccountName string
+	ToAccountName   string
+	StartDateStr    string
+	EndDateStr      string
+	NextDateStr     string
+}
+
+// EmptyRecurringTransaction returns an empty recurring transaction
+func EmptyRecurringTransaction() RecurringTransaction {
+	rt := RecurringTransaction{
+		ID:              0,
+		Name:            "",
+		Description:     "",
+		Active:          true,
+		Amount:          0,
+		ToAmount:        0,
+		FromAccount:     0,
+		ToAccount:       0,
+		CategoryID:      0,
+		TransactionType: "",
+		Schedule:        ScheduleMonthly,
+		Day:             1,
+		StartDate:       time.Now().Local(),
+		CreateDate:      time.Now().Local(),
+		LastUpdate:      time.Now().Local(),
+	}
+
+	return rt
+}
+
+// GetAllSchedules returns all schedules a recurring transaction can have
+func GetAllSchedules() []string {
+	return []string{
+		ScheduleMonthly,
+		ScheduleWeekly,
+		ScheduleYearly,
+		ScheduleLastBusinessDay,
+	}
+}
+
+// lastDayOfMonth returns the number of days in the month
+func lastDayOfMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.Local).Day()
+}
+
+// nextOccurrence returns the first due date of the schedule which is after the given time
+// The time of the day of all due dates is the one of the StartDate
+func (rt *RecurringTransaction) nextOccurrence(after time.Time) time.Time {
+	s := rt.StartDate
+	hour, min, sec := s.Clock()
+
+	// dayIn returns the due date in the given month
+	dayIn := func(year int, month time.Month, day int) time.Time {
+		if last := lastDayOfMonth(year, month); day > last {
+			day = last
+		}
+		return time.Date(year, month, day, hour, min, sec, 0, s.Location())
+	}
+
+	// lastBusinessDayIn returns the last weekday of the given month
+	lastBusinessDayIn := func(year int, month time.Month) time.Time {
+		d := dayIn(year, month, 31)
+		for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			d = d.AddDate(0, 0, -1)
+		}
+		return d
+	}
+
+	switch rt.Schedule {
+	case ScheduleWeekly:
+		next := s
+		for !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	case ScheduleYearly:
+		next := dayIn(after.Year(), s.Month(), s.Day())
+		if !next.After(after) {
+			next = dayIn(after.Year()+1, s.Month(), s.Day())
+		}
+		return next
+	case ScheduleLastBusinessDay:
+		next := lastBusinessDayIn(after.Year(), after.Month())
+		if !next.After(after) {
+			m := time.Date(after.Year(), after.Month()+1, 1, 0, 0, 0, 0, s.Location())
+			next = lastBusinessDayIn(m.Year(), m.Month())
+		}
+		return next
+	default:
+		next := dayIn(after.Year(), after.Month(), int(rt.Day))
+		if !next.After(after) {
+			m := time.Date(after.Year(), after.Month()+1, 1, 0, 0, 0, 0, s.Location())
+			next = dayIn(m.Year(), m.Month(), int(rt.Day))
+		}
+		return next
+	}
+}
+
+// computeNextDate sets the NextDate to the first due date after the last booking,
+// or to the first due date on or after the StartDate if nothing was booked yet
+func (rt *RecurringTransaction) computeNextDate() {
+	after := rt.StartDate.Add(-time.Second)
+
+	if rt.LastRun.After(after) {
+		after = rt.LastRun
+	}
+
+	rt.NextDate = rt.nextOccurrence(after)
+}
+
+func (rt *RecurringTransaction) validate(funcName string) err.Error {
+	if rt.Name == "" {
+		var err err.Error
+		err.Init(funcName, "The recurring transaction does not have a name")
+		return err
+	} else if rt.Amount == 0 {
+		var err err.Error
+		err.Init(funcName, "The amount of the recurring transaction "+rt.Name+" is 0")
+		return err
+	} else if !StrContains(GetAllSchedules(), rt.Schedule) {
+		var err err.Error
+		err.Init(funcName, "Unknown schedule: "+rt.Schedule)
+		return err
+	} else if rt.Schedule == ScheduleMonthly && (rt.Day < 1 || rt.Day > 31) {
+		var err err.Error
+		err.Init(funcName, "The day of a monthly schedule must be between 1 and 31")
+		return err
+	} else if !rt.EndDate.IsZero() && rt.EndDate.Before(rt.StartDate) {
+		var err err.Error
+		err.Init(funcName, "The end date is before the start date")
+		return err
+	} else if rt.TransactionType != "" && !transactionTypeFits(rt.TransactionType, rt.FromAccount, rt.ToAccount) {
+		var err err.Error
+		err.Init(funcName, "The accounts of the recurring transaction don't fit the type "+rt.TransactionType)
+		return err
+	}
+
+	return err.Error{}
+}
+
+// nullableFields returns the values which are stored as NULL if they are empty
+func (rt *RecurringTransaction) nullableFields() (fromAccount, toAccount, categID, endDate, lastRun interface{}) {
+	fromAccount = rt.FromAccount
+	toAccount = rt.ToAccount
+	categID = rt.CategoryID
+	endDate = rt.EndDate
+	lastRun = rt.LastRun
+
+	if rt.FromAccount == 0 {
+		fromAccount = nil
+	}
+	if rt.ToAccount == 0 {
+		toAccount = nil
+	}
+	if rt.CategoryID == 0 {
+		categID = nil
+	}
+	if rt.EndDate.IsZero() {
+		endDate = nil
+	}
+	if rt.LastRun.IsZero() {
+		lastRun = nil
+	}
+
+	return
+}
+
+// Create 's the recurring transaction in the database
+func (rt *RecurringTransaction) Create(cr Cursor) err.Error {
+	if rt.ID != 0 {
+		var err err.Error
+		err.Init("RecurringTransaction.Create()", "This object already has an id")
+		return err
+	}
+	if err := rt.validate("RecurringTransaction.Create()"); !err.Empty() {
+		return err
+	}
+
+	rt.computeNextDate()
+	rt.CreateDate = time.Now().Local()
+	rt.LastUpdate = time.Now().Local()
+
+	fromAccount, toAccount, categID, endDate, lastRun := rt.nullableFields()
+
+	query := "INSERT INTO recurring_transactions (name, description, active, amount, to_amount, account_id, to_account, "
+	query += "category_id, transaction_type, schedule, day, start_date, end_date, next_date, last_run, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		rt.Name,
+		rt.Description,
+		rt.Active,
+		rt.Amount,
+		rt.ToAmount,
+		fromAccount,
+		toAccount,
+		categID,
+		rt.TransactionType,
+		rt.Schedule,
+		rt.Day,
+		rt.StartDate,
+		endDate,
+		rt.NextDate,
+		lastRun,
+		rt.CreateDate,
+		rt.LastUpdate,
+	).Scan(&rt.ID)
+
+	if e != nil {
+		var err err.Error
+		err.Init("RecurringTransaction.Create()", e.Error())
+		return err
+	}
+
+	rt.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the recurring transaction to the database
+// The next due date is computed again, so changes of the schedule apply to the next booking
+func (rt *RecurringTransaction) Save(cr Cursor) err.Error {
+	if rt.ID <= 0 {
+		var err err.Error
+		err.Init("RecurringTransaction.Save()", "This recurring transaction has no ID, maybe create it first?")
+		return err
+	}
+	if err := rt.validate("RecurringTransaction.Save()"); !err.Empty() {
+		return err
+	}
+
+	rt.computeNextDate()
+	rt.LastUpdate = time.Now().Local()
+
+	fromAccount, toAccount, categID, endDate, lastRun := rt.nullableFields()
+
+	query := "UPDATE recurring_transactions SET name=$2, description=$3, active=$4, amount=$5, to_amount=$6, "
+	query += "account_id=$7, to_account=$8, category_id=$9, transaction_type=$10, schedule=$11, day=$12, "
+	query += "start_date=$13, end_date=$14, next_date=$15, last_run=$16, last_update=$17 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		rt.ID,
+		rt.Name,
+		rt.Description,
+		rt.Active,
+		rt.Amount,
+		rt.ToAmount,
+		fromAccount,
+		toAccount,
+		categID,
+		rt.TransactionType,
+		rt.Schedule,
+		rt.Day,
+		rt.StartDate,
+		endDate,
+		rt.NextDate,
+		lastRun,
+		rt.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("RecurringTransaction.Save()", e.Error())
+		return err
+	}
+
+	rt.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the recurring transaction, transactions which were already booked are kept
+func (rt *RecurringTransaction) Delete(cr Cursor) err.Error {
+	if rt.ID <= 0 {
+		var err err.Error
+		err.Init("RecurringTransaction.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM recurring_transactions WHERE id=$1", rt.ID); e != nil {
+		var err err.Error
+		err.Init("RecurringTransaction.Delete()", e.Error())
+		return err
+	}
+
+	rt.ID = 0
+
+	return err.Error{}
+}
+
+// book creates the transactions of all due dates up to now through Transaction.Create
+// Definitions whose end date has passed are deactivated
+func (rt *RecurringTransaction) book(cr *sql.Tx, now time.Time) err.Error {
+	for rt.Active && !rt.NextDate.After(now) {
+		if !rt.EndDate.IsZero() && rt.NextDate.After(rt.EndDate) {
+			rt.Active = false
+			break
+		}
+
+		t := EmptyTransaction()
+		t.Name = rt.Name
+		t.Description = rt.Description
+		t.Active = true
+		t.TransactionDate = rt.NextDate
+		t.Amount = rt.Amount
+		t.ToAmount = rt.ToAmount
+		t.FromAccount = rt.FromAccount
+		t.ToAccount = rt.ToAccount
+		t.CategoryID = rt.CategoryID
+		t.TransactionType = rt.TransactionType
+		t.RecurringID = rt.ID
+
+		if err := t.Create(cr); !err.Empty() {
+			err.AddTraceback("RecurringTransaction.book()", "Error while booking "+rt.Name+" due on "+rt.NextDate.Format(dateLayout))
+			return err
+		}
+		if err := LogAudit(cr, schedulerActor, AuditCreate, AuditTransaction, t.ID, nil, t); !err.Empty() {
+			err.AddTraceback("RecurringTransaction.book()", "Error while logging the booking of "+rt.Name)
+			return err
+		}
+
+		rt.LastRun = rt.NextDate
+		rt.NextDate = rt.nextOccurrence(rt.NextDate)
+	}
+
+	if !rt.EndDate.IsZero() && rt.NextDate.After(rt.EndDate) {
+		rt.Active = false
+	}
+
+	query := "UPDATE recurring_transactions SET active=$2, next_date=$3, last_run=$4 WHERE id=$1"
+
+	_, _, _, _, lastRun := rt.nullableFields()
+
+	if _, e := cr.Exec(query, rt.ID, rt.Active, rt.NextDate, lastRun); e != nil {
+		var err err.Error
+		err.Init("RecurringTransaction.book()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+func (rt *RecurringTransaction) computeFields(cr Cursor) {
+	// Compute: FromAccountName, ToAccountName
+	rt.FromAccountName = "External Account"
+	rt.ToAccountName = "External Account"
+
+	if rt.FromAccount != 0 {
+		a, err := FindAccountByID(cr, rt.FromAccount)
+		if !err.Empty() {
+			err.AddTraceback("RecurringTransaction.computeFields()", "Error while finding origin account by ID.")
+			log.Println("[WARN]", err)
+		}
+		rt.FromAccountName = a.Name
+	}
+	if rt.ToAccount != 0 {
+		a, err := FindAccountByID(cr, rt.ToAccount)
+		if !err.Empty() {
+			err.AddTraceback("RecurringTransaction.computeFields()", "Error while finding recipient account by ID.")
+			log.Println("[WARN]", err)
+		}
+		rt.ToAccountName = a.Name
+	}
+
+	// Compute: StartDateStr, EndDateStr, NextDateStr
+	rt.StartDateStr = rt.StartDate.Format(dtLayout)
+	rt.NextDateStr = rt.NextDate.Format(dtLayout)
+	rt.EndDateStr = ""
+	if !rt.EndDate.IsZero() {
+		rt.EndDateStr = rt.EndDate.Format(dtLayout)
+	}
+}
+
+// FindByID finds a recurring transaction with it's id
+func (rt *RecurringTransaction) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, description, active, amount, to_amount, account_id, to_account, category_id, "
+	query += "transaction_type, schedule, day, start_date, end_date, next_date, last_run, create_date, last_update "
+	query += "FROM recurring_transactions WHERE id=$1"
+
+	var fromAccount, toAccount, categID, endDate, lastRun interface{}
+
+	e := cr.QueryRow(query, id).Scan(
+		&rt.ID,
+		&rt.Name,
+		&rt.Description,
+		&rt.Active,
+		&rt.Amount,
+		&rt.ToAmount,
+		&fromAccount,
+		&toAccount,
+		&categID,
+		&rt.TransactionType,
+		&rt.Schedule,
+		&rt.Day,
+		&rt.StartDate,
+		&endDate,
+		&rt.NextDate,
+		&lastRun,
+		&rt.CreateDate,
+		&rt.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("RecurringTransaction.FindByID()", e.Error())
+		return err
+	}
+
+	if fromAccount != nil {
+		rt.FromAccount = fromAccount.(int64)
+	}
+	if toAccount != nil {
+		rt.ToAccount = toAccount.(int64)
+	}
+	if categID != nil {
+		rt.CategoryID = categID.(int64)
+	}
+	if endDate != nil {
+		rt.EndDate = endDate.(time.Time)
+	}
+	if lastRun != nil {
+		rt.LastRun = lastRun.(time.Time)
+	}
+
+	rt.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindRecurringTransactionByID is similar to FindByID but returns the recurring transaction
+func FindRecurringTransactionByID(cr Cursor, id int64) (RecurringTransaction, err.Error) {
+	rt := EmptyRecurringTransaction()
+
+	if e := rt.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindRecurringTransactionByID()", "Error while finding recurring transaction by ID: "+fmt.Sprintf("%d", id))
+		return rt, e
+	}
+
+	return rt, err.Error{}
+}
+
+// recurringTransactionIDs returns the ids of the recurring transactions the query selects
+// The rows are closed before the caller reads the records, so it can be used inside of a database transaction
+func recurringTransactionIDs(cr Cursor, query string, args ...interface{}) ([]int64, err.Error) {
+	var ids []int64
+
+	rows, e := cr.Query(query, args...)
+	if e != nil {
+		var err err.Error
+		err.Init("recurringTransactionIDs()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] recurringTransactionIDs(): Skipping record")
+			log.Printf("[WARN] recurringTransactionIDs(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, err.Error{}
+}
+
+// GetAllRecurringTransactions returns all recurring transactions, the active ones ordered by their next due date first
+func GetAllRecurringTransactions(cr Cursor) ([]RecurringTransaction, err.Error) {
+	var result []RecurringTransaction
+
+	ids, e := recurringTransactionIDs(cr, "SELECT id FROM recurring_transactions ORDER BY active DESC, next_date")
+	if !e.Empty() {
+		e.AddTraceback("GetAllRecurringTransactions()", "Error while getting the ids.")
+		return nil, e
+	}
+
+	for _, id := range ids {
+		rt := EmptyRecurringTransaction()
+
+		if err := rt.FindByID(cr, id); !err.Empty() {
+			log.Printf("[INFO] GetAllRecurringTransactions(): Skipping record with ID %d\n", id)
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, rt)
+	}
+
+	return result, err.Error{}
+}
+
+// BookDueRecurringTransactions books all due dates of the active recurring transactions up to now
+// Every definition is booked in it's own database transaction, so one failing
+// definition does not stop the others
+func BookDueRecurringTransactions(cr *sql.DB, now time.Time) err.Error {
+	query := "SELECT id FROM recurring_transactions WHERE active=true AND next_date <= $1 ORDER BY next_date"
+
+	ids, e := recurringTransactionIDs(cr, query, now)
+	if !e.Empty() {
+		e.AddTraceback("BookDueRecurringTransactions()", "Error while getting the due recurring transactions.")
+		return e
+	}
+
+	for _, id := range ids {
+		err := withTransaction(cr, func(tx *sql.Tx) err.Error {
+			rt := EmptyRecurringTransaction()
+			if err := rt.FindByID(tx, id); !err.Empty() {
+				return err
+			}
+			return rt.book(tx, now)
+		})
+		if !err.Empty() {
+			err.AddTraceback("BookDueRecurringTransactions()", "Error while booking recurring transaction: "+fmt.Sprintf("%d", id))
+			log.Println("[ERROR]", err)
+		}
+	}
+
+	return err.Error{}
+}
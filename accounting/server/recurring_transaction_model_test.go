@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns the local time of the day, it's used by the tests of the schedules and periods
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.Local)
+}
+
+func TestNextOccurrence(t *testing.T) {
+	tests := []struct {
+		schedule string
+		day      int64
+		start    time.Time
+		after    time.Time
+		want     time.Time
+	}{
+		// Monthly on the day, shorter months use their last day
+		{ScheduleMonthly, 31, at(2026, 1, 10, 9, 0), at(2026, 1, 15, 0, 0), at(2026, 1, 31, 9, 0)},
+		{ScheduleMonthly, 31, at(2026, 1, 10, 9, 0), at(2026, 1, 31, 9, 0), at(2026, 2, 28, 9, 0)},
+		{ScheduleMonthly, 31, at(2026, 1, 10, 9, 0), at(2028, 2, 1, 0, 0), at(2028, 2, 29, 9, 0)},
+		{ScheduleMonthly, 31, at(2026, 1, 10, 9, 0), at(2026, 12, 31, 9, 0), at(2027, 1, 31, 9, 0)},
+		{ScheduleMonthly, 1, at(2026, 1, 10, 9, 0), at(2026, 3, 1, 8, 59), at(2026, 3, 1, 9, 0)},
+		{ScheduleMonthly, 1, at(2026, 1, 10, 9, 0), at(2026, 3, 1, 9, 0), at(2026, 4, 1, 9, 0)},
+		// Weekly from the StartDate on
+		{ScheduleWeekly, 0, at(2026, 1, 5, 9, 0), at(2026, 1, 4, 0, 0), at(2026, 1, 5, 9, 0)},
+		{ScheduleWeekly, 0, at(2026, 1, 5, 9, 0), at(2026, 1, 5, 9, 0), at(2026, 1, 12, 9, 0)},
+		{ScheduleWeekly, 0, at(2026, 1, 5, 9, 0), at(2026, 2, 1, 0, 0), at(2026, 2, 2, 9, 0)},
+		// Yearly on the day and month of the StartDate, the 29th of February is the 28th in other years
+		{ScheduleYearly, 0, at(2026, 3, 15, 9, 0), at(2026, 3, 1, 0, 0), at(2026, 3, 15, 9, 0)},
+		{ScheduleYearly, 0, at(2026, 3, 15, 9, 0), at(2026, 3, 15, 9, 0), at(2027, 3, 15, 9, 0)},
+		{ScheduleYearly, 0, at(2024, 2, 29, 9, 0), at(2025, 1, 1, 0, 0), at(2025, 2, 28, 9, 0)},
+		{ScheduleYearly, 0, at(2024, 2, 29, 9, 0), at(2028, 1, 1, 0, 0), at(2028, 2, 29, 9, 0)},
+		// The last weekday, the 31st of January and the 28th of February 2026 are saturdays
+		{ScheduleLastBusinessDay, 0, at(2026, 1, 1, 9, 0), at(2026, 1, 10, 0, 0), at(2026, 1, 30, 9, 0)},
+		{ScheduleLastBusinessDay, 0, at(2026, 1, 1, 9, 0), at(2026, 1, 30, 9, 0), at(2026, 2, 27, 9, 0)},
+		{ScheduleLastBusinessDay, 0, at(2026, 1, 1, 9, 0), at(2026, 5, 1, 0, 0), at(2026, 5, 29, 9, 0)},
+		{ScheduleLastBusinessDay, 0, at(2026, 1, 1, 9, 0), at(2026, 12, 31, 9, 0), at(2027, 1, 29, 9, 0)},
+	}
+
+	for _, test := range tests {
+		rt := EmptyRecurringTransaction()
+		rt.Schedule = test.schedule
+		rt.Day = test.day
+		rt.StartDate = test.start
+
+		if got := rt.nextOccurrence(test.after); !got.Equal(test.want) {
+			t.Errorf("%s (day %d) after %s = %s, expected %s", test.schedule, test.day,
+				test.after.Format(dtLayout), got.Format(dtLayout), test.want.Format(dtLayout))
+		}
+	}
+}
+
+func TestComputeNextDate(t *testing.T) {
+	tests := []struct {
+		start   time.Time
+		lastRun time.Time
+		want    time.Time
+	}{
+		// The StartDate itself is due if nothing was booked yet
+		{at(2026, 1, 10, 9, 0), time.Time{}, at(2026, 1, 10, 9, 0)},
+		{at(2026, 1, 10, 9, 0), at(2026, 2, 10, 9, 0), at(2026, 3, 10, 9, 0)},
+		// A booking before the StartDate was moved doesn't count
+		{at(2026, 6, 10, 9, 0), at(2026, 2, 10, 9, 0), at(2026, 6, 10, 9, 0)},
+	}
+
+	for _, test := range tests {
+		rt := EmptyRecurringTransaction()
+		rt.Schedule = ScheduleMonthly
+		rt.Day = 10
+		rt.StartDate = test.start
+		rt.LastRun = test.lastRun
+
+		rt.computeNextDate()
+		if !rt.NextDate.Equal(test.want) {
+			t.Errorf("computeNextDate() with start %s and last run %s = %s, expected %s", test.start.Format(dtLayout),
+				test.lastRun.Format(dtLayout), rt.NextDate.Format(dtLayout), test.want.Format(dtLayout))
+		}
+	}
+}
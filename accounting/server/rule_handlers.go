@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/nitohu/err"
+)
+
+/*
+	##############################
+	#                            #
+	#            Rules           #
+	#                            #
+	##############################
+*/
+
+// handleRuleOverview lists the rules in the order they are applied
+// A POST runs the rules over the uncategorised transactions, with dry_run the changes are only listed
+func handleRuleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rules/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, e := createContextFromSession(db, session)
+	if !e.Empty() {
+		e.AddTraceback("handleRuleOverview()", "Error while creating the context.")
+		log.Println("[ERROR]", e)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Rules"
+
+	if r.Method == http.MethodPost {
+		dryRun := r.FormValue("dry_run") == "on"
+		var matches []RuleMatch
+
+		e = withTransaction(db, func(tx *sql.Tx) err.Error {
+			var runErr err.Error
+			matches, runErr = ApplyRules(tx, webActor(ctx), dryRun)
+			return runErr
+		})
+		if !e.Empty() {
+			e.AddTraceback("handleRuleOverview()", "Error while applying the rules.")
+			log.Println("[ERROR]", e)
+			ctx["Error"] = "The rules could not be applied: " + e.Error()
+		} else {
+			ctx["Run"] = true
+			ctx["DryRun"] = dryRun
+			ctx["Matches"] = matches
+		}
+	}
+
+	if ctx["Rules"], e = GetAllRules(db, false); !e.Empty() {
+		e.AddTraceback("handleRuleOverview()", "Error while getting all rules.")
+		log.Println("[WARN]", e)
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "rules.html", ctx); err != nil {
+		e.Init("handleRuleOverview()", err.Error())
+		log.Println("[ERROR]", e)
+	}
+}
+
+func handleRuleForm(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/rules/form/" {
+		handleNotFound(w, r)
+		return
+	}
+	session, _ := store.Get(r, "session")
+
+	ctx, err := createContextFromSession(db, session)
+	if !err.Empty() {
+		err.AddTraceback("handleRuleForm()", "Error while creating the context.")
+		log.Println("[ERROR]", err)
+		http.Redirect(w, r, "/logout/", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	ctx["Title"] = "Create Rule"
+	ctx["Btn"] = "Create Rule"
+
+	rule := EmptyRule()
+
+	// Get the current rule
+	if ruleID, ok := r.URL.Query()["id"]; ok {
+		id, e := strconv.Atoi(ruleID[0])
+		if e != nil {
+			err.Init("handleRuleForm()", e.Error())
+			log.Println("[ERROR]", err)
+			return
+		}
+
+		if err = rule.FindByID(db, int64(id)); !err.Empty() {
+			err.AddTraceback("handleRuleForm()", "Error finding rule: "+fmt.Sprintf("%d", id))
+			log.Println("[WARN]", err)
+			rule = EmptyRule()
+		} else {
+			ctx["Title"] = "Edit Rule"
+			ctx["Btn"] = "Save Rule"
+		}
+	}
+
+	ctx["Rule"] = rule
+
+	if ctx["Categories"], err = GetAllCategories(db); !err.Empty() {
+		err.AddTraceback("handleRuleForm()", "Error while getting the categories.")
+		log.Println("[WARN]", err)
+	}
+	if ctx["Accounts"], err = GetAllAccounts(db); !err.Empty() {
+		err.AddTraceback("handleRuleForm()", "Error while getting the accounts.")
+		log.Println("[WARN]", err)
+	}
+
+	if r.Method != http.MethodPost {
+		if e := tmpl.ExecuteTemplate(w, "rule_form.html", ctx); e != nil {
+			err.Init("handleRuleForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	before := auditSnapshot(rule)
+
+	rule.Name = r.FormValue("name")
+	rule.NameContains = r.FormValue("name_contains")
+	rule.Tags = ParseTags(r.FormValue("tags"))
+	rule.Active = r.FormValue("active") == "on"
+
+	var e error
+	if rule.Sequence, e = strconv.ParseInt(r.FormValue("sequence"), 0, 64); e != nil {
+		rule.Sequence = 10
+	}
+	if rule.AccountID, e = strconv.ParseInt(r.FormValue("account"), 0, 64); e != nil {
+		rule.AccountID = 0
+	}
+	if rule.CategoryID, e = strconv.ParseInt(r.FormValue("category"), 0, 64); e != nil {
+		rule.CategoryID = 0
+	}
+	// Empty amounts are not checked
+	if rule.MinAmount, e = ParseMoney(r.FormValue("min_amount")); e != nil {
+		rule.MinAmount = 0
+	}
+	if rule.MaxAmount, e = ParseMoney(r.FormValue("max_amount")); e != nil {
+		rule.MaxAmount = 0
+	}
+
+	create := rule.ID == 0
+	err = writeRule(&rule, webActor(ctx), before)
+
+	if !err.Empty() {
+		err.AddTraceback("handleRuleForm()", "Error while writing the rule to the database.")
+		log.Println("[ERROR]", err)
+
+		if create {
+			rule.ID = 0
+		}
+		ctx["Rule"] = rule
+		ctx["Error"] = "The rule could not be saved: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "rule_form.html", ctx); e != nil {
+			err.Init("handleRuleForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/rules/", http.StatusSeeOther)
+}
+
+// writeRule creates or saves the rule, the change is logged in the same database transaction
+func writeRule(rule *Rule, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if rule.ID == 0 {
+			if err := rule.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, actor, AuditCreate, AuditRule, rule.ID, nil, rule)
+		}
+		if err := rule.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditRule, rule.ID, before, rule)
+	})
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Rule categorises and tags new transactions which match all of it's conditions
+// The conditions which are empty or 0 are not checked:
+// NameContains is part of the reference of the transaction, ignoring the case,
+// MinAmount and MaxAmount limit the Amount, AccountID is the origin or the recipient account
+// The rules are applied in the order of their Sequence, the first matching rule with a
+// category sets it if the transaction has neither a category nor splits,
+// the Tags of all matching rules are added to the transaction
+type Rule struct {
+	ID           int64
+	Name         string
+	Sequence     int64
+	NameContains string
+	MinAmount    Money
+	MaxAmount    Money
+	AccountID    int64
+	CategoryID   int64
+	Tags         []string
+	Active       bool
+	CreateDate   time.Time
+	LastUpdate   time.Time
+
+	// Computed fields
+	AccountName  string
+	CategoryName string
+	CategoryHex  string
+}
+
+// RuleMatch is the change of a transaction by the rules in ApplyRules
+type RuleMatch struct {
+	TransactionID      int64
+	TransactionName    string
+	TransactionDateStr string
+	Amount             Money
+	Currency           string
+	// Names of the rules which changed the transaction
+	Rules        []string
+	CategoryID   int64
+	CategoryName string
+	AddedTags    []string
+}
+
+// EmptyRule returns an empty rule
+func EmptyRule() Rule {
+	r := Rule{
+		ID:           0,
+		Name:         "",
+		Sequence:     10,
+		NameContains: "",
+		MinAmount:    0,
+		MaxAmount:    0,
+		AccountID:    0,
+		CategoryID:   0,
+		Active:       true,
+		CreateDate:   time.Now().Local(),
+		LastUpdate:   time.Now().Local(),
+	}
+
+	return r
+}
+
+func (r *Rule) validate(funcName string) err.Error {
+	var err err.Error
+
+	r.Name = strings.TrimSpace(r.Name)
+	r.NameContains = strings.TrimSpace(r.NameContains)
+	r.Tags = normalizeTags(r.Tags)
+
+	if r.Name == "" {
+		err.Init(funcName, "The rule does not have a name")
+	} else if r.NameContains == "" && r.MinAmount == 0 && r.MaxAmount == 0 && r.AccountID == 0 {
+		err.Init(funcName, "The rule needs at least one condition, otherwise it matches every transaction")
+	} else if r.MinAmount < 0 || r.MaxAmount < 0 {
+		err.Init(funcName, "The amounts of a rule can't be negative")
+	} else if r.MaxAmount != 0 && r.MinAmount > r.MaxAmount {
+		err.Init(funcName, "The minimum amount is bigger than the maximum amount")
+	} else if r.CategoryID == 0 && len(r.Tags) == 0 {
+		err.Init(funcName, "The rule neither sets a category nor tags")
+	}
+
+	return err
+}
+
+// writeTags replaces the tags the rule adds with Tags
+func (r *Rule) writeTags(cr *sql.Tx) err.Error {
+	if _, e := cr.Exec("DELETE FROM rule_tags WHERE rule_id=$1", r.ID); e != nil {
+		var err err.Error
+		err.Init("Rule.writeTags()", e.Error())
+		return err
+	}
+
+	for _, tag := range r.Tags {
+		if _, e := cr.Exec("INSERT INTO rule_tags (rule_id, tag) VALUES ($1, $2)", r.ID, tag); e != nil {
+			var err err.Error
+			err.Init("Rule.writeTags()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+// Create 's the rule with it's tags, run it with withTransaction
+func (r *Rule) Create(cr *sql.Tx) err.Error {
+	if r.ID != 0 {
+		var err err.Error
+		err.Init("Rule.Create()", "This object already has an id")
+		return err
+	}
+	if err := r.validate("Rule.Create()"); !err.Empty() {
+		return err
+	}
+
+	r.CreateDate = time.Now().Local()
+	r.LastUpdate = time.Now().Local()
+
+	var accountID, categID interface{} = r.AccountID, r.CategoryID
+	if r.AccountID == 0 {
+		accountID = nil
+	}
+	if r.CategoryID == 0 {
+		categID = nil
+	}
+
+	query := "INSERT INTO rules (name, sequence, name_contains, min_amount, max_amount, account_id, category_id, "
+	query += "active, create_date, last_update) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		r.Name,
+		r.Sequence,
+		r.NameContains,
+		r.MinAmount,
+		r.MaxAmount,
+		accountID,
+		categID,
+		r.Active,
+		r.CreateDate,
+		r.LastUpdate,
+	).Scan(&r.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Rule.Create()", e.Error())
+		return err
+	}
+
+	if err := r.writeTags(cr); !err.Empty() {
+		err.AddTraceback("Rule.Create()", "Error while writing the tags.")
+		return err
+	}
+
+	r.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the rule and replaces it's tags, run it with withTransaction
+func (r *Rule) Save(cr *sql.Tx) err.Error {
+	if r.ID <= 0 {
+		var err err.Error
+		err.Init("Rule.Save()", "This rule has no ID, maybe create it first?")
+		return err
+	}
+	if err := r.validate("Rule.Save()"); !err.Empty() {
+		return err
+	}
+
+	r.LastUpdate = time.Now().Local()
+
+	var accountID, categID interface{} = r.AccountID, r.CategoryID
+	if r.AccountID == 0 {
+		accountID = nil
+	}
+	if r.CategoryID == 0 {
+		categID = nil
+	}
+
+	query := "UPDATE rules SET name=$2, sequence=$3, name_contains=$4, min_amount=$5, max_amount=$6, "
+	query += "account_id=$7, category_id=$8, active=$9, last_update=$10 WHERE id=$1"
+
+	_, e := cr.Exec(query,
+		r.ID,
+		r.Name,
+		r.Sequence,
+		r.NameContains,
+		r.MinAmount,
+		r.MaxAmount,
+		accountID,
+		categID,
+		r.Active,
+		r.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Rule.Save()", e.Error())
+		return err
+	}
+
+	if err := r.writeTags(cr); !err.Empty() {
+		err.AddTraceback("Rule.Save()", "Error while writing the tags.")
+		return err
+	}
+
+	r.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the rule, the transactions it categorised keep their category and tags
+func (r *Rule) Delete(cr Cursor) err.Error {
+	if r.ID <= 0 {
+		var err err.Error
+		err.Init("Rule.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM rules WHERE id=$1", r.ID); e != nil {
+		var err err.Error
+		err.Init("Rule.Delete()", e.Error())
+		return err
+	}
+
+	r.ID = 0
+
+	return err.Error{}
+}
+
+// Matches returns true if the transaction fulfills all conditions of the rule
+// Opening balances are neither income nor expense, so no rule matches them
+func (r *Rule) Matches(t *Transaction) bool {
+	if t.TransactionType == TransactionOpeningBalance {
+		return false
+	}
+	if r.NameContains != "" && !strings.Contains(strings.ToLower(t.Name), strings.ToLower(r.NameContains)) {
+		return false
+	}
+	if r.MinAmount != 0 && t.Amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount != 0 && t.Amount > r.MaxAmount {
+		return false
+	}
+	if r.AccountID != 0 && t.FromAccount != r.AccountID && t.ToAccount != r.AccountID {
+		return false
+	}
+
+	return true
+}
+
+func (r *Rule) computeFields(cr Cursor) {
+	r.AccountName = ""
+	r.CategoryName = ""
+	r.CategoryHex = ""
+
+	// Compute: AccountName
+	if r.AccountID > 0 {
+		if e := cr.QueryRow("SELECT name FROM accounts WHERE id=$1", r.AccountID).Scan(&r.AccountName); e != nil {
+			var err err.Error
+			err.Init("Rule.computeFields()", e.Error())
+			log.Println("[WARN]", err)
+		}
+	}
+
+	// Compute: CategoryName, CategoryHex
+	if r.CategoryID > 0 {
+		c, err := FindCategoryByID(cr, r.CategoryID)
+		if !err.Empty() {
+			err.AddTraceback("Rule.computeFields()", "Error while finding category by ID: "+fmt.Sprintf("%d", r.CategoryID))
+			log.Println("[WARN]", err)
+		}
+		r.CategoryName = c.Path
+		r.CategoryHex = c.Hex
+	}
+}
+
+// FindByID finds a rule with it's id
+func (r *Rule) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, sequence, name_contains, min_amount, max_amount, account_id, category_id, "
+	query += "active, create_date, last_update FROM rules WHERE id=$1"
+
+	var accountID, categID sql.NullInt64
+
+	e := cr.QueryRow(query, id).Scan(
+		&r.ID,
+		&r.Name,
+		&r.Sequence,
+		&r.NameContains,
+		&r.MinAmount,
+		&r.MaxAmount,
+		&accountID,
+		&categID,
+		&r.Active,
+		&r.CreateDate,
+		&r.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Rule.FindByID()", e.Error())
+		return err
+	}
+
+	r.AccountID = accountID.Int64
+	r.CategoryID = categID.Int64
+
+	rows, e := cr.Query("SELECT tag FROM rule_tags WHERE rule_id=$1 ORDER BY tag", r.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Rule.FindByID()", e.Error())
+		return err
+	}
+
+	r.Tags = nil
+	for rows.Next() {
+		var tag string
+		if e = rows.Scan(&tag); e != nil {
+			log.Println("[INFO] Rule.FindByID(): Skipping tag")
+			log.Printf("[WARN] Rule.FindByID(): %s\n", e)
+			continue
+		}
+		r.Tags = append(r.Tags, tag)
+	}
+	rows.Close()
+
+	r.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindRuleByID is similar to FindByID but returns the rule
+func FindRuleByID(cr Cursor, id int64) (Rule, err.Error) {
+	r := EmptyRule()
+
+	if e := r.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindRuleByID()", "Error while finding rule by ID: "+fmt.Sprintf("%d", id))
+		return r, e
+	}
+
+	return r, err.Error{}
+}
+
+// GetAllRules returns all rules in the order they are applied
+// If activeOnly is true, inactive rules are left out
+func GetAllRules(cr Cursor, activeOnly bool) ([]Rule, err.Error) {
+	var ids []int64
+	var result []Rule
+
+	query := "SELECT id FROM rules "
+	if activeOnly {
+		query += "WHERE active=true "
+	}
+	query += "ORDER BY sequence, id"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllRules()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllRules(): Skipping record")
+			log.Printf("[WARN] GetAllRules(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		r, err := FindRuleByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllRules(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result, err.Error{}
+}
+
+// applyRules categorises and tags the transaction with the matching rules
+// Returns what was changed, Rules is empty if no rule changed the transaction
+func (t *Transaction) applyRules(rules []Rule) RuleMatch {
+	m := RuleMatch{
+		TransactionID:      t.ID,
+		TransactionName:    t.Name,
+		TransactionDateStr: t.TransactionDate.Format(dtLayout),
+		Amount:             t.Amount,
+		Currency:           t.FromCurrency,
+	}
+
+	categorise := t.CategoryID == 0 && len(t.Splits) == 0
+
+	for i := range rules {
+		r := &rules[i]
+		if !r.Matches(t) {
+			continue
+		}
+
+		changed := false
+		if categorise && r.CategoryID > 0 {
+			t.CategoryID = r.CategoryID
+			m.CategoryID = r.CategoryID
+			m.CategoryName = r.CategoryName
+			categorise = false
+			changed = true
+		}
+		for _, tag := range r.Tags {
+			if !StrContains(t.Tags, tag) {
+				t.Tags = append(t.Tags, tag)
+				m.AddedTags = append(m.AddedTags, tag)
+				changed = true
+			}
+		}
+
+		if changed {
+			m.Rules = append(m.Rules, r.Name)
+		}
+	}
+
+	return m
+}
+
+// ApplyRules runs the active rules over the transactions without a category and without splits,
+// reconciled transactions and the ones in closed periods are left out because they can't be changed
+// With dryRun the changes are only returned, otherwise the transactions are saved and the
+// changes are written to the audit log with actor, run it with withTransaction
+func ApplyRules(cr *sql.Tx, actor string, dryRun bool) ([]RuleMatch, err.Error) {
+	var ids []int64
+	var result []RuleMatch
+
+	rules, err := GetAllRules(cr, true)
+	if !err.Empty() {
+		err.AddTraceback("ApplyRules()", "Error while getting the rules.")
+		return nil, err
+	} else if len(rules) == 0 {
+		return nil, err
+	}
+
+	query := "SELECT id FROM transactions AS t WHERE category_id IS NULL "
+	query += "AND NOT EXISTS (SELECT 1 FROM transaction_splits AS s WHERE s.transaction_id=t.id) "
+	query += "AND NOT EXISTS (SELECT 1 FROM periods AS p WHERE t.transaction_date::date BETWEEN p.start_date AND p.end_date) "
+	query += "ORDER BY transaction_date DESC, id DESC"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		err.Init("ApplyRules()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] ApplyRules(): Skipping record")
+			log.Printf("[WARN] ApplyRules(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		t, err := FindTransactionByID(cr, id)
+		if !err.Empty() {
+			err.AddTraceback("ApplyRules()", "Error while finding transaction: "+fmt.Sprintf("%d", id))
+			return nil, err
+		}
+
+		if t.Reconciled {
+			continue
+		}
+
+		before := auditSnapshot(t)
+		m := t.applyRules(rules)
+		if len(m.Rules) == 0 {
+			continue
+		}
+		result = append(result, m)
+
+		if dryRun {
+			continue
+		}
+
+		t.LastUpdate = time.Now().Local()
+		if err = t.Save(cr); !err.Empty() {
+			err.AddTraceback("ApplyRules()", "Error while saving transaction: "+fmt.Sprintf("%d", id))
+			return nil, err
+		}
+		if err = LogAudit(cr, actor, AuditUpdate, AuditTransaction, t.ID, before, t); !err.Empty() {
+			err.AddTraceback("ApplyRules()", "Error while logging the change of transaction: "+fmt.Sprintf("%d", id))
+			return nil, err
+		}
+	}
+
+	return result, err
+}
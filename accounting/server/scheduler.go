@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// schedulerInterval is the time between two runs of the scheduler
+var schedulerInterval = time.Hour
+
+// runScheduler runs the background jobs once at startup and then in every interval
+// It's started as goroutine from main() and runs until the application exits
+func runScheduler(cr *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runScheduledJobs(cr, time.Now().Local())
+		<-ticker.C
+	}
+}
+
+// runScheduledJobs runs all background jobs for the given time
+func runScheduledJobs(cr *sql.DB, now time.Time) {
+	bookDue := func(tx *sql.Tx) err.Error {
+		return BookDueJournalLines(tx, now)
+	}
+	if err := withTransaction(cr, bookDue); !err.Empty() {
+		err.AddTraceback("runScheduledJobs()", "Error while booking the due journal lines.")
+		log.Println("[ERROR]", err)
+	}
+
+	if err := BookDueRecurringTransactions(cr, now); !err.Empty() {
+		err.AddTraceback("runScheduledJobs()", "Error while booking the recurring transactions.")
+		log.Println("[ERROR]", err)
+	}
+}
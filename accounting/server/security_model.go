@@ -0,0 +1,359 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// priceDateLayouts are the date formats which are accepted in price files
+var priceDateLayouts = []string{"2006-01-02", dateLayout}
+
+// Security is a stock, fund or bond which is traded in investment accounts
+// Symbol identifies the security in price files, e.g. the ticker or the ISIN
+// The prices of the security are in it's Currency
+type Security struct {
+	ID         int64
+	Name       string
+	Symbol     string
+	Currency   string
+	CreateDate time.Time
+	LastUpdate time.Time
+
+	// Computed fields
+	Price        Money
+	PriceDate    time.Time
+	PriceDateStr string
+}
+
+// EmptySecurity returns an empty security
+func EmptySecurity() Security {
+	s := Security{
+		ID:         0,
+		Name:       "",
+		Symbol:     "",
+		Currency:   "",
+		CreateDate: time.Now().Local(),
+		LastUpdate: time.Now().Local(),
+	}
+
+	return s
+}
+
+// PriceImport is the result of ImportPrices
+// Skipped lists the lines which could not be imported, with the reason
+type PriceImport struct {
+	Imported int64
+	Skipped  []string
+}
+
+func (s *Security) validate(funcName string) err.Error {
+	var err err.Error
+
+	if s.Name == "" || s.Symbol == "" {
+		err.Init(funcName, "The security needs a name and a symbol")
+	} else if !ValidCurrency(s.Currency) {
+		err.Init(funcName, "The currency must be a three letter code like EUR: "+s.Currency)
+	}
+
+	return err
+}
+
+// Create 's the security, securities without a currency are held in the base currency
+func (s *Security) Create(cr Cursor) err.Error {
+	if s.ID != 0 {
+		var err err.Error
+		err.Init("Security.Create()", "This object already has an id")
+		return err
+	}
+
+	s.Symbol = strings.ToUpper(strings.TrimSpace(s.Symbol))
+	if s.Currency == "" {
+		var err err.Error
+		if s.Currency, err = GetBaseCurrency(cr); !err.Empty() {
+			err.AddTraceback("Security.Create()", "Error while getting the base currency.")
+			return err
+		}
+	}
+	if err := s.validate("Security.Create()"); !err.Empty() {
+		return err
+	}
+
+	s.CreateDate = time.Now().Local()
+	s.LastUpdate = time.Now().Local()
+
+	query := "INSERT INTO securities (name, symbol, currency, create_date, last_update) "
+	query += "VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+
+	if e := cr.QueryRow(query, s.Name, s.Symbol, s.Currency, s.CreateDate, s.LastUpdate).Scan(&s.ID); e != nil {
+		var err err.Error
+		err.Init("Security.Create()", e.Error())
+		return err
+	}
+
+	s.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Save 's the security, the currency can't be changed once it was traded
+func (s *Security) Save(cr Cursor) err.Error {
+	if s.ID == 0 {
+		var err err.Error
+		err.Init("Security.Save()", "This security has no ID, maybe create it first?")
+		return err
+	}
+
+	s.Symbol = strings.ToUpper(strings.TrimSpace(s.Symbol))
+	if err := s.validate("Security.Save()"); !err.Empty() {
+		return err
+	}
+
+	var count int64
+
+	query := "SELECT COUNT(*) FROM trades AS t JOIN accounts AS a ON a.id=t.account_id WHERE t.security_id=$1 AND a.currency<>$2"
+
+	if e := cr.QueryRow(query, s.ID, s.Currency).Scan(&count); e != nil {
+		var err err.Error
+		err.Init("Security.Save()", e.Error())
+		return err
+	} else if count > 0 {
+		var err err.Error
+		err.Init("Security.Save()", "The currency of "+s.Name+" can't be changed, it was traded in another currency")
+		return err
+	}
+
+	s.LastUpdate = time.Now().Local()
+
+	query = "UPDATE securities SET name=$2, symbol=$3, currency=$4, last_update=$5 WHERE id=$1"
+
+	if _, e := cr.Exec(query, s.ID, s.Name, s.Symbol, s.Currency, s.LastUpdate); e != nil {
+		var err err.Error
+		err.Init("Security.Save()", e.Error())
+		return err
+	}
+
+	s.computeFields(cr)
+
+	return err.Error{}
+}
+
+// Delete 's the security with it's prices, securities which were traded can't be deleted
+func (s *Security) Delete(cr Cursor) err.Error {
+	if s.ID <= 0 {
+		var err err.Error
+		err.Init("Security.Delete()", "ID must be bigger than 0")
+		return err
+	}
+
+	var count int64
+
+	if e := cr.QueryRow("SELECT COUNT(*) FROM trades WHERE security_id=$1", s.ID).Scan(&count); e != nil {
+		var err err.Error
+		err.Init("Security.Delete()", e.Error())
+		return err
+	} else if count > 0 {
+		var err err.Error
+		err.Init("Security.Delete()", fmt.Sprintf("%s has %d trades, delete them first", s.Name, count))
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM securities WHERE id=$1", s.ID); e != nil {
+		var err err.Error
+		err.Init("Security.Delete()", e.Error())
+		return err
+	}
+
+	s.ID = 0
+
+	return err.Error{}
+}
+
+func (s *Security) computeFields(cr Cursor) {
+	s.Price = 0
+	s.PriceDate = time.Time{}
+	s.PriceDateStr = ""
+
+	query := "SELECT price, price_date FROM security_latest_prices WHERE security_id=$1"
+
+	e := cr.QueryRow(query, s.ID).Scan(&s.Price, &s.PriceDate)
+	if e == sql.ErrNoRows {
+		return
+	} else if e != nil {
+		var err err.Error
+		err.Init("Security.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+		return
+	}
+
+	s.PriceDateStr = s.PriceDate.Format(dateLayout)
+}
+
+// FindByID finds a security with it's id
+func (s *Security) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, name, symbol, currency, create_date, last_update FROM securities WHERE id=$1"
+
+	e := cr.QueryRow(query, id).Scan(
+		&s.ID,
+		&s.Name,
+		&s.Symbol,
+		&s.Currency,
+		&s.CreateDate,
+		&s.LastUpdate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Security.FindByID()", e.Error())
+		return err
+	}
+
+	s.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindSecurityByID is similar to FindByID but returns the security
+func FindSecurityByID(cr Cursor, id int64) (Security, err.Error) {
+	s := EmptySecurity()
+
+	if e := s.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindSecurityByID()", "Error while finding security by ID: "+fmt.Sprintf("%d", id))
+		return s, e
+	}
+
+	return s, err.Error{}
+}
+
+// GetAllSecurities returns all securities ordered by their name
+func GetAllSecurities(cr Cursor) ([]Security, err.Error) {
+	var ids []int64
+	var result []Security
+
+	rows, e := cr.Query("SELECT id FROM securities ORDER BY name, id")
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllSecurities()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetAllSecurities(): Skipping record")
+			log.Printf("[WARN] GetAllSecurities(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		s, err := FindSecurityByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetAllSecurities(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, s)
+	}
+
+	return result, err.Error{}
+}
+
+// parsePriceDate parses the date of a price file in one of the priceDateLayouts
+func parsePriceDate(value string) (time.Time, bool) {
+	for _, layout := range priceDateLayouts {
+		if date, e := time.ParseInLocation(layout, value, time.Local); e == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ImportPrices imports the prices of a CSV file with the columns symbol, date and price, e.g. "ACME,2026-10-16,123.45"
+// Dates are YYYY-MM-DD or DD.MM.YYYY, a header line and lines of unknown securities are skipped
+// Existing prices of the same day are replaced
+func ImportPrices(cr *sql.Tx, content io.Reader) (PriceImport, err.Error) {
+	var result PriceImport
+
+	symbols := make(map[string]int64)
+
+	rows, e := cr.Query("SELECT id, symbol FROM securities")
+	if e != nil {
+		var err err.Error
+		err.Init("ImportPrices()", e.Error())
+		return result, err
+	}
+	for rows.Next() {
+		var id int64
+		var symbol string
+
+		if e = rows.Scan(&id, &symbol); e != nil {
+			log.Println("[INFO] ImportPrices(): Skipping security")
+			log.Printf("[WARN] ImportPrices(): %s\n", e)
+			continue
+		}
+		symbols[symbol] = id
+	}
+	rows.Close()
+
+	reader := csv.NewReader(content)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	query := "INSERT INTO security_prices (security_id, price_date, price) VALUES ($1, $2, $3) "
+	query += "ON CONFLICT (security_id, price_date) DO UPDATE SET price=EXCLUDED.price"
+
+	for line := 1; ; line++ {
+		record, e := reader.Read()
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			var err err.Error
+			err.Init("ImportPrices()", e.Error())
+			return result, err
+		}
+
+		if len(record) < 3 {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("Line %d: expected symbol, date and price", line))
+			continue
+		}
+
+		symbol := strings.ToUpper(strings.TrimSpace(record[0]))
+		date, dateOk := parsePriceDate(strings.TrimSpace(record[1]))
+		price, priceErr := ParseMoney(strings.TrimSpace(record[2]))
+
+		id, ok := symbols[symbol]
+		if line == 1 && (!dateOk || priceErr != nil) {
+			// Header
+			continue
+		} else if !ok {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("Line %d: unknown security %s", line, symbol))
+			continue
+		} else if !dateOk {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("Line %d: invalid date %s", line, record[1]))
+			continue
+		} else if priceErr != nil || price < 0 {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("Line %d: invalid price %s", line, record[2]))
+			continue
+		}
+
+		if _, e = cr.Exec(query, id, date, price); e != nil {
+			var err err.Error
+			err.Init("ImportPrices()", fmt.Sprintf("Line %d: %s", line, e.Error()))
+			return result, err
+		}
+		result.Imported++
+	}
+
+	return result, err.Error{}
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"crypto/sha256"
-	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/nitohu/err"
@@ -14,20 +12,18 @@ import (
 type Settings struct {
 	Name         string
 	Email        string
-	SalaryDate   time.Time
 	CalcInterval int64
 	CalcUoM      string
 	Currency     string
+	BaseCurrency string
 	APIKey       API
 
 	password   string
 	lastUpdate time.Time
-
-	SalaryDateForm string
 }
 
 // InitializeSettings creates an empty settings object and initializes it
-func InitializeSettings(cr *sql.DB) (Settings, err.Error) {
+func InitializeSettings(cr Cursor) (Settings, err.Error) {
 	s := Settings{}
 
 	e := s.Init(cr)
@@ -41,8 +37,8 @@ func InitializeSettings(cr *sql.DB) (Settings, err.Error) {
 }
 
 // Init the settings
-func (s *Settings) Init(cr *sql.DB) err.Error {
-	query := "SELECT name,email,last_update,salary_date,calc_interval,calc_uom,currency,api_key,password FROM settings;"
+func (s *Settings) Init(cr Cursor) err.Error {
+	query := "SELECT name,email,last_update,calc_interval,calc_uom,currency,base_currency,api_key,password FROM settings;"
 
 	var apiKey interface{}
 
@@ -50,10 +46,10 @@ func (s *Settings) Init(cr *sql.DB) err.Error {
 		&s.Name,
 		&s.Email,
 		&s.lastUpdate,
-		&s.SalaryDate,
 		&s.CalcInterval,
 		&s.CalcUoM,
 		&s.Currency,
+		&s.BaseCurrency,
 		&apiKey,
 		&s.password,
 	)
@@ -90,25 +86,29 @@ func (s *Settings) Init(cr *sql.DB) err.Error {
 		}
 	}
 
-	s.computeFields(cr)
-
 	return err.Error{}
 }
 
 // Save the current Settings object to the database
-// func (s *Settings) Save(cr *sql.DB, password string) error {
-func (s *Settings) Save(cr *sql.DB) err.Error {
-	query := "UPDATE settings SET name=$1,email=$2,last_update=$3,salary_date=$4,"
-	query += "calc_interval=$5,calc_uom=$6,currency=$7,api_key=$8;"
+// func (s *Settings) Save(cr Cursor, password string) error {
+func (s *Settings) Save(cr Cursor) err.Error {
+	if !ValidCurrency(s.BaseCurrency) {
+		var err err.Error
+		err.Init("Settings.Save()", "The base currency must be a three letter code like EUR: "+s.BaseCurrency)
+		return err
+	}
+
+	query := "UPDATE settings SET name=$1,email=$2,last_update=$3,"
+	query += "calc_interval=$4,calc_uom=$5,currency=$6,base_currency=$7,api_key=$8;"
 
 	_, e := cr.Exec(query,
 		s.Name,
 		s.Email,
 		time.Now(),
-		s.SalaryDate,
 		s.CalcInterval,
 		s.CalcUoM,
 		s.Currency,
+		s.BaseCurrency,
 		s.APIKey.ID,
 	)
 	if e != nil {
@@ -117,8 +117,6 @@ func (s *Settings) Save(cr *sql.DB) err.Error {
 		return err
 	}
 
-	s.computeFields(cr)
-
 	return err.Error{}
 }
 
@@ -128,7 +126,7 @@ func (s Settings) GetLastUpdate() time.Time {
 }
 
 // UpdateMasterPassword updates the master password if the provided password matches the current one
-func (s *Settings) UpdateMasterPassword(cr *sql.DB, currPassword, newPassword string) err.Error {
+func (s *Settings) UpdateMasterPassword(cr Cursor, currPassword, newPassword string) err.Error {
 	cpw := sha256.Sum256([]byte(currPassword))
 	currPassword = fmt.Sprintf("%X", cpw)
 	if currPassword != s.password {
@@ -150,25 +148,3 @@ func (s *Settings) UpdateMasterPassword(cr *sql.DB, currPassword, newPassword st
 
 	return err.Error{}
 }
-
-// ShiftSalaryDate .."
-func (s *Settings) ShiftSalaryDate(cr *sql.DB) err.Error {
-	n := time.Now()
-	shifted := false
-	for n.After(s.SalaryDate) {
-		shifted = true
-		s.SalaryDate = s.SalaryDate.AddDate(0, 1, 0)
-	}
-	if shifted {
-		if e := s.Save(cr); !e.Empty() {
-			e.AddTraceback("Settings.shiftSalaryDate()", "Error while saving the settings to the database.")
-			return e
-		}
-		log.Println("[INFO] Settings.ShiftSalaryDate(): Salary date shifted.")
-	}
-	return err.Error{}
-}
-
-func (s *Settings) computeFields(cr *sql.DB) {
-	s.SalaryDateForm = s.SalaryDate.Format("Monday 02 January 2006")
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -30,6 +31,8 @@ func getCmdLineArgs(args []string) (map[string]string, err.Error) {
 			fmt.Println("\t-u, --dbuser <name>\tSpecifies the database user")
 			fmt.Println("\t-pw, --dbpassword <pw>\tSpecifies the database password")
 			fmt.Println("\t-P, --dbport <port>\tSpecifies the database port")
+			fmt.Println("\t-l, --check-ledger <mode>\tRecalculate the balances from the transactions and exit,")
+			fmt.Println("\t\t\t\tmode \"report\" only reports issues, \"fix\" also repairs them")
 			os.Exit(0)
 			return nil, err.Error{}
 		} else if kw == "-c" || kw == "--config" {
@@ -48,6 +51,8 @@ func getCmdLineArgs(args []string) (map[string]string, err.Error) {
 			res["port"] = val
 		} else if kw == "-d" || kw == "--database" {
 			res["dbdatabase"] = val
+		} else if kw == "-l" || kw == "--check-ledger" {
+			res["check_ledger"] = val
 		}
 	}
 
@@ -114,6 +119,42 @@ func validateCmdlineData(data map[string]string) err.Error {
 	if val, ok := data["dbdatabase"]; !ok || val == "" {
 		err.Init("validateCmdlineData()", "Please provide a database name.")
 	}
+	if val, ok := data["check_ledger"]; ok && val != "report" && val != "fix" {
+		err.Init("validateCmdlineData()", "The mode of --check-ledger must be report or fix.")
+	}
 
 	return err
 }
+
+// runLedgerCheck checks the ledger, prints the report and returns the exit code
+// The exit code is 1 if issues were found which were not fixed
+func runLedgerCheck(cr *sql.DB, mode string) int {
+	report, e := CheckLedger(cr, mode == "fix", cmdlineActor)
+	if !e.Empty() {
+		e.AddTraceback("runLedgerCheck()", "Error while checking the ledger.")
+		fmt.Println("[ERROR]", e)
+		return 1
+	}
+
+	fmt.Printf("Checked %d transactions at %s\n", report.TransactionCount, report.CheckDate.Format(dtLayout))
+
+	exitCode := 0
+	fmt.Printf("\n%d issues found\n", len(report.Issues))
+	for _, issue := range report.Issues {
+		state := "open "
+		if issue.Fixed {
+			state = "fixed"
+		} else {
+			exitCode = 1
+		}
+		fmt.Printf("  [%s] %s: %s\n", state, issue.Kind, issue.Message)
+	}
+
+	fmt.Println("\nAccount\tBalance\tRebuilt\tForecast\tRebuilt")
+	for _, a := range report.Accounts {
+		fmt.Printf("%s (%s)\t%s\t%s\t%s\t%s\n", a.Name, a.Currency,
+			a.Balance, a.RebuiltBalance, a.BalanceForecast, a.RebuiltBalanceForecast)
+	}
+
+	return exitCode
+}
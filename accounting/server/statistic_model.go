@@ -30,6 +30,10 @@ type Statistic struct {
 	Suffix        string
 	ExternalID    string
 	Monetary      bool
+
+	// Computed fields
+	// Currency monetary values are reported in
+	Currency string
 }
 
 // EmptyStatistic returns an empty statistic
@@ -51,7 +55,7 @@ func EmptyStatistic() Statistic {
 }
 
 // Create the current object in the database
-func (s *Statistic) Create(cr *sql.DB) err.Error {
+func (s *Statistic) Create(cr Cursor) err.Error {
 	if s.ID > 0 {
 		var err err.Error
 		err.Init("Statistic.Create()", "The Statistic "+s.Name+" already has an ID. Maybe try saving it?")
@@ -105,7 +109,7 @@ func (s *Statistic) Create(cr *sql.DB) err.Error {
 }
 
 // Save the current object to the database
-func (s *Statistic) Save(cr *sql.DB) err.Error {
+func (s *Statistic) Save(cr Cursor) err.Error {
 	if s.ID <= 0 {
 		var err err.Error
 		err.Init("Statistic.Save()", "The Statistic "+s.Name+" does not have an ID. Maybe try creating it first?")
@@ -168,21 +172,31 @@ func (s *Statistic) Save(cr *sql.DB) err.Error {
 }
 
 // Compute the value with the ComputeQuery
-func (s *Statistic) Compute(cr *sql.DB) err.Error {
-	// Make sure the salary_date is always in the future
+func (s *Statistic) Compute(cr Cursor) err.Error {
 	settings, e := InitializeSettings(cr)
 	if !e.Empty() {
 		e.AddTraceback("Statistic.Compute()", "There was an error initializing the settings.")
 		return e
 	}
-	if e := settings.ShiftSalaryDate(cr); !e.Empty() {
-		e.AddTraceback("Statistic.Compute()", "Error while shifting the salary date.")
+	// Make sure the next paydays are always in the future
+	if e := ShiftIncomeSchedules(cr); !e.Empty() {
+		e.AddTraceback("Statistic.Compute()", "Error while shifting the income schedules.")
 		return e
 	}
 
-	// If s.Monetary is true, set the suffix to the currency symbol
-	if s.Monetary {
+	// Monetary values are converted into the base currency by the query
+	if error := cr.QueryRow("SELECT base_currency();").Scan(&s.Currency); error != nil {
+		var err err.Error
+		err.Init("Statistic.Compute()", error.Error())
+		return err
+	}
+
+	// If s.Monetary is true, set the suffix to the currency symbol,
+	// or to the currency code if another currency was chosen
+	if s.Monetary && s.Currency == settings.BaseCurrency {
 		s.Suffix = settings.Currency
+	} else if s.Monetary {
+		s.Suffix = s.Currency
 	}
 
 	// Compute the value of the statistic
@@ -192,8 +206,17 @@ func (s *Statistic) Compute(cr *sql.DB) err.Error {
 		return err
 	}
 
-	// If the value is numerical, shorten the number of decimals
-	if s.Visualisation == "number" {
+	// Monetary values are rounded to cents without going through a float
+	if s.Visualisation == "number" && s.Monetary {
+		val, er := ParseMoney(s.Value)
+		if er != nil {
+			var err err.Error
+			err.Init("Statistic.Compute()", er.Error())
+			return err
+		}
+		s.Value = val.String()
+	} else if s.Visualisation == "number" {
+		// If the value is numerical, shorten the number of decimals
 		val, er := strconv.ParseFloat(s.Value, 64)
 		if er != nil {
 			var err err.Error
@@ -206,8 +229,34 @@ func (s *Statistic) Compute(cr *sql.DB) err.Error {
 	return err.Error{}
 }
 
+// ComputeInCurrency computes the value with monetary values converted into currency
+// instead of the base currency from the settings
+func (s *Statistic) ComputeInCurrency(cr *sql.DB, currency string) err.Error {
+	if !ValidCurrency(currency) {
+		var err err.Error
+		err.Init("Statistic.ComputeInCurrency()", "The currency must be a three letter code like EUR: "+currency)
+		return err
+	}
+
+	// The setting is local to the transaction, so other queries still use the base currency
+	return withTransaction(cr, func(tx *sql.Tx) err.Error {
+		if _, e := tx.Exec("SELECT set_config('accounting.base_currency', $1, true);", currency); e != nil {
+			var err err.Error
+			err.Init("Statistic.ComputeInCurrency()", e.Error())
+			return err
+		}
+
+		if err := s.Compute(tx); !err.Empty() {
+			err.AddTraceback("Statistic.ComputeInCurrency()", "Error computing the value of "+s.Name+" in "+currency)
+			return err
+		}
+
+		return err.Error{}
+	})
+}
+
 // FindByID finds a statistic by it's ID and sets it's value to the current object
-func (s *Statistic) FindByID(cr *sql.DB, id int64) err.Error {
+func (s *Statistic) FindByID(cr Cursor, id int64) err.Error {
 	if id <= 0 {
 		var err err.Error
 		err.Init("Statistic.FindByID()", "ID must be greater than 0")
@@ -249,7 +298,7 @@ func (s *Statistic) FindByID(cr *sql.DB, id int64) err.Error {
 }
 
 // GetAllStatistics returns all statistics from the database
-func GetAllStatistics(cr *sql.DB) (StatisticSet, err.Error) {
+func GetAllStatistics(cr Cursor) (StatisticSet, err.Error) {
 	query := "SELECT id FROM statistics"
 	var stats StatisticSet
 
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Tag is a free-form label of transactions, a transaction can have several tags
+// Tags are created when they are first used on a transaction
+type Tag struct {
+	ID         int64
+	Name       string
+	CreateDate time.Time
+
+	// Computed fields
+	TransactionCount int64
+	// Total of the active transactions with the tag in the base currency
+	Total Money
+}
+
+// ParseTags splits a comma separated list of tags
+func ParseTags(s string) []string {
+	return normalizeTags(strings.Split(s, ","))
+}
+
+// normalizeTags trims the tags and removes empty and duplicate ones
+func normalizeTags(tags []string) []string {
+	var result []string
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || StrContains(result, tag) {
+			continue
+		}
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+// writeTags replaces the tags of the transaction in the database with t.Tags
+// Tags which don't exist yet are created
+func (t *Transaction) writeTags(cr *sql.Tx) err.Error {
+	if _, e := cr.Exec("DELETE FROM transaction_tags WHERE transaction_id=$1", t.ID); e != nil {
+		var err err.Error
+		err.Init("Transaction.writeTags()", e.Error())
+		return err
+	}
+
+	t.Tags = normalizeTags(t.Tags)
+
+	for _, tag := range t.Tags {
+		query := "INSERT INTO tags (name, create_date) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING"
+		if _, e := cr.Exec(query, tag, time.Now().Local()); e != nil {
+			var err err.Error
+			err.Init("Transaction.writeTags()", e.Error())
+			return err
+		}
+
+		query = "INSERT INTO transaction_tags (transaction_id, tag_id) SELECT $1, id FROM tags WHERE name=$2"
+		if _, e := cr.Exec(query, t.ID, tag); e != nil {
+			var err err.Error
+			err.Init("Transaction.writeTags()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+// GetTagsByTransaction returns the names of the tags of the transaction ordered by name
+func GetTagsByTransaction(cr Cursor, transactionID int64) ([]string, err.Error) {
+	var tags []string
+
+	query := "SELECT tg.name FROM transaction_tags AS tt JOIN tags AS tg ON tg.id=tt.tag_id "
+	query += "WHERE tt.transaction_id=$1 ORDER BY tg.name"
+
+	rows, e := cr.Query(query, transactionID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetTagsByTransaction()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+
+		if e = rows.Scan(&tag); e != nil {
+			log.Println("[INFO] GetTagsByTransaction(): Skipping record")
+			log.Printf("[WARN] GetTagsByTransaction(): %s\n", e)
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, err.Error{}
+}
+
+// GetAllTags returns the tags which are used on at least one transaction ordered by name
+func GetAllTags(cr Cursor) ([]Tag, err.Error) {
+	var result []Tag
+
+	query := "SELECT tg.id, tg.name, tg.create_date, COUNT(*), "
+	query += "COALESCE(SUM(tta.base_amount) FILTER (WHERE t.active=true), 0) "
+	query += "FROM tags AS tg JOIN transaction_tag_amounts AS tta ON tta.tag=tg.name "
+	query += "JOIN transactions AS t ON t.id=tta.transaction_id "
+	query += "GROUP BY tg.id, tg.name, tg.create_date ORDER BY tg.name"
+
+	rows, e := cr.Query(query)
+	if e != nil {
+		var err err.Error
+		err.Init("GetAllTags()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag Tag
+
+		if e = rows.Scan(&tag.ID, &tag.Name, &tag.CreateDate, &tag.TransactionCount, &tag.Total); e != nil {
+			log.Println("[INFO] GetAllTags(): Skipping record")
+			log.Printf("[WARN] GetAllTags(): %s\n", e)
+			continue
+		}
+
+		result = append(result, tag)
+	}
+
+	return result, err.Error{}
+}
+
+// GetTransactionsByTags returns the transactions which have all of the tags,
+// latest transactions first
+func GetTransactionsByTags(cr Cursor, tags []string) ([]Transaction, err.Error) {
+	var ids []int64
+	var transactions []Transaction
+
+	tags = normalizeTags(tags)
+	query := "SELECT t.id FROM transactions AS t WHERE true"
+	args := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		args[i] = tag
+		query += " AND EXISTS (SELECT 1 FROM transaction_tags AS tt JOIN tags AS tg ON tg.id=tt.tag_id "
+		query += fmt.Sprintf("WHERE tt.transaction_id=t.id AND tg.name=$%d)", i+1)
+	}
+	query += " ORDER BY t.transaction_date DESC"
+
+	rows, e := cr.Query(query, args...)
+	if e != nil {
+		var err err.Error
+		err.Init("GetTransactionsByTags()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetTransactionsByTags(): Skipping record")
+			log.Printf("[WARN] GetTransactionsByTags(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		t, err := FindTransactionByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetTransactionsByTags(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, err.Error{}
+}
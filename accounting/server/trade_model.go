@@ -0,0 +1,559 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nitohu/err"
+)
+
+// Types of trades, stored in TradeType
+const (
+	// TradeBuy pays Amount (Quantity * Price plus the fees) for the securities
+	TradeBuy = "buy"
+	// TradeSell receives Amount (Quantity * Price less the fees) for the securities
+	TradeSell = "sell"
+	// TradeDividend receives Amount as payout of the security, Quantity and Price are not used
+	TradeDividend = "dividend"
+)
+
+// GetAllTradeTypes returns all types a trade can have
+func GetAllTradeTypes() []string {
+	return []string{
+		TradeBuy,
+		TradeSell,
+		TradeDividend,
+	}
+}
+
+// Trade is a buy, sell or dividend of a security in an investment account, all amounts are in the currency of the account
+// The cash of the trade is posted into the journal as entry without transaction, the securities are part of the
+// Holdings of the account instead. CostBasis is the cost of bought securities, for sells it's the average cost of
+// the sold quantity, which is recomputed for all trades of the security whenever a trade is created or deleted
+// Trades can't be changed, they are deleted and created again, trades dated in a closed period not even that
+type Trade struct {
+	ID         int64
+	AccountID  int64
+	SecurityID int64
+	TradeType  string
+	TradeDate  time.Time
+	Quantity   Quantity
+	Price      Money
+	Fees       Money
+	Amount     Money
+	CostBasis  Money
+	EntryID    int64
+	CreateDate time.Time
+
+	// Computed fields
+	AccountName  string
+	SecurityName string
+	Symbol       string
+	Currency     string
+	TradeDateStr string
+	// RealisedGain is the gain of sells over their cost basis and the amount of dividends
+	RealisedGain Money
+}
+
+// Holding is the position of a security in an account
+// Securities without a price are valued at their cost basis
+type Holding struct {
+	AccountID      int64
+	AccountName    string
+	SecurityID     int64
+	SecurityName   string
+	Symbol         string
+	Quantity       Quantity
+	CostBasis      Money
+	MarketValue    Money
+	UnrealisedGain Money
+	Price          Money
+	PriceDateStr   string
+}
+
+// EmptyTrade returns an empty trade
+func EmptyTrade() Trade {
+	t := Trade{
+		ID:         0,
+		AccountID:  0,
+		SecurityID: 0,
+		TradeType:  TradeBuy,
+		TradeDate:  time.Now().Local(),
+		Quantity:   0,
+		Price:      0,
+		Fees:       0,
+		Amount:     0,
+		CostBasis:  0,
+		CreateDate: time.Now().Local(),
+	}
+
+	return t
+}
+
+// validate checks the trade and computes the Amount of buys and sells
+func (t *Trade) validate(cr Cursor) err.Error {
+	var err err.Error
+
+	valid := false
+	for _, tradeType := range GetAllTradeTypes() {
+		valid = valid || tradeType == t.TradeType
+	}
+	if !valid {
+		err.Init("Trade.validate()", "Unknown trade type: "+t.TradeType)
+		return err
+	} else if t.TradeDate.After(time.Now().Local()) {
+		err.Init("Trade.validate()", "The trade date can't be in the future")
+		return err
+	} else if t.Fees < 0 {
+		err.Init("Trade.validate()", "The fees can't be negative")
+		return err
+	} else if err = checkPeriodOpen(cr, t.TradeDate, "Trade.validate()"); !err.Empty() {
+		return err
+	}
+
+	account, err := FindAccountByID(cr, t.AccountID)
+	if !err.Empty() {
+		err.AddTraceback("Trade.validate()", "Error while finding account: "+fmt.Sprintf("%d", t.AccountID))
+		return err
+	} else if account.BankType != AccountInvestment {
+		err.Init("Trade.validate()", "Securities can only be traded in investment accounts")
+		return err
+	}
+
+	security, err := FindSecurityByID(cr, t.SecurityID)
+	if !err.Empty() {
+		err.AddTraceback("Trade.validate()", "Error while finding security: "+fmt.Sprintf("%d", t.SecurityID))
+		return err
+	} else if security.Currency != account.Currency {
+		err.Init("Trade.validate()", fmt.Sprintf("%s is traded in %s, the account %s is in %s", security.Name, security.Currency, account.Name, account.Currency))
+		return err
+	}
+
+	switch t.TradeType {
+	case TradeBuy, TradeSell:
+		if t.Quantity <= 0 || t.Price < 0 {
+			err.Init("Trade.validate()", "The quantity must be bigger than 0 and the price can't be negative")
+			return err
+		}
+		t.Amount = t.Quantity.Times(t.Price)
+		if t.TradeType == TradeBuy {
+			t.Amount += t.Fees
+		} else if t.Amount -= t.Fees; t.Amount <= 0 {
+			err.Init("Trade.validate()", "The fees of the sell are as high as it's proceeds, nothing would be paid in")
+			return err
+		}
+	case TradeDividend:
+		t.Quantity = 0
+		t.Price = 0
+		if t.Amount <= 0 {
+			err.Init("Trade.validate()", "The amount of the dividend must be bigger than 0")
+			return err
+		}
+	}
+
+	if t.TradeType == TradeSell {
+		var held Quantity
+
+		query := "SELECT COALESCE(SUM(CASE trade_type WHEN 'buy' THEN quantity WHEN 'sell' THEN -quantity ELSE 0 END), 0) "
+		query += "FROM trades WHERE account_id=$1 AND security_id=$2 AND trade_date<=$3"
+
+		if e := cr.QueryRow(query, t.AccountID, t.SecurityID, t.TradeDate).Scan(&held); e != nil {
+			err.Init("Trade.validate()", e.Error())
+			return err
+		} else if t.Quantity > held {
+			err.Init("Trade.validate()", fmt.Sprintf("Only %s of %s are held on the trade date", held, security.Name))
+			return err
+		}
+	}
+
+	return err
+}
+
+// post creates the journal entry of the cash, buys take it out of the account and sells and dividends pay it in
+func (t *Trade) post(cr *sql.Tx) err.Error {
+	currency, currencyErr := accountCurrency(cr, t.AccountID)
+	if !currencyErr.Empty() {
+		currencyErr.AddTraceback("Trade.post()", "Error while getting the currency of the account.")
+		return currencyErr
+	}
+
+	je := EmptyJournalEntry()
+	je.Name = fmt.Sprintf("%s %s", t.TradeType, t.SecurityName)
+	je.EntryDate = t.TradeDate
+
+	if t.TradeType == TradeBuy {
+		je.AddLine(t.AccountID, 0, t.Amount, currency, true)
+	} else {
+		je.AddLine(0, t.AccountID, t.Amount, currency, true)
+	}
+
+	if err := je.Create(cr); !err.Empty() {
+		err.AddTraceback("Trade.post()", "Error while posting the trade.")
+		return err
+	}
+	t.EntryID = je.ID
+
+	return err.Error{}
+}
+
+// Create 's the trade and posts it's cash into the journal
+// Sells which would sell more than is held on their date, also later ones, are rejected
+func (t *Trade) Create(cr *sql.Tx) err.Error {
+	if t.ID != 0 {
+		var err err.Error
+		err.Init("Trade.Create()", "This object already has an id")
+		return err
+	}
+
+	if err := t.validate(cr); !err.Empty() {
+		err.AddTraceback("Trade.Create()", "The trade is not valid.")
+		return err
+	}
+
+	security, securityErr := FindSecurityByID(cr, t.SecurityID)
+	if !securityErr.Empty() {
+		securityErr.AddTraceback("Trade.Create()", "Error while finding security: "+fmt.Sprintf("%d", t.SecurityID))
+		return securityErr
+	}
+	t.SecurityName = security.Name
+
+	if err := t.post(cr); !err.Empty() {
+		err.AddTraceback("Trade.Create()", "Error while posting the trade.")
+		return err
+	}
+
+	t.CreateDate = time.Now().Local()
+
+	query := "INSERT INTO trades (account_id, security_id, trade_type, trade_date, quantity, price, fees, amount, entry_id, create_date) "
+	query += "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;"
+
+	e := cr.QueryRow(query,
+		t.AccountID,
+		t.SecurityID,
+		t.TradeType,
+		t.TradeDate,
+		t.Quantity,
+		t.Price,
+		t.Fees,
+		t.Amount,
+		t.EntryID,
+		t.CreateDate,
+	).Scan(&t.ID)
+	if e != nil {
+		var err err.Error
+		err.Init("Trade.Create()", e.Error())
+		return err
+	}
+
+	// A backdated sell can leave later sells without holdings
+	if err := checkHoldings(cr, t.AccountID, t.SecurityID, "Trade.Create()"); !err.Empty() {
+		return err
+	}
+
+	if err := updateCostBasis(cr, t.AccountID, t.SecurityID); !err.Empty() {
+		err.AddTraceback("Trade.Create()", "Error while updating the cost basis.")
+		return err
+	}
+
+	return t.FindByID(cr, t.ID)
+}
+
+// Delete 's the trade and it's journal entry
+// The trade can't be deleted if later sells would sell more than is held without it
+func (t *Trade) Delete(cr *sql.Tx) err.Error {
+	if t.ID <= 0 {
+		var err err.Error
+		err.Init("Trade.Delete()", "ID must be bigger than 0")
+		return err
+	} else if err := checkPeriodOpen(cr, t.TradeDate, "Trade.Delete()"); !err.Empty() {
+		return err
+	}
+
+	if _, e := cr.Exec("DELETE FROM trades WHERE id=$1", t.ID); e != nil {
+		var err err.Error
+		err.Init("Trade.Delete()", e.Error())
+		return err
+	}
+
+	if err := checkHoldings(cr, t.AccountID, t.SecurityID, "Trade.Delete()"); !err.Empty() {
+		return err
+	}
+
+	if t.EntryID > 0 {
+		je := EmptyJournalEntry()
+		je.ID = t.EntryID
+		if err := je.Delete(cr); !err.Empty() {
+			err.AddTraceback("Trade.Delete()", "Error while deleting the journal entry of trade: "+fmt.Sprintf("%d", t.ID))
+			return err
+		}
+	}
+
+	if err := updateCostBasis(cr, t.AccountID, t.SecurityID); !err.Empty() {
+		err.AddTraceback("Trade.Delete()", "Error while updating the cost basis.")
+		return err
+	}
+
+	t.ID = 0
+
+	return err.Error{}
+}
+
+// checkHoldings returns an error if a sell of the security in the account sells more than is held on it's date
+func checkHoldings(cr Cursor, accountID, securityID int64, funcName string) err.Error {
+	var held Quantity
+
+	query := "SELECT trade_type, quantity, trade_date FROM trades WHERE account_id=$1 AND security_id=$2 ORDER BY trade_date, id"
+
+	rows, e := cr.Query(query, accountID, securityID)
+	if e != nil {
+		var err err.Error
+		err.Init(funcName, e.Error())
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tradeType string
+		var quantity Quantity
+		var tradeDate time.Time
+
+		if e = rows.Scan(&tradeType, &quantity, &tradeDate); e != nil {
+			var err err.Error
+			err.Init(funcName, e.Error())
+			return err
+		}
+
+		if tradeType == TradeBuy {
+			held += quantity
+		} else if tradeType == TradeSell && quantity > held {
+			var err err.Error
+			err.Init(funcName, fmt.Sprintf("The sell of %s on %s would sell more than the %s which are held", quantity, tradeDate.Format(dateLayout), held))
+			return err
+		} else if tradeType == TradeSell {
+			held -= quantity
+		}
+	}
+
+	return err.Error{}
+}
+
+// updateCostBasis recomputes the cost basis of all trades of the security in the account in the order of their date
+// Buys add their amount to the cost, sells take the average cost of the sold quantity out of it
+func updateCostBasis(cr *sql.Tx, accountID, securityID int64) err.Error {
+	type costBasis struct {
+		id        int64
+		cost      Money
+		tradeType string
+		quantity  Quantity
+		amount    Money
+	}
+	var trades []costBasis
+
+	query := "SELECT id, trade_type, quantity, amount FROM trades WHERE account_id=$1 AND security_id=$2 ORDER BY trade_date, id"
+
+	rows, e := cr.Query(query, accountID, securityID)
+	if e != nil {
+		var err err.Error
+		err.Init("updateCostBasis()", e.Error())
+		return err
+	}
+	for rows.Next() {
+		var c costBasis
+
+		if e = rows.Scan(&c.id, &c.tradeType, &c.quantity, &c.amount); e != nil {
+			rows.Close()
+			var err err.Error
+			err.Init("updateCostBasis()", e.Error())
+			return err
+		}
+		trades = append(trades, c)
+	}
+	rows.Close()
+
+	var quantity Quantity
+	var cost Money
+
+	for _, c := range trades {
+		switch c.tradeType {
+		case TradeBuy:
+			c.cost = c.amount
+			quantity += c.quantity
+			cost += c.cost
+		case TradeSell:
+			if quantity > 0 {
+				c.cost = cost.Share(c.quantity, quantity)
+			}
+			if c.quantity >= quantity {
+				c.cost = cost
+			}
+			quantity -= c.quantity
+			cost -= c.cost
+		}
+
+		if _, e := cr.Exec("UPDATE trades SET cost_basis=$2 WHERE id=$1", c.id, c.cost); e != nil {
+			var err err.Error
+			err.Init("updateCostBasis()", e.Error())
+			return err
+		}
+	}
+
+	return err.Error{}
+}
+
+func (t *Trade) computeFields(cr Cursor) {
+	query := "SELECT a.name, s.name, s.symbol, a.currency FROM trades AS t "
+	query += "JOIN securities AS s ON s.id=t.security_id JOIN accounts AS a ON a.id=t.account_id WHERE t.id=$1"
+
+	if e := cr.QueryRow(query, t.ID).Scan(&t.AccountName, &t.SecurityName, &t.Symbol, &t.Currency); e != nil {
+		var err err.Error
+		err.Init("Trade.computeFields()", e.Error())
+		log.Println("[WARN]", err)
+	}
+
+	t.TradeDateStr = t.TradeDate.Format(dateLayout)
+
+	t.RealisedGain = 0
+	switch t.TradeType {
+	case TradeSell:
+		t.RealisedGain = t.Amount - t.CostBasis
+	case TradeDividend:
+		t.RealisedGain = t.Amount
+	}
+}
+
+// FindByID finds a trade with it's id
+func (t *Trade) FindByID(cr Cursor, id int64) err.Error {
+	query := "SELECT id, account_id, security_id, trade_type, trade_date, quantity, price, fees, amount, cost_basis, "
+	query += "entry_id, create_date FROM trades WHERE id=$1"
+
+	var entryID sql.NullInt64
+
+	e := cr.QueryRow(query, id).Scan(
+		&t.ID,
+		&t.AccountID,
+		&t.SecurityID,
+		&t.TradeType,
+		&t.TradeDate,
+		&t.Quantity,
+		&t.Price,
+		&t.Fees,
+		&t.Amount,
+		&t.CostBasis,
+		&entryID,
+		&t.CreateDate,
+	)
+	if e != nil {
+		var err err.Error
+		err.Init("Trade.FindByID()", e.Error())
+		return err
+	}
+
+	t.EntryID = entryID.Int64
+	t.computeFields(cr)
+
+	return err.Error{}
+}
+
+// FindTradeByID is similar to FindByID but returns the trade
+func FindTradeByID(cr Cursor, id int64) (Trade, err.Error) {
+	t := EmptyTrade()
+
+	if e := t.FindByID(cr, id); !e.Empty() {
+		e.AddTraceback("FindTradeByID()", "Error while finding trade by ID: "+fmt.Sprintf("%d", id))
+		return t, e
+	}
+
+	return t, err.Error{}
+}
+
+// GetTradesByAccount returns the trades of an account, the latest first
+// All trades are returned if accountID is 0
+func GetTradesByAccount(cr Cursor, accountID int64) ([]Trade, err.Error) {
+	var ids []int64
+	var result []Trade
+
+	rows, e := cr.Query("SELECT id FROM trades WHERE account_id=$1 OR $1=0 ORDER BY trade_date DESC, id DESC", accountID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetTradesByAccount()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		var id int64
+
+		if e = rows.Scan(&id); e != nil {
+			log.Println("[INFO] GetTradesByAccount(): Skipping record")
+			log.Printf("[WARN] GetTradesByAccount(): %s\n", e)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		t, err := FindTradeByID(cr, id)
+		if !err.Empty() {
+			log.Println("[INFO] GetTradesByAccount(): Skipping record")
+			log.Println("[WARN]", err)
+			continue
+		}
+
+		result = append(result, t)
+	}
+
+	return result, err.Error{}
+}
+
+// GetHoldings returns the securities held in an account, or in all accounts if accountID is 0
+func GetHoldings(cr Cursor, accountID int64) ([]Holding, err.Error) {
+	var result []Holding
+
+	query := "SELECT h.account_id, a.name, h.security_id, s.name, s.symbol, h.quantity, h.cost_basis, h.market_value, "
+	query += "COALESCE(p.price, 0), p.price_date FROM holdings AS h JOIN securities AS s ON s.id=h.security_id "
+	query += "JOIN accounts AS a ON a.id=h.account_id LEFT JOIN security_latest_prices AS p ON p.security_id=h.security_id "
+	query += "WHERE h.account_id=$1 OR $1=0 ORDER BY a.name, s.name"
+
+	rows, e := cr.Query(query, accountID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetHoldings()", e.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h Holding
+		var priceDate sql.NullTime
+
+		e = rows.Scan(
+			&h.AccountID,
+			&h.AccountName,
+			&h.SecurityID,
+			&h.SecurityName,
+			&h.Symbol,
+			&h.Quantity,
+			&h.CostBasis,
+			&h.MarketValue,
+			&h.Price,
+			&priceDate,
+		)
+		if e != nil {
+			log.Println("[INFO] GetHoldings(): Skipping record")
+			log.Printf("[WARN] GetHoldings(): %s\n", e)
+			continue
+		}
+
+		if priceDate.Valid {
+			h.PriceDateStr = priceDate.Time.Format(dateLayout)
+		}
+		h.UnrealisedGain = h.MarketValue - h.CostBasis
+
+		result = append(result, h)
+	}
+
+	return result, err.Error{}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nitohu/err"
 )
 
 /*
@@ -36,11 +38,25 @@ func handleTransactionOverview(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	ctx["Title"] = "Transactions"
-	if ctx["Transactions"], e = GetLatestTransactions(db, -1); !e.Empty() {
+
+	// Only the transactions with all of the tags are listed when filtering by tag
+	tags := normalizeTags(r.URL.Query()["tag"])
+	ctx["FilterTags"] = tags
+	if len(tags) > 0 {
+		if ctx["Transactions"], e = GetTransactionsByTags(db, tags); !e.Empty() {
+			e.AddTraceback("handleTransactionOverview()", "Error while getting the transactions by tags.")
+			fmt.Println("[WARN]", e)
+		}
+	} else if ctx["Transactions"], e = GetLatestTransactions(db, -1); !e.Empty() {
 		e.AddTraceback("handleTransactionOverview()", "Error while getting all transactions.")
 		fmt.Println("[WARN]", e)
 	}
 
+	if ctx["Tags"], e = GetAllTags(db); !e.Empty() {
+		e.AddTraceback("handleTransactionOverview()", "Error while getting the tags.")
+		fmt.Println("[WARN]", e)
+	}
+
 	if err := tmpl.ExecuteTemplate(w, "transactions.html", ctx); err != nil {
 		e.Init("handleTransactionOverview", err.Error())
 		fmt.Println("[ERROR]", e)
@@ -89,6 +105,11 @@ func handleTransactionForm(w http.ResponseWriter, r *http.Request) {
 		} else {
 			ctx["Title"] = "Edit " + t.Name
 			ctx["Btn"] = "Save Transaction"
+
+			if ctx["Attachments"], err = GetAttachments(db, AuditTransaction, t.ID); !err.Empty() {
+				err.AddTraceback("handleTransactionForm()", "Error while getting the attachments of transaction: "+fmt.Sprintf("%d", id))
+				log.Println("[WARN]", err)
+			}
 		}
 	}
 
@@ -100,12 +121,26 @@ func handleTransactionForm(w http.ResponseWriter, r *http.Request) {
 		log.Println("[WARN]", err)
 	}
 
+	ctx["TransactionTypes"] = GetAllTransactionTypes()
+
 	// Get Categories
 	if ctx["Categories"], err = GetAllCategories(db); !err.Empty() {
 		err.AddTraceback("handleTransactionForm()", "Error while getting the categories.")
 		log.Println("[WARN]", err)
 	}
 
+	// Get Payees
+	if ctx["Payees"], err = GetAllPayees(db, true); !err.Empty() {
+		err.AddTraceback("handleTransactionForm()", "Error while getting the payees.")
+		log.Println("[WARN]", err)
+	}
+
+	// Get the existing tags for the suggestions
+	if ctx["Tags"], err = GetAllTags(db); !err.Empty() {
+		err.AddTraceback("handleTransactionForm()", "Error while getting the tags.")
+		log.Println("[WARN]", err)
+	}
+
 	if r.Method != http.MethodPost {
 		e := tmpl.ExecuteTemplate(w, "transaction_form.html", ctx)
 		if e != nil {
@@ -115,6 +150,8 @@ func handleTransactionForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := auditSnapshot(t)
+
 	// Format the time received from the form
 	tDate := r.FormValue("datetime")
 	transactionDate, e := time.Parse(dtLayout, tDate)
@@ -129,11 +166,21 @@ func handleTransactionForm(w http.ResponseWriter, r *http.Request) {
 
 	t.Name = r.FormValue("name")
 
-	if t.Amount, e = strconv.ParseFloat(r.FormValue("amount"), 64); e != nil {
+	if t.Amount, e = ParseMoney(r.FormValue("amount")); e != nil {
 		err.Init("handleTransactionsForm()", e.Error())
 		log.Println("[WARN]", err)
 		t.Amount = 0
 	}
+	// The received amount is only needed for cross-currency transactions,
+	// if it's empty the amount is converted with the exchange rate
+	t.ToAmount = 0
+	if r.FormValue("to_amount") != "" {
+		if t.ToAmount, e = ParseMoney(r.FormValue("to_amount")); e != nil {
+			err.Init("handleTransactionsForm()", e.Error())
+			log.Println("[WARN]", err)
+			t.ToAmount = 0
+		}
+	}
 	if t.FromAccount, e = strconv.ParseInt(r.FormValue("fromAccount"), 0, 64); e != nil {
 		err.Init("handleTransactionsForm()", e.Error())
 		log.Println("[WARN]", err)
@@ -149,30 +196,90 @@ func handleTransactionForm(w http.ResponseWriter, r *http.Request) {
 		log.Println("[WARN]", err)
 		t.CategoryID = 0
 	}
+	// 0 links new transactions to the payee matching their name
+	if t.PayeeID, e = strconv.ParseInt(r.FormValue("payee"), 0, 64); e != nil {
+		t.PayeeID = 0
+	}
 	t.LastUpdate = time.Now().Local()
 	t.TransactionDate = transactionDate
 	t.Description = r.FormValue("description")
+	t.Tags = ParseTags(r.FormValue("tags"))
+	// An empty type is detected from the accounts
+	t.TransactionType = r.FormValue("type")
+
+	// Split lines, rows without an amount are ignored
+	t.Splits = nil
+	splitCategories := r.Form["split_category"]
+	splitNotes := r.Form["split_note"]
+	for i, amount := range r.Form["split_amount"] {
+		if amount == "" {
+			continue
+		}
 
-	if t.ID == 0 {
+		split := EmptyTransactionSplit()
+		if split.Amount, e = ParseMoney(amount); e != nil {
+			err.Init("handleTransactionsForm()", e.Error())
+			log.Println("[WARN]", err)
+			continue
+		}
+		if i < len(splitCategories) {
+			split.CategoryID, _ = strconv.ParseInt(splitCategories[i], 0, 64)
+		}
+		if i < len(splitNotes) {
+			split.Note = splitNotes[i]
+		}
+		t.Splits = append(t.Splits, split)
+	}
+
+	// Write the transaction, it's journal entry and the audit entry atomically
+	create := t.ID == 0
+	if create {
 		t.Active = true
-		err = t.Create(db)
-	} else {
-		err = t.Save(db)
 	}
+	err = writeTransaction(&t, webActor(ctx), before)
 
 	if !err.Empty() {
 		err.AddTraceback("handleTransactionForm()", "Error while writing the transaction to the database.")
-		log.Println(err)
+		log.Println("[ERROR]", err)
+
+		// Everything was rolled back, so the transaction does not exist if it was just created
+		if create {
+			t.ID = 0
+		}
+		ctx["Transaction"] = t
+		ctx["Error"] = "The transaction could not be saved, nothing was written to the database: " + err.Error()
+
+		if e := tmpl.ExecuteTemplate(w, "transaction_form.html", ctx); e != nil {
+			err.Init("handleTransactionForm()", e.Error())
+			log.Println("[ERROR]", err)
+		}
+		return
 	}
 
 	http.Redirect(w, r, "/transactions/", http.StatusSeeOther)
 }
 
+// writeTransaction creates or saves the transaction, the change is logged in the same database transaction
+func writeTransaction(t *Transaction, actor string, before interface{}) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if t.ID == 0 {
+			if err := t.Create(tx); !err.Empty() {
+				return err
+			}
+			return LogAudit(tx, actor, AuditCreate, AuditTransaction, t.ID, nil, t)
+		}
+		if err := t.Save(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditUpdate, AuditTransaction, t.ID, before, t)
+	})
+}
+
 // TODO: Replace w/ API
 func handleTransactionDeletion(w http.ResponseWriter, r *http.Request) {
 	session, _ := store.Get(r, "session")
 
-	_, err := createContextFromSession(db, session)
+	ctx, err := createContextFromSession(db, session)
 
 	if !err.Empty() {
 		err.AddTraceback("handleTransactionDeletion()", "Error while creating the context.")
@@ -203,11 +310,22 @@ func handleTransactionDeletion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = t.Delete(db)
+	err = deleteAndLogTransaction(&t, webActor(ctx))
 
 	if !err.Empty() {
 		err.AddTraceback("handleTransactionDeletion()", "Error while deleting the transaction from the database.")
 		log.Println("[ERROR]", err)
 		http.Error(w, "Error while deleting", http.StatusInternalServerError)
+		return
 	}
 }
+
+// deleteAndLogTransaction deletes the transaction, it's logged in the same database transaction
+func deleteAndLogTransaction(t *Transaction, actor string) err.Error {
+	return withTransaction(db, func(tx *sql.Tx) err.Error {
+		if err := t.Delete(tx); !err.Empty() {
+			return err
+		}
+		return LogAudit(tx, actor, AuditDelete, AuditTransaction, t.ID, t, nil)
+	})
+}
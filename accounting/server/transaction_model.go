@@ -9,8 +9,79 @@ import (
 	"github.com/nitohu/err"
 )
 
+// Types of transactions, stored in TransactionType
+const (
+	// TransactionIncome is money which enters an account from outside
+	TransactionIncome = "income"
+	// TransactionExpense is money which leaves an account
+	TransactionExpense = "expense"
+	// TransactionTransfer is money moved between two own accounts
+	TransactionTransfer = "transfer"
+	// TransactionRefund is money which is paid back into an account, it reduces the expenses
+	TransactionRefund = "refund"
+	// TransactionFee is a fee charged on an account, it counts as an expense
+	TransactionFee = "fee"
+	// TransactionOpeningBalance is the balance an account started with, it's neither income nor expense
+	TransactionOpeningBalance = "opening_balance"
+)
+
+// GetAllTransactionTypes returns all types a transaction can have
+func GetAllTransactionTypes() []string {
+	return []string{
+		TransactionIncome,
+		TransactionExpense,
+		TransactionTransfer,
+		TransactionRefund,
+		TransactionFee,
+		TransactionOpeningBalance,
+	}
+}
+
+// detectTransactionType returns the type which follows from the accounts:
+// transfer between two accounts, income into an account and expense out of an account
+func detectTransactionType(fromAccount, toAccount int64) string {
+	if fromAccount > 0 && toAccount > 0 {
+		return TransactionTransfer
+	} else if toAccount > 0 {
+		return TransactionIncome
+	}
+	return TransactionExpense
+}
+
+// transactionTypeFits returns true if the type is possible with the accounts
+// Transfers need both accounts, the other types have an external side
+func transactionTypeFits(transactionType string, fromAccount, toAccount int64) bool {
+	switch transactionType {
+	case TransactionTransfer:
+		return fromAccount > 0 && toAccount > 0
+	case TransactionIncome, TransactionRefund:
+		return fromAccount == 0 && toAccount > 0
+	case TransactionExpense, TransactionFee:
+		return fromAccount > 0 && toAccount == 0
+	case TransactionOpeningBalance:
+		return (fromAccount > 0) != (toAccount > 0)
+	}
+	return false
+}
+
 // Transaction model
-// TODO: Implement Forecasted and Booked in database
+// The booked state of both sides is stored in origin_booked and dest_booked
+// and gets written when the transaction is posted into the journal
+// Amount is in the currency of the origin account, ToAmount is the amount the
+// recipient receives in it's currency, both are equal if the currencies are the same
+// Splits divide the Amount into several categories, a split transaction is counted
+// in the categories of it's splits instead of CategoryID
+// Tags are free-form labels, they are created when they are first used
+// PayeeID is the counterparty, new transactions without one are linked to the payee matching their Name
+// New transactions are categorised and tagged by the matching rules before the
+// default category of the payee is used
+// TransactionType is one of GetAllTransactionTypes, it's detected from the accounts if it's empty
+// RecurringID is the recurring transaction the transaction was booked from
+// Booked is false as long as the TransactionDate is in the future, the transaction
+// is part of the BalanceForecast of the accounts but not of their Balance until then
+// Reconciled transactions are locked, Save and Delete fail until they are un-reconciled
+// Transactions dated in a closed period can't be created, saved or deleted, see period_model.go
+// Transactions with attachments can't be deleted until the attachments are deleted
 type Transaction struct {
 	// Database fields
 	ID              int64
@@ -20,17 +91,27 @@ type Transaction struct {
 	TransactionDate time.Time
 	CreateDate      time.Time
 	LastUpdate      time.Time
-	Amount          float64
+	Amount          Money
+	ToAmount        Money
 	FromAccount     int64
 	ToAccount       int64
 	TransactionType string
 	CategoryID      int64
+	Splits          []TransactionSplit
+	Tags            []string
+	PayeeID         int64
+	RecurringID     int64
 
 	// Computed fields
 	FromAccountName    string
 	ToAccountName      string
+	FromCurrency       string
+	ToCurrency         string
 	TransactionDateStr string
 	Category           Category
+	PayeeName          string
+	Booked             bool
+	Reconciled         bool
 }
 
 // EmptyTransaction ..
@@ -43,125 +124,344 @@ func EmptyTransaction() Transaction {
 		TransactionDate: time.Now().Local(),
 		CreateDate:      time.Now().Local(),
 		LastUpdate:      time.Now().Local(),
-		Amount:          0.0,
+		Amount:          0,
+		ToAmount:        0,
 		FromAccount:     0,
 		ToAccount:       0,
 		TransactionType: "",
 		CategoryID:      0,
+		PayeeID:         0,
+		RecurringID:     0,
 	}
 
 	return t
 }
 
-func bookIntoAccount(cr *sql.DB, id int64, t *Transaction, invert bool) err.Error {
-	acc, e := FindAccountByID(cr, id)
+// post writes the balanced journal entry of the transaction
+// Entries which were posted before are removed first, so the journal
+// always reflects the current values of the transaction
+// Transactions dated in the future are posted as pending, they only count in the
+// forecast until BookDueJournalLines books them on their transaction date
+func (t *Transaction) post(cr *sql.Tx) err.Error {
+	if e := t.unpost(cr); !e.Empty() {
+		e.AddTraceback("Transaction.post()", "Error while removing the old journal entry.")
+		return e
+	}
 
-	if !e.Empty() {
-		e.AddTraceback("bookIntoAccount()", "Error while finding account")
+	je := t.journalEntry()
+
+	if e := je.Create(cr); !e.Empty() {
+		e.AddTraceback("Transaction.post()", "Error while creating the journal entry for transaction: "+fmt.Sprintf("%d", t.ID))
 		return e
 	}
 
-	e = acc.Book(cr, t, invert)
+	query := "UPDATE transactions SET origin_booked=$2, dest_booked=$3 WHERE id=$1"
 
-	if !e.Empty() {
-		e.AddTraceback("bookIntoAccount()", "Error while booking into account")
+	if _, e := cr.Exec(query, t.ID, je.Lines[0].Booked, je.Lines[len(je.Lines)-1].Booked); e != nil {
+		var err err.Error
+		err.Init("Transaction.post()", e.Error())
+		return err
+	}
+
+	t.Booked = je.Lines[0].Booked
+
+	return err.Error{}
+}
+
+// journalEntry returns the journal entry of the transaction without writing it
+func (t *Transaction) journalEntry() JournalEntry {
+	je := EmptyJournalEntry()
+	je.TransactionID = t.ID
+	je.Name = t.Name
+	je.EntryDate = t.TransactionDate
+
+	booked := !t.TransactionDate.After(time.Now())
+
+	if t.FromCurrency == t.ToCurrency {
+		je.AddLine(t.FromAccount, t.ToAccount, t.Amount, t.FromCurrency, booked)
+	} else {
+		// Cross-currency transfers are exchanged by the external account,
+		// it receives the sent amount and pays out the received amount
+		je.AddLine(t.FromAccount, 0, t.Amount, t.FromCurrency, booked)
+		je.AddLine(0, t.ToAccount, t.ToAmount, t.ToCurrency, booked)
+	}
+
+	return je
+}
+
+// unpost removes the journal entry of the transaction
+func (t *Transaction) unpost(cr *sql.Tx) err.Error {
+	if e := deleteJournalEntries(cr, t.ID); !e.Empty() {
+		e.AddTraceback("Transaction.unpost()", "Error while deleting the journal entry of transaction: "+fmt.Sprintf("%d", t.ID))
 		return e
 	}
 
+	query := "UPDATE transactions SET origin_booked=false, dest_booked=false WHERE id=$1"
+
+	if _, e := cr.Exec(query, t.ID); e != nil {
+		var err err.Error
+		err.Init("Transaction.unpost()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// resolveAmounts sets the currencies of both sides and the received amount
+// If the accounts have different currencies and no received amount is given,
+// it's converted with the exchange rate at the date of the transaction
+func (t *Transaction) resolveAmounts(cr Cursor) err.Error {
+	var err err.Error
+
+	if t.FromCurrency, err = accountCurrency(cr, t.FromAccount); !err.Empty() {
+		err.AddTraceback("Transaction.resolveAmounts()", "Error while getting the currency of the origin account.")
+		return err
+	}
+	if t.ToCurrency, err = accountCurrency(cr, t.ToAccount); !err.Empty() {
+		err.AddTraceback("Transaction.resolveAmounts()", "Error while getting the currency of the recipient account.")
+		return err
+	}
+
+	// The external account uses the currency of the other side
+	if t.FromCurrency == "" && t.ToCurrency == "" {
+		if t.FromCurrency, err = GetBaseCurrency(cr); !err.Empty() {
+			err.AddTraceback("Transaction.resolveAmounts()", "Error while getting the base currency.")
+			return err
+		}
+		t.ToCurrency = t.FromCurrency
+	} else if t.FromCurrency == "" {
+		t.FromCurrency = t.ToCurrency
+	} else if t.ToCurrency == "" {
+		t.ToCurrency = t.FromCurrency
+	}
+
+	if t.FromCurrency == t.ToCurrency {
+		t.ToAmount = t.Amount
+		return err
+	}
+
+	if t.ToAmount == 0 {
+		rate, err := FindExchangeRate(cr, t.FromCurrency, t.ToCurrency, t.TransactionDate)
+		if !err.Empty() {
+			err.AddTraceback("Transaction.resolveAmounts()", "No received amount given and no exchange rate found.")
+			return err
+		}
+		t.ToAmount = t.Amount.Convert(rate)
+	} else if (t.ToAmount < 0) != (t.Amount < 0) {
+		err.Init("Transaction.resolveAmounts()", "The sent and the received amount must have the same sign")
+		return err
+	}
+
+	return err
+}
+
+// validateType detects the type from the accounts if it's empty and checks that it fits the accounts
+func (t *Transaction) validateType() err.Error {
+	var err err.Error
+
+	if t.TransactionType == "" {
+		t.TransactionType = detectTransactionType(t.FromAccount, t.ToAccount)
+	}
+
+	if !StrContains(GetAllTransactionTypes(), t.TransactionType) {
+		err.Init("Transaction.validateType()", "Unknown transaction type: "+t.TransactionType)
+	} else if t.FromAccount == 0 && t.ToAccount == 0 {
+		err.Init("Transaction.validateType()", "The transaction needs at least one account")
+	} else if !transactionTypeFits(t.TransactionType, t.FromAccount, t.ToAccount) {
+		err.Init("Transaction.validateType()", "The accounts of the transaction don't fit the type "+t.TransactionType)
+	}
+
+	return err
+}
+
+// validateSplits checks that the splits add up to the amount of the transaction
+func (t *Transaction) validateSplits() err.Error {
+	if len(t.Splits) == 0 {
+		return err.Error{}
+	}
+
+	var sum Money
+
+	for _, split := range t.Splits {
+		sum += split.Amount
+	}
+
+	if sum != t.Amount {
+		var err err.Error
+		err.Init("Transaction.validateSplits()", "The splits add up to "+sum.String()+" instead of "+t.Amount.String())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// writeSplits replaces the splits of the transaction in the database with t.Splits
+func (t *Transaction) writeSplits(cr *sql.Tx) err.Error {
+	if err := deleteTransactionSplits(cr, t.ID); !err.Empty() {
+		err.AddTraceback("Transaction.writeSplits()", "Error while deleting the old splits of transaction: "+fmt.Sprintf("%d", t.ID))
+		return err
+	}
+
+	for i := range t.Splits {
+		split := &t.Splits[i]
+		split.ID = 0
+		split.TransactionID = t.ID
+
+		if err := split.Create(cr); !err.Empty() {
+			err.AddTraceback("Transaction.writeSplits()", "Error while creating a split of transaction: "+fmt.Sprintf("%d", t.ID))
+			return err
+		}
+	}
+
 	return err.Error{}
 }
 
+// resolvePayee links the transaction to the payee matching it's name if it doesn't have one
+// The default category of the payee is used if the transaction has neither a category nor splits
+func (t *Transaction) resolvePayee(cr Cursor) err.Error {
+	if t.PayeeID == 0 {
+		var err err.Error
+		if t.PayeeID, err = MatchPayee(cr, t.Name); !err.Empty() {
+			err.AddTraceback("Transaction.resolvePayee()", "Error while matching the payee of: "+t.Name)
+			return err
+		}
+	}
+
+	if t.PayeeID == 0 || t.CategoryID != 0 || len(t.Splits) > 0 {
+		return err.Error{}
+	}
+
+	var categID sql.NullInt64
+	if e := cr.QueryRow("SELECT category_id FROM payees WHERE id=$1", t.PayeeID).Scan(&categID); e != nil {
+		var err err.Error
+		err.Init("Transaction.resolvePayee()", e.Error())
+		return err
+	}
+	t.CategoryID = categID.Int64
+
+	return err.Error{}
+}
+
+// checkUnreconciled returns an error if the transaction is ticked off in a reconciliation
+// Reconciled transactions are locked until they are un-reconciled
+func (t *Transaction) checkUnreconciled(cr Cursor, funcName string) err.Error {
+	reconciled, err := transactionReconciled(cr, t.ID)
+	if !err.Empty() {
+		err.AddTraceback(funcName, "Error while checking if the transaction is reconciled.")
+		return err
+	} else if reconciled {
+		err.Init(funcName, "The transaction "+t.Name+" is reconciled, un-reconcile it before changing it")
+		return err
+	}
+
+	return err
+}
+
+// checkPeriodsOpen returns an error if the transaction is dated in a closed period,
+// the stored date is checked as well so transactions can't be moved out of a closed period
+func (t *Transaction) checkPeriodsOpen(cr Cursor, funcName string) err.Error {
+	if t.ID > 0 {
+		var stored time.Time
+
+		if e := cr.QueryRow("SELECT transaction_date FROM transactions WHERE id=$1", t.ID).Scan(&stored); e != nil {
+			var err err.Error
+			err.Init(funcName, e.Error())
+			return err
+		} else if err := checkPeriodOpen(cr, stored, funcName); !err.Empty() {
+			return err
+		}
+	}
+
+	return checkPeriodOpen(cr, t.TransactionDate, funcName)
+}
+
 // Create 's a transaction with the current values of the object
-func (t *Transaction) Create(cr *sql.DB) err.Error {
+func (t *Transaction) Create(cr *sql.Tx) err.Error {
 	// Requirements for creating a transaction
 	if t.ID != 0 {
 		var err err.Error
 		err.Init("Transaction.Create()", "This object already has an id")
 		return err
-	} else if t.Amount == 0.0 {
+	} else if t.Amount == 0 {
 		var err err.Error
 		err.Init("Transaction.Create()", "The Amount of this transaction is 0")
 		return err
+	} else if err := t.validateSplits(); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "The splits of the transaction are invalid")
+		return err
+	} else if err := t.validateType(); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "The type of the transaction is invalid")
+		return err
+	} else if err := t.checkPeriodsOpen(cr, "Transaction.Create()"); !err.Empty() {
+		return err
+	}
+
+	if err := t.resolveAmounts(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "Error while resolving the amounts of the transaction")
+		return err
+	}
+
+	rules, rulesErr := GetAllRules(cr, true)
+	if !rulesErr.Empty() {
+		rulesErr.AddTraceback("Transaction.Create()", "Error while getting the rules")
+		return rulesErr
+	}
+	t.applyRules(rules)
+
+	if err := t.resolvePayee(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "Error while finding the payee of the transaction")
+		return err
 	}
 
 	var id int64
-	var categID interface{}
+	var fromAccount, toAccount, categID, payeeID, recurringID interface{}
 
 	// Initializing variables
-	query := "INSERT INTO transactions ( name, active, transaction_date, last_update, create_date, amount,"
-	query += " account_id, to_account, transaction_type, description, category_id"
-	query += ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id;"
+	query := "INSERT INTO transactions ( name, active, transaction_date, last_update, create_date, amount, to_amount,"
+	query += " account_id, to_account, transaction_type, description, category_id, payee_id, recurring_id"
+	query += ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id;"
 
 	t.CreateDate = time.Now().Local()
 	t.LastUpdate = time.Now().Local()
 
+	fromAccount = t.FromAccount
+	toAccount = t.ToAccount
 	categID = t.CategoryID
+	payeeID = t.PayeeID
+	recurringID = t.RecurringID
 
+	if t.FromAccount == 0 {
+		fromAccount = nil
+	}
+	if t.ToAccount == 0 {
+		toAccount = nil
+	}
 	if t.CategoryID == 0 {
 		categID = nil
 	}
-
-	var e error
-
-	// 4 cases of executing the query
-	if t.ToAccount == 0 && t.FromAccount > 0 {
-		e = cr.QueryRow(query,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.CreateDate,
-			t.Amount,
-			t.FromAccount,
-			nil,
-			t.TransactionType,
-			t.Description,
-			categID,
-		).Scan(&id)
-	} else if t.ToAccount > 0 && t.FromAccount > 0 {
-		e = cr.QueryRow(query,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.CreateDate,
-			t.Amount,
-			t.FromAccount,
-			t.ToAccount,
-			t.TransactionType,
-			t.Description,
-			categID,
-		).Scan(&id)
-		// TODO: This should throw an error
-	} else if t.ToAccount == 0 && t.FromAccount == 0 {
-		e = cr.QueryRow(query,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.CreateDate,
-			t.Amount,
-			nil,
-			nil,
-			t.TransactionType,
-			t.Description,
-			categID,
-		).Scan(&id)
-	} else if t.ToAccount > 0 && t.FromAccount == 0 {
-		e = cr.QueryRow(query,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.CreateDate,
-			t.Amount,
-			nil,
-			t.ToAccount,
-			t.TransactionType,
-			t.Description,
-			categID,
-		).Scan(&id)
-	}
+	if t.PayeeID == 0 {
+		payeeID = nil
+	}
+	if t.RecurringID == 0 {
+		recurringID = nil
+	}
+
+	e := cr.QueryRow(query,
+		t.Name,
+		t.Active,
+		t.TransactionDate,
+		t.LastUpdate,
+		t.CreateDate,
+		t.Amount,
+		t.ToAmount,
+		fromAccount,
+		toAccount,
+		t.TransactionType,
+		t.Description,
+		categID,
+		payeeID,
+		recurringID,
+	).Scan(&id)
 
 	if e != nil {
 		var err err.Error
@@ -172,128 +472,94 @@ func (t *Transaction) Create(cr *sql.DB) err.Error {
 	// Writing id to object
 	t.ID = id
 
-	// Book transaction into FromAccount if it's given
-	if t.FromAccount > 0 {
-		err := bookIntoAccount(cr, t.FromAccount, t, true)
-
-		if !err.Empty() {
-			err.AddTraceback("Transaction.Create()", "Error while booking into FromAccount")
-			return err
-		}
+	if err := t.writeSplits(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "Error while writing the splits")
+		return err
 	}
 
-	// Book the transaction into ToAccount if it's given
-	if t.ToAccount > 0 {
-		err := bookIntoAccount(cr, t.ToAccount, t, false)
+	if err := t.writeTags(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "Error while writing the tags")
+		return err
+	}
 
-		if !err.Empty() {
-			err.AddTraceback("Transaction.Create()", "Error while booking into ToAccount")
-			return err
-		}
+	// Post the transaction into the journal
+	if err := t.post(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Create()", "Error while posting the transaction")
+		return err
 	}
 
 	return err.Error{}
 }
 
 // Save 's the current values of the object to the database
-func (t *Transaction) Save(cr *sql.DB) err.Error {
+func (t *Transaction) Save(cr *sql.Tx) err.Error {
 	if t.ID == 0 {
 		var err err.Error
 		err.Init("Transaction.Save()", "This transaction as no ID, maybe create it first?")
 		return err
-	} else if t.Amount == 0.0 {
+	} else if t.Amount == 0 {
 		var err err.Error
 		err.Init("Transaction.Save()", "The Amount of the transaction with the id "+fmt.Sprintf("%d", t.ID)+" is 0")
 		return err
+	} else if err := t.validateSplits(); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "The splits of the transaction are invalid")
+		return err
+	} else if err := t.validateType(); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "The type of the transaction is invalid")
+		return err
 	}
 
-	// Get old data
-	var oldAmount float64
-	var accountID, toAccountID interface{}
-
-	query := "SELECT amount, account_id, to_account FROM transactions WHERE id=$1"
-
-	row := cr.QueryRow(query, t.ID)
-
-	e := row.Scan(&oldAmount, &accountID, &toAccountID)
+	if err := t.checkUnreconciled(cr, "Transaction.Save()"); !err.Empty() {
+		return err
+	} else if err := t.checkPeriodsOpen(cr, "Transaction.Save()"); !err.Empty() {
+		return err
+	}
 
-	if e != nil {
-		var err err.Error
-		err.Init("Transaction.Save()", e.Error())
+	if err := t.resolveAmounts(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "Error while resolving the amounts of the transaction")
 		return err
 	}
 
 	// Write values to database
-	query = "UPDATE transactions SET name=$2, active=$3, transaction_date=$4, last_update=$5, amount=$6, account_id=$7,"
-	query += "to_account=$8, transaction_type=$9, description=$10, category_id=$11 WHERE id=$1"
+	query := "UPDATE transactions SET name=$2, active=$3, transaction_date=$4, last_update=$5, amount=$6, to_amount=$7,"
+	query += "account_id=$8, to_account=$9, transaction_type=$10, description=$11, category_id=$12, payee_id=$13 WHERE id=$1"
 
-	var categID interface{}
+	var fromAccount, toAccount, categID, payeeID interface{}
 
+	fromAccount = t.FromAccount
+	toAccount = t.ToAccount
 	categID = t.CategoryID
+	payeeID = t.PayeeID
 
+	if t.FromAccount == 0 {
+		fromAccount = nil
+	}
+	if t.ToAccount == 0 {
+		toAccount = nil
+	}
 	if t.CategoryID == 0 {
 		categID = nil
 	}
+	if t.PayeeID == 0 {
+		payeeID = nil
+	}
 
 	// Write data to database
-	if t.ToAccount == 0 && t.FromAccount > 0 {
-		_, e = cr.Exec(query,
-			t.ID,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.Amount,
-			t.FromAccount,
-			nil,
-			t.TransactionType,
-			t.Description,
-			categID,
-		)
-	} else if t.ToAccount > 0 && t.FromAccount > 0 {
-		_, e = cr.Exec(query,
-			t.ID,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.Amount,
-			t.FromAccount,
-			t.ToAccount,
-			t.TransactionType,
-			t.Description,
-			categID,
-		)
-	} else if t.ToAccount == 0 && t.FromAccount == 0 {
-		// TODO: This case shouldn't be allowed
-		_, e = cr.Exec(query,
-			t.ID,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.Amount,
-			nil,
-			nil,
-			t.TransactionType,
-			t.Description,
-			categID,
-		)
-	} else if t.ToAccount > 0 && t.FromAccount == 0 {
-		_, e = cr.Exec(query,
-			t.ID,
-			t.Name,
-			t.Active,
-			t.TransactionDate,
-			t.LastUpdate,
-			t.Amount,
-			nil,
-			t.ToAccount,
-			t.TransactionType,
-			t.Description,
-			categID,
-		)
-	}
+	_, e := cr.Exec(query,
+		t.ID,
+		t.Name,
+		t.Active,
+		t.TransactionDate,
+		t.LastUpdate,
+		t.Amount,
+		t.ToAmount,
+		fromAccount,
+		toAccount,
+		t.TransactionType,
+		t.Description,
+		categID,
+		payeeID,
+	)
 
 	if e != nil {
 		var err err.Error
@@ -301,125 +567,46 @@ func (t *Transaction) Save(cr *sql.DB) err.Error {
 		return err
 	}
 
-	/*
-		Change balance on accounts
-	*/
-	temp := Transaction{
-		Name:   t.Name,
-		Amount: oldAmount,
-	}
-
-	// The origin account changed
-	if accountID != t.FromAccount {
-		// Remove booking from old account
-		// Amount needs to be inverted
-		// Make sure the old amount gets removed from the old account
-		if accountID != nil {
-			err := bookIntoAccount(cr, accountID.(int64), &temp, false)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while redoing booking from old origin account: "+accountID.(string))
-				return err
-			}
-		}
-
-		// Book the amount into the new account
-		if t.FromAccount > 0 {
-			err := bookIntoAccount(cr, t.FromAccount, t, true)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while booking to new origin account: "+fmt.Sprintf("%d", t.FromAccount))
-				return err
-			}
-		}
+	if err := t.writeSplits(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "Error while writing the splits")
+		return err
 	}
 
-	// The destination account changed
-	if toAccountID != t.ToAccount {
-		// Remove booking from old destination account
-		// Make sure the old amount is used
-		if toAccountID != nil {
-			err := bookIntoAccount(cr, toAccountID.(int64), &temp, true)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while removing transaction from the old receiving account: "+toAccountID.(string))
-				return err
-			}
-		}
-
-		// Book into new account
-		if t.ToAccount > 0 {
-			err := bookIntoAccount(cr, t.ToAccount, t, false)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while booking transaction into new receiving account: "+fmt.Sprintf("%d", t.ToAccount))
-				return err
-			}
-		}
+	if err := t.writeTags(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "Error while writing the tags")
+		return err
 	}
 
-	// The amount of the transaction changed
-	if t.Amount != oldAmount {
-		diff := t.Amount - oldAmount
-
-		temp.Amount = diff
-		// The origin did not change
-		// So book the difference into the origin account
-		// If the origin has changed we've already booked into the accounts
-		if accountID == t.FromAccount {
-			// Calculate difference and book the difference into the origin account
-			diff := t.Amount - oldAmount
-
-			temp.Amount = diff
-
-			err := bookIntoAccount(cr, t.FromAccount, &temp, true)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while booking difference into origin account: "+fmt.Sprintf("%d", t.FromAccount))
-				return err
-			}
-		}
-
-		// The destination did not change
-		if toAccountID == t.ToAccount {
-
-			err := bookIntoAccount(cr, t.ToAccount, &temp, false)
-
-			if !err.Empty() {
-				err.AddTraceback("Transaction.Save()", "Error while booking difference into destination account: "+fmt.Sprintf("%d", t.ToAccount))
-				return err
-			}
-		}
+	// Replace the journal entry with the current values
+	if err := t.post(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Save()", "Error while posting the transaction")
+		return err
 	}
 
 	return err.Error{}
 }
 
 // Delete 's the transtaction
-func (t *Transaction) Delete(cr *sql.DB) err.Error {
+func (t *Transaction) Delete(cr *sql.Tx) err.Error {
 	if t.ID == 0 {
 		var err err.Error
 		err.Init("Transaction.Delete()", "The transaction you want to delete does not have an id")
 		return err
 	}
 
-	if t.FromAccount > 0 {
-		err := bookIntoAccount(cr, t.FromAccount, t, false)
+	if err := t.checkUnreconciled(cr, "Transaction.Delete()"); !err.Empty() {
+		return err
+	} else if err := t.checkPeriodsOpen(cr, "Transaction.Delete()"); !err.Empty() {
+		return err
+	}
 
-		if !err.Empty() {
-			err.AddTraceback("Transaction.Delete()", "Redo booking from origin account: "+fmt.Sprintf("%d", t.FromAccount))
-			return err
-		}
+	if err := checkNoAttachments(cr, AuditTransaction, t.ID, "Transaction.Delete()"); !err.Empty() {
+		return err
 	}
-	if t.ToAccount > 0 {
-		err := bookIntoAccount(cr, t.ToAccount, t, true)
 
-		if !err.Empty() {
-			// TODO: If FromAccount was bigger than 0, it's already booked at this time
-			// Make sure the booking is reverted again.
-			err.AddTraceback("Transaction.Delete()", "Redo booking from recipient account: "+fmt.Sprintf("%d", t.FromAccount))
-			return err
-		}
+	if err := t.unpost(cr); !err.Empty() {
+		err.AddTraceback("Transaction.Delete()", "Error while removing the transaction from the journal")
+		return err
 	}
 
 	query := "DELETE FROM transactions WHERE id=$1"
@@ -437,7 +624,7 @@ func (t *Transaction) Delete(cr *sql.DB) err.Error {
 
 // ComputeFields computes the fields which are not directly received
 // from the database
-func (t *Transaction) computeFields(cr *sql.DB) {
+func (t *Transaction) computeFields(cr Cursor) {
 	// Compute: FromAccountName
 	if t.FromAccount != 0 {
 		fromAccount, err := FindAccountByID(cr, t.FromAccount)
@@ -448,6 +635,7 @@ func (t *Transaction) computeFields(cr *sql.DB) {
 		}
 
 		t.FromAccountName = fromAccount.Name
+		t.FromCurrency = fromAccount.Currency
 	} else {
 		t.FromAccountName = "External Account"
 	}
@@ -462,10 +650,19 @@ func (t *Transaction) computeFields(cr *sql.DB) {
 		}
 
 		t.ToAccountName = toAccount.Name
+		t.ToCurrency = toAccount.Currency
 	} else {
 		t.ToAccountName = "External Account"
 	}
 
+	// Compute: FromCurrency, ToCurrency
+	// The external account uses the currency of the other side
+	if t.FromCurrency == "" {
+		t.FromCurrency = t.ToCurrency
+	} else if t.ToCurrency == "" {
+		t.ToCurrency = t.FromCurrency
+	}
+
 	// Compute: TransactionDateStr
 	t.TransactionDateStr = t.TransactionDate.Format("02.01.2006 - 15:04")
 
@@ -477,16 +674,45 @@ func (t *Transaction) computeFields(cr *sql.DB) {
 			log.Println("[WARN]", err)
 		}
 	}
+
+	// Compute: PayeeName
+	if t.PayeeID > 0 {
+		if e := cr.QueryRow("SELECT name FROM payees WHERE id=$1", t.PayeeID).Scan(&t.PayeeName); e != nil {
+			var err err.Error
+			err.Init("Transaction.computeFields()", e.Error())
+			log.Println("[WARN]", err)
+		}
+	}
+
+	// Compute: Reconciled
+	var err err.Error
+	if t.Reconciled, err = transactionReconciled(cr, t.ID); !err.Empty() {
+		err.AddTraceback("Transaction.computeFields()", "Error while checking if transaction is reconciled: "+fmt.Sprintf("%d", t.ID))
+		log.Println("[WARN]", err)
+	}
+
+	// Compute: Splits
+	if t.Splits, err = GetSplitsByTransaction(cr, t.ID); !err.Empty() {
+		err.AddTraceback("Transaction.computeFields()", "Error while getting the splits of transaction: "+fmt.Sprintf("%d", t.ID))
+		log.Println("[WARN]", err)
+	}
+
+	// Compute: Tags
+	if t.Tags, err = GetTagsByTransaction(cr, t.ID); !err.Empty() {
+		err.AddTraceback("Transaction.computeFields()", "Error while getting the tags of transaction: "+fmt.Sprintf("%d", t.ID))
+		log.Println("[WARN]", err)
+	}
 }
 
 // FindByID finds a transaction with it's id
-func (t *Transaction) FindByID(cr *sql.DB, transactionID int64) err.Error {
+func (t *Transaction) FindByID(cr Cursor, transactionID int64) err.Error {
 	query := "SELECT id, name, active, transaction_date, last_update, create_date, "
-	query += "amount, account_id, to_account, transaction_type, description, category_id "
+	query += "amount, to_amount, account_id, to_account, transaction_type, description, category_id, payee_id, recurring_id, "
+	query += "COALESCE(origin_booked AND dest_booked, false) "
 	query += "FROM transactions WHERE id=$1 "
 	query += "ORDER BY transaction_date"
 
-	var fromAccountID, toAccountID, categID interface{}
+	var fromAccountID, toAccountID, categID, payeeID, recurringID interface{}
 
 	e := cr.QueryRow(query, transactionID).Scan(
 		&t.ID,
@@ -496,11 +722,15 @@ func (t *Transaction) FindByID(cr *sql.DB, transactionID int64) err.Error {
 		&t.LastUpdate,
 		&t.CreateDate,
 		&t.Amount,
+		&t.ToAmount,
 		&fromAccountID,
 		&toAccountID,
 		&t.TransactionType,
 		&t.Description,
 		&categID,
+		&payeeID,
+		&recurringID,
+		&t.Booked,
 	)
 	if e != nil {
 		var err err.Error
@@ -520,13 +750,21 @@ func (t *Transaction) FindByID(cr *sql.DB, transactionID int64) err.Error {
 		t.CategoryID = categID.(int64)
 	}
 
+	if payeeID != nil {
+		t.PayeeID = payeeID.(int64)
+	}
+
+	if recurringID != nil {
+		t.RecurringID = recurringID.(int64)
+	}
+
 	t.computeFields(cr)
 
 	return err.Error{}
 }
 
 // FindTransactionByID is similar to FindByID but returns the transaction
-func FindTransactionByID(cr *sql.DB, transactionID int64) (Transaction, err.Error) {
+func FindTransactionByID(cr Cursor, transactionID int64) (Transaction, err.Error) {
 	t := EmptyTransaction()
 
 	e := t.FindByID(cr, transactionID)
@@ -540,7 +778,7 @@ func FindTransactionByID(cr *sql.DB, transactionID int64) (Transaction, err.Erro
 }
 
 // GetAllTransactions does that what you expect
-func GetAllTransactions(cr *sql.DB) ([]Transaction, err.Error) {
+func GetAllTransactions(cr Cursor) ([]Transaction, err.Error) {
 	var transactions []Transaction
 	query := "SELECT id FROM transactions"
 
@@ -576,7 +814,7 @@ func GetAllTransactions(cr *sql.DB) ([]Transaction, err.Error) {
 
 // GetLatestTransactions returns a limited number of the latest transactions
 // latest transactions are sorted by their transaction_date
-func GetLatestTransactions(cr *sql.DB, amount int) ([]Transaction, err.Error) {
+func GetLatestTransactions(cr Cursor, amount int) ([]Transaction, err.Error) {
 	var transactions []Transaction
 	query := "SELECT id FROM transactions ORDER BY transaction_date DESC"
 
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nitohu/err"
+)
+
+// TransactionSplit is a part of a transaction with it's own category
+// The amounts of all splits of a transaction add up to the amount of the transaction
+type TransactionSplit struct {
+	ID            int64
+	TransactionID int64
+	Amount        Money
+	CategoryID    int64
+	Note          string
+
+	// Computed fields
+	Category Category
+}
+
+// EmptyTransactionSplit returns an empty split
+func EmptyTransactionSplit() TransactionSplit {
+	s := TransactionSplit{
+		ID:            0,
+		TransactionID: 0,
+		Amount:        0,
+		CategoryID:    0,
+		Note:          "",
+	}
+
+	return s
+}
+
+// Create 's the split in the database
+func (s *TransactionSplit) Create(cr Cursor) err.Error {
+	if s.ID != 0 {
+		var err err.Error
+		err.Init("TransactionSplit.Create()", "This object already has an id")
+		return err
+	} else if s.TransactionID == 0 {
+		var err err.Error
+		err.Init("TransactionSplit.Create()", "The split does not belong to a transaction")
+		return err
+	}
+
+	var categID interface{}
+
+	categID = s.CategoryID
+
+	if s.CategoryID == 0 {
+		categID = nil
+	}
+
+	query := "INSERT INTO transaction_splits (transaction_id, amount, category_id, note) "
+	query += "VALUES ($1, $2, $3, $4) RETURNING id;"
+
+	if e := cr.QueryRow(query, s.TransactionID, s.Amount, categID, s.Note).Scan(&s.ID); e != nil {
+		var err err.Error
+		err.Init("TransactionSplit.Create()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+func (s *TransactionSplit) computeFields(cr Cursor) {
+	// Compute: Category
+	if s.CategoryID > 0 {
+		var err err.Error
+		if s.Category, err = FindCategoryByID(cr, s.CategoryID); !err.Empty() {
+			err.AddTraceback("TransactionSplit.computeFields()", "Error while finding category by ID: "+fmt.Sprintf("%d", s.CategoryID))
+			log.Println("[WARN]", err)
+		}
+	}
+}
+
+// deleteTransactionSplits deletes all splits of the transaction with the given id
+func deleteTransactionSplits(cr Cursor, transactionID int64) err.Error {
+	query := "DELETE FROM transaction_splits WHERE transaction_id=$1"
+
+	if _, e := cr.Exec(query, transactionID); e != nil {
+		var err err.Error
+		err.Init("deleteTransactionSplits()", e.Error())
+		return err
+	}
+
+	return err.Error{}
+}
+
+// GetSplitsByTransaction returns the splits of the transaction in the order they were entered
+func GetSplitsByTransaction(cr Cursor, transactionID int64) ([]TransactionSplit, err.Error) {
+	var splits []TransactionSplit
+
+	query := "SELECT id, transaction_id, amount, category_id, note FROM transaction_splits "
+	query += "WHERE transaction_id=$1 ORDER BY id"
+
+	rows, e := cr.Query(query, transactionID)
+	if e != nil {
+		var err err.Error
+		err.Init("GetSplitsByTransaction()", e.Error())
+		return nil, err
+	}
+
+	for rows.Next() {
+		s := EmptyTransactionSplit()
+		var categID interface{}
+
+		if e = rows.Scan(&s.ID, &s.TransactionID, &s.Amount, &categID, &s.Note); e != nil {
+			log.Println("[INFO] GetSplitsByTransaction(): Skipping record")
+			log.Printf("[WARN] GetSplitsByTransaction(): %s\n", e)
+			continue
+		}
+
+		if categID != nil {
+			s.CategoryID = categID.(int64)
+		}
+
+		splits = append(splits, s)
+	}
+	rows.Close()
+
+	// The rows have to be closed before querying the categories inside of a database transaction
+	for i := range splits {
+		splits[i].computeFields(cr)
+	}
+
+	return splits, err.Error{}
+}
@@ -1,19 +1,62 @@
 BEGIN;
 
+-- Paydays of an income, counted from anchor_date with the frequency weekly, biweekly, monthly or last_business_day
+-- weekend_rule moves paydays on a weekend (keep, before, after), next_date is shifted by the application
+-- accounts and groups without a schedule use the default one
+CREATE TABLE income_schedules (
+    id serial,
+    primary key(id),
+    name text,
+    active boolean DEFAULT true,
+    frequency text CHECK (frequency IN ('weekly', 'biweekly', 'monthly', 'last_business_day')),
+    anchor_date timestamp,
+    weekend_rule text DEFAULT 'keep' CHECK (weekend_rule IN ('keep', 'before', 'after')),
+    is_default boolean DEFAULT false,
+    next_date timestamp,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE income_schedules OWNER TO "accounting";
+
+-- Groups of accounts on the accounts page and the dashboard, ordered by sequence
+-- only the groups with include_in_net_worth count in the net worth
+CREATE TABLE account_groups (
+    id serial,
+    primary key(id),
+    name text,
+    sequence int DEFAULT 10,
+    include_in_net_worth boolean DEFAULT true,
+    income_schedule_id int references income_schedules(id) ON DELETE SET NULL,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE account_groups OWNER TO "accounting";
+
 CREATE TABLE accounts (
     id serial,
     primary key(id),
     name text,
     active boolean,
-    balance float,
-    balance_forecast float,
     iban text,
     bank_code text,
     account_nr text,
     bank_name text,
-    bank_type text,
+    -- loan and credit accounts are liabilities, their balance is negative
+    -- the balance of investment accounts includes the market value of their holdings
+    bank_type text CHECK (bank_type IN ('bank', 'online', 'loan', 'credit', 'investment')),
+    -- ISO 4217 code, e.g. EUR
+    currency text,
     create_date timestamp,
-    last_update timestamp
+    last_update timestamp,
+    -- Terms of loans, interest_rate is yearly in percent
+    principal numeric(15,2) DEFAULT 0,
+    interest_rate numeric(6,3) DEFAULT 0,
+    term_months int DEFAULT 0,
+    first_payment_date timestamp,
+    -- accounts without a group are listed as other accounts
+    group_id int references account_groups(id) ON DELETE SET NULL,
+    -- paydays of the account, the ones of the group or the default schedule are used without
+    income_schedule_id int references income_schedules(id) ON DELETE SET NULL
 );
 ALTER TABLE accounts OWNER TO "accounting";
 
@@ -24,7 +67,9 @@ CREATE TABLE categories (
     name text,
     create_date timestamp,
     last_update timestamp,
-    hex text
+    hex text,
+    -- NULL for top-level categories, subcategories become top-level when their parent is deleted
+    parent_id int references categories(id) ON DELETE SET NULL
 );
 ALTER TABLE categories OWNER TO "accounting";
 
@@ -50,10 +95,11 @@ CREATE TABLE settings (
     password text,
     email text,
     last_update timestamp,
-    salary_date timestamp,
     calc_interval int,
     calc_uom text,
     currency text,
+    -- ISO 4217 code statistics are reported in
+    base_currency text,
     session_key text,
     account_id int references accounts(id),
     api_key int references api(id)
@@ -79,6 +125,60 @@ CREATE TABLE statistics (
 );
 ALTER TABLE statistics OWNER TO "accounting";
 
+-- Recurring transactions (standing orders)
+-- The scheduler creates a transaction on every due date, next_date
+-- is the next due date which was not booked yet
+CREATE TABLE recurring_transactions (
+    id serial,
+    primary key(id),
+    name text,
+    description text,
+    active boolean,
+    amount numeric(15,2),
+    to_amount numeric(15,2),
+    account_id int references accounts(id),
+    to_account int references accounts(id),
+    category_id int references categories(id),
+    -- Empty to detect the type of the booked transactions from the accounts
+    transaction_type text DEFAULT '' CHECK (transaction_type IN ('', 'income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance')),
+    -- monthly, weekly, yearly or last_business_day
+    schedule text,
+    -- Day of the month for monthly schedules
+    day int,
+    start_date timestamp,
+    end_date timestamp,
+    next_date timestamp,
+    last_run timestamp,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE recurring_transactions OWNER TO "accounting";
+
+-- Counterparties of transactions, a transaction is linked to the payee whose name is
+-- it's reference or one of whose aliases is part of it
+-- category_id is used for linked transactions which were created without a category
+-- The bank fields are the same as the ones of the accounts, bank_code holds the BIC
+CREATE TABLE payees (
+    id serial,
+    primary key(id),
+    name text,
+    category_id int references categories(id) ON DELETE SET NULL,
+    iban text,
+    bank_code text,
+    bank_name text,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE payees OWNER TO "accounting";
+
+CREATE TABLE payee_aliases (
+    payee_id int references payees(id) ON DELETE CASCADE,
+    alias text,
+    primary key(payee_id, alias)
+);
+ALTER TABLE payee_aliases OWNER TO "accounting";
+
 CREATE TABLE transactions (
     id serial,
     primary key(id),
@@ -87,15 +187,477 @@ CREATE TABLE transactions (
     transaction_date TIMESTAMP,
     last_update TIMESTAMP,
     create_date TIMESTAMP,
-    amount float,
+    amount numeric(15,2),
+    -- Amount received in the currency of to_account, equals amount
+    -- if both accounts have the same currency
+    to_amount numeric(15,2),
     account_id int references accounts(id),
     to_account int references accounts(id),
-    transaction_type text,
+    -- income and refund have no account_id, expense and fee no to_account, transfer has both
+    -- and opening_balance one of them
+    transaction_type text NOT NULL CHECK (transaction_type IN ('income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance')),
     dest_booked boolean,
     origin_booked boolean,
     description text,
-    category_id int references categories(id)
+    category_id int references categories(id),
+    payee_id int references payees(id) ON DELETE SET NULL,
+    -- Recurring transaction this transaction was booked from
+    recurring_id int references recurring_transactions(id) ON DELETE SET NULL
 );
 ALTER TABLE transactions OWNER TO "accounting";
 
+-- Split lines of a transaction, each with it's own category
+-- The amounts add up to the amount of the transaction
+CREATE TABLE transaction_splits (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    amount numeric(15,2),
+    category_id int references categories(id),
+    note text
+);
+ALTER TABLE transaction_splits OWNER TO "accounting";
+
+-- Double-entry journal
+-- Every transaction writes one entry with balanced debit/credit lines,
+-- entries without a transaction are the cash of trades
+CREATE TABLE journal_entries (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    name text,
+    entry_date timestamp,
+    create_date timestamp
+);
+ALTER TABLE journal_entries OWNER TO "accounting";
+
+-- Reconciliations of accounts against bank statements
+-- state is open while transactions are ticked off and done once the
+-- ticked transactions match the closing balance of the statement
+CREATE TABLE reconciliations (
+    id serial,
+    primary key(id),
+    account_id int references accounts(id) ON DELETE CASCADE,
+    statement_date timestamp,
+    closing_balance numeric(15,2),
+    state text,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE reconciliations OWNER TO "accounting";
+
+CREATE TABLE journal_lines (
+    id serial,
+    primary key(id),
+    entry_id int references journal_entries(id) ON DELETE CASCADE,
+    -- NULL: external account
+    account_id int references accounts(id),
+    debit numeric(15,2),
+    credit numeric(15,2),
+    currency text,
+    booked boolean,
+    -- Reconciliation the line was ticked off in, the transaction is locked while set
+    reconciliation_id int references reconciliations(id) ON DELETE SET NULL
+);
+ALTER TABLE journal_lines OWNER TO "accounting";
+
+-- Securities like stocks, funds or bonds, identified by their symbol (e.g. ticker or ISIN)
+-- The prices of a security are in it's currency, it can only be traded in accounts of that currency
+CREATE TABLE securities (
+    id serial,
+    primary key(id),
+    name text,
+    symbol text UNIQUE,
+    currency text,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE securities OWNER TO "accounting";
+
+-- Prices of the securities per day, imported from CSV files
+CREATE TABLE security_prices (
+    security_id int references securities(id) ON DELETE CASCADE,
+    price_date date,
+    price numeric(15,2),
+    primary key(security_id, price_date)
+);
+ALTER TABLE security_prices OWNER TO "accounting";
+
+-- Buys, sells and dividends of securities in investment accounts
+-- amount is the cash which is paid (buy) or received (sell, dividend) after the fees,
+-- cost_basis is the cost of the bought quantity or the average cost of the sold quantity
+-- The cash is posted in the journal entry entry_id, which has no transaction
+CREATE TABLE trades (
+    id serial,
+    primary key(id),
+    account_id int references accounts(id) ON DELETE CASCADE,
+    security_id int references securities(id),
+    trade_type text CHECK (trade_type IN ('buy', 'sell', 'dividend')),
+    trade_date timestamp,
+    quantity numeric(18,6) DEFAULT 0,
+    price numeric(15,2) DEFAULT 0,
+    fees numeric(15,2) DEFAULT 0,
+    amount numeric(15,2),
+    cost_basis numeric(15,2) DEFAULT 0,
+    entry_id int references journal_entries(id) ON DELETE SET NULL,
+    create_date timestamp
+);
+ALTER TABLE trades OWNER TO "accounting";
+
+-- Latest price of every security
+CREATE VIEW security_latest_prices AS
+    SELECT DISTINCT ON (security_id) security_id, price_date, price
+    FROM security_prices
+    ORDER BY security_id, price_date DESC;
+ALTER VIEW security_latest_prices OWNER TO "accounting";
+
+-- Quantity, cost basis and market value of the securities per account
+-- Securities without a price are valued at their cost basis
+CREATE VIEW holdings AS
+    SELECT
+        h.account_id,
+        h.security_id,
+        h.quantity,
+        h.cost_basis,
+        round(COALESCE(h.quantity * p.price, h.cost_basis), 2) AS market_value
+    FROM (
+        SELECT
+            account_id,
+            security_id,
+            SUM(CASE trade_type WHEN 'buy' THEN quantity WHEN 'sell' THEN -quantity ELSE 0 END) AS quantity,
+            SUM(CASE trade_type WHEN 'buy' THEN cost_basis WHEN 'sell' THEN -cost_basis ELSE 0 END) AS cost_basis
+        FROM trades
+        GROUP BY account_id, security_id
+    ) AS h
+    LEFT JOIN security_latest_prices AS p ON p.security_id=h.security_id
+    WHERE h.quantity <> 0;
+ALTER VIEW holdings OWNER TO "accounting";
+
+-- Balances of the accounts computed from the journal and the market value of their holdings
+-- balance only contains booked lines, balance_forecast all of them, the market value is part of both
+CREATE VIEW account_balances AS
+    SELECT
+        a.id AS account_id,
+        a.currency,
+        COALESCE(j.balance, 0) + COALESCE(h.market_value, 0) AS balance,
+        COALESCE(j.balance_forecast, 0) + COALESCE(h.market_value, 0) AS balance_forecast,
+        COALESCE(h.market_value, 0) AS market_value
+    FROM accounts AS a
+    LEFT JOIN (
+        SELECT
+            account_id,
+            SUM(debit - credit) FILTER (WHERE booked) AS balance,
+            SUM(debit - credit) AS balance_forecast
+        FROM journal_lines
+        GROUP BY account_id
+    ) AS j ON j.account_id=a.id
+    LEFT JOIN (
+        SELECT account_id, SUM(market_value) AS market_value FROM holdings GROUP BY account_id
+    ) AS h ON h.account_id=a.id;
+ALTER VIEW account_balances OWNER TO "accounting";
+
+-- Budgets per category, amount is in the base currency
+-- period is monthly or salary_cycle (from one salary date of the settings to the next one),
+-- with rollover the unspent money of the periods since start_date is added to the current one
+CREATE TABLE budgets (
+    id serial,
+    primary key(id),
+    category_id int references categories(id) ON DELETE CASCADE,
+    amount numeric(15,2),
+    period text,
+    rollover boolean DEFAULT false,
+    start_date timestamp,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE budgets OWNER TO "accounting";
+
+-- Savings goals, the balances of the linked accounts are converted into the currency of the goal
+CREATE TABLE goals (
+    id serial,
+    primary key(id),
+    name text,
+    description text,
+    target_amount numeric(15,2),
+    currency text,
+    deadline timestamp,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE goals OWNER TO "accounting";
+
+CREATE TABLE goal_accounts (
+    goal_id int references goals(id) ON DELETE CASCADE,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    primary key(goal_id, account_id)
+);
+ALTER TABLE goal_accounts OWNER TO "accounting";
+
+-- Free-form tags of transactions, a transaction can have several tags
+CREATE TABLE tags (
+    id serial,
+    primary key(id),
+    name text UNIQUE NOT NULL,
+    create_date timestamp
+);
+ALTER TABLE tags OWNER TO "accounting";
+
+CREATE TABLE transaction_tags (
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    tag_id int references tags(id) ON DELETE CASCADE,
+    primary key(transaction_id, tag_id)
+);
+ALTER TABLE transaction_tags OWNER TO "accounting";
+
+-- Files like receipts, invoices or contracts of a transaction or an account
+-- The files are stored under <app_dir>/attachments named by their SHA-256 checksum,
+-- records with attachments can't be deleted until the attachments are deleted
+CREATE TABLE attachments (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id),
+    account_id int references accounts(id),
+    file_name text,
+    content_type text,
+    size bigint,
+    checksum text,
+    create_date timestamp,
+    CHECK ((transaction_id IS NULL) <> (account_id IS NULL))
+);
+ALTER TABLE attachments OWNER TO "accounting";
+CREATE INDEX attachments_checksum ON attachments (checksum);
+
+-- Rules categorise and tag new transactions which match all of their conditions,
+-- empty or 0 conditions are not checked, account_id matches the origin or the recipient account
+-- The rules are applied in the order of their sequence
+CREATE TABLE rules (
+    id serial,
+    primary key(id),
+    name text,
+    sequence int DEFAULT 10,
+    name_contains text DEFAULT '',
+    min_amount numeric(15,2) DEFAULT 0,
+    max_amount numeric(15,2) DEFAULT 0,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    category_id int references categories(id) ON DELETE SET NULL,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE rules OWNER TO "accounting";
+
+CREATE TABLE rule_tags (
+    rule_id int references rules(id) ON DELETE CASCADE,
+    tag text,
+    primary key(rule_id, tag)
+);
+ALTER TABLE rule_tags OWNER TO "accounting";
+
+-- Column mappings of the CSV statements of a bank for the transaction import
+-- The columns are counted from 1, columns which are 0 are not imported, date_format is a Go layout like 02.01.2006
+-- account_id is the account the statements are booked into unless another one is chosen
+CREATE TABLE import_mappings (
+    id serial,
+    primary key(id),
+    name text,
+    delimiter text DEFAULT ';',
+    skip_lines int DEFAULT 1,
+    date_format text DEFAULT '02.01.2006',
+    decimal_separator text DEFAULT ',' CHECK (decimal_separator IN (',', '.')),
+    date_column int DEFAULT 0,
+    amount_column int DEFAULT 0,
+    name_column int DEFAULT 0,
+    counterparty_column int DEFAULT 0,
+    iban_column int DEFAULT 0,
+    description_column int DEFAULT 0,
+    account_id int references accounts(id) ON DELETE SET NULL,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE import_mappings OWNER TO "accounting";
+
+-- Closed months and years, transactions and trades dated between start_date and end_date can't be changed
+-- Reopening a period deletes it, both is recorded in the audit log
+CREATE TABLE periods (
+    id serial,
+    primary key(id),
+    name text,
+    period_type text CHECK (period_type IN ('month', 'year')),
+    start_date date,
+    end_date date,
+    close_date timestamp,
+    -- actor of the audit log who closed the period
+    closed_by text
+);
+ALTER TABLE periods OWNER TO "accounting";
+
+-- Balances of the accounts at the end of a closed period, taken from the journal when it was closed
+CREATE TABLE period_balances (
+    period_id int references periods(id) ON DELETE CASCADE,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    currency text,
+    balance numeric(15,2),
+    primary key(period_id, account_id)
+);
+ALTER TABLE period_balances OWNER TO "accounting";
+
+-- Changes of accounts, transactions, categories, payees, rules, import mappings, securities, trades, periods, statistics, settings and api keys
+-- actor is "web:<name>" for the web interface, "api:<prefix>" for api keys and "scheduler" for background jobs
+-- before is NULL for created records, after for deleted ones
+CREATE TABLE audit_log (
+    id serial,
+    primary key(id),
+    model text NOT NULL,
+    record_id int NOT NULL,
+    action text NOT NULL,
+    actor text,
+    change_date timestamp,
+    before jsonb,
+    after jsonb
+);
+ALTER TABLE audit_log OWNER TO "accounting";
+CREATE INDEX audit_log_record ON audit_log (model, record_id);
+
+-- Dated exchange rates, 1 from_currency = rate to_currency
+CREATE TABLE exchange_rates (
+    id serial,
+    primary key(id),
+    from_currency text,
+    to_currency text,
+    rate numeric(18,8),
+    rate_date date,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE exchange_rates OWNER TO "accounting";
+
+-- Currency statistics are reported in
+-- Can be overwritten per transaction with set_config('accounting.base_currency', 'USD', true)
+CREATE FUNCTION base_currency() RETURNS text AS $$
+    SELECT COALESCE(
+        NULLIF(current_setting('accounting.base_currency', true), ''),
+        (SELECT base_currency FROM settings LIMIT 1)
+    );
+$$ LANGUAGE sql STABLE;
+ALTER FUNCTION base_currency() OWNER TO "accounting";
+
+-- Rate for converting from_cur into to_cur at the given date
+-- Uses the latest rate dated on or before the date, the opposite pair is used inverted
+CREATE FUNCTION exchange_rate(from_cur text, to_cur text, at date) RETURNS numeric AS $$
+DECLARE
+    r numeric;
+BEGIN
+    IF from_cur = to_cur THEN
+        RETURN 1;
+    END IF;
+
+    SELECT rate INTO r FROM exchange_rates
+        WHERE from_currency=from_cur AND to_currency=to_cur AND rate_date <= at
+        ORDER BY rate_date DESC LIMIT 1;
+    IF r IS NOT NULL THEN
+        RETURN r;
+    END IF;
+
+    SELECT 1 / rate INTO r FROM exchange_rates
+        WHERE from_currency=to_cur AND to_currency=from_cur AND rate_date <= at
+        ORDER BY rate_date DESC LIMIT 1;
+    IF r IS NOT NULL THEN
+        RETURN r;
+    END IF;
+
+    RAISE EXCEPTION 'No exchange rate from % to % on %', from_cur, to_cur, at;
+END;
+$$ LANGUAGE plpgsql STABLE;
+ALTER FUNCTION exchange_rate(text, text, date) OWNER TO "accounting";
+
+-- Amount which counts as spent for the type of a transaction, refunds reduce the spending
+-- Income, transfers and opening balances are not spent
+CREATE FUNCTION spent_amount(transaction_type text, amount numeric) RETURNS numeric AS $$
+    SELECT CASE
+        WHEN transaction_type IN ('expense', 'fee') THEN amount
+        WHEN transaction_type = 'refund' THEN -amount
+        ELSE 0
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+ALTER FUNCTION spent_amount(text, numeric) OWNER TO "accounting";
+
+-- Next payday of an account: from it's own income schedule, the one of it's group or the default schedule
+CREATE FUNCTION next_payday(account int) RETURNS timestamp AS $$
+    SELECT COALESCE(
+        (SELECT s.next_date FROM accounts AS a
+            JOIN income_schedules AS s ON s.id=a.income_schedule_id AND s.active
+            WHERE a.id=account),
+        (SELECT s.next_date FROM accounts AS a
+            JOIN account_groups AS g ON g.id=a.group_id
+            JOIN income_schedules AS s ON s.id=g.income_schedule_id AND s.active
+            WHERE a.id=account),
+        (SELECT next_date FROM income_schedules WHERE is_default AND active LIMIT 1)
+    );
+$$ LANGUAGE sql STABLE;
+ALTER FUNCTION next_payday(int) OWNER TO "accounting";
+
+-- Amounts of the transactions converted into the base currency
+-- amount is in the currency of the origin account, or of the recipient for incoming money
+CREATE VIEW transaction_amounts AS
+    SELECT
+        t.id AS transaction_id,
+        COALESCE(fa.currency, ta.currency, base_currency()) AS currency,
+        round(t.amount * exchange_rate(
+            COALESCE(fa.currency, ta.currency, base_currency()), base_currency(), t.transaction_date::date
+        ), 2) AS base_amount
+    FROM transactions AS t
+    LEFT JOIN accounts AS fa ON fa.id=t.account_id
+    LEFT JOIN accounts AS ta ON ta.id=t.to_account;
+ALTER VIEW transaction_amounts OWNER TO "accounting";
+
+-- Amounts per category, split transactions count with their split lines,
+-- all others with the category of the transaction
+CREATE VIEW transaction_category_amounts AS
+    SELECT
+        s.transaction_id,
+        s.category_id,
+        s.amount,
+        round(s.amount * exchange_rate(ta.currency, base_currency(), t.transaction_date::date), 2) AS base_amount
+    FROM transaction_splits AS s
+    JOIN transactions AS t ON t.id=s.transaction_id
+    JOIN transaction_amounts AS ta ON ta.transaction_id=s.transaction_id
+    UNION ALL
+    SELECT
+        t.id,
+        t.category_id,
+        t.amount,
+        ta.base_amount
+    FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.category_id IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM transaction_splits AS s WHERE s.transaction_id=t.id);
+ALTER VIEW transaction_category_amounts OWNER TO "accounting";
+
+-- Amounts per tag, a transaction with several tags counts fully in each of them
+CREATE VIEW transaction_tag_amounts AS
+    SELECT
+        tg.name AS tag,
+        t.id AS transaction_id,
+        t.amount,
+        ta.base_amount
+    FROM transaction_tags AS tt
+    JOIN tags AS tg ON tg.id=tt.tag_id
+    JOIN transactions AS t ON t.id=tt.transaction_id
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id;
+ALTER VIEW transaction_tag_amounts OWNER TO "accounting";
+
+-- Every category with itself and all of it's subcategories, depth is 0 for the category itself
+CREATE VIEW category_tree AS
+    WITH RECURSIVE tree (ancestor_id, category_id, depth) AS (
+        SELECT id, id, 0 FROM categories
+        UNION ALL
+        SELECT tree.ancestor_id, c.id, tree.depth + 1
+        FROM tree
+        JOIN categories AS c ON c.parent_id=tree.category_id
+    )
+    SELECT ancestor_id, category_id, depth FROM tree;
+ALTER VIEW category_tree OWNER TO "accounting";
+
 COMMIT;
\ No newline at end of file
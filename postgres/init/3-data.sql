@@ -1,7 +1,7 @@
 BEGIN;
 
 -- Settings
-INSERT INTO settings (name, password, email, last_update, calc_interval, calc_uom, currency, session_key, salary_date) VALUES (
+INSERT INTO settings (name, password, email, last_update, calc_interval, calc_uom, currency, base_currency, session_key) VALUES (
     'your name',
     '8C6976E5B5410415BDE908BD4DEE15DFB167A9C873FC4BB8A81F6F2AB448A918',
     'admin',
@@ -9,7 +9,20 @@ INSERT INTO settings (name, password, email, last_update, calc_interval, calc_uo
     30,
     'minutes',
     '€',
-    '',
+    'EUR',
+    ''
+);
+
+-- Default income schedule, paid on the first of every month
+INSERT INTO income_schedules (name, active, frequency, anchor_date, weekend_rule, is_default, next_date, create_date, last_update) VALUES (
+    'Salary',
+    't',
+    'monthly',
+    date_trunc('month', NOW()),
+    'keep',
+    't',
+    date_trunc('month', NOW()) + interval '1 month',
+    NOW(),
     NOW()
 );
 
@@ -20,16 +33,37 @@ INSERT INTO settings (name, password, email, last_update, calc_interval, calc_uo
 -- Numbers
 INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
     't',
-    'Total Balance',
-    'SELECT SUM(a.balance) FROM (SELECT balance FROM accounts WHERE active=True) AS a;',
+    'Net worth',
+    'SELECT round(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2)
+    FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id
+    LEFT JOIN account_groups AS g ON g.id=a.group_id
+    WHERE a.active=True AND COALESCE(g.include_in_net_worth, True);',
     NOW(),
     NOW(),
     NOW(),
     'number',
     'total_balance',
     't',
+    'Balances of all accounts less the debt of loans and credits, without the groups which are not included',
     '',
     '',
+    ''
+);
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Total debt',
+    'SELECT round(COALESCE(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 0) * -1, 2)
+    FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id
+    WHERE a.active=True AND a.bank_type IN (''loan'', ''credit'');',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'total_debt',
+    't',
+    'Remaining debt of all loans and credits',
+    '',
     '',
     ''
 );
@@ -53,8 +87,10 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
 INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
     't',
     'Total income last 30 days',
-    'SELECT SUM(amount) FROM transactions WHERE transaction_date >= NOW() - interval ''30'' day
-    AND transaction_date <= NOW() + interval ''1'' day AND active=''t'' AND account_id IS NULL;',
+    'SELECT SUM(ta.base_amount) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t'' AND t.transaction_type=''income'';',
     NOW(),
     NOW(),
     NOW(),
@@ -70,8 +106,11 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
 INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
     't',
     'Total expenses last 30 days',
-    'SELECT SUM(amount) FROM transactions WHERE transaction_date >= NOW() - interval ''30'' day
-    AND transaction_date <= NOW() + interval ''1'' day AND active=''t'' AND to_account IS NULL;',
+    'SELECT SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t''
+    AND t.transaction_type IN (''expense'', ''fee'', ''refund'');',
     NOW(),
     NOW(),
     NOW(),
@@ -84,31 +123,46 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
     ''
 );
 
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Money per day until payday',
+    'SELECT COALESCE(round(SUM(bal.balance / GREATEST(
+            COALESCE(next_payday(acc.id), NOW() + interval ''1'' month)::date - CURRENT_DATE, 1
+        )), 2), 0)
+    FROM accounts AS acc
+    JOIN (
+        SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+        FROM account_balances
+    ) AS bal ON bal.account_id=acc.id
+    WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'total_avg_balance',
+    't',
+    'Balance of every account divided by the days until its next payday',
+    '',
+    '',
+    ''
+);
+
 -- Graphs
 INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
     't',
     'Balance per day',
     'SELECT json_object_agg(a.name, a.money_per_day) FROM (
         SELECT
-            acc.id,
-            CASE
-                WHEN b.delta_salary_date > 1
-                THEN acc.balance / b.delta_salary_date 
-                ELSE acc.balance * b.delta_salary_date
-            END money_per_day,
             acc.name,
-            acc.balance
+            round(bal.balance / GREATEST(
+                COALESCE(next_payday(acc.id), NOW() + interval ''1'' month)::date - CURRENT_DATE, 1
+            ), 2) AS money_per_day
         FROM accounts AS acc
         JOIN (
-            SELECT 
-                CASE 
-                    WHEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 >= 0
-                    THEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400
-                    ELSE EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 * -1
-                END delta_salary_date
-            FROM settings LIMIT 1
-        ) AS b ON 1=1
-        WHERE acc.active=True AND acc.balance > 0
+            SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+            FROM account_balances
+        ) AS bal ON bal.account_id=acc.id
+        WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0
     ) AS a;',
     NOW(),
     NOW(),
@@ -127,9 +181,11 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
     'Total amount per category',
     'SELECT json_object_agg(b.name, b.obj) FROM (
         SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
-            SELECT c.name,SUM(t.amount),c.hex FROM categories AS c
-            JOIN transactions AS t ON c.id=t.category_id
-            WHERE t.active=true AND c.active=true
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN category_tree AS ct ON ct.ancestor_id=c.id
+            JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true AND c.parent_id IS NULL
             GROUP BY c.name,c.hex
         ) AS a
     ) AS b;',
@@ -150,9 +206,11 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
     'Amount per Category, last 30 days',
     'SELECT json_object_agg(b.name, b.obj) FROM (
         SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
-            SELECT c.name,SUM(t.amount),c.hex FROM categories AS c
-            JOIN transactions AS t ON c.id=t.category_id
-            WHERE t.active=true AND c.active=true AND t.transaction_date >= NOW() - interval ''30 days''
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN category_tree AS ct ON ct.ancestor_id=c.id
+            JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true AND c.parent_id IS NULL AND t.transaction_date >= NOW() - interval ''30 days''
             GROUP BY c.name,c.hex
         ) AS a
     ) AS b;',
@@ -168,4 +226,86 @@ INSERT INTO statistics (active, name, compute_query, create_date, last_update, e
     ''
 );
 
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Total amount per tag',
+    'SELECT json_object_agg(a.tag, a.sum) FROM (
+        SELECT tta.tag,SUM(tta.base_amount) FROM transaction_tag_amounts AS tta
+        JOIN transactions AS t ON t.id=tta.transaction_id
+        WHERE t.active=true
+        GROUP BY tta.tag
+    ) AS a;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'pie',
+    'total_tag_amount',
+    't',
+    '',
+    '',
+    '',
+    ''
+);
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Spent per payee, last 30 days',
+    'SELECT json_object_agg(a.name, a.sum) FROM (
+        SELECT p.name,SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM payees AS p
+        JOIN transactions AS t ON t.payee_id=p.id
+        JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+        WHERE t.active=true AND t.transaction_type IN (''expense'', ''fee'', ''refund'') AND t.transaction_date >= NOW() - interval ''30 days''
+        GROUP BY p.name
+    ) AS a;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'bar',
+    'past_payee_spent',
+    't',
+    '',
+    '',
+    '',
+    ''
+);
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Unrealised gains',
+    'SELECT round(COALESCE(SUM((h.market_value - h.cost_basis) * exchange_rate(a.currency, base_currency(), CURRENT_DATE)), 0), 2)
+    FROM holdings AS h JOIN accounts AS a ON a.id=h.account_id
+    WHERE a.active=True;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'unrealised_gains',
+    't',
+    'Market value of the held securities less their cost basis',
+    '',
+    '',
+    ''
+);
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Realised gains and dividends',
+    'SELECT round(COALESCE(SUM(
+        CASE t.trade_type WHEN ''sell'' THEN t.amount - t.cost_basis ELSE t.amount END
+        * exchange_rate(a.currency, base_currency(), t.trade_date::date)
+    ), 0), 2)
+    FROM trades AS t JOIN accounts AS a ON a.id=t.account_id
+    WHERE t.trade_type IN (''sell'', ''dividend'');',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'realised_gains',
+    't',
+    'Gains of sold securities over their cost basis and the received dividends',
+    '',
+    '',
+    ''
+);
+
 COMMIT;
\ No newline at end of file
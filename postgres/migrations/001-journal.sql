@@ -0,0 +1,124 @@
+-- Migration: Double-entry journal behind the account balances
+--
+-- Creates the journal tables, posts every existing transaction into the journal
+-- and moves the stored balances of the accounts into opening balance entries.
+-- Afterwards the balances are computed by the account_balances view.
+
+BEGIN;
+
+CREATE TABLE journal_entries (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    name text,
+    entry_date timestamp,
+    create_date timestamp
+);
+ALTER TABLE journal_entries OWNER TO "accounting";
+
+CREATE TABLE journal_lines (
+    id serial,
+    primary key(id),
+    entry_id int references journal_entries(id) ON DELETE CASCADE,
+    -- NULL: external account
+    account_id int references accounts(id),
+    debit float,
+    credit float,
+    booked boolean
+);
+ALTER TABLE journal_lines OWNER TO "accounting";
+
+DO $$
+DECLARE
+    t record;
+    a record;
+    entry int;
+    diff float;
+BEGIN
+    -- Post all transactions, negative amounts are posted the other way round
+    FOR t IN SELECT id, name, transaction_date, amount, account_id, to_account FROM transactions LOOP
+        INSERT INTO journal_entries (transaction_id, name, entry_date, create_date)
+            VALUES (t.id, t.name, t.transaction_date, NOW()) RETURNING id INTO entry;
+
+        IF t.amount >= 0 THEN
+            INSERT INTO journal_lines (entry_id, account_id, debit, credit, booked) VALUES
+                (entry, t.account_id, 0, t.amount, true),
+                (entry, t.to_account, t.amount, 0, true);
+        ELSE
+            INSERT INTO journal_lines (entry_id, account_id, debit, credit, booked) VALUES
+                (entry, t.to_account, 0, t.amount * -1, true),
+                (entry, t.account_id, t.amount * -1, 0, true);
+        END IF;
+    END LOOP;
+
+    UPDATE transactions SET origin_booked=true, dest_booked=true;
+
+    -- Everything in the stored balance which is not explained by a transaction
+    -- becomes the opening balance of the account
+    FOR a IN SELECT id, name, create_date, balance FROM accounts LOOP
+        SELECT COALESCE(a.balance, 0) - COALESCE(SUM(debit - credit), 0) INTO diff
+            FROM journal_lines WHERE account_id=a.id;
+
+        IF diff <> 0 THEN
+            INSERT INTO journal_entries (transaction_id, name, entry_date, create_date)
+                VALUES (NULL, 'Opening balance ' || a.name, a.create_date, NOW()) RETURNING id INTO entry;
+
+            IF diff > 0 THEN
+                INSERT INTO journal_lines (entry_id, account_id, debit, credit, booked) VALUES
+                    (entry, NULL, 0, diff, true),
+                    (entry, a.id, diff, 0, true);
+            ELSE
+                INSERT INTO journal_lines (entry_id, account_id, debit, credit, booked) VALUES
+                    (entry, a.id, 0, diff * -1, true),
+                    (entry, NULL, diff * -1, 0, true);
+            END IF;
+        END IF;
+    END LOOP;
+END $$;
+
+ALTER TABLE accounts DROP COLUMN balance;
+ALTER TABLE accounts DROP COLUMN balance_forecast;
+
+-- Balances of the accounts computed from the journal
+-- balance only contains booked lines, balance_forecast all of them
+CREATE VIEW account_balances AS
+    SELECT
+        a.id AS account_id,
+        COALESCE(SUM(l.debit - l.credit) FILTER (WHERE l.booked), 0) AS balance,
+        COALESCE(SUM(l.debit - l.credit), 0) AS balance_forecast
+    FROM accounts AS a
+    LEFT JOIN journal_lines AS l ON l.account_id=a.id
+    GROUP BY a.id;
+ALTER VIEW account_balances OWNER TO "accounting";
+
+-- Statistics which read the dropped balance column
+UPDATE statistics SET compute_query='SELECT SUM(b.balance) FROM account_balances AS b
+    JOIN accounts AS a ON a.id=b.account_id WHERE a.active=True;'
+WHERE external_id='total_balance';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(a.name, a.money_per_day) FROM (
+        SELECT
+            acc.id,
+            CASE
+                WHEN b.delta_salary_date > 1
+                THEN bal.balance / b.delta_salary_date
+                ELSE bal.balance * b.delta_salary_date
+            END money_per_day,
+            acc.name,
+            bal.balance
+        FROM accounts AS acc
+        JOIN account_balances AS bal ON bal.account_id=acc.id
+        JOIN (
+            SELECT
+                CASE
+                    WHEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 >= 0
+                    THEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400
+                    ELSE EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 * -1
+                END delta_salary_date
+            FROM settings LIMIT 1
+        ) AS b ON 1=1
+        WHERE acc.active=True AND bal.balance > 0
+    ) AS a;'
+WHERE external_id='balance_per_day';
+
+COMMIT;
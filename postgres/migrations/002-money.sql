@@ -0,0 +1,73 @@
+-- Migration: Exact money amounts
+--
+-- Converts the float amounts of transactions and journal lines into numeric(15,2).
+-- Before converting, every value which changes by rounding to cents is listed,
+-- as well as the resulting difference of each account balance.
+
+BEGIN;
+
+-- Rounding differences of single values
+SELECT
+    'transactions' AS "table",
+    id,
+    amount AS old_value,
+    round(amount::numeric, 2) AS new_value,
+    round(amount::numeric, 2) - amount::numeric AS difference
+FROM transactions
+WHERE amount::numeric <> round(amount::numeric, 2)
+UNION ALL
+SELECT
+    'journal_lines',
+    id,
+    debit - credit,
+    round(debit::numeric, 2) - round(credit::numeric, 2),
+    (round(debit::numeric, 2) - round(credit::numeric, 2)) - (debit - credit)::numeric
+FROM journal_lines
+WHERE debit::numeric <> round(debit::numeric, 2) OR credit::numeric <> round(credit::numeric, 2)
+ORDER BY 1, 2;
+
+-- Rounding differences of the account balances
+SELECT
+    a.id AS account_id,
+    a.name,
+    SUM(l.debit - l.credit) AS old_balance,
+    SUM(round(l.debit::numeric, 2) - round(l.credit::numeric, 2)) AS new_balance,
+    SUM(round(l.debit::numeric, 2) - round(l.credit::numeric, 2)) - SUM(l.debit - l.credit)::numeric AS difference
+FROM accounts AS a
+JOIN journal_lines AS l ON l.account_id=a.id
+GROUP BY a.id, a.name
+HAVING SUM(round(l.debit::numeric, 2) - round(l.credit::numeric, 2)) <> SUM(l.debit - l.credit)::numeric
+ORDER BY a.id;
+
+-- The view depends on the converted columns
+DROP VIEW account_balances;
+
+ALTER TABLE transactions ALTER COLUMN amount TYPE numeric(15,2) USING round(amount::numeric, 2);
+ALTER TABLE journal_lines ALTER COLUMN debit TYPE numeric(15,2) USING round(debit::numeric, 2);
+ALTER TABLE journal_lines ALTER COLUMN credit TYPE numeric(15,2) USING round(credit::numeric, 2);
+
+CREATE VIEW account_balances AS
+    SELECT
+        a.id AS account_id,
+        COALESCE(SUM(l.debit - l.credit) FILTER (WHERE l.booked), 0) AS balance,
+        COALESCE(SUM(l.debit - l.credit), 0) AS balance_forecast
+    FROM accounts AS a
+    LEFT JOIN journal_lines AS l ON l.account_id=a.id
+    GROUP BY a.id;
+ALTER VIEW account_balances OWNER TO "accounting";
+
+-- Entries which were balanced with float amounts must still be balanced after rounding
+DO $$
+DECLARE
+    unbalanced int;
+BEGIN
+    SELECT COUNT(*) INTO unbalanced FROM (
+        SELECT entry_id FROM journal_lines GROUP BY entry_id HAVING SUM(debit) <> SUM(credit)
+    ) AS a;
+
+    IF unbalanced > 0 THEN
+        RAISE EXCEPTION '% journal entries are not balanced after rounding, nothing was converted', unbalanced;
+    END IF;
+END $$;
+
+COMMIT;
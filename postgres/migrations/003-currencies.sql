@@ -0,0 +1,178 @@
+-- Migration: Currencies per account and exchange rates
+--
+-- Adds a currency to the accounts, the amount received by cross-currency
+-- transactions and the exchange rate table. All existing accounts, transactions
+-- and journal lines get the base currency, which is derived from the currency
+-- symbol of the settings.
+
+BEGIN;
+
+ALTER TABLE settings ADD COLUMN base_currency text;
+ALTER TABLE accounts ADD COLUMN currency text;
+ALTER TABLE transactions ADD COLUMN to_amount numeric(15,2);
+ALTER TABLE journal_lines ADD COLUMN currency text;
+
+UPDATE settings SET base_currency = CASE currency
+    WHEN '€' THEN 'EUR'
+    WHEN '$' THEN 'USD'
+    WHEN '£' THEN 'GBP'
+    WHEN 'CHF' THEN 'CHF'
+    WHEN 'Fr.' THEN 'CHF'
+    ELSE 'EUR'
+END;
+
+UPDATE accounts SET currency=(SELECT base_currency FROM settings LIMIT 1);
+UPDATE transactions SET to_amount=amount;
+UPDATE journal_lines SET currency=(SELECT base_currency FROM settings LIMIT 1);
+
+-- Dated exchange rates, 1 from_currency = rate to_currency
+CREATE TABLE exchange_rates (
+    id serial,
+    primary key(id),
+    from_currency text,
+    to_currency text,
+    rate numeric(18,8),
+    rate_date date,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE exchange_rates OWNER TO "accounting";
+
+-- Currency statistics are reported in
+-- Can be overwritten per transaction with set_config('accounting.base_currency', 'USD', true)
+CREATE FUNCTION base_currency() RETURNS text AS $$
+    SELECT COALESCE(
+        NULLIF(current_setting('accounting.base_currency', true), ''),
+        (SELECT base_currency FROM settings LIMIT 1)
+    );
+$$ LANGUAGE sql STABLE;
+ALTER FUNCTION base_currency() OWNER TO "accounting";
+
+-- Rate for converting from_cur into to_cur at the given date
+-- Uses the latest rate dated on or before the date, the opposite pair is used inverted
+CREATE FUNCTION exchange_rate(from_cur text, to_cur text, at date) RETURNS numeric AS $$
+DECLARE
+    r numeric;
+BEGIN
+    IF from_cur = to_cur THEN
+        RETURN 1;
+    END IF;
+
+    SELECT rate INTO r FROM exchange_rates
+        WHERE from_currency=from_cur AND to_currency=to_cur AND rate_date <= at
+        ORDER BY rate_date DESC LIMIT 1;
+    IF r IS NOT NULL THEN
+        RETURN r;
+    END IF;
+
+    SELECT 1 / rate INTO r FROM exchange_rates
+        WHERE from_currency=to_cur AND to_currency=from_cur AND rate_date <= at
+        ORDER BY rate_date DESC LIMIT 1;
+    IF r IS NOT NULL THEN
+        RETURN r;
+    END IF;
+
+    RAISE EXCEPTION 'No exchange rate from % to % on %', from_cur, to_cur, at;
+END;
+$$ LANGUAGE plpgsql STABLE;
+ALTER FUNCTION exchange_rate(text, text, date) OWNER TO "accounting";
+
+-- The balances are in the currency of the account
+DROP VIEW account_balances;
+CREATE VIEW account_balances AS
+    SELECT
+        a.id AS account_id,
+        a.currency,
+        COALESCE(SUM(l.debit - l.credit) FILTER (WHERE l.booked), 0) AS balance,
+        COALESCE(SUM(l.debit - l.credit), 0) AS balance_forecast
+    FROM accounts AS a
+    LEFT JOIN journal_lines AS l ON l.account_id=a.id
+    GROUP BY a.id, a.currency;
+ALTER VIEW account_balances OWNER TO "accounting";
+
+-- Amounts of the transactions converted into the base currency
+-- amount is in the currency of the origin account, or of the recipient for incoming money
+CREATE VIEW transaction_amounts AS
+    SELECT
+        t.id AS transaction_id,
+        COALESCE(fa.currency, ta.currency, base_currency()) AS currency,
+        round(t.amount * exchange_rate(
+            COALESCE(fa.currency, ta.currency, base_currency()), base_currency(), t.transaction_date::date
+        ), 2) AS base_amount
+    FROM transactions AS t
+    LEFT JOIN accounts AS fa ON fa.id=t.account_id
+    LEFT JOIN accounts AS ta ON ta.id=t.to_account;
+ALTER VIEW transaction_amounts OWNER TO "accounting";
+
+-- Monetary statistics are converted into the base currency
+UPDATE statistics SET compute_query='SELECT round(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2)
+    FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id WHERE a.active=True;'
+WHERE external_id='total_balance';
+
+UPDATE statistics SET compute_query='SELECT SUM(ta.base_amount) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t'' AND t.account_id IS NULL;'
+WHERE external_id='total_income';
+
+UPDATE statistics SET compute_query='SELECT SUM(ta.base_amount) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t'' AND t.to_account IS NULL;'
+WHERE external_id='total_expenses';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(a.name, a.money_per_day) FROM (
+        SELECT
+            acc.id,
+            CASE
+                WHEN b.delta_salary_date > 1
+                THEN bal.balance / b.delta_salary_date
+                ELSE bal.balance * b.delta_salary_date
+            END money_per_day,
+            acc.name,
+            bal.balance
+        FROM accounts AS acc
+        JOIN (
+            SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+            FROM account_balances
+        ) AS bal ON bal.account_id=acc.id
+        JOIN (
+            SELECT
+                CASE
+                    WHEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 >= 0
+                    THEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400
+                    ELSE EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 * -1
+                END delta_salary_date
+            FROM settings LIMIT 1
+        ) AS b ON 1=1
+        WHERE acc.active=True AND bal.balance > 0
+    ) AS a;'
+WHERE external_id='balance_per_day';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ta.base_amount),c.hex FROM categories AS c
+            JOIN transactions AS t ON c.id=t.category_id
+            JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+            WHERE t.active=true AND c.active=true
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;'
+WHERE external_id='total_category_amount';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ta.base_amount),c.hex FROM categories AS c
+            JOIN transactions AS t ON c.id=t.category_id
+            JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+            WHERE t.active=true AND c.active=true AND t.transaction_date >= NOW() - interval ''30 days''
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;'
+WHERE external_id='past_category_amount';
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';exchangerate.read;exchangerate.write;exchangerate.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,63 @@
+-- Migration: Split transactions
+--
+-- Adds the split lines of transactions and lets the category statistics
+-- count the split amounts instead of the category of the transaction.
+
+BEGIN;
+
+CREATE TABLE transaction_splits (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    amount numeric(15,2),
+    category_id int references categories(id),
+    note text
+);
+ALTER TABLE transaction_splits OWNER TO "accounting";
+
+-- Amounts per category, split transactions count with their split lines,
+-- all others with the category of the transaction
+CREATE VIEW transaction_category_amounts AS
+    SELECT
+        s.transaction_id,
+        s.category_id,
+        s.amount,
+        round(s.amount * exchange_rate(ta.currency, base_currency(), t.transaction_date::date), 2) AS base_amount
+    FROM transaction_splits AS s
+    JOIN transactions AS t ON t.id=s.transaction_id
+    JOIN transaction_amounts AS ta ON ta.transaction_id=s.transaction_id
+    UNION ALL
+    SELECT
+        t.id,
+        t.category_id,
+        t.amount,
+        ta.base_amount
+    FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.category_id IS NOT NULL
+    AND NOT EXISTS (SELECT 1 FROM transaction_splits AS s WHERE s.transaction_id=t.id);
+ALTER VIEW transaction_category_amounts OWNER TO "accounting";
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN transaction_category_amounts AS ca ON ca.category_id=c.id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;'
+WHERE external_id='total_category_amount';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN transaction_category_amounts AS ca ON ca.category_id=c.id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true AND t.transaction_date >= NOW() - interval ''30 days''
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;'
+WHERE external_id='past_category_amount';
+
+COMMIT;
@@ -0,0 +1,42 @@
+-- Migration: Recurring transactions
+--
+-- Adds the definitions of recurring transactions which are booked by the
+-- scheduler of the application and links the booked transactions to them.
+
+BEGIN;
+
+-- Recurring transactions (standing orders)
+-- The scheduler creates a transaction on every due date, next_date
+-- is the next due date which was not booked yet
+CREATE TABLE recurring_transactions (
+    id serial,
+    primary key(id),
+    name text,
+    description text,
+    active boolean,
+    amount numeric(15,2),
+    to_amount numeric(15,2),
+    account_id int references accounts(id),
+    to_account int references accounts(id),
+    category_id int references categories(id),
+    transaction_type text,
+    -- monthly, weekly, yearly or last_business_day
+    schedule text,
+    -- Day of the month for monthly schedules
+    day int,
+    start_date timestamp,
+    end_date timestamp,
+    next_date timestamp,
+    last_run timestamp,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE recurring_transactions OWNER TO "accounting";
+
+ALTER TABLE transactions ADD COLUMN recurring_id int references recurring_transactions(id) ON DELETE SET NULL;
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';recurring.read;recurring.write;recurring.delete'
+WHERE local_key=true;
+
+COMMIT;
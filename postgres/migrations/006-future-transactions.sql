@@ -0,0 +1,18 @@
+-- Migration: Future-dated transactions
+--
+-- Transactions dated in the future are only part of the forecast balance until
+-- they are due. Their journal lines become pending, the application books them
+-- on their transaction date.
+
+BEGIN;
+
+UPDATE journal_lines SET booked=false
+WHERE entry_id IN (
+    SELECT e.id FROM journal_entries AS e
+    WHERE e.transaction_id IS NOT NULL AND e.entry_date > NOW()
+);
+
+UPDATE transactions SET origin_booked=false, dest_booked=false
+WHERE transaction_date > NOW();
+
+COMMIT;
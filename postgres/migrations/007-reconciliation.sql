@@ -0,0 +1,29 @@
+-- Migration: Reconciliation
+--
+-- Adds the reconciliations of accounts against bank statements. The journal
+-- lines of an account are ticked off by setting their reconciliation.
+
+BEGIN;
+
+-- Reconciliations of accounts against bank statements
+-- state is open while transactions are ticked off and done once the
+-- ticked transactions match the closing balance of the statement
+CREATE TABLE reconciliations (
+    id serial,
+    primary key(id),
+    account_id int references accounts(id) ON DELETE CASCADE,
+    statement_date timestamp,
+    closing_balance numeric(15,2),
+    state text,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE reconciliations OWNER TO "accounting";
+
+ALTER TABLE journal_lines ADD COLUMN reconciliation_id int references reconciliations(id) ON DELETE SET NULL;
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';reconciliation.read;reconciliation.write;reconciliation.delete'
+WHERE local_key=true;
+
+COMMIT;
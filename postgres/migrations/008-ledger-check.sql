@@ -0,0 +1,10 @@
+-- Migration: Ledger check
+--
+-- Grants the access rights of the ledger check to the keys of the application.
+
+BEGIN;
+
+UPDATE api SET access_rights=access_rights || ';ledger.read;ledger.write'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,29 @@
+-- Migration: Audit log
+--
+-- Adds the audit log which records the changes of the records with their
+-- values before and after the change.
+
+BEGIN;
+
+-- Changes of accounts, transactions, categories, statistics, settings and api keys
+-- actor is "web:<name>" for the web interface, "api:<prefix>" for api keys and "scheduler" for background jobs
+-- before is NULL for created records, after for deleted ones
+CREATE TABLE audit_log (
+    id serial,
+    primary key(id),
+    model text NOT NULL,
+    record_id int NOT NULL,
+    action text NOT NULL,
+    actor text,
+    change_date timestamp,
+    before jsonb,
+    after jsonb
+);
+ALTER TABLE audit_log OWNER TO "accounting";
+CREATE INDEX audit_log_record ON audit_log (model, record_id);
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';audit.read'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Migration: Budgets
+--
+-- Adds budgets per category which are compared with the spending of a period.
+
+BEGIN;
+
+-- Budgets per category, amount is in the base currency
+-- period is monthly or salary_cycle (from one salary date of the settings to the next one),
+-- with rollover the unspent money of the periods since start_date is added to the current one
+CREATE TABLE budgets (
+    id serial,
+    primary key(id),
+    category_id int references categories(id) ON DELETE CASCADE,
+    amount numeric(15,2),
+    period text,
+    rollover boolean DEFAULT false,
+    start_date timestamp,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE budgets OWNER TO "accounting";
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';budget.read;budget.write;budget.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Migration: Savings goals
+--
+-- Adds savings goals with a target amount and a deadline which are linked to accounts.
+
+BEGIN;
+
+-- Savings goals, the balances of the linked accounts are converted into the currency of the goal
+CREATE TABLE goals (
+    id serial,
+    primary key(id),
+    name text,
+    description text,
+    target_amount numeric(15,2),
+    currency text,
+    deadline timestamp,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE goals OWNER TO "accounting";
+
+CREATE TABLE goal_accounts (
+    goal_id int references goals(id) ON DELETE CASCADE,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    primary key(goal_id, account_id)
+);
+ALTER TABLE goal_accounts OWNER TO "accounting";
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';goal.read;goal.write;goal.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,57 @@
+-- Migration: Tags
+--
+-- Adds free-form tags on transactions and a statistic with the total amount per tag.
+
+BEGIN;
+
+-- Free-form tags of transactions, a transaction can have several tags
+CREATE TABLE tags (
+    id serial,
+    primary key(id),
+    name text UNIQUE NOT NULL,
+    create_date timestamp
+);
+ALTER TABLE tags OWNER TO "accounting";
+
+CREATE TABLE transaction_tags (
+    transaction_id int references transactions(id) ON DELETE CASCADE,
+    tag_id int references tags(id) ON DELETE CASCADE,
+    primary key(transaction_id, tag_id)
+);
+ALTER TABLE transaction_tags OWNER TO "accounting";
+
+-- Amounts per tag, a transaction with several tags counts fully in each of them
+CREATE VIEW transaction_tag_amounts AS
+    SELECT
+        tg.name AS tag,
+        t.id AS transaction_id,
+        t.amount,
+        ta.base_amount
+    FROM transaction_tags AS tt
+    JOIN tags AS tg ON tg.id=tt.tag_id
+    JOIN transactions AS t ON t.id=tt.transaction_id
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id;
+ALTER VIEW transaction_tag_amounts OWNER TO "accounting";
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Total amount per tag',
+    'SELECT json_object_agg(a.tag, a.sum) FROM (
+        SELECT tta.tag,SUM(tta.base_amount) FROM transaction_tag_amounts AS tta
+        JOIN transactions AS t ON t.id=tta.transaction_id
+        WHERE t.active=true
+        GROUP BY tta.tag
+    ) AS a;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'pie',
+    'total_tag_amount',
+    't',
+    '',
+    '',
+    '',
+    ''
+);
+
+COMMIT;
@@ -0,0 +1,61 @@
+-- Migration: Payees
+--
+-- Adds payees with aliases and a default category, links the transactions to them
+-- and adds a statistic with the spending per payee.
+
+BEGIN;
+
+-- Counterparties of transactions, a transaction is linked to the payee whose name is
+-- it's reference or one of whose aliases is part of it
+-- category_id is used for linked transactions which were created without a category
+-- The bank fields are the same as the ones of the accounts, bank_code holds the BIC
+CREATE TABLE payees (
+    id serial,
+    primary key(id),
+    name text,
+    category_id int references categories(id) ON DELETE SET NULL,
+    iban text,
+    bank_code text,
+    bank_name text,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE payees OWNER TO "accounting";
+
+CREATE TABLE payee_aliases (
+    payee_id int references payees(id) ON DELETE CASCADE,
+    alias text,
+    primary key(payee_id, alias)
+);
+ALTER TABLE payee_aliases OWNER TO "accounting";
+
+ALTER TABLE transactions ADD COLUMN payee_id int references payees(id) ON DELETE SET NULL;
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Spent per payee, last 30 days',
+    'SELECT json_object_agg(a.name, a.sum) FROM (
+        SELECT p.name,SUM(ta.base_amount) FROM payees AS p
+        JOIN transactions AS t ON t.payee_id=p.id
+        JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+        WHERE t.active=true AND t.to_account IS NULL AND t.transaction_date >= NOW() - interval ''30 days''
+        GROUP BY p.name
+    ) AS a;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'bar',
+    'past_payee_spent',
+    't',
+    '',
+    '',
+    '',
+    ''
+);
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';payee.read;payee.write;payee.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- Migration: Attachments
+--
+-- Adds files like receipts and invoices to transactions and accounts.
+
+BEGIN;
+
+-- Files like receipts, invoices or contracts of a transaction or an account
+-- The files are stored under <app_dir>/attachments named by their SHA-256 checksum,
+-- records with attachments can't be deleted until the attachments are deleted
+CREATE TABLE attachments (
+    id serial,
+    primary key(id),
+    transaction_id int references transactions(id),
+    account_id int references accounts(id),
+    file_name text,
+    content_type text,
+    size bigint,
+    checksum text,
+    create_date timestamp,
+    CHECK ((transaction_id IS NULL) <> (account_id IS NULL))
+);
+ALTER TABLE attachments OWNER TO "accounting";
+CREATE INDEX attachments_checksum ON attachments (checksum);
+
+COMMIT;
@@ -0,0 +1,44 @@
+-- Migration: Category hierarchy
+--
+-- Adds parent categories, the category_tree view and rolls the amounts of subcategories
+-- up into their top-level category in the category statistics.
+
+BEGIN;
+
+ALTER TABLE categories ADD COLUMN parent_id int references categories(id) ON DELETE SET NULL;
+
+-- Every category with itself and all of it's subcategories, depth is 0 for the category itself
+CREATE VIEW category_tree AS
+    WITH RECURSIVE tree (ancestor_id, category_id, depth) AS (
+        SELECT id, id, 0 FROM categories
+        UNION ALL
+        SELECT tree.ancestor_id, c.id, tree.depth + 1
+        FROM tree
+        JOIN categories AS c ON c.parent_id=tree.category_id
+    )
+    SELECT ancestor_id, category_id, depth FROM tree;
+ALTER VIEW category_tree OWNER TO "accounting";
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN category_tree AS ct ON ct.ancestor_id=c.id
+            JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true AND c.parent_id IS NULL
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;' WHERE external_id='total_category_amount';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(b.name, b.obj) FROM (
+        SELECT a.name,json_build_object(''hex'', a.hex, ''value'', a.sum) obj FROM (
+            SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+            JOIN category_tree AS ct ON ct.ancestor_id=c.id
+            JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+            JOIN transactions AS t ON t.id=ca.transaction_id
+            WHERE t.active=true AND c.active=true AND c.parent_id IS NULL AND t.transaction_date >= NOW() - interval ''30 days''
+            GROUP BY c.name,c.hex
+        ) AS a
+    ) AS b;' WHERE external_id='past_category_amount';
+
+COMMIT;
@@ -0,0 +1,37 @@
+-- Migration: Rules
+--
+-- Adds rules which categorise and tag new transactions.
+
+BEGIN;
+
+-- Rules categorise and tag new transactions which match all of their conditions,
+-- empty or 0 conditions are not checked, account_id matches the origin or the recipient account
+-- The rules are applied in the order of their sequence
+CREATE TABLE rules (
+    id serial,
+    primary key(id),
+    name text,
+    sequence int DEFAULT 10,
+    name_contains text DEFAULT '',
+    min_amount numeric(15,2) DEFAULT 0,
+    max_amount numeric(15,2) DEFAULT 0,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    category_id int references categories(id) ON DELETE SET NULL,
+    active boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE rules OWNER TO "accounting";
+
+CREATE TABLE rule_tags (
+    rule_id int references rules(id) ON DELETE CASCADE,
+    tag text,
+    primary key(rule_id, tag)
+);
+ALTER TABLE rule_tags OWNER TO "accounting";
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';rule.read;rule.write;rule.delete'
+WHERE local_key=true;
+
+COMMIT;
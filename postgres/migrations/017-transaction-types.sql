@@ -0,0 +1,76 @@
+-- Migration: Transaction types
+--
+-- Makes the type of the transactions explicit: income, expense, transfer, refund, fee or opening_balance.
+-- Every transaction gets the type which follows from it's accounts, existing values are kept if they
+-- are one of the types (ignoring the case) and fit the accounts. The changed types are listed before
+-- they are written. Recurring transactions with an unknown type detect it from their accounts.
+-- The statistics of income and expenses use the types instead of the empty accounts.
+
+BEGIN;
+
+CREATE TEMPORARY TABLE transaction_type_backfill ON COMMIT DROP AS
+    SELECT
+        id,
+        transaction_type AS old_type,
+        CASE
+            WHEN account_id IS NOT NULL AND to_account IS NOT NULL THEN 'transfer'
+            WHEN account_id IS NULL AND lower(trim(transaction_type)) IN ('refund', 'opening_balance') THEN lower(trim(transaction_type))
+            WHEN account_id IS NULL THEN 'income'
+            WHEN lower(trim(transaction_type)) IN ('fee', 'opening_balance') THEN lower(trim(transaction_type))
+            ELSE 'expense'
+        END AS new_type
+    FROM transactions;
+
+-- Types which are changed
+SELECT old_type, new_type, COUNT(*) AS transactions
+FROM transaction_type_backfill
+WHERE old_type IS DISTINCT FROM new_type
+GROUP BY old_type, new_type
+ORDER BY old_type, new_type;
+
+UPDATE transactions AS t SET transaction_type=b.new_type
+FROM transaction_type_backfill AS b
+WHERE b.id=t.id AND b.old_type IS DISTINCT FROM b.new_type;
+
+ALTER TABLE transactions ALTER COLUMN transaction_type SET NOT NULL;
+ALTER TABLE transactions ADD CHECK (transaction_type IN ('income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance'));
+
+UPDATE recurring_transactions SET transaction_type=lower(trim(transaction_type))
+WHERE lower(trim(transaction_type)) IN ('income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance');
+UPDATE recurring_transactions SET transaction_type=''
+WHERE transaction_type IS NULL OR transaction_type NOT IN ('income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance');
+
+ALTER TABLE recurring_transactions ALTER COLUMN transaction_type SET DEFAULT '';
+ALTER TABLE recurring_transactions ADD CHECK (transaction_type IN ('', 'income', 'expense', 'transfer', 'refund', 'fee', 'opening_balance'));
+
+-- Amount which counts as spent for the type of a transaction, refunds reduce the spending
+-- Income, transfers and opening balances are not spent
+CREATE FUNCTION spent_amount(transaction_type text, amount numeric) RETURNS numeric AS $$
+    SELECT CASE
+        WHEN transaction_type IN ('expense', 'fee') THEN amount
+        WHEN transaction_type = 'refund' THEN -amount
+        ELSE 0
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+ALTER FUNCTION spent_amount(text, numeric) OWNER TO "accounting";
+
+UPDATE statistics SET compute_query='SELECT SUM(ta.base_amount) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t'' AND t.transaction_type=''income'';' WHERE external_id='total_income';
+
+UPDATE statistics SET compute_query='SELECT SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM transactions AS t
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.transaction_date >= NOW() - interval ''30'' day
+    AND t.transaction_date <= NOW() + interval ''1'' day AND t.active=''t''
+    AND t.transaction_type IN (''expense'', ''fee'', ''refund'');' WHERE external_id='total_expenses';
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(a.name, a.sum) FROM (
+        SELECT p.name,SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM payees AS p
+        JOIN transactions AS t ON t.payee_id=p.id
+        JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+        WHERE t.active=true AND t.transaction_type IN (''expense'', ''fee'', ''refund'') AND t.transaction_date >= NOW() - interval ''30 days''
+        GROUP BY p.name
+    ) AS a;' WHERE external_id='past_payee_spent';
+
+COMMIT;
@@ -0,0 +1,75 @@
+-- Migration: Loans
+--
+-- Adds loan and credit accounts, loans have a principal, an interest rate, a term and the date of the first payment.
+-- Accounts with an unknown type become online accounts, the changed types are listed before they are written.
+-- The total balance is renamed to net worth, the debt of loans and credits gets a statistic of it's own.
+
+BEGIN;
+
+-- Types which are changed
+SELECT bank_type AS old_type, COUNT(*) AS accounts
+FROM accounts
+WHERE bank_type IS NULL OR bank_type NOT IN ('bank', 'online', 'loan', 'credit')
+GROUP BY bank_type;
+
+UPDATE accounts SET bank_type='online'
+WHERE bank_type IS NULL OR bank_type NOT IN ('bank', 'online', 'loan', 'credit');
+
+ALTER TABLE accounts ADD CHECK (bank_type IN ('bank', 'online', 'loan', 'credit'));
+
+-- Terms of loans, interest_rate is yearly in percent
+ALTER TABLE accounts ADD COLUMN principal numeric(15,2) DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN interest_rate numeric(6,3) DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN term_months int DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN first_payment_date timestamp;
+
+UPDATE statistics SET name='Net worth', description='Balances of all accounts less the debt of loans and credits'
+WHERE external_id='total_balance';
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Total debt',
+    'SELECT round(COALESCE(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 0) * -1, 2)
+    FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id
+    WHERE a.active=True AND a.bank_type IN (''loan'', ''credit'');',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'total_debt',
+    't',
+    'Remaining debt of all loans and credits',
+    '',
+    '',
+    ''
+);
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(a.name, a.money_per_day) FROM (
+        SELECT
+            acc.id,
+            CASE
+                WHEN b.delta_salary_date > 1
+                THEN bal.balance / b.delta_salary_date 
+                ELSE bal.balance * b.delta_salary_date
+            END money_per_day,
+            acc.name,
+            bal.balance
+        FROM accounts AS acc
+        JOIN (
+            SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+            FROM account_balances
+        ) AS bal ON bal.account_id=acc.id
+        JOIN (
+            SELECT 
+                CASE 
+                    WHEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 >= 0
+                    THEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400
+                    ELSE EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 * -1
+                END delta_salary_date
+            FROM settings LIMIT 1
+        ) AS b ON 1=1
+        WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0
+    ) AS a;'
+WHERE external_id='balance_per_day';
+
+COMMIT;
@@ -0,0 +1,150 @@
+-- Migration: Investments
+--
+-- Adds investment accounts with securities, their prices and trades.
+-- The balance of the accounts includes the market value of their holdings, so account_balances is recreated.
+
+BEGIN;
+
+ALTER TABLE accounts DROP CONSTRAINT accounts_bank_type_check;
+ALTER TABLE accounts ADD CHECK (bank_type IN ('bank', 'online', 'loan', 'credit', 'investment'));
+
+-- Securities like stocks, funds or bonds, identified by their symbol (e.g. ticker or ISIN)
+-- The prices of a security are in it's currency, it can only be traded in accounts of that currency
+CREATE TABLE securities (
+    id serial,
+    primary key(id),
+    name text,
+    symbol text UNIQUE,
+    currency text,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE securities OWNER TO "accounting";
+
+-- Prices of the securities per day, imported from CSV files
+CREATE TABLE security_prices (
+    security_id int references securities(id) ON DELETE CASCADE,
+    price_date date,
+    price numeric(15,2),
+    primary key(security_id, price_date)
+);
+ALTER TABLE security_prices OWNER TO "accounting";
+
+-- Buys, sells and dividends of securities in investment accounts
+-- amount is the cash which is paid (buy) or received (sell, dividend) after the fees,
+-- cost_basis is the cost of the bought quantity or the average cost of the sold quantity
+-- The cash is posted in the journal entry entry_id, which has no transaction
+CREATE TABLE trades (
+    id serial,
+    primary key(id),
+    account_id int references accounts(id) ON DELETE CASCADE,
+    security_id int references securities(id),
+    trade_type text CHECK (trade_type IN ('buy', 'sell', 'dividend')),
+    trade_date timestamp,
+    quantity numeric(18,6) DEFAULT 0,
+    price numeric(15,2) DEFAULT 0,
+    fees numeric(15,2) DEFAULT 0,
+    amount numeric(15,2),
+    cost_basis numeric(15,2) DEFAULT 0,
+    entry_id int references journal_entries(id) ON DELETE SET NULL,
+    create_date timestamp
+);
+ALTER TABLE trades OWNER TO "accounting";
+
+-- Latest price of every security
+CREATE VIEW security_latest_prices AS
+    SELECT DISTINCT ON (security_id) security_id, price_date, price
+    FROM security_prices
+    ORDER BY security_id, price_date DESC;
+ALTER VIEW security_latest_prices OWNER TO "accounting";
+
+-- Quantity, cost basis and market value of the securities per account
+-- Securities without a price are valued at their cost basis
+CREATE VIEW holdings AS
+    SELECT
+        h.account_id,
+        h.security_id,
+        h.quantity,
+        h.cost_basis,
+        round(COALESCE(h.quantity * p.price, h.cost_basis), 2) AS market_value
+    FROM (
+        SELECT
+            account_id,
+            security_id,
+            SUM(CASE trade_type WHEN 'buy' THEN quantity WHEN 'sell' THEN -quantity ELSE 0 END) AS quantity,
+            SUM(CASE trade_type WHEN 'buy' THEN cost_basis WHEN 'sell' THEN -cost_basis ELSE 0 END) AS cost_basis
+        FROM trades
+        GROUP BY account_id, security_id
+    ) AS h
+    LEFT JOIN security_latest_prices AS p ON p.security_id=h.security_id
+    WHERE h.quantity <> 0;
+ALTER VIEW holdings OWNER TO "accounting";
+
+DROP VIEW account_balances;
+-- Balances of the accounts computed from the journal and the market value of their holdings
+-- balance only contains booked lines, balance_forecast all of them, the market value is part of both
+CREATE VIEW account_balances AS
+    SELECT
+        a.id AS account_id,
+        a.currency,
+        COALESCE(j.balance, 0) + COALESCE(h.market_value, 0) AS balance,
+        COALESCE(j.balance_forecast, 0) + COALESCE(h.market_value, 0) AS balance_forecast,
+        COALESCE(h.market_value, 0) AS market_value
+    FROM accounts AS a
+    LEFT JOIN (
+        SELECT
+            account_id,
+            SUM(debit - credit) FILTER (WHERE booked) AS balance,
+            SUM(debit - credit) AS balance_forecast
+        FROM journal_lines
+        GROUP BY account_id
+    ) AS j ON j.account_id=a.id
+    LEFT JOIN (
+        SELECT account_id, SUM(market_value) AS market_value FROM holdings GROUP BY account_id
+    ) AS h ON h.account_id=a.id;
+ALTER VIEW account_balances OWNER TO "accounting";
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';investment.read;investment.write;investment.delete'
+WHERE local_key=true;
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Unrealised gains',
+    'SELECT round(COALESCE(SUM((h.market_value - h.cost_basis) * exchange_rate(a.currency, base_currency(), CURRENT_DATE)), 0), 2)
+    FROM holdings AS h JOIN accounts AS a ON a.id=h.account_id
+    WHERE a.active=True;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'unrealised_gains',
+    't',
+    'Market value of the held securities less their cost basis',
+    '',
+    '',
+    ''
+);
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix) VALUES (
+    't',
+    'Realised gains and dividends',
+    'SELECT round(COALESCE(SUM(
+        CASE t.trade_type WHEN ''sell'' THEN t.amount - t.cost_basis ELSE t.amount END
+        * exchange_rate(a.currency, base_currency(), t.trade_date::date)
+    ), 0), 2)
+    FROM trades AS t JOIN accounts AS a ON a.id=t.account_id
+    WHERE t.trade_type IN (''sell'', ''dividend'');',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'realised_gains',
+    't',
+    'Gains of sold securities over their cost basis and the received dividends',
+    '',
+    '',
+    ''
+);
+
+COMMIT;
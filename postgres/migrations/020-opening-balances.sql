@@ -0,0 +1,54 @@
+-- Migration: Opening balances
+--
+-- The opening balances of the accounts become transactions of the type opening_balance.
+-- They were journal entries without a transaction, every entry with exactly one line on an account
+-- which is not the cash of a trade gets a transaction and is linked to it, so the journal stays the same.
+-- The converted opening balances are listed before they are written.
+
+BEGIN;
+
+CREATE TEMPORARY TABLE opening_balance_backfill ON COMMIT DROP AS
+    SELECT
+        nextval('transactions_id_seq') AS transaction_id,
+        e.id AS entry_id,
+        e.name,
+        e.entry_date,
+        l.account_id,
+        l.debit - l.credit AS amount,
+        l.booked
+    FROM journal_entries AS e
+    JOIN journal_lines AS l ON l.entry_id=e.id AND l.account_id IS NOT NULL AND l.debit <> l.credit
+    WHERE e.transaction_id IS NULL
+        AND NOT EXISTS (SELECT 1 FROM trades AS t WHERE t.entry_id=e.id)
+        AND (SELECT COUNT(*) FROM journal_lines AS c WHERE c.entry_id=e.id AND c.account_id IS NOT NULL)=1;
+
+-- Opening balances which are converted
+SELECT b.entry_id, a.name AS account, b.amount, a.currency
+FROM opening_balance_backfill AS b JOIN accounts AS a ON a.id=b.account_id
+ORDER BY a.name;
+
+-- Positive balances come into the account, negative ones leave it
+INSERT INTO transactions (id, name, active, transaction_date, last_update, create_date, amount, to_amount,
+    account_id, to_account, transaction_type, dest_booked, origin_booked, description)
+SELECT
+    transaction_id,
+    name,
+    true,
+    entry_date,
+    NOW(),
+    NOW(),
+    abs(amount),
+    abs(amount),
+    CASE WHEN amount < 0 THEN account_id END,
+    CASE WHEN amount > 0 THEN account_id END,
+    'opening_balance',
+    booked,
+    booked,
+    ''
+FROM opening_balance_backfill;
+
+UPDATE journal_entries AS e SET transaction_id=b.transaction_id
+FROM opening_balance_backfill AS b
+WHERE b.entry_id=e.id;
+
+COMMIT;
@@ -0,0 +1,38 @@
+-- Migration: Closed periods
+--
+-- Adds closable months and years with the balances of the accounts at their end.
+-- Transactions and trades dated in a closed period can't be created, changed or deleted.
+-- Reopening needs the right period.reopen, which is meant for the keys of administrators.
+
+BEGIN;
+
+-- Closed months and years, transactions and trades dated between start_date and end_date can't be changed
+-- Reopening a period deletes it, both is recorded in the audit log
+CREATE TABLE periods (
+    id serial,
+    primary key(id),
+    name text,
+    period_type text CHECK (period_type IN ('month', 'year')),
+    start_date date,
+    end_date date,
+    close_date timestamp,
+    -- actor of the audit log who closed the period
+    closed_by text
+);
+ALTER TABLE periods OWNER TO "accounting";
+
+-- Balances of the accounts at the end of a closed period, taken from the journal when it was closed
+CREATE TABLE period_balances (
+    period_id int references periods(id) ON DELETE CASCADE,
+    account_id int references accounts(id) ON DELETE CASCADE,
+    currency text,
+    balance numeric(15,2),
+    primary key(period_id, account_id)
+);
+ALTER TABLE period_balances OWNER TO "accounting";
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';period.read;period.write;period.reopen'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Migration: Account groups
+--
+-- Adds groups of accounts which are ordered by their sequence, accounts can be in one group.
+-- The net worth leaves out the accounts of the groups which are not included in it.
+
+BEGIN;
+
+CREATE TABLE account_groups (
+    id serial,
+    primary key(id),
+    name text,
+    sequence int DEFAULT 10,
+    include_in_net_worth boolean DEFAULT true,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE account_groups OWNER TO "accounting";
+
+-- accounts without a group are listed as other accounts
+ALTER TABLE accounts ADD COLUMN group_id int references account_groups(id) ON DELETE SET NULL;
+
+UPDATE statistics SET
+    compute_query='SELECT round(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2)
+    FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id
+    LEFT JOIN account_groups AS g ON g.id=a.group_id
+    WHERE a.active=True AND COALESCE(g.include_in_net_worth, True);',
+    description='Balances of all accounts less the debt of loans and credits, without the groups which are not included'
+WHERE external_id='total_balance';
+
+COMMIT;
@@ -0,0 +1,108 @@
+-- Migration: Income schedules
+--
+-- Replaces the salary date of the settings with income schedules. The salary date becomes the monthly default schedule "Salary",
+-- accounts and account groups can use schedules of their own. The balance per day and the money per day until payday
+-- (total_avg_balance) use the next payday of every account, the statistic is added if it doesn't exist yet.
+
+BEGIN;
+
+CREATE TABLE income_schedules (
+    id serial,
+    primary key(id),
+    name text,
+    active boolean DEFAULT true,
+    frequency text CHECK (frequency IN ('weekly', 'biweekly', 'monthly', 'last_business_day')),
+    anchor_date timestamp,
+    weekend_rule text DEFAULT 'keep' CHECK (weekend_rule IN ('keep', 'before', 'after')),
+    is_default boolean DEFAULT false,
+    next_date timestamp,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE income_schedules OWNER TO "accounting";
+
+ALTER TABLE account_groups ADD COLUMN income_schedule_id int references income_schedules(id) ON DELETE SET NULL;
+ALTER TABLE accounts ADD COLUMN income_schedule_id int references income_schedules(id) ON DELETE SET NULL;
+
+-- The salary date is the next payday, the application shifts it when it's over
+INSERT INTO income_schedules (name, active, frequency, anchor_date, weekend_rule, is_default, next_date, create_date, last_update)
+SELECT 'Salary', true, 'monthly', date_trunc('day', salary_date), 'keep', true, date_trunc('day', salary_date), NOW(), NOW()
+FROM settings WHERE salary_date IS NOT NULL LIMIT 1;
+
+ALTER TABLE settings DROP COLUMN salary_date;
+
+-- Next payday of an account: from it's own income schedule, the one of it's group or the default schedule
+CREATE FUNCTION next_payday(account int) RETURNS timestamp AS $$
+    SELECT COALESCE(
+        (SELECT s.next_date FROM accounts AS a
+            JOIN income_schedules AS s ON s.id=a.income_schedule_id AND s.active
+            WHERE a.id=account),
+        (SELECT s.next_date FROM accounts AS a
+            JOIN account_groups AS g ON g.id=a.group_id
+            JOIN income_schedules AS s ON s.id=g.income_schedule_id AND s.active
+            WHERE a.id=account),
+        (SELECT next_date FROM income_schedules WHERE is_default AND active LIMIT 1)
+    );
+$$ LANGUAGE sql STABLE;
+ALTER FUNCTION next_payday(int) OWNER TO "accounting";
+
+UPDATE statistics SET compute_query='SELECT json_object_agg(a.name, a.money_per_day) FROM (
+        SELECT
+            acc.name,
+            round(bal.balance / GREATEST(
+                COALESCE(next_payday(acc.id), NOW() + interval ''1'' month)::date - CURRENT_DATE, 1
+            ), 2) AS money_per_day
+        FROM accounts AS acc
+        JOIN (
+            SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+            FROM account_balances
+        ) AS bal ON bal.account_id=acc.id
+        WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0
+    ) AS a;'
+WHERE external_id='balance_per_day';
+
+UPDATE statistics SET
+    name='Money per day until payday',
+    description='Balance of every account divided by the days until its next payday',
+    monetary=true,
+    compute_query='SELECT COALESCE(round(SUM(bal.balance / GREATEST(
+            COALESCE(next_payday(acc.id), NOW() + interval ''1'' month)::date - CURRENT_DATE, 1
+        )), 2), 0)
+    FROM accounts AS acc
+    JOIN (
+        SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+        FROM account_balances
+    ) AS bal ON bal.account_id=acc.id
+    WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0;'
+WHERE external_id='total_avg_balance';
+
+INSERT INTO statistics (active, name, compute_query, create_date, last_update, execution_date, visualisation, external_id, monetary, description, keys, value, suffix)
+SELECT
+    't',
+    'Money per day until payday',
+    'SELECT COALESCE(round(SUM(bal.balance / GREATEST(
+            COALESCE(next_payday(acc.id), NOW() + interval ''1'' month)::date - CURRENT_DATE, 1
+        )), 2), 0)
+    FROM accounts AS acc
+    JOIN (
+        SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+        FROM account_balances
+    ) AS bal ON bal.account_id=acc.id
+    WHERE acc.active=True AND acc.bank_type NOT IN (''loan'', ''credit'') AND bal.balance > 0;',
+    NOW(),
+    NOW(),
+    NOW(),
+    'number',
+    'total_avg_balance',
+    't',
+    'Balance of every account divided by the days until its next payday',
+    '',
+    '',
+    ''
+WHERE NOT EXISTS (SELECT 1 FROM statistics WHERE external_id='total_avg_balance');
+
+-- The keys of the application itself get the new access rights
+UPDATE api SET access_rights=access_rights || ';income.read;income.write;income.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -0,0 +1,31 @@
+-- Migration: Import mappings
+--
+-- Adds the column mappings of the CSV statements of the banks for the transaction import
+-- and grants the new access rights to the keys of the application.
+
+BEGIN;
+
+CREATE TABLE import_mappings (
+    id serial,
+    primary key(id),
+    name text,
+    delimiter text DEFAULT ';',
+    skip_lines int DEFAULT 1,
+    date_format text DEFAULT '02.01.2006',
+    decimal_separator text DEFAULT ',' CHECK (decimal_separator IN (',', '.')),
+    date_column int DEFAULT 0,
+    amount_column int DEFAULT 0,
+    name_column int DEFAULT 0,
+    counterparty_column int DEFAULT 0,
+    iban_column int DEFAULT 0,
+    description_column int DEFAULT 0,
+    account_id int references accounts(id) ON DELETE SET NULL,
+    create_date timestamp,
+    last_update timestamp
+);
+ALTER TABLE import_mappings OWNER TO "accounting";
+
+UPDATE api SET access_rights=access_rights || ';import.read;import.write;import.delete'
+WHERE local_key=true;
+
+COMMIT;
@@ -7,18 +7,23 @@ SELECT COUNT(*) FROM transactions WHERE transaction_date >= NOW() - interval '30
 AND transaction_date <= NOW() + interval '1 day' day AND active='t';
 
 -- Total balance
-SELECT SUM(a.balance) FROM (
-    SELECT balance FROM accounts WHERE active=True
-) AS a;
+-- Converted into the base currency, see base_currency() and exchange_rate()
+SELECT round(SUM(b.balance * exchange_rate(b.currency, base_currency(), CURRENT_DATE)), 2)
+FROM account_balances AS b JOIN accounts AS a ON a.id=b.account_id WHERE a.active=True;
 
--- Total expenses last 30 days 
-SELECT SUM(amount) FROM transactions WHERE transaction_date >= NOW() - interval '30' day
-AND transaction_date <= NOW() + interval '1' day AND active='t'
-AND to_account IS NULL;
+-- Total expenses last 30 days
+-- Expenses and fees less refunds, see spent_amount()
+SELECT SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM transactions AS t
+JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+WHERE t.transaction_date >= NOW() - interval '30' day
+AND t.transaction_date <= NOW() + interval '1' day AND t.active='t'
+AND t.transaction_type IN ('expense', 'fee', 'refund');
 
 -- Total income last 30 days
-SELECT SUM(amount) FROM transactions WHERE transaction_date >= NOW() - interval '30' day
-AND transaction_date <= NOW() + interval '1' day AND active='t' AND account_id IS NULL;
+SELECT SUM(ta.base_amount) FROM transactions AS t
+JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+WHERE t.transaction_date >= NOW() - interval '30' day
+AND t.transaction_date <= NOW() + interval '1' day AND t.active='t' AND t.transaction_type='income';
 
 -- Average value moved per account
 SELECT 
@@ -26,54 +31,79 @@ SELECT
 FROM transactions WHERE transaction_date >= NOW() - interval '30' day
 AND transaction_date <= NOW() + interval '1' day AND active='t';
 
+-- Money per day until the next payday, total => Ext. ID: total_avg_balance
+-- The next payday of an account comes from it's income schedule, see next_payday()
+SELECT COALESCE(round(SUM(bal.balance / GREATEST(
+        EXTRACT(epoch FROM COALESCE(next_payday(acc.id), NOW() + interval '1' month) - NOW())/86400, 1
+    )), 2), 0)
+FROM accounts AS acc
+JOIN (
+    SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+    FROM account_balances
+) AS bal ON bal.account_id=acc.id
+WHERE acc.active=True AND acc.bank_type NOT IN ('loan', 'credit') AND bal.balance > 0;
+
 --
 -- Graphs
 --
 
--- Average balance per day, per account
+-- Money per day until the next payday, per account
 SELECT json_object_agg(a.name, a.money_per_day) FROM (
     SELECT
-        acc.id,
-        CASE
-            WHEN b.delta_salary_date > 1
-            THEN acc.balance / b.delta_salary_date 
-            ELSE acc.balance * b.delta_salary_date
-        END money_per_day,
         acc.name,
-        acc.balance
+        round(bal.balance / GREATEST(
+            EXTRACT(epoch FROM COALESCE(next_payday(acc.id), NOW() + interval '1' month) - NOW())/86400, 1
+        ), 2) AS money_per_day
     FROM accounts AS acc
     JOIN (
-        SELECT 
-            CASE 
-                WHEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 >= 0
-                THEN EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400
-                ELSE EXTRACT(epoch FROM AGE(salary_date, NOW()))/86400 * -1
-            END delta_salary_date
-        FROM settings LIMIT 1
-    ) AS b ON 1=1
-    WHERE acc.active=True AND acc.balance > 0
+        SELECT account_id, balance * exchange_rate(currency, base_currency(), CURRENT_DATE) AS balance
+        FROM account_balances
+    ) AS bal ON bal.account_id=acc.id
+    WHERE acc.active=True AND acc.bank_type NOT IN ('loan', 'credit') AND bal.balance > 0
 ) AS a;
 
--- Money spent per category, total
+-- Money spent per top-level category including it's subcategories, total
 SELECT json_object_agg(b.name, b.obj) FROM (
     SELECT a.name,json_build_object('hex', a.hex, 'value', a.sum) obj FROM (
-        SELECT c.name,SUM(t.amount),c.hex FROM categories AS c
-        JOIN transactions AS t ON c.id=t.category_id
-        WHERE t.active=true AND c.active=true
+        SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+        JOIN category_tree AS ct ON ct.ancestor_id=c.id
+        JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+        JOIN transactions AS t ON t.id=ca.transaction_id
+        WHERE t.active=true AND c.active=true AND c.parent_id IS NULL
         GROUP BY c.name,c.hex
     ) AS a
 ) AS b;
 
--- Money spent per category, last 30 days
+-- Money spent per top-level category including it's subcategories, last 30 days
 SELECT json_object_agg(b.name, b.obj) FROM (
     SELECT a.name,json_build_object('hex', a.hex, 'value', a.sum) obj FROM (
-        SELECT c.name,SUM(t.amount),c.hex FROM categories AS c
-        JOIN transactions AS t ON c.id=t.category_id
-        WHERE t.active=true AND c.active=true AND t.transaction_date >= NOW() - interval '30 days'
+        SELECT c.name,SUM(ca.base_amount),c.hex FROM categories AS c
+        JOIN category_tree AS ct ON ct.ancestor_id=c.id
+        JOIN transaction_category_amounts AS ca ON ca.category_id=ct.category_id
+        JOIN transactions AS t ON t.id=ca.transaction_id
+        WHERE t.active=true AND c.active=true AND c.parent_id IS NULL AND t.transaction_date >= NOW() - interval '30 days'
         GROUP BY c.name,c.hex
     ) AS a
 ) AS b;
 
+-- Money per tag, total
+-- A transaction with several tags counts fully in each of them
+SELECT json_object_agg(a.tag, a.sum) FROM (
+    SELECT tta.tag,SUM(tta.base_amount) FROM transaction_tag_amounts AS tta
+    JOIN transactions AS t ON t.id=tta.transaction_id
+    WHERE t.active=true
+    GROUP BY tta.tag
+) AS a;
+
+-- Money spent per payee, last 30 days
+SELECT json_object_agg(a.name, a.sum) FROM (
+    SELECT p.name,SUM(spent_amount(t.transaction_type, ta.base_amount)) FROM payees AS p
+    JOIN transactions AS t ON t.payee_id=p.id
+    JOIN transaction_amounts AS ta ON ta.transaction_id=t.id
+    WHERE t.active=true AND t.transaction_type IN ('expense', 'fee', 'refund') AND t.transaction_date >= NOW() - interval '30 days'
+    GROUP BY p.name
+) AS a;
+
 -- Average Money spent per category, last 30 days
 SELECT json_object_agg(b.name, b.amount) FROM (
     SELECT a.name,a.amount/30 amount FROM (
@@ -91,9 +121,9 @@ SELECT json_object_agg(
 ) FROM (
 	SELECT to_char(date_trunc('month', t.transaction_date), 'YYYY') AS year,
 		   to_char(date_trunc('month', t.transaction_date), 'Mon') AS month,
-		   SUM(t.amount) AS amount
+		   SUM(spent_amount(t.transaction_type, t.amount)) AS amount
 	FROM transactions AS t
-    WHERE t.account_id IS NOT NULL AND t.to_account IS NULL
+    WHERE t.transaction_type IN ('expense', 'fee', 'refund')
 	GROUP BY date_trunc('month', t.transaction_date)
 	ORDER BY date_trunc('month', t.transaction_date) ASC
 ) AS a;